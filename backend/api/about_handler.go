@@ -1,13 +1,17 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/shrijan-swaminathan/markbyte/backend/auth"
 	"github.com/shrijan-swaminathan/markbyte/backend/features/markdown_render"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
 )
 
 type AboutUploadResponse struct {
@@ -49,27 +53,28 @@ func HandleAboutPageUpload(w http.ResponseWriter, r *http.Request) {
 
 	about_filname_md := username + "_about_file.md"
 	about_filename_html := username + "_about_file.html"
-	cred, err := LoadCredentials()
-	if err != nil {
-		http.Error(w, "Error loading credentials", http.StatusInternalServerError)
+
+	err = putUserObject(r.Context(), blobStore, username, about_filename_html, strings.NewReader(html_content), int64(len(html_content)), "text/html")
+	if writeQuotaError(w, err) {
 		return
 	}
-
-	html_url, err := UploadHTMLFile(r.Context(), html_content, about_filename_html, cred)
 	if err != nil {
 		http.Error(w, "Error uploading HTML file", http.StatusInternalServerError)
 		return
 	}
 
-	md_url, err := UploadMDFile(r.Context(), string(md_content), about_filname_md, cred)
+	err = putUserObject(r.Context(), blobStore, username, about_filname_md, bytes.NewReader(md_content), int64(len(md_content)), "text/markdown")
+	if writeQuotaError(w, err) {
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error uploading MD file", http.StatusInternalServerError)
 		return
 	}
 
 	response := AboutUploadResponse{
-		MarkdownURL: md_url,
-		HTMLURL:     html_url,
+		MarkdownURL: blobStore.URL(about_filname_md),
+		HTMLURL:     blobStore.URL(about_filename_html),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -95,16 +100,11 @@ func HandleAboutPageGet(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Username is required", http.StatusBadRequest)
 		return
 	}
-	cred, err := LoadCredentials()
-	if err != nil {
-		http.Error(w, "Error loading credentials", http.StatusInternalServerError)
-		return
-	}
 
 	about_page_key := fmt.Sprintf("%s_about_file.html", username)
-	html_content, err := ReadFilefromS3(r.Context(), about_page_key, cred)
+	html_content, err := storage.ReadString(r.Context(), blobStore, about_page_key)
 	if err != nil {
-		http.Error(w, "Error reading file from S3", http.StatusInternalServerError)
+		http.Error(w, "Error reading file from storage", http.StatusInternalServerError)
 		return
 	}
 	user_details, err := userDB.GetUser(r.Context(), username)
@@ -116,14 +116,15 @@ func HandleAboutPageGet(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
-	if user_details.Name == "" {
-		user_details.Name = username
-	}
-	if user_details.Style == "" {
-		user_details.Style = "default"
+	html_content, err = markdown_render.RenderUserPage(r.Context(), user_details.Style, markdown_render.Page{
+		Title:   "About",
+		Content: template.HTML(html_content),
+		Author:  markdown_render.AuthorOf(user_details),
+	})
+	if err != nil {
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
 	}
-	style := user_details.Style
-	markdown_render.InsertTemplate(&html_content, style, username, user_details.Name, "")
 
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
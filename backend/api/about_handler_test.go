@@ -11,25 +11,12 @@ import (
 	"testing"
 
 	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestHandleAboutPageUpload(t *testing.T) {
-	origLoadCredentials := LoadCredentials
-	origUploadHTMLFile := UploadHTMLFile
-	origUploadMDFile := UploadMDFile
-	LoadCredentials = func() (S3Credentials, error) { return S3Credentials{}, nil }
-	UploadHTMLFile = func(ctx context.Context, html, key string, cred S3Credentials) (string, error) {
-		return "https://s3.mock/about.html", nil
-	}
-	UploadMDFile = func(ctx context.Context, md, key string, cred S3Credentials) (string, error) {
-		return "https://s3.mock/about.md", nil
-	}
-	defer func() {
-		LoadCredentials = origLoadCredentials
-		UploadHTMLFile = origUploadHTMLFile
-		UploadMDFile = origUploadMDFile
-	}()
+	store := useTestBlobStore(t)
 
 	userDB = &mockUserDB{}
 
@@ -50,21 +37,19 @@ func TestHandleAboutPageUpload(t *testing.T) {
 	HandleAboutPageUpload(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
-	assert.Contains(t, rr.Body.String(), "https://s3.mock/about.html")
-	assert.Contains(t, rr.Body.String(), "https://s3.mock/about.md")
+	assert.Contains(t, rr.Body.String(), "https://blobs.mock/testuser_about_file.html")
+	assert.Contains(t, rr.Body.String(), "https://blobs.mock/testuser_about_file.md")
+	md, err := storage.ReadString(context.Background(), store, "testuser_about_file.md")
+	assert.NoError(t, err)
+	assert.Contains(t, md, "About Me")
 }
 
 func TestHandleAboutPageGet(t *testing.T) {
-	origLoadCredentials := LoadCredentials
-	origReadFilefromS3 := ReadFilefromS3
-	LoadCredentials = func() (S3Credentials, error) { return S3Credentials{}, nil }
-	ReadFilefromS3 = func(ctx context.Context, key string, cred S3Credentials) (string, error) {
-		return "<html>About Content</html>", nil
+	store := useTestBlobStore(t)
+	err := store.Put(context.Background(), "testuser_about_file.html", strings.NewReader("<html>About Content</html>"), "text/html")
+	if err != nil {
+		t.Fatalf("store.Put failed: %v", err)
 	}
-	defer func() {
-		LoadCredentials = origLoadCredentials
-		ReadFilefromS3 = origReadFilefromS3
-	}()
 
 	userDB = &mockUserDB{}
 
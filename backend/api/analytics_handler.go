@@ -86,8 +86,17 @@ func HandleLikePost(w http.ResponseWriter, r *http.Request) {
 	activeVersion, err := blogPostDataDB.FetchActiveBlog(r.Context(), likePostRequest.PostUsername, likePostRequest.Title)
 	if err != nil {
 		http.Error(w, "Failed to fetch active version", http.StatusInternalServerError)
+		return
+	}
+	// during an experiment the like goes to the version the reader was served
+	likedVersion := servedVersion(r, likePostRequest.PostUsername, likePostRequest.Title, activeVersion)
+	// posts the user cannot open cannot be liked either
+	likedPost, err := blogPostDataDB.FetchBlogPost(r.Context(), likePostRequest.PostUsername, likePostRequest.Title, likedVersion)
+	if err != nil || likedPost.DeletedAt != nil || !canView(likedPost.Visibility, likePostRequest.PostUsername, username) {
+		http.Error(w, "No such Blog Post exists", http.StatusNotFound)
+		return
 	}
-	liked, err := AnalyticsDataDB.ToggleLike(r.Context(), likePostRequest.PostUsername, likePostRequest.Title, activeVersion, username)
+	liked, err := AnalyticsDataDB.ToggleLike(r.Context(), likePostRequest.PostUsername, likePostRequest.Title, likedVersion, username)
 	if err != nil {
 		http.Error(w, "Failed to toggle like", http.StatusInternalServerError)
 		return
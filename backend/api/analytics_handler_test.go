@@ -6,8 +6,10 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -85,6 +87,52 @@ func TestHandleLikePost(t *testing.T) {
 	}
 }
 
+func TestHandleLikePost_HiddenPosts(t *testing.T) {
+	userDB = &mockUserDB{}
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+	trashedAt := time.Now()
+	posts := map[string]db.BlogPostData{
+		"Private": {Visibility: db.VisibilityPrivate},
+		"Draft":   {Visibility: db.VisibilityDraft},
+		"Trashed": {Visibility: db.VisibilityPublic, DeletedAt: &trashedAt},
+	}
+	blogPostDataDB = &mockBlogPostDataDB{
+		FetchActiveBlogFunc: func(ctx context.Context, username, title string) (string, error) {
+			if title == "Missing" {
+				return "", assert.AnError
+			}
+			return "1", nil
+		},
+		FetchBlogPostFunc: func(ctx context.Context, username, title, version string) (db.BlogPostData, error) {
+			post := posts[title]
+			post.User, post.Title, post.Version = username, title, version
+			return post, nil
+		},
+	}
+
+	tests := []struct {
+		title        string
+		username     string
+		expectedCode int
+	}{
+		{"Missing", "otheruser", http.StatusInternalServerError},
+		{"Private", "otheruser", http.StatusNotFound},
+		{"Private", "testuser", http.StatusOK},
+		{"Draft", "testuser", http.StatusNotFound},
+		{"Trashed", "otheruser", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title+" as "+tt.username, func(t *testing.T) {
+			body := `{"post_username":"testuser","title":"` + tt.title + `"}`
+			req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+			req = req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, tt.username))
+			rr := httptest.NewRecorder()
+			HandleLikePost(rr, req)
+			assert.Equal(t, tt.expectedCode, rr.Code)
+		})
+	}
+}
+
 func TestHandleAllAnalytics(t *testing.T) {
 	blogPostDataDB = &mockBlogPostDataDB{}
 	userDB = &mockUserDB{}
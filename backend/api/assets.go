@@ -0,0 +1,221 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/attachment"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/imageproc"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
+)
+
+const assetPrefix = "assets/"
+
+var assetDB db.AssetDB
+
+func SetAssetDB(repo db.AssetDB) {
+	assetDB = repo
+}
+
+// storeAsset uploads an attachment that passed attachment.Check under
+// assets/<sha256><ext>, the hash being that of the file as uploaded. When the
+// hash is already recorded the upload is skipped, so re-uploading a post with
+// an unchanged file only costs a lookup. body holds the checked file and is
+// streamed to the store, except for jpeg and png images: those are read to be
+// re-encoded, which strips their metadata, and stored alongside their
+// resized, thumbnail and webp variants as assets/<sha256><suffix><ext>. A new
+// asset is charged to the quota of the user who first uploaded it.
+func storeAsset(ctx context.Context, store storage.BlobStore, username string, name string, hash string, file *attachment.File, body io.Reader, size int64) (*db.Asset, error) {
+	existing, err := assetDB.GetAsset(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up asset: %w", err)
+	}
+	if existing != nil {
+		// mark it used so the garbage collector does not race this upload
+		err = assetDB.SaveAsset(ctx, existing)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record asset: %w", err)
+		}
+		return existing, nil
+	}
+
+	asset := &db.Asset{
+		Hash:        hash,
+		Key:         assetPrefix + hash + file.Ext,
+		ContentType: file.ContentType,
+		Size:        size,
+		Uploader:    username,
+		CreatedAt:   time.Now(),
+		LastUsedAt:  time.Now(),
+		Width:       file.Width,
+		Height:      file.Height,
+	}
+
+	if file.Raster {
+		content, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		processed, err := imageproc.Process(content, imageproc.DefaultOptions)
+		if err != nil {
+			return nil, &attachment.RejectedError{Name: name, Reason: err.Error()}
+		}
+		body = bytes.NewReader(processed.Data)
+		size = int64(len(processed.Data))
+		asset.Key = assetPrefix + hash + processed.Ext
+		asset.ContentType = processed.ContentType
+		asset.Size = int64(len(processed.Data))
+		asset.Width = processed.Width
+		asset.Height = processed.Height
+
+		for _, variant := range processed.Variants {
+			key := assetPrefix + hash + variant.Suffix + variant.Ext
+			err = putUserObject(ctx, store, username, key, bytes.NewReader(variant.Data), int64(len(variant.Data)), variant.ContentType)
+			if err != nil {
+				return nil, err
+			}
+			asset.Variants = append(asset.Variants, db.AssetVariant{
+				Key:         key,
+				ContentType: variant.ContentType,
+				Width:       variant.Width,
+				Height:      variant.Height,
+				Size:        int64(len(variant.Data)),
+				Thumbnail:   variant.Thumbnail,
+			})
+		}
+	}
+
+	// the main object goes last: once it exists the asset is usable
+	err = putUserObject(ctx, store, username, asset.Key, body, size, asset.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	err = assetDB.SaveAsset(ctx, asset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record asset: %w", err)
+	}
+	return asset, nil
+}
+
+var (
+	imgTag        = regexp.MustCompile(`(?i)<img\b[^>]*>`)
+	imgSrcAttr    = regexp.MustCompile(`(?i)\ssrc\s*=\s*["']([^"']+)["']`)
+	imgSizeAttr   = regexp.MustCompile(`(?i)\s(?:width|height)\s*=`)
+	imgSrcsetAttr = regexp.MustCompile(`(?i)\ssrcset\s*=`)
+)
+
+// addImageVariants gives <img> tags pointing at a stored image asset its
+// intrinsic width and height plus a srcset of the resized copies. When webp
+// variants exist the tag is wrapped in a <picture> offering them first.
+// assets is keyed by the url the html references.
+func addImageVariants(content string, assets map[string]*db.Asset, store storage.BlobStore) string {
+	return imgTag.ReplaceAllStringFunc(content, func(tag string) string {
+		src := imgSrcAttr.FindStringSubmatch(tag)
+		if src == nil {
+			return tag
+		}
+		asset, ok := assets[src[1]]
+		if !ok || asset.Width == 0 {
+			return tag
+		}
+
+		var sameFormat, webp []string
+		for _, variant := range asset.Variants {
+			if variant.Thumbnail {
+				continue
+			}
+			entry := fmt.Sprintf("%s %dw", store.URL(variant.Key), variant.Width)
+			if variant.ContentType == "image/webp" {
+				webp = append(webp, entry)
+			} else {
+				sameFormat = append(sameFormat, entry)
+			}
+		}
+		sizes := fmt.Sprintf("(max-width: %dpx) 100vw, %dpx", asset.Width, asset.Width)
+
+		attrs := ""
+		if !imgSizeAttr.MatchString(tag) {
+			attrs += fmt.Sprintf(` width="%d" height="%d"`, asset.Width, asset.Height)
+		}
+		if len(sameFormat) > 0 && !imgSrcsetAttr.MatchString(tag) {
+			sameFormat = append(sameFormat, fmt.Sprintf("%s %dw", store.URL(asset.Key), asset.Width))
+			attrs += fmt.Sprintf(` srcset="%s" sizes="%s"`, html.EscapeString(strings.Join(sameFormat, ", ")), sizes)
+		}
+		tag = tag[:len("<img")] + attrs + tag[len("<img"):]
+		if len(webp) == 0 {
+			return tag
+		}
+		return fmt.Sprintf(`<picture><source type="image/webp" srcset="%s" sizes="%s">%s</picture>`,
+			html.EscapeString(strings.Join(webp, ", ")), sizes, tag)
+	})
+}
+
+var (
+	mdLinkDest    = regexp.MustCompile(`(\]\()(<[^>\n]*>|[^)\s]+)`)
+	mdRefDest     = regexp.MustCompile(`(?m)^( {0,3}\[[^\]\n]+\]:[ \t]*)(<[^>\n]*>|\S+)`)
+	htmlAttrValue = regexp.MustCompile(`((?:src|href)\s*=\s*["'])([^"'\n]+)(["'])`)
+)
+
+// rewriteAssetLinks points markdown links, reference definitions and html
+// src/href attributes that name a zip entry at that entry's stored url.
+// Destinations are resolved relative to the markdown file's folder.
+func rewriteAssetLinks(md []byte, mdDir string, urls map[string]string) []byte {
+	byBase := make(map[string][]string)
+	for name := range urls {
+		byBase[path.Base(name)] = append(byBase[path.Base(name)], name)
+	}
+
+	resolve := func(dest string) (string, bool) {
+		bracketed := strings.HasPrefix(dest, "<") && strings.HasSuffix(dest, ">")
+		target := strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+		if strings.Contains(target, ":") || strings.HasPrefix(target, "/") || strings.HasPrefix(target, "#") {
+			return "", false
+		}
+		if unescaped, err := url.PathUnescape(target); err == nil {
+			target = unescaped
+		}
+
+		resolved, ok := urls[path.Join(mdDir, target)]
+		if !ok {
+			// fall back to the file name when it is unambiguous
+			candidates := byBase[path.Base(target)]
+			if len(candidates) != 1 {
+				return "", false
+			}
+			resolved = urls[candidates[0]]
+		}
+		if bracketed {
+			return "<" + resolved + ">", true
+		}
+		return resolved, true
+	}
+
+	replace := func(re *regexp.Regexp) {
+		md = re.ReplaceAllFunc(md, func(match []byte) []byte {
+			groups := re.FindSubmatch(match)
+			resolved, ok := resolve(string(groups[2]))
+			if !ok {
+				return match
+			}
+			out := append([]byte{}, groups[1]...)
+			out = append(out, resolved...)
+			if len(groups) > 3 {
+				out = append(out, groups[3]...)
+			}
+			return out
+		})
+	}
+	replace(mdLinkDest)
+	replace(mdRefDest)
+	replace(htmlAttrValue)
+	return md
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/shrijan-swaminathan/markbyte/backend/db"
 	"github.com/shrijan-swaminathan/markbyte/backend/db/redisdb"
 	"github.com/shrijan-swaminathan/markbyte/backend/features/markdown_render"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
 )
 
 var userDB db.UserDB
@@ -23,26 +25,75 @@ func SetUserDB(repo db.UserDB) {
 func HandleFetchBlogPost(w http.ResponseWriter, r *http.Request) {
 	username := chi.URLParam(r, "username")
 	post := chi.URLParam(r, "post")
-	unprocess_post_title := strings.ReplaceAll(post, "_", " ")
 	var htmlContent string
 
-	active, err := blogPostDataDB.FetchActiveBlog(r.Context(), username, unprocess_post_title)
+	title, err := blogPostDataDB.FetchTitleBySlug(r.Context(), username, post)
 	if err != nil {
+		http.Error(w, "Failed to fetch blog post", http.StatusInternalServerError)
+		return
+	}
+	if title == "" {
+		// the post was renamed since the link was made
+		current_slug, err := blogPostDataDB.FetchSlugByPreviousSlug(r.Context(), username, post)
+		if err == nil && current_slug != "" {
+			http.Redirect(w, r, slug.Path(username, current_slug), http.StatusMovedPermanently)
+			return
+		}
+		// links from before slugs were the title with spaces turned into
+		// underscores, send those to where the post lives now
+		legacy_slug, err := blogPostDataDB.FetchPostSlug(r.Context(), username, strings.ReplaceAll(post, "_", " "))
+		if err == nil && legacy_slug != "" && legacy_slug != post {
+			http.Redirect(w, r, slug.Path(username, legacy_slug), http.StatusMovedPermanently)
+			return
+		}
 		http.Error(w, "No such Blog Post exists", http.StatusNotFound)
 		return
 	}
 
-	b_p, err := blogPostDataDB.FetchBlogPost(r.Context(), username, unprocess_post_title, active)
+	active, err := blogPostDataDB.FetchActiveBlog(r.Context(), username, title)
 	if err != nil {
 		http.Error(w, "No such Blog Post exists", http.StatusNotFound)
 		return
 	}
-	date_str := b_p.DateUploaded.Format("01/02/2006")
 
-	endpoint := "/" + username + "/" + post
+	b_p, err := blogPostDataDB.FetchBlogPost(r.Context(), username, title, active)
+	if err != nil {
+		http.Error(w, "No such Blog Post exists", http.StatusNotFound)
+		return
+	}
+	// drafts, trashed and other people's private posts look like they do
+	// not exist
+	requester, _ := r.Context().Value(auth.UsernameKey).(string)
+	if b_p.DeletedAt != nil || !canView(b_p.Visibility, username, requester) {
+		http.Error(w, "No such Blog Post exists", http.StatusNotFound)
+		return
+	}
+
+	// a running experiment serves each reader one of its two versions, the
+	// pages then differ per reader and bypass the cache
+	served := active
+	experiment, err := runningExperiment(r.Context(), username, title)
+	if err != nil {
+		fmt.Printf("Failed to fetch experiment: handlefetchblogpost %v\n", err)
+	}
+	if experiment != nil {
+		served = assignVariant(w, r, experiment)
+		if served != active {
+			variant, err := blogPostDataDB.FetchBlogPost(r.Context(), username, title, served)
+			if err != nil {
+				fmt.Printf("Failed to fetch variant: handlefetchblogpost %v\n", err)
+				served = active
+			} else {
+				b_p = variant
+			}
+		}
+	}
+	useCache := redisdb.RedisActive && experiment == nil
+
+	endpoint := slug.Path(username, post)
 	//try redis
 	cacheHit := false
-	if redisdb.RedisActive {
+	if useCache {
 		htmlContent, err = redisdb.GetEndpoint(r.Context(), endpoint)
 		if err == nil && htmlContent != "" {
 			fmt.Printf("Redis cache hit\n")
@@ -54,14 +105,9 @@ func HandleFetchBlogPost(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if !cacheHit {
-		key := fmt.Sprintf("%s_%s_%s.html", username, post, active)
+		key := slug.Key(username, post, served, ".html")
 
-		cred, err := LoadCredentials()
-		if err != nil {
-			http.Error(w, "Failed to load credentials", http.StatusInternalServerError)
-			return
-		}
-		htmlContent, err = ReadFilefromS3(r.Context(), key, cred)
+		htmlContent, err = storage.ReadString(r.Context(), blobStore, key)
 		if err != nil {
 			http.Error(w, "Failed to read HTML file", http.StatusInternalServerError)
 			return
@@ -75,22 +121,34 @@ func HandleFetchBlogPost(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "User not found", http.StatusNotFound)
 			return
 		}
-		if user_details.Name == "" {
-			user_details.Name = username
+		if experiment != nil {
+			htmlContent += readThroughScript(username, title)
 		}
-		if user_details.Style == "" {
-			user_details.Style = "default"
+		page := markdown_render.PostPage(b_p, user_details, htmlContent)
+		page.Series, err = postSeries(r.Context(), username, title)
+		if err != nil {
+			fmt.Printf("Failed to fetch series: handlefetchblogpost %v\n", err)
+		}
+		if b_p.ShowHistory {
+			page.History, err = postRevisions(r.Context(), username, title, served)
+			if err != nil {
+				fmt.Printf("Failed to fetch revisions: handlefetchblogpost %v\n", err)
+			}
+		}
+		htmlContent, err = markdown_render.RenderUserPage(r.Context(), user_details.Style, page)
+		if err != nil {
+			http.Error(w, "Failed to render page", http.StatusInternalServerError)
+			fmt.Println(err)
+			return
 		}
-		style := user_details.Style
-		markdown_render.InsertTemplate(&htmlContent, style, username, user_details.Name, date_str)
 	}
-	if redisdb.RedisActive && !cacheHit {
+	if useCache && !cacheHit {
 		err := redisdb.SetEndpoint(r.Context(), endpoint, &htmlContent)
 		if err != nil {
 			fmt.Printf("Some error with redis set: handlefetchblogpost")
 		}
 	}
-	err = AnalyticsDataDB.IncrementViews(r.Context(), username, unprocess_post_title, active)
+	err = AnalyticsDataDB.IncrementViews(r.Context(), username, title, served)
 	if err != nil {
 		fmt.Printf("Failed to increment views: handlefetchblogpost %v\n", err)
 	}
@@ -122,19 +180,22 @@ func HandleFetchMD(w http.ResponseWriter, r *http.Request) {
 	}
 
 	title := data.Title
-	processed_title := strings.ReplaceAll(title, " ", "_")
 	version := data.Version
 	if title == "" || version == "" {
 		fmt.Printf("title %s or version %s is empty", title, version)
 		http.Error(w, "Invalid title or version", http.StatusBadRequest)
 		return
 	}
-	cred, err := LoadCredentials()
+	post_slug, err := blogPostDataDB.FetchPostSlug(r.Context(), username, title)
 	if err != nil {
-		http.Error(w, "Failed to s3 load credentials", http.StatusInternalServerError)
+		http.Error(w, "Failed to fetch blog post", http.StatusInternalServerError)
+		return
+	}
+	if post_slug == "" {
+		http.Error(w, "No such Blog Post exists", http.StatusNotFound)
 		return
 	}
-	mdContent, err := ReadFilefromS3(r.Context(), fmt.Sprintf("%s_%s_%s.md", username, processed_title, version), cred)
+	mdContent, err := storage.ReadString(r.Context(), blobStore, slug.Key(username, post_slug, version, ".md"))
 	if err != nil {
 		http.Error(w, "Failed to read markdown file", http.StatusInternalServerError)
 		return
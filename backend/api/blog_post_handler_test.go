@@ -15,19 +15,14 @@ import (
 )
 
 func TestHandleFetchBlogPost(t *testing.T) {
-	// Save and override S3 functions
-	origLoadCredentials := LoadCredentials
-	origReadFilefromS3 := ReadFilefromS3
-	LoadCredentials = func() (S3Credentials, error) { return S3Credentials{}, nil }
-	ReadFilefromS3 = func(ctx context.Context, key string, cred S3Credentials) (string, error) {
-		return "Test Blog Content", nil
+	store := useTestBlobStore(t)
+	err := store.Put(context.Background(), "testuser_test-post_1.html", strings.NewReader("Test Blog Content"), "text/html")
+	if err != nil {
+		t.Fatalf("store.Put failed: %v", err)
 	}
-	defer func() {
-		LoadCredentials = origLoadCredentials
-		ReadFilefromS3 = origReadFilefromS3
-	}()
 
 	blogPostDataDB = &mockBlogPostDataDB{
+		slugs: map[string]string{"test-post": "Test Post"},
 		FetchActiveBlogFunc: func(ctx context.Context, username, title string) (string, error) {
 			return "1", nil
 		},
@@ -46,7 +41,7 @@ func TestHandleFetchBlogPost(t *testing.T) {
 
 	rctx := chi.NewRouteContext()
 	rctx.URLParams.Add("username", "testuser")
-	rctx.URLParams.Add("post", "test_post")
+	rctx.URLParams.Add("post", "test-post")
 	req := httptest.NewRequest("GET", "/", nil)
 	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
 	rr := httptest.NewRecorder()
@@ -57,20 +52,42 @@ func TestHandleFetchBlogPost(t *testing.T) {
 	assert.Contains(t, rr.Body.String(), "Test Blog Content")
 }
 
+func TestHandleFetchBlogPost_LegacyURL(t *testing.T) {
+	useTestBlobStore(t)
+	blogPostDataDB = &mockBlogPostDataDB{slugs: map[string]string{"test-post": "Test Post"}}
+
+	for _, tc := range []struct {
+		post string
+		code int
+	}{
+		{"Test_Post", http.StatusMovedPermanently},
+		{"Other_Post", http.StatusNotFound},
+	} {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("username", "testuser")
+		rctx.URLParams.Add("post", tc.post)
+		req := httptest.NewRequest("GET", "/testuser/"+tc.post, nil)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		HandleFetchBlogPost(rr, req)
+
+		assert.Equal(t, tc.code, rr.Code, tc.post)
+		if tc.code == http.StatusMovedPermanently {
+			assert.Equal(t, "/testuser/test-post", rr.Header().Get("Location"))
+		}
+	}
+}
+
 func TestHandleFetchMD(t *testing.T) {
-	origLoadCredentials := LoadCredentials
-	origReadFilefromS3 := ReadFilefromS3
-	LoadCredentials = func() (S3Credentials, error) { return S3Credentials{}, nil }
-	ReadFilefromS3 = func(ctx context.Context, key string, cred S3Credentials) (string, error) {
-		return "Test Markdown Content", nil
+	store := useTestBlobStore(t)
+	err := store.Put(context.Background(), "testuser_test-post_1.md", strings.NewReader("Test Markdown Content"), "text/markdown")
+	if err != nil {
+		t.Fatalf("store.Put failed: %v", err)
 	}
-	defer func() {
-		LoadCredentials = origLoadCredentials
-		ReadFilefromS3 = origReadFilefromS3
-	}()
 
 	userDB = &mockUserDB{}
-	blogPostDataDB = &mockBlogPostDataDB{}
+	blogPostDataDB = &mockBlogPostDataDB{slugs: map[string]string{"test-post": "Test Post"}}
 	AnalyticsDataDB = &mockAnalyticsDataDB{}
 
 	body := `{"title":"Test Post","version":"1"}`
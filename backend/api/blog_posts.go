@@ -1,15 +1,17 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
+	"slices"
 	"time"
 
 	"github.com/shrijan-swaminathan/markbyte/backend/auth"
 	"github.com/shrijan-swaminathan/markbyte/backend/db"
 	"github.com/shrijan-swaminathan/markbyte/backend/db/redisdb"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
 )
 
 var blogPostDataDB db.BlogPostDataDB
@@ -44,6 +46,8 @@ type PublishPostVersion struct {
 	Username string `json:"username"`
 	Title    string `json:"title"`
 	Version  string `json:"version"`
+	// PublishAt schedules the version instead of publishing it right away.
+	PublishAt *time.Time `json:"publish_at,omitempty"`
 }
 
 func HandlePublishPostVersion(w http.ResponseWriter, r *http.Request) {
@@ -65,41 +69,52 @@ func HandlePublishPostVersion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var postVersions db.BlogPostVersionsData
-	postVersions, err = blogPostDataDB.FetchAllPostVersions(r.Context(), postVersionReq.Username, postVersionReq.Title)
-	if err != nil {
-		http.Error(w, "Failed to fetch post versions", http.StatusInternalServerError)
+	if postVersionReq.PublishAt != nil {
+		schedulePublish(w, r, postVersionReq)
 		return
 	}
 
-	for _, post := range postVersions.Versions {
-		if post.IsActive {
-			err = blogPostDataDB.UpdateActiveStatus(r.Context(), postVersionReq.Username, postVersionReq.Title, post.Version, false)
-			if err != nil {
-				http.Error(w, "Failed to update active status", http.StatusInternalServerError)
-				return
-			}
-		}
-	}
-
-	err = blogPostDataDB.UpdateActiveStatus(r.Context(), postVersionReq.Username, postVersionReq.Title, postVersionReq.Version, true)
+	err = PublishVersion(r.Context(), postVersionReq.Username, postVersionReq.Title, postVersionReq.Version)
 	if err != nil {
 		http.Error(w, "Failed to update active status", http.StatusInternalServerError)
+		fmt.Println(err)
 		return
 	}
 
-	post_title := postVersionReq.Title
-	process_post_title := strings.ReplaceAll(post_title, " ", "_")
+	w.WriteHeader(http.StatusOK)
+}
+
+// PublishVersion makes version the active version of a post and drops the
+// cached page. The scheduler calls it for versions that are due. Versions
+// that do not exist or are in the trash are refused before anything changes.
+func PublishVersion(ctx context.Context, username string, title string, version string) error {
+	postVersions, err := blogPostDataDB.FetchAllPostVersions(ctx, username, title)
+	if err != nil {
+		return fmt.Errorf("failed to fetch post versions: %w", err)
+	}
+	i := slices.IndexFunc(postVersions.Versions, func(post db.BlogPostData) bool {
+		return post.Version == version
+	})
+	if i < 0 {
+		return fmt.Errorf("version %s does not exist", version)
+	}
+	if postVersions.Versions[i].DeletedAt != nil {
+		return fmt.Errorf("version %s is in the trash", version)
+	}
+
+	err = blogPostDataDB.ActivateVersion(ctx, username, title, version)
+	if err != nil {
+		return fmt.Errorf("failed to activate version %s: %w", version, err)
+	}
 
-	if redisdb.RedisActive {
-		endpoint := "/" + postVersionReq.Username + "/" + process_post_title
-		err = redisdb.DeleteEndpoint(r.Context(), endpoint)
+	if redisdb.RedisActive && len(postVersions.Versions) > 0 {
+		endpoint := slug.Path(username, postVersions.Versions[0].Slug)
+		err = redisdb.DeleteEndpoint(ctx, endpoint)
 		if err != nil {
 			fmt.Printf("Error removing old endpoint from redis")
 		}
 	}
-
-	w.WriteHeader(http.StatusOK)
+	return nil
 }
 
 type BlogPostDataViews struct {
@@ -127,7 +142,17 @@ func HandleFetchUserActivePosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	blogs, err := blogPostDataDB.FetchAllActiveBlogPosts(r.Context(), username)
+	var blogs []db.BlogPostData
+	if r.URL.Query().Has("tag") {
+		tag := normalizeTag(r.URL.Query().Get("tag"))
+		if tag == "" {
+			http.Error(w, "Invalid tag", http.StatusBadRequest)
+			return
+		}
+		blogs, err = blogPostDataDB.FetchActivePostsByTag(r.Context(), username, tag)
+	} else {
+		blogs, err = blogPostDataDB.FetchAllActiveBlogPosts(r.Context(), username)
+	}
 	if err != nil {
 		http.Error(w, "Failed to fetch active posts", http.StatusInternalServerError)
 		return
@@ -135,6 +160,9 @@ func HandleFetchUserActivePosts(w http.ResponseWriter, r *http.Request) {
 
 	blogPostViews := make([]BlogPostDataViews, 0)
 	for _, blog := range blogs {
+		if !blog.Visibility.Listed() {
+			continue
+		}
 		viewsData, err := AnalyticsDataDB.GetPostAnalytics(r.Context(), username, blog.Title, blog.Version)
 		if err != nil {
 			http.Error(w, "Failed to fetch post analytics", http.StatusInternalServerError)
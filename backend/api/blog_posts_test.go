@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/shrijan-swaminathan/markbyte/backend/auth"
 	"github.com/stretchr/testify/assert"
@@ -53,7 +54,7 @@ func TestHandleFetchAllBlogPosts(t *testing.T) {
 }
 
 func TestHandlePublishPostVersion(t *testing.T) {
-	blogPostDataDB = &mockBlogPostDataDB{}
+	blogPostDataDB = &mockBlogPostDataDB{FetchAllPostVersionsFunc: manyVersions}
 	tests := []struct {
 		name         string
 		username     string
@@ -64,21 +65,27 @@ func TestHandlePublishPostVersion(t *testing.T) {
 		{
 			name:         "authorized, valid",
 			username:     "testuser",
-			body:         `{"username":"testuser","title":"Test Title","version":"1"}`,
+			body:         `{"username":"testuser","title":"Test Post","version":"4"}`,
 			expectedCode: http.StatusOK,
 			expectedBody: "",
 		},
+		{
+			name:         "missing version",
+			username:     "testuser",
+			body:         `{"username":"testuser","title":"Test Post","version":"9"}`,
+			expectedCode: http.StatusInternalServerError,
+		},
 		{
 			name:         "unauthorized",
 			username:     "",
-			body:         `{"username":"testuser","title":"Test Title","version":"1"}`,
+			body:         `{"username":"testuser","title":"Test Post","version":"4"}`,
 			expectedCode: http.StatusUnauthorized,
 			expectedBody: "Unauthorized",
 		},
 		{
 			name:         "username mismatch",
 			username:     "testuser",
-			body:         `{"username":"otheruser","title":"Test Title","version":"1"}`,
+			body:         `{"username":"otheruser","title":"Test Post","version":"4"}`,
 			expectedCode: http.StatusUnauthorized,
 			expectedBody: "Unauthorized",
 		},
@@ -100,3 +107,34 @@ func TestHandlePublishPostVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestPublishVersion_Trashed(t *testing.T) {
+	blogPostDataDB = &mockBlogPostDataDB{FetchAllPostVersionsFunc: trashedVersions(time.Now())}
+
+	err := PublishVersion(context.Background(), "testuser", "Test Post", "1")
+	assert.ErrorContains(t, err, "in the trash")
+}
+
+func TestPublishVersion_ActivatesInOneCall(t *testing.T) {
+	var activated []string
+	blogPostDataDB = &mockBlogPostDataDB{
+		FetchAllPostVersionsFunc: manyVersions,
+		ActivateVersionFunc: func(ctx context.Context, username, title, version string) error {
+			activated = append(activated, version)
+			return nil
+		},
+	}
+
+	err := PublishVersion(context.Background(), "testuser", "Test Post", "4")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4"}, activated)
+
+	blogPostDataDB = &mockBlogPostDataDB{
+		FetchAllPostVersionsFunc: manyVersions,
+		ActivateVersionFunc: func(ctx context.Context, username, title, version string) error {
+			return assert.AnError
+		},
+	}
+	err = PublishVersion(context.Background(), "testuser", "Test Post", "4")
+	assert.ErrorIs(t, err, assert.AnError)
+}
@@ -0,0 +1,411 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/db/redisdb"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/markdown_render"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
+)
+
+const (
+	maxCollectionName  = 100
+	maxCollectionPosts = 100
+)
+
+var collectionDB db.CollectionDB
+
+func SetCollectionDB(repo db.CollectionDB) {
+	collectionDB = repo
+}
+
+type CollectionRequest struct {
+	// Slug picks the collection to update or delete, a new collection gets
+	// one from its name.
+	Slug        string   `json:"slug,omitempty"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Posts       []string `json:"posts"`
+}
+
+// validateCollection checks the name and that every title is one of the
+// user's posts, listed once.
+func validateCollection(ctx context.Context, username string, req *CollectionRequest) (int, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len([]rune(req.Name)) > maxCollectionName {
+		return http.StatusBadRequest, fmt.Errorf("name must be between 1 and %d characters", maxCollectionName)
+	}
+	if len(req.Posts) > maxCollectionPosts {
+		return http.StatusBadRequest, fmt.Errorf("a collection can hold at most %d posts", maxCollectionPosts)
+	}
+	seen := make(map[string]bool)
+	for _, title := range req.Posts {
+		if seen[title] {
+			return http.StatusBadRequest, fmt.Errorf("post %q is listed twice", title)
+		}
+		seen[title] = true
+		post_slug, err := blogPostDataDB.FetchPostSlug(ctx, username, title)
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("failed to fetch blog post")
+		}
+		if post_slug == "" {
+			return http.StatusBadRequest, fmt.Errorf("no such post %q", title)
+		}
+	}
+	if req.Posts == nil {
+		req.Posts = []string{}
+	}
+	return http.StatusOK, nil
+}
+
+// invalidatePostPages drops the cached pages of titles, whose series box
+// changes with the collection.
+func invalidatePostPages(ctx context.Context, username string, titles []string) {
+	if !redisdb.RedisActive {
+		return
+	}
+	for _, title := range titles {
+		post_slug, err := blogPostDataDB.FetchPostSlug(ctx, username, title)
+		if err != nil || post_slug == "" {
+			continue
+		}
+		err = redisdb.DeleteEndpoint(ctx, slug.Path(username, post_slug))
+		if err != nil {
+			fmt.Printf("Error removing old endpoint from redis")
+		}
+	}
+}
+
+func HandleCreateCollection(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req CollectionRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+	status, err := validateCollection(r.Context(), username, &req)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	collection_slug, err := slug.Unique(slug.Make(req.Name), func(candidate string) (bool, error) {
+		existing, err := collectionDB.FetchCollection(r.Context(), username, candidate)
+		return existing != nil, err
+	})
+	if err != nil {
+		http.Error(w, "Failed to pick collection slug", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	collection := db.Collection{
+		User:        username,
+		Name:        req.Name,
+		Slug:        collection_slug,
+		Description: req.Description,
+		Posts:       req.Posts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	err = collectionDB.CreateCollection(r.Context(), &collection)
+	if err != nil {
+		http.Error(w, "Failed to create collection", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	invalidatePostPages(r.Context(), username, collection.Posts)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(collection)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func HandleUpdateCollection(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req CollectionRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+
+	collection, err := collectionDB.FetchCollection(r.Context(), username, req.Slug)
+	if err != nil {
+		http.Error(w, "Failed to fetch collection", http.StatusInternalServerError)
+		return
+	}
+	if collection == nil {
+		http.Error(w, "No such collection exists", http.StatusNotFound)
+		return
+	}
+	status, err := validateCollection(r.Context(), username, &req)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	previous := collection.Posts
+	collection.Name = req.Name
+	collection.Description = req.Description
+	collection.Posts = req.Posts
+	collection.UpdatedAt = time.Now()
+	err = collectionDB.UpdateCollection(r.Context(), collection)
+	if err != nil {
+		http.Error(w, "Failed to update collection", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	invalidatePostPages(r.Context(), username, append(previous, collection.Posts...))
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(collection)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+type DeleteCollectionRequest struct {
+	Slug string `json:"slug"`
+}
+
+func HandleDeleteCollection(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req DeleteCollectionRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+
+	collection, err := collectionDB.FetchCollection(r.Context(), username, req.Slug)
+	if err != nil {
+		http.Error(w, "Failed to fetch collection", http.StatusInternalServerError)
+		return
+	}
+	if collection == nil {
+		http.Error(w, "No such collection exists", http.StatusNotFound)
+		return
+	}
+
+	_, err = collectionDB.DeleteCollection(r.Context(), username, req.Slug)
+	if err != nil {
+		http.Error(w, "Failed to delete collection", http.StatusInternalServerError)
+		return
+	}
+	invalidatePostPages(r.Context(), username, collection.Posts)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleFetchUserCollections lists the logged in user's collections as
+// stored, including posts readers cannot see.
+func HandleFetchUserCollections(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	collections, err := collectionDB.FetchUserCollections(r.Context(), username)
+	if err != nil {
+		http.Error(w, "Failed to fetch collections", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(collections)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+type CollectionPost struct {
+	Title      string `json:"title"`
+	DirectLink string `json:"direct_link"`
+}
+
+type PublicCollection struct {
+	Name        string           `json:"name"`
+	Slug        string           `json:"slug"`
+	Description string           `json:"description,omitempty"`
+	Posts       []CollectionPost `json:"posts"`
+}
+
+// HandleFetchPublicCollections lists a user's collections with the posts
+// that show up on their profile.
+func HandleFetchPublicCollections(w http.ResponseWriter, r *http.Request) {
+	username := r.URL.Query().Get("user")
+	if username == "" {
+		http.Error(w, "No user provided", http.StatusBadRequest)
+		return
+	}
+
+	collections, err := collectionDB.FetchUserCollections(r.Context(), username)
+	if err != nil {
+		http.Error(w, "Failed to fetch collections", http.StatusInternalServerError)
+		return
+	}
+	active, err := activePostsByTitle(r.Context(), username)
+	if err != nil {
+		http.Error(w, "Failed to fetch active posts", http.StatusInternalServerError)
+		return
+	}
+
+	public := make([]PublicCollection, 0, len(collections))
+	for _, collection := range collections {
+		entry := PublicCollection{
+			Name:        collection.Name,
+			Slug:        collection.Slug,
+			Description: collection.Description,
+			Posts:       []CollectionPost{},
+		}
+		for _, title := range collection.Posts {
+			post, ok := active[title]
+			if !ok || !post.Visibility.Listed() {
+				continue
+			}
+			entry.Posts = append(entry.Posts, CollectionPost{Title: title, DirectLink: slug.Path(username, post.Slug)})
+		}
+		public = append(public, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(public)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func activePostsByTitle(ctx context.Context, username string) (map[string]db.BlogPostData, error) {
+	blogs, err := blogPostDataDB.FetchAllActiveBlogPosts(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	active := make(map[string]db.BlogPostData, len(blogs))
+	for _, blog := range blogs {
+		active[blog.Title] = blog
+	}
+	return active, nil
+}
+
+// postSeries returns a series box for every collection title is part of.
+// Parts readers cannot open are left out, the rendered post always stays in.
+func postSeries(ctx context.Context, username string, title string) ([]markdown_render.Series, error) {
+	if collectionDB == nil {
+		return nil, nil
+	}
+	collections, err := collectionDB.FetchCollectionsWithPost(ctx, username, title)
+	if err != nil || len(collections) == 0 {
+		return nil, err
+	}
+	active, err := activePostsByTitle(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	series := make([]markdown_render.Series, 0, len(collections))
+	for _, collection := range collections {
+		entry := markdown_render.Series{Name: collection.Name}
+		for _, part := range collection.Posts {
+			post, ok := active[part]
+			if !ok || (part != title && !canView(post.Visibility, username, "")) {
+				continue
+			}
+			if part == title {
+				entry.Current = len(entry.Parts)
+			}
+			entry.Parts = append(entry.Parts, markdown_render.SeriesPart{Title: part, Link: slug.Path(username, post.Slug)})
+		}
+		if len(entry.Parts) > 1 {
+			series = append(series, entry)
+		}
+	}
+	return series, nil
+}
+
+// invalidateSeriesPages drops the cached pages of the posts sharing a
+// collection with title, whose series box lists it.
+func invalidateSeriesPages(ctx context.Context, username string, title string) {
+	if collectionDB == nil {
+		return
+	}
+	collections, err := collectionDB.FetchCollectionsWithPost(ctx, username, title)
+	if err != nil {
+		fmt.Printf("failed to fetch collections of %s: %v\n", title, err)
+		return
+	}
+	for _, collection := range collections {
+		invalidatePostPages(ctx, username, collection.Posts)
+	}
+}
+
+// renamePostInCollections keeps the collections of a renamed post pointing at
+// it. The rename itself is done by then, so failures are only logged.
+func renamePostInCollections(ctx context.Context, username string, title string, newTitle string) {
+	if collectionDB == nil {
+		return
+	}
+	collections, err := collectionDB.FetchCollectionsWithPost(ctx, username, title)
+	if err != nil {
+		fmt.Printf("failed to fetch collections of %s: %v\n", title, err)
+		return
+	}
+	err = collectionDB.RenamePostInCollections(ctx, username, title, newTitle)
+	if err != nil {
+		fmt.Printf("failed to rename %s in collections: %v\n", title, err)
+		return
+	}
+	for _, collection := range collections {
+		invalidatePostPages(ctx, username, collection.Posts)
+	}
+}
+
+// removePostFromCollections drops a deleted post from its collections.
+func removePostFromCollections(ctx context.Context, username string, title string) {
+	if collectionDB == nil {
+		return
+	}
+	collections, err := collectionDB.FetchCollectionsWithPost(ctx, username, title)
+	if err != nil {
+		fmt.Printf("failed to fetch collections of %s: %v\n", title, err)
+		return
+	}
+	err = collectionDB.RemovePostFromCollections(ctx, username, title)
+	if err != nil {
+		fmt.Printf("failed to remove %s from collections: %v\n", title, err)
+		return
+	}
+	for _, collection := range collections {
+		invalidatePostPages(ctx, username, collection.Posts)
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func seriesPosts() *mockBlogPostDataDB {
+	return &mockBlogPostDataDB{
+		slugs: map[string]string{"part-one": "Part One", "part-two": "Part Two", "part-three": "Part Three"},
+		active: []db.BlogPostData{
+			{User: "testuser", Title: "Part One", Slug: "part-one", Version: "1", IsActive: true},
+			{User: "testuser", Title: "Part Two", Slug: "part-two", Version: "1", IsActive: true},
+			{User: "testuser", Title: "Part Three", Slug: "part-three", Version: "1", IsActive: true, Visibility: db.VisibilityDraft},
+		},
+	}
+}
+
+func TestHandleCreateCollection(t *testing.T) {
+	blogPostDataDB = seriesPosts()
+	collections := useTestCollectionDB(t)
+
+	body := `{"name": "Go Basics", "posts": ["Part One", "Part Two"]}`
+	rr := httptest.NewRecorder()
+	HandleCreateCollection(rr, withUser(httptest.NewRequest("POST", "/collection/create", strings.NewReader(body))))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var created db.Collection
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+	assert.Equal(t, "go-basics", created.Slug)
+	assert.Equal(t, []string{"Part One", "Part Two"}, created.Posts)
+
+	// a second collection with the same name gets its own slug
+	rr = httptest.NewRecorder()
+	HandleCreateCollection(rr, withUser(httptest.NewRequest("POST", "/collection/create", strings.NewReader(body))))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, collections.collections, 2)
+	assert.NotEqual(t, collections.collections[0].Slug, collections.collections[1].Slug)
+}
+
+func TestHandleCreateCollection_Invalid(t *testing.T) {
+	blogPostDataDB = seriesPosts()
+	useTestCollectionDB(t)
+
+	for _, body := range []string{
+		`{"name": "", "posts": []}`,
+		`{"name": "Go", "posts": ["Missing"]}`,
+		`{"name": "Go", "posts": ["Part One", "Part One"]}`,
+	} {
+		rr := httptest.NewRecorder()
+		HandleCreateCollection(rr, withUser(httptest.NewRequest("POST", "/collection/create", strings.NewReader(body))))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+	}
+}
+
+func TestHandleUpdateCollection_NotFound(t *testing.T) {
+	blogPostDataDB = seriesPosts()
+	useTestCollectionDB(t)
+
+	body := `{"slug": "missing", "name": "Go", "posts": []}`
+	rr := httptest.NewRecorder()
+	HandleUpdateCollection(rr, withUser(httptest.NewRequest("POST", "/collection/update", strings.NewReader(body))))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHandleFetchPublicCollections(t *testing.T) {
+	blogPostDataDB = seriesPosts()
+	collections := useTestCollectionDB(t)
+	collections.collections = []db.Collection{
+		{User: "testuser", Name: "Go Basics", Slug: "go-basics", Posts: []string{"Part One", "Part Three", "Part Two"}},
+	}
+
+	rr := httptest.NewRecorder()
+	HandleFetchPublicCollections(rr, httptest.NewRequest("GET", "/collections?user=testuser", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp []PublicCollection
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	if assert.Len(t, resp, 1) {
+		assert.Equal(t, []CollectionPost{
+			{Title: "Part One", DirectLink: "/testuser/part-one"},
+			{Title: "Part Two", DirectLink: "/testuser/part-two"},
+		}, resp[0].Posts)
+	}
+}
+
+func TestHandleFetchBlogPost_Series(t *testing.T) {
+	store := useTestBlobStore(t)
+	err := store.Put(context.Background(), "testuser_part-one_1.html", strings.NewReader("Part one content"), "text/html")
+	if err != nil {
+		t.Fatalf("store.Put failed: %v", err)
+	}
+	blogPostDataDB = seriesPosts()
+	userDB = &mockUserDB{}
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+	collections := useTestCollectionDB(t)
+	collections.collections = []db.Collection{
+		{User: "testuser", Name: "Go Basics", Slug: "go-basics", Posts: []string{"Part One", "Part Three", "Part Two"}},
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("username", "testuser")
+	rctx.URLParams.Add("post", "part-one")
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	rr := httptest.NewRecorder()
+
+	HandleFetchBlogPost(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	page := rr.Body.String()
+	assert.Contains(t, page, "Part 1 of 2 in <strong>Go Basics</strong>")
+	assert.Contains(t, page, `<a rel="next" href="/testuser/part-two">`)
+	// the draft in between is skipped
+	assert.NotContains(t, page, "Part Three")
+}
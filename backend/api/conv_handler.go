@@ -13,7 +13,9 @@ import (
 	"github.com/shrijan-swaminathan/markbyte/backend/auth"
 	"github.com/shrijan-swaminathan/markbyte/backend/db"
 	"github.com/shrijan-swaminathan/markbyte/backend/db/redisdb"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/frontmatter"
 	"github.com/shrijan-swaminathan/markbyte/backend/features/markdown_render"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
 )
 
 const StaticDir = "cmd/static"
@@ -41,27 +43,51 @@ func HandleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	title := r.FormValue("title")
+	// read md file
+	mdContent, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Failed to read uploaded file", http.StatusInternalServerError)
+		return
+	}
+
+	// the front matter is kept in the stored markdown but not rendered
+	meta, mdBody, err := frontmatter.Split(mdContent)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	baseFilename := strings.TrimSuffix(header.Filename, ".md")
+	title := postTitle(r.FormValue("title"), meta, baseFilename)
 	//check for special characters in title
-	if strings.ContainsAny(title, `\/:*?"<>|_`) {
+	if strings.ContainsAny(title, `\/:*?"<>|`) {
 		http.Error(w, "Title contains invalid characters", http.StatusBadRequest)
 		return
 	}
 
-	// read md file
-	mdContent, err := io.ReadAll(file)
+	post_tags, err := uploadTags(r.FormValue("tags"), meta)
 	if err != nil {
-		http.Error(w, "Failed to read uploaded file", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// md -> html, from features/markdown_render/converter.go
-	htmlContent, err := markdown_render.ConvertMarkdown(mdContent)
+	htmlContent, err := markdown_render.ConvertMarkdown(mdBody)
 	if err != nil {
 		http.Error(w, "Failed to convert markdown", http.StatusInternalServerError)
 		return
 	}
 
+	// check the quota before the current version is deactivated
+	err = checkQuota(r.Context(), username, int64(len(htmlContent)+len(mdContent)), 2)
+	if writeQuotaError(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to check storage quota", http.StatusInternalServerError)
+		return
+	}
+
 	// create static dir if not there
 	err = os.MkdirAll(StaticDir, os.ModePerm)
 	if err != nil {
@@ -70,15 +96,9 @@ func HandleUpload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// save html file
-	baseFilename := strings.TrimSuffix(header.Filename, ".md")
 	outputFilename := fmt.Sprintf("%s.html", baseFilename)
 	outputPath := filepath.Join(StaticDir, outputFilename)
 
-	//check if title is empty/not present
-	if title == "" {
-		title = baseFilename
-	}
-
 	err = os.WriteFile(outputPath, []byte(htmlContent), 0644)
 	if err != nil {
 		http.Error(w, "Failed to save HTML file", http.StatusInternalServerError)
@@ -91,82 +111,58 @@ func HandleUpload(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to fetch existing blog posts", http.StatusInternalServerError)
 		return
 	}
-
-	newVersion := 1
-	for _, post := range existingPostsVersions {
-		verNum := 1
-		_, err := fmt.Sscanf(post.Version, "%d", &verNum)
-		if err != nil {
-			http.Error(w, "Failed to parse version number", http.StatusInternalServerError)
-			return
-		}
-
-		if verNum >= newVersion {
-			newVersion = verNum + 1
-		}
-		if post.IsActive {
-			err = blogPostDataDB.UpdateActiveStatus(r.Context(), username, title, post.Version, false)
-			if err != nil {
-				http.Error(w, "Failed to deactivate prev post", http.StatusInternalServerError)
-				return
-			}
-		}
+	if inTrash(existingPostsVersions) {
+		http.Error(w, "Post is in the trash, restore it first", http.StatusConflict)
+		return
 	}
-	//replace space's in filename with underscores
-	processed_title := strings.ReplaceAll(title, " ", "_")
-
-	url := fmt.Sprintf("/static/%s", outputFilename)
 
-	keyname := fmt.Sprintf("%s_%s_%d.html", username, processed_title, newVersion)
-	md_keyname := fmt.Sprintf("%s_%s_%d.md", username, processed_title, newVersion)
-
-	fmt.Println("Keyname: ", keyname)
-	fmt.Println("MD Keyname: ", md_keyname)
-	cred, err := LoadCredentials()
+	post_slug, err := postSlug(r.Context(), username, title, meta.Slug)
 	if err != nil {
-		fmt.Println("AWS CREDENTIALS NOT SET UP")
+		http.Error(w, "Failed to pick post slug", http.StatusInternalServerError)
+		return
 	}
-	if err == nil {
-		s3URL, err := UploadHTMLFile(r.Context(), htmlContent, keyname, cred)
-		if err != nil {
-			http.Error(w, "Failed to upload html file to s3", http.StatusInternalServerError)
-			fmt.Println(err)
-			return
-		}
-
-		_, err = UploadMDFile(r.Context(), string(mdContent), md_keyname, cred)
-		if err != nil {
-			http.Error(w, "Failed to upload md file to s3", http.StatusInternalServerError)
-			fmt.Println(err)
-			return
-		}
 
-		url = s3URL
+	visibility, err := uploadVisibility(existingPostsVersions, uploadVisibilityField(r.FormValue("visibility"), meta))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	endpoint := "/" + username + "/" + processed_title
+	endpoint := slug.Path(username, post_slug)
 
 	post_time := time.Now()
 
 	newBlogPostData := db.BlogPostData{
 		User:         username,
 		Title:        title,
+		Slug:         post_slug,
 		DateUploaded: post_time,
-		Version:      fmt.Sprintf("%d", newVersion),
-		IsActive:     true,
-		Link:         &url,
 		DirectLink:   &endpoint,
+		Visibility:   visibility,
+		Tags:         post_tags,
+		Message:      uploadMessage(r.FormValue("message"), meta, ""),
+	}
+	applyFrontMatter(&newBlogPostData, meta)
+	version, err := createPostVersion(r.Context(), &newBlogPostData, htmlContent, mdContent)
+	if writeQuotaError(w, err) {
+		return
 	}
-	_, err = blogPostDataDB.CreateBlogPost(r.Context(), &newBlogPostData)
 	if err != nil {
 		http.Error(w, "Failed to save blog post data", http.StatusInternalServerError)
+		fmt.Println(err)
 		return
 	}
+	err = syncUploadVisibility(r.Context(), &newBlogPostData, existingPostsVersions)
+	if err != nil {
+		http.Error(w, "Failed to update visibility", http.StatusInternalServerError)
+		return
+	}
+	url := *newBlogPostData.Link
 
 	newPostAnalytics := db.PostAnalytics{
 		Username:  username,
 		Title:     title,
-		Version:   fmt.Sprintf("%d", newVersion),
+		Version:   version,
 		Date:      post_time,
 		Views:     []time.Time{},
 		ViewCount: 0,
@@ -193,8 +189,12 @@ func HandleUpload(w http.ResponseWriter, r *http.Request) {
 
 type DeleteRequest struct {
 	Title string `json:"title"`
+	// Permanent skips the trash.
+	Permanent bool `json:"permanent,omitempty"`
 }
 
+// HandleDelete moves a post to the trash, where it is hidden everywhere
+// until it is restored or purged.
 func HandleDelete(w http.ResponseWriter, r *http.Request) {
 	username, ok := r.Context().Value(auth.UsernameKey).(string)
 	if !ok || username == "" {
@@ -214,57 +214,33 @@ func HandleDelete(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to fetch post versions", http.StatusInternalServerError)
 		return
 	}
-
-	versions := make([]string, len(postVersions.Versions))
-
-	for index, post := range postVersions.Versions {
-		versions[index] = post.Version
-	}
-
-	_, err = blogPostDataDB.DeleteBlogPost(r.Context(), username, req.Title)
-	if err != nil {
-		http.Error(w, "Failed to delete blog post", http.StatusInternalServerError)
+	if len(postVersions.Versions) == 0 {
+		http.Error(w, "No such Blog Post exists", http.StatusNotFound)
 		return
 	}
 
-	_, err = AnalyticsDataDB.DeletePostAnalytics(r.Context(), username, req.Title)
-	if err != nil {
-		http.Error(w, "Failed to delete post analytics", http.StatusInternalServerError)
-		return
-	}
-
-	cred, err := LoadCredentials()
-	if err != nil {
-		fmt.Println("AWS CREDENTIALS NOT SET UP")
-		http.Error(w, "Failed to load AWS credentials", http.StatusInternalServerError)
-		return
-	}
-
-	processed_title := strings.ReplaceAll(req.Title, " ", "_")
-
-	for _, version := range versions {
-		html_keyname := fmt.Sprintf("%s_%s_%s.html", username, processed_title, version)
-		md_keyname := fmt.Sprintf("%s_%s_%s.md", username, processed_title, version)
-		err = DeleteFile(r.Context(), html_keyname, cred)
+	if req.Permanent {
+		err = PurgePost(r.Context(), username, req.Title)
 		if err != nil {
-			http.Error(w, "Failed to delete html file", http.StatusInternalServerError)
-			return
-		}
-		err = DeleteFile(r.Context(), md_keyname, cred)
-		if err != nil {
-			http.Error(w, "Failed to delete md file", http.StatusInternalServerError)
+			http.Error(w, "Failed to delete blog post", http.StatusInternalServerError)
+			fmt.Println(err)
 			return
 		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"message": "Post deleted successfully"}`)
+		return
 	}
 
-	endpoint := "/" + username + "/" + processed_title
-	if redisdb.RedisActive {
-		err = redisdb.DeleteEndpoint(r.Context(), endpoint)
+	if !inTrash(postVersions.Versions) {
+		now := time.Now()
+		_, err = blogPostDataDB.TrashBlogPost(r.Context(), username, req.Title, &now)
 		if err != nil {
-			fmt.Printf("Error removing old endpoint from redis")
+			http.Error(w, "Failed to move blog post to trash", http.StatusInternalServerError)
+			return
 		}
+		invalidatePost(r.Context(), username, req.Title, postVersions.Versions)
 	}
 
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"message": "Post deleted successfully"}`)
+	fmt.Fprintf(w, `{"message": "Post moved to trash"}`)
 }
@@ -12,25 +12,13 @@ import (
 	"testing"
 
 	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestHandleUpload(t *testing.T) {
-	origLoadCredentials := LoadCredentials
-	origUploadHTMLFile := UploadHTMLFile
-	origUploadMDFile := UploadMDFile
-	LoadCredentials = func() (S3Credentials, error) { return S3Credentials{}, nil }
-	UploadHTMLFile = func(ctx context.Context, html, key string, cred S3Credentials) (string, error) {
-		return "https://s3.mock/blog.html", nil
-	}
-	UploadMDFile = func(ctx context.Context, md, key string, cred S3Credentials) (string, error) {
-		return "https://s3.mock/blog.md", nil
-	}
-	defer func() {
-		LoadCredentials = origLoadCredentials
-		UploadHTMLFile = origUploadHTMLFile
-		UploadMDFile = origUploadMDFile
-	}()
+	store := useTestBlobStore(t)
 
 	blogPostDataDB = &mockBlogPostDataDB{}
 	AnalyticsDataDB = &mockAnalyticsDataDB{}
@@ -56,26 +44,278 @@ func TestHandleUpload(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Contains(t, rr.Body.String(), "File processed successfully")
+	assert.Contains(t, rr.Body.String(), "https://blobs.mock/testuser_test-title_1.html")
+	html, err := storage.ReadString(context.Background(), store, "testuser_test-title_1.html")
+	assert.NoError(t, err)
+	assert.Contains(t, html, "<h1")
 	// clean up
 	if err := os.RemoveAll("cmd/"); err != nil {
 		t.Fatalf("Failed to remove file: %v", err)
 	}
 }
 
-func TestHandleDelete(t *testing.T) {
-	origLoadCredentials := LoadCredentials
-	origDeleteFile := DeleteFile
-	LoadCredentials = func() (S3Credentials, error) { return S3Credentials{}, nil }
-	DeleteFile = func(ctx context.Context, key string, cred S3Credentials) error { return nil }
-	defer func() {
-		LoadCredentials = origLoadCredentials
-		DeleteFile = origDeleteFile
-	}()
+func TestHandleUpload_SlugFromTitle(t *testing.T) {
+	store := useTestBlobStore(t)
+
+	// "cafe-notes" already belongs to another post, so this one gets a suffix
+	blogPostDataDB = &mockBlogPostDataDB{slugs: map[string]string{"cafe-notes": "Cafe notes"}}
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	var b bytes.Buffer
+	wr := multipart.NewWriter(&b)
+	fw, _ := wr.CreateFormFile("file", "test.md")
+	if _, err := io.Copy(fw, strings.NewReader("# Hello")); err != nil {
+		t.Fatalf("io.Copy failed: %v", err)
+	}
+	if err := wr.WriteField("title", "Café_Notes"); err != nil {
+		t.Fatalf("wr.WriteField failed: %v", err)
+	}
+	wr.Close()
+
+	req := httptest.NewRequest("POST", "/upload", &b)
+	req.Header.Set("Content-Type", wr.FormDataContentType())
+	req = req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, "testuser"))
+	rr := httptest.NewRecorder()
+
+	HandleUpload(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	_, err := store.Stat(context.Background(), "testuser_cafe-notes-2_1.html")
+	assert.NoError(t, err)
+	_, err = store.Stat(context.Background(), "testuser_cafe-notes-2_1.md")
+	assert.NoError(t, err)
+	if err := os.RemoveAll("cmd/"); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+}
+
+func TestHandleUpload_NextVersion(t *testing.T) {
+	store := useTestBlobStore(t)
+	t.Cleanup(func() { os.RemoveAll("cmd/") })
+
+	mock := &mockBlogPostDataDB{
+		slugs: map[string]string{"test-title": "Test Title"},
+		FetchAllPostVersionsFunc: func(ctx context.Context, username, title string) (db.BlogPostVersionsData, error) {
+			return db.BlogPostVersionsData{Title: title, Versions: []db.BlogPostData{
+				{Title: title, Slug: "test-title", Version: "1"},
+				{Title: title, Slug: "test-title", Version: "3", IsActive: true},
+			}}, nil
+		},
+	}
+	blogPostDataDB = mock
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	var b bytes.Buffer
+	wr := multipart.NewWriter(&b)
+	fw, _ := wr.CreateFormFile("file", "test.md")
+	if _, err := io.Copy(fw, strings.NewReader("# Hello")); err != nil {
+		t.Fatalf("io.Copy failed: %v", err)
+	}
+	if err := wr.WriteField("title", "Test Title"); err != nil {
+		t.Fatalf("wr.WriteField failed: %v", err)
+	}
+	wr.Close()
+
+	req := httptest.NewRequest("POST", "/upload", &b)
+	req.Header.Set("Content-Type", wr.FormDataContentType())
+	req = req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, "testuser"))
+	rr := httptest.NewRecorder()
+
+	HandleUpload(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	if assert.Len(t, mock.created, 1) {
+		assert.Equal(t, "4", mock.created[0].Version)
+		assert.True(t, mock.created[0].IsActive)
+		assert.Equal(t, "https://blobs.mock/testuser_test-title_4.html", *mock.created[0].Link)
+	}
+	_, err := storage.ReadString(context.Background(), store, "testuser_test-title_4.md")
+	assert.NoError(t, err)
+}
+
+func TestHandleUpload_ChangesVisibility(t *testing.T) {
+	useTestBlobStore(t)
+	t.Cleanup(func() { os.RemoveAll("cmd/") })
+
+	mock := &mockBlogPostDataDB{
+		slugs: map[string]string{"test-title": "Test Title"},
+		FetchAllPostVersionsFunc: func(ctx context.Context, username, title string) (db.BlogPostVersionsData, error) {
+			return db.BlogPostVersionsData{Title: title, Versions: []db.BlogPostData{
+				{Title: title, Slug: "test-title", Version: "1", IsActive: true, Visibility: db.VisibilityDraft},
+			}}, nil
+		},
+	}
+	blogPostDataDB = mock
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	var b bytes.Buffer
+	wr := multipart.NewWriter(&b)
+	fw, _ := wr.CreateFormFile("file", "test.md")
+	if _, err := io.Copy(fw, strings.NewReader("# Hello")); err != nil {
+		t.Fatalf("io.Copy failed: %v", err)
+	}
+	if err := wr.WriteField("title", "Test Title"); err != nil {
+		t.Fatalf("wr.WriteField failed: %v", err)
+	}
+	if err := wr.WriteField("visibility", "public"); err != nil {
+		t.Fatalf("wr.WriteField failed: %v", err)
+	}
+	wr.Close()
+
+	req := httptest.NewRequest("POST", "/upload", &b)
+	req.Header.Set("Content-Type", wr.FormDataContentType())
+	req = req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, "testuser"))
+	rr := httptest.NewRecorder()
+
+	HandleUpload(rr, req)
 
+	assert.Equal(t, http.StatusOK, rr.Code)
+	if assert.Len(t, mock.created, 1) {
+		assert.Equal(t, db.VisibilityPublic, mock.created[0].Visibility)
+	}
+	// the older versions follow the new one
+	assert.Equal(t, db.VisibilityPublic, mock.visibility["Test Title"])
+}
+
+func TestHandleUpload_FailedActivationRemovesVersion(t *testing.T) {
+	store := useTestBlobStore(t)
+	t.Cleanup(func() { os.RemoveAll("cmd/") })
+
+	mock := &mockBlogPostDataDB{
+		ActivateVersionFunc: func(ctx context.Context, username, title, version string) error {
+			return assert.AnError
+		},
+	}
+	blogPostDataDB = mock
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	var b bytes.Buffer
+	wr := multipart.NewWriter(&b)
+	fw, _ := wr.CreateFormFile("file", "test.md")
+	if _, err := io.Copy(fw, strings.NewReader("# Hello")); err != nil {
+		t.Fatalf("io.Copy failed: %v", err)
+	}
+	if err := wr.WriteField("title", "Test Title"); err != nil {
+		t.Fatalf("wr.WriteField failed: %v", err)
+	}
+	wr.Close()
+
+	req := httptest.NewRequest("POST", "/upload", &b)
+	req.Header.Set("Content-Type", wr.FormDataContentType())
+	req = req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, "testuser"))
+	rr := httptest.NewRecorder()
+
+	HandleUpload(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	// the reserved version and its files are gone again
+	assert.Equal(t, []string{"Test Title/1"}, mock.deleted)
+	for _, key := range []string{"testuser_test-title_1.html", "testuser_test-title_1.md"} {
+		_, err := store.Stat(context.Background(), key)
+		assert.ErrorIs(t, err, storage.ErrNotFound, key)
+	}
+}
+
+func TestHandleUpload_FrontMatter(t *testing.T) {
+	useTestBlobStore(t)
+	t.Cleanup(func() { os.RemoveAll("cmd/") })
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	md := "---\ntitle: From Front Matter\ndescription: Short summary\ntags: [go, testing]\ndate: 2024-03-01\nslug: custom-slug\ndraft: true\ncanonical_url: https://example.com/post\nmessage: First draft\n---\n# Body\n"
+	for _, tc := range []struct {
+		formTitle   string
+		formTags    string
+		formMessage string
+		title       string
+		tags        []string
+		message     string
+	}{
+		{"", "", "", "From Front Matter", []string{"go", "testing"}, "First draft"},
+		{"Form Title", "Web, Go", "  Fix typos\n", "Form Title", []string{"web", "go"}, "Fix typos"},
+	} {
+		mock := &mockBlogPostDataDB{}
+		blogPostDataDB = mock
+
+		var b bytes.Buffer
+		wr := multipart.NewWriter(&b)
+		fw, _ := wr.CreateFormFile("file", "test.md")
+		if _, err := io.Copy(fw, strings.NewReader(md)); err != nil {
+			t.Fatalf("io.Copy failed: %v", err)
+		}
+		if tc.formTitle != "" {
+			if err := wr.WriteField("title", tc.formTitle); err != nil {
+				t.Fatalf("wr.WriteField failed: %v", err)
+			}
+		}
+		if tc.formTags != "" {
+			if err := wr.WriteField("tags", tc.formTags); err != nil {
+				t.Fatalf("wr.WriteField failed: %v", err)
+			}
+		}
+		if tc.formMessage != "" {
+			if err := wr.WriteField("message", tc.formMessage); err != nil {
+				t.Fatalf("wr.WriteField failed: %v", err)
+			}
+		}
+		wr.Close()
+
+		req := httptest.NewRequest("POST", "/upload", &b)
+		req.Header.Set("Content-Type", wr.FormDataContentType())
+		req = req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, "testuser"))
+		rr := httptest.NewRecorder()
+
+		HandleUpload(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		if !assert.Len(t, mock.created, 1) {
+			continue
+		}
+		post := mock.created[0]
+		assert.Equal(t, tc.title, post.Title)
+		assert.Equal(t, "custom-slug", post.Slug)
+		assert.Equal(t, db.VisibilityDraft, post.Visibility)
+		assert.Equal(t, "Short summary", post.Description)
+		assert.Equal(t, tc.tags, post.Tags)
+		assert.Equal(t, tc.message, post.Message)
+		assert.Equal(t, "https://example.com/post", post.CanonicalURL)
+		if assert.NotNil(t, post.Date) {
+			assert.Equal(t, 2024, post.Date.Year())
+		}
+	}
+}
+
+func TestHandleUpload_InvalidFrontMatter(t *testing.T) {
+	t.Cleanup(func() { os.RemoveAll("cmd/") })
+	useTestBlobStore(t)
 	blogPostDataDB = &mockBlogPostDataDB{}
+
+	var b bytes.Buffer
+	wr := multipart.NewWriter(&b)
+	fw, _ := wr.CreateFormFile("file", "test.md")
+	if _, err := io.Copy(fw, strings.NewReader("---\ntitle: [Not, A, String]\n---\n# Body\n")); err != nil {
+		t.Fatalf("io.Copy failed: %v", err)
+	}
+	wr.Close()
+
+	req := httptest.NewRequest("POST", "/upload", &b)
+	req.Header.Set("Content-Type", wr.FormDataContentType())
+	req = req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, "testuser"))
+	rr := httptest.NewRecorder()
+
+	HandleUpload(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "invalid front matter")
+}
+
+func TestHandleDelete(t *testing.T) {
+	useTestBlobStore(t)
+
+	mock := &mockBlogPostDataDB{FetchAllPostVersionsFunc: postVersions}
+	blogPostDataDB = mock
 	AnalyticsDataDB = &mockAnalyticsDataDB{}
 
-	body := `{"title":"Test Title"}`
+	body := `{"title":"Test Post"}`
 	req := httptest.NewRequest("POST", "/delete", strings.NewReader(body))
 	ctx := context.WithValue(req.Context(), auth.UsernameKey, "testuser")
 	req = req.WithContext(ctx)
@@ -83,6 +323,39 @@ func TestHandleDelete(t *testing.T) {
 
 	HandleDelete(rr, req)
 
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Post moved to trash")
+	assert.NotNil(t, mock.trashed["Test Post"])
+	assert.Empty(t, mock.deleted, "only the purge deletes for good")
+}
+
+func TestHandleDelete_Permanent(t *testing.T) {
+	store := useTestBlobStore(t)
+	err := store.Put(context.Background(), "testuser_test-post_1.html", strings.NewReader("<p>hi</p>"), "text/html")
+	if err != nil {
+		t.Fatalf("store.Put failed: %v", err)
+	}
+
+	mock := &mockBlogPostDataDB{FetchAllPostVersionsFunc: postVersions}
+	blogPostDataDB = mock
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	body := `{"title":"Test Post","permanent":true}`
+	rr := httptest.NewRecorder()
+	HandleDelete(rr, withUser(httptest.NewRequest("POST", "/delete", strings.NewReader(body))))
+
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Post deleted successfully")
+	assert.Equal(t, []string{"Test Post"}, mock.deleted)
+	_, err = store.Get(context.Background(), "testuser_test-post_1.html")
+	assert.Error(t, err)
+}
+
+func TestHandleDelete_NotFound(t *testing.T) {
+	blogPostDataDB = &mockBlogPostDataDB{}
+
+	rr := httptest.NewRecorder()
+	HandleDelete(rr, withUser(httptest.NewRequest("POST", "/delete", strings.NewReader(`{"title":"Missing"}`))))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/htmldiff"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
+)
+
+type DiffResponse struct {
+	Title string `json:"title"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	// Markdown is a unified diff of the markdown sources, empty when they are
+	// the same.
+	Markdown string `json:"markdown"`
+	// HTML is the rendered "to" version with removed words in <del> and added
+	// words in <ins>.
+	HTML string `json:"html"`
+}
+
+// HandlePostDiff compares two versions of one of the user's posts, so a
+// change can be reviewed before it is published.
+func HandlePostDiff(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	title := r.URL.Query().Get("title")
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+	if title == "" || from == "" || to == "" {
+		http.Error(w, "title, from and to are required", http.StatusBadRequest)
+		return
+	}
+
+	post_slug, err := blogPostDataDB.FetchPostSlug(r.Context(), username, title)
+	if err != nil {
+		http.Error(w, "Failed to fetch blog post", http.StatusInternalServerError)
+		return
+	}
+	if post_slug == "" {
+		http.Error(w, "No such Blog Post exists", http.StatusNotFound)
+		return
+	}
+
+	// markdown and html of the from and to versions, in that order
+	contents := make([]string, 0, 4)
+	for _, version := range []string{from, to} {
+		for _, ext := range []string{".md", ".html"} {
+			content, err := storage.ReadString(r.Context(), blobStore, slug.Key(username, post_slug, version, ext))
+			if errors.Is(err, storage.ErrNotFound) {
+				http.Error(w, fmt.Sprintf("Version %s does not exist", version), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Failed to read post version", http.StatusInternalServerError)
+				return
+			}
+			contents = append(contents, content)
+		}
+	}
+
+	mdDiff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(contents[0]),
+		B:        difflib.SplitLines(contents[2]),
+		FromFile: fmt.Sprintf("%s (version %s)", title, from),
+		ToFile:   fmt.Sprintf("%s (version %s)", title, to),
+		Context:  3,
+	})
+	if err != nil {
+		http.Error(w, "Failed to diff markdown", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(DiffResponse{
+		Title:    title,
+		From:     from,
+		To:       to,
+		Markdown: mdDiff,
+		HTML:     htmldiff.Diff(contents[1], contents[3]),
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
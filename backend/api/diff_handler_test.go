@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func diffRequest(query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/post/diff?"+query, nil)
+	req = req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, "testuser"))
+	rr := httptest.NewRecorder()
+	HandlePostDiff(rr, req)
+	return rr
+}
+
+func TestHandlePostDiff(t *testing.T) {
+	ctx := context.Background()
+	store := useTestBlobStore(t)
+	files := map[string]string{
+		"testuser_my-post_1.md":   "# Title\n\nthe quick fox\n",
+		"testuser_my-post_1.html": "<h1>Title</h1>\n<p>the quick fox</p>\n",
+		"testuser_my-post_2.md":   "# Title\n\nthe slow fox\n",
+		"testuser_my-post_2.html": "<h1>Title</h1>\n<p>the slow fox</p>\n",
+	}
+	for key, content := range files {
+		assert.NoError(t, store.Put(ctx, key, strings.NewReader(content), "text/plain"))
+	}
+	blogPostDataDB = &mockBlogPostDataDB{slugs: map[string]string{"my-post": "My Post"}}
+
+	rr := diffRequest("title=My+Post&from=1&to=2")
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp DiffResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Contains(t, resp.Markdown, "--- My Post (version 1)\n+++ My Post (version 2)\n")
+	assert.Contains(t, resp.Markdown, "-the quick fox\n+the slow fox\n")
+	assert.Equal(t, "<h1>Title</h1>\n<p>the <del>quick</del><ins>slow</ins> fox</p>\n", resp.HTML)
+}
+
+func TestHandlePostDiff_Errors(t *testing.T) {
+	ctx := context.Background()
+	store := useTestBlobStore(t)
+	assert.NoError(t, store.Put(ctx, "testuser_my-post_1.md", strings.NewReader("a"), "text/markdown"))
+	assert.NoError(t, store.Put(ctx, "testuser_my-post_1.html", strings.NewReader("a"), "text/html"))
+	blogPostDataDB = &mockBlogPostDataDB{slugs: map[string]string{"my-post": "My Post"}}
+
+	assert.Equal(t, http.StatusBadRequest, diffRequest("title=My+Post&from=1").Code)
+	assert.Equal(t, http.StatusNotFound, diffRequest("title=Other&from=1&to=2").Code)
+	assert.Equal(t, http.StatusNotFound, diffRequest("title=My+Post&from=1&to=9").Code)
+}
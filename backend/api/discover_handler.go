@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"time"
@@ -19,36 +20,20 @@ type HandleDiscoverPostsResponse struct {
 	Posts []PostData `json:"posts"`
 }
 
-func HandleDiscoverNewPosts(w http.ResponseWriter, r *http.Request) {
-	if redisdb.RedisActive {
-		cacheHit, err := redisdb.GetEndpoint(r.Context(), "discover:new")
-		if err == nil && cacheHit != "" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_, err = w.Write([]byte(cacheHit))
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			return
-		}
-	}
-
-	blogs, err := blogPostDataDB.FetchFiftyNewestPosts(r.Context())
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+// discoverPostData adds the profile picture of the author and the view count
+// to each post of a feed.
+func discoverPostData(ctx context.Context, blogs []db.BlogPostData) ([]PostData, error) {
 	pfp_map := make(map[string]string)
 	post_data := make([]PostData, 0)
 
 	var user_data *db.User
 	var pfp string
 	var ok bool
+	var err error
 	for _, blog := range blogs {
 		pfp, ok = pfp_map[blog.User]
 		if !ok {
-			user_data, err = userDB.GetUser(r.Context(), blog.User)
+			user_data, err = userDB.GetUser(ctx, blog.User)
 			if err != nil {
 				pfp = ""
 			} else {
@@ -56,10 +41,9 @@ func HandleDiscoverNewPosts(w http.ResponseWriter, r *http.Request) {
 			}
 			pfp_map[blog.User] = pfp
 		}
-		view_count, err := AnalyticsDataDB.GetPostViewCount(r.Context(), blog.User, blog.Title, blog.Version)
+		view_count, err := AnalyticsDataDB.GetPostViewCount(ctx, blog.User, blog.Title, blog.Version)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return nil, err
 		}
 		post_data = append(post_data, PostData{
 			Pfp:       pfp,
@@ -67,6 +51,34 @@ func HandleDiscoverNewPosts(w http.ResponseWriter, r *http.Request) {
 			ViewCount: view_count,
 		})
 	}
+	return post_data, nil
+}
+
+func HandleDiscoverNewPosts(w http.ResponseWriter, r *http.Request) {
+	if redisdb.RedisActive {
+		cacheHit, err := redisdb.GetEndpoint(r.Context(), "discover:new")
+		if err == nil && cacheHit != "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, err = w.Write([]byte(cacheHit))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			return
+		}
+	}
+
+	blogs, err := blogPostDataDB.FetchFiftyNewestPosts(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	post_data, err := discoverPostData(r.Context(), blogs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	response := HandleDiscoverPostsResponse{
 		Posts: post_data,
 	}
@@ -117,7 +129,7 @@ func HandleDiscoverTopPosts(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 		blog_post, err := blogPostDataDB.FetchBlogPost(r.Context(), analytics.Username, analytics.Title, analytics.Version)
-		if err != nil || !blog_post.IsActive {
+		if err != nil || !blog_post.IsActive || !blog_post.Visibility.Listed() || blog_post.DeletedAt != nil {
 			continue
 		}
 
@@ -0,0 +1,445 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+)
+
+const (
+	defaultExperimentSplit = 50
+	experimentCookieAge    = 30 * 24 * 60 * 60
+)
+
+// experimentDB stores A/B experiments, experiments are off while it is nil.
+var experimentDB db.ExperimentDB
+
+func SetExperimentDB(repo db.ExperimentDB) {
+	experimentDB = repo
+}
+
+// variantRoll picks a number in [0, 100) for a new reader, readers below the
+// split are served version B.
+var variantRoll = func() int {
+	return rand.IntN(100)
+}
+
+// runningExperiment returns the experiment readers of a post are split by,
+// nil when there is none.
+func runningExperiment(ctx context.Context, username string, title string) (*db.Experiment, error) {
+	if experimentDB == nil {
+		return nil, nil
+	}
+	experiment, err := experimentDB.FetchExperiment(ctx, username, title)
+	if err != nil || !experiment.Running() {
+		return nil, err
+	}
+	return experiment, nil
+}
+
+// experimentCookie names the cookie holding the variant of a reader. It
+// changes with every experiment so readers are split again for the next one.
+func experimentCookie(experiment *db.Experiment) string {
+	sum := sha256.Sum256([]byte(experiment.User + "\x00" + experiment.Title + "\x00" + experiment.StartedAt.UTC().Format(time.RFC3339Nano)))
+	return "ab_" + hex.EncodeToString(sum[:6])
+}
+
+// experimentReader splits the cookie of a reader into their variant, "a" or
+// "b", and the id they were given when first served. Cookies set before ids
+// were added hold only the variant.
+func experimentReader(r *http.Request, experiment *db.Experiment) (variant string, reader string) {
+	cookie, err := r.Cookie(experimentCookie(experiment))
+	if err != nil {
+		return "", ""
+	}
+	variant, reader, _ = strings.Cut(cookie.Value, ".")
+	return variant, reader
+}
+
+// cookieVariant returns the version the reader was served before, empty when
+// they have not been split yet.
+func cookieVariant(r *http.Request, experiment *db.Experiment) string {
+	variant, _ := experimentReader(r, experiment)
+	switch variant {
+	case "a":
+		return experiment.VersionA
+	case "b":
+		return experiment.VersionB
+	}
+	return ""
+}
+
+// assignVariant returns the version to serve the reader, picking one and
+// remembering it in a cookie the first time. The cookie also gets an id for
+// the reader, so their reads are counted once.
+func assignVariant(w http.ResponseWriter, r *http.Request, experiment *db.Experiment) string {
+	if version := cookieVariant(r, experiment); version != "" {
+		return version
+	}
+	variant, version := "a", experiment.VersionA
+	if variantRoll() < experiment.Split {
+		variant, version = "b", experiment.VersionB
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     experimentCookie(experiment),
+		Value:    fmt.Sprintf("%s.%016x", variant, rand.Uint64()),
+		Path:     "/",
+		MaxAge:   experimentCookieAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return version
+}
+
+// servedVersion returns the version of a post the reader sees: their
+// variant while an experiment runs, active otherwise.
+func servedVersion(r *http.Request, username string, title string, active string) string {
+	experiment, err := runningExperiment(r.Context(), username, title)
+	if err != nil {
+		fmt.Printf("Failed to fetch experiment: %v\n", err)
+	}
+	if experiment == nil {
+		return active
+	}
+	if version := cookieVariant(r, experiment); version != "" {
+		return version
+	}
+	return active
+}
+
+// inExperiment reports whether version is one of the two being served.
+func inExperiment(ctx context.Context, username string, title string, version string) (bool, error) {
+	experiment, err := runningExperiment(ctx, username, title)
+	if err != nil || experiment == nil {
+		return false, err
+	}
+	return version == experiment.VersionA || version == experiment.VersionB, nil
+}
+
+// readThroughScript reports a read once the reader scrolls to the end of
+// the post.
+func readThroughScript(username string, title string) string {
+	body, _ := json.Marshal(RecordReadRequest{Username: username, Title: title})
+	return fmt.Sprintf(`<div id="read-through"></div>
+<script>
+(function () {
+  var end = document.getElementById("read-through");
+  if (!end || !("IntersectionObserver" in window)) return;
+  var observer = new IntersectionObserver(function (entries) {
+    if (!entries[0].isIntersecting) return;
+    observer.disconnect();
+    navigator.sendBeacon("/post/read", new Blob([%q], {type: "application/json"}));
+  });
+  observer.observe(end);
+})();
+</script>
+`, body)
+}
+
+type StartExperimentRequest struct {
+	Title    string `json:"title"`
+	VersionA string `json:"version_a"`
+	VersionB string `json:"version_b"`
+	// Split is the share of readers, in percent, served version B, 50 when
+	// left out.
+	Split int `json:"split,omitempty"`
+}
+
+// HandleStartExperiment splits the readers of a post between two of its
+// versions until the experiment is ended.
+func HandleStartExperiment(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if experimentDB == nil {
+		http.Error(w, "Experiments are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	var req StartExperimentRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+	if req.Split == 0 {
+		req.Split = defaultExperimentSplit
+	}
+	if req.Split < 1 || req.Split > 99 {
+		http.Error(w, "Split must be between 1 and 99", http.StatusBadRequest)
+		return
+	}
+	if req.VersionA == "" || req.VersionA == req.VersionB {
+		http.Error(w, "Pick two different versions", http.StatusBadRequest)
+		return
+	}
+
+	postVersions, err := blogPostDataDB.FetchAllPostVersions(r.Context(), username, req.Title)
+	if err != nil {
+		http.Error(w, "Failed to fetch post versions", http.StatusInternalServerError)
+		return
+	}
+	if len(postVersions.Versions) == 0 {
+		http.Error(w, "No such Blog Post exists", http.StatusNotFound)
+		return
+	}
+	if inTrash(postVersions.Versions) {
+		http.Error(w, "Post is in the trash, restore it first", http.StatusConflict)
+		return
+	}
+	found := 0
+	for _, post := range postVersions.Versions {
+		if post.Version == req.VersionA || post.Version == req.VersionB {
+			found++
+		}
+	}
+	if found != 2 {
+		http.Error(w, "No such version exists", http.StatusNotFound)
+		return
+	}
+
+	running, err := runningExperiment(r.Context(), username, req.Title)
+	if err != nil {
+		http.Error(w, "Failed to fetch experiment", http.StatusInternalServerError)
+		return
+	}
+	if running != nil {
+		http.Error(w, "An experiment is already running, end it first", http.StatusConflict)
+		return
+	}
+
+	// mongo keeps milliseconds, the cookie name has to survive the round trip
+	experiment := db.Experiment{
+		User:      username,
+		Title:     req.Title,
+		VersionA:  req.VersionA,
+		VersionB:  req.VersionB,
+		Split:     req.Split,
+		StartedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+	err = experimentDB.SaveExperiment(r.Context(), &experiment)
+	if err != nil {
+		http.Error(w, "Failed to save experiment", http.StatusInternalServerError)
+		return
+	}
+	invalidatePost(r.Context(), username, req.Title, postVersions.Versions)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(experiment)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+type EndExperimentRequest struct {
+	Title string `json:"title"`
+	// Publish makes this version active once readers are no longer split.
+	Publish string `json:"publish,omitempty"`
+}
+
+// HandleEndExperiment stops splitting readers. The experiment is kept so its
+// results can still be compared.
+func HandleEndExperiment(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if experimentDB == nil {
+		http.Error(w, "Experiments are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	var req EndExperimentRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+
+	experiment, err := runningExperiment(r.Context(), username, req.Title)
+	if err != nil {
+		http.Error(w, "Failed to fetch experiment", http.StatusInternalServerError)
+		return
+	}
+	if experiment == nil {
+		http.Error(w, "No experiment is running", http.StatusNotFound)
+		return
+	}
+	if req.Publish != "" && req.Publish != experiment.VersionA && req.Publish != experiment.VersionB {
+		http.Error(w, "Publish one of the versions in the experiment", http.StatusBadRequest)
+		return
+	}
+
+	// the experiment keeps running when the publish fails, so the request
+	// can simply be repeated
+	if req.Publish != "" {
+		err = PublishVersion(r.Context(), username, req.Title, req.Publish)
+		if err != nil {
+			http.Error(w, "Failed to publish version", http.StatusInternalServerError)
+			fmt.Println(err)
+			return
+		}
+	}
+	_, err = experimentDB.EndExperiment(r.Context(), username, req.Title, time.Now().UTC())
+	if err != nil {
+		http.Error(w, "Failed to end experiment", http.StatusInternalServerError)
+		return
+	}
+	postVersions, err := blogPostDataDB.FetchAllPostVersions(r.Context(), username, req.Title)
+	if err == nil {
+		invalidatePost(r.Context(), username, req.Title, postVersions.Versions)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+type VariantResults struct {
+	Version string `json:"version"`
+	// Share is the percentage of readers served this version.
+	Share int `json:"share"`
+	Views int `json:"views"`
+	Likes int `json:"likes"`
+	Reads int `json:"reads"`
+	// ReadThrough is the fraction of views that reached the end of the post.
+	ReadThrough float64 `json:"read_through"`
+}
+
+type ExperimentResults struct {
+	Experiment db.Experiment    `json:"experiment"`
+	Variants   []VariantResults `json:"variants"`
+}
+
+// HandleExperimentResults compares the two versions of the last experiment
+// of a post. Views, likes and reads only count while the experiment ran.
+func HandleExperimentResults(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if experimentDB == nil {
+		http.Error(w, "Experiments are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	title := r.URL.Query().Get("title")
+	experiment, err := experimentDB.FetchExperiment(r.Context(), username, title)
+	if err != nil {
+		http.Error(w, "Failed to fetch experiment", http.StatusInternalServerError)
+		return
+	}
+	if experiment == nil {
+		http.Error(w, "No experiment exists for this post", http.StatusNotFound)
+		return
+	}
+
+	end := time.Now()
+	if experiment.EndedAt != nil {
+		end = *experiment.EndedAt
+	}
+	inWindow := func(times []time.Time) int {
+		count := 0
+		for _, t := range times {
+			if !t.Before(experiment.StartedAt) && !t.After(end) {
+				count++
+			}
+		}
+		return count
+	}
+
+	results := ExperimentResults{Experiment: *experiment, Variants: []VariantResults{}}
+	for _, variant := range []struct {
+		version string
+		share   int
+	}{
+		{experiment.VersionA, 100 - experiment.Split},
+		{experiment.VersionB, experiment.Split},
+	} {
+		analytics, err := AnalyticsDataDB.GetPostAnalytics(r.Context(), username, title, variant.version)
+		if err != nil {
+			http.Error(w, "Failed to fetch analytics", http.StatusInternalServerError)
+			return
+		}
+		likes := make([]time.Time, 0, len(analytics.LikedAt))
+		for _, like := range analytics.LikedAt {
+			likes = append(likes, like.At)
+		}
+		variantResults := VariantResults{
+			Version: variant.version,
+			Share:   variant.share,
+			Views:   inWindow(analytics.Views),
+			Likes:   inWindow(likes),
+			Reads:   inWindow(analytics.Reads),
+		}
+		if variantResults.Views > 0 {
+			variantResults.ReadThrough = float64(variantResults.Reads) / float64(variantResults.Views)
+		}
+		results.Variants = append(results.Variants, variantResults)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(results)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+type RecordReadRequest struct {
+	Username string `json:"username"`
+	Title    string `json:"title"`
+}
+
+// HandleRecordRead counts a reader reaching the end of a post against the
+// variant they were served. Reads outside experiments are not recorded, and
+// each reader, by username or else by the id in their cookie, is counted
+// once per version.
+func HandleRecordRead(w http.ResponseWriter, r *http.Request) {
+	var req RecordReadRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+
+	experiment, err := runningExperiment(r.Context(), req.Username, req.Title)
+	if err != nil {
+		http.Error(w, "Failed to fetch experiment", http.StatusInternalServerError)
+		return
+	}
+	if experiment == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	version := cookieVariant(r, experiment)
+	_, reader := experimentReader(r, experiment)
+	if username, ok := r.Context().Value(auth.UsernameKey).(string); ok && username != "" {
+		reader = "user:" + username
+	}
+	if version == "" || reader == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// readers are only unique within one experiment
+	reader = experimentCookie(experiment) + ":" + reader
+	err = AnalyticsDataDB.RecordRead(r.Context(), req.Username, req.Title, version, reader, experiment.StartedAt)
+	if err != nil {
+		http.Error(w, "Failed to record read", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/stretchr/testify/assert"
+)
+
+// variantAnalyticsDB records which versions views and reads were counted
+// against, counting each reader once.
+type variantAnalyticsDB struct {
+	mockAnalyticsDataDB
+	views     []string
+	reads     []string
+	readers   []string
+	analytics map[string]db.PostAnalytics
+}
+
+func (m *variantAnalyticsDB) IncrementViews(ctx context.Context, username, title, version string) error {
+	m.views = append(m.views, version)
+	return nil
+}
+
+func (m *variantAnalyticsDB) RecordRead(ctx context.Context, username, title, version, reader string, since time.Time) error {
+	if slices.Contains(m.readers, version+" "+reader) {
+		return nil
+	}
+	m.readers = append(m.readers, version+" "+reader)
+	m.reads = append(m.reads, version)
+	return nil
+}
+
+func (m *variantAnalyticsDB) GetPostAnalytics(ctx context.Context, username, title, version string) (db.PostAnalytics, error) {
+	return m.analytics[version], nil
+}
+
+func useVariantRoll(t *testing.T, roll int) {
+	t.Helper()
+	orig := variantRoll
+	variantRoll = func() int { return roll }
+	t.Cleanup(func() { variantRoll = orig })
+}
+
+func runningTestExperiment(experiments *mockExperimentDB) db.Experiment {
+	experiment := db.Experiment{
+		User:      "testuser",
+		Title:     "Test Post",
+		VersionA:  "2",
+		VersionB:  "4",
+		Split:     30,
+		StartedAt: time.Now().Add(-time.Hour).UTC().Truncate(time.Millisecond),
+	}
+	experiments.experiments = append(experiments.experiments, experiment)
+	return experiment
+}
+
+func fetchTestPost(cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("username", "testuser")
+	rctx.URLParams.Add("post", "test-post")
+	req := httptest.NewRequest("GET", "/testuser/test-post", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	rr := httptest.NewRecorder()
+	HandleFetchBlogPost(rr, req)
+	return rr
+}
+
+func TestHandleStartExperiment(t *testing.T) {
+	experiments := useTestExperimentDB(t)
+	blogPostDataDB = &mockBlogPostDataDB{FetchAllPostVersionsFunc: manyVersions}
+
+	for _, tc := range []struct {
+		name string
+		body string
+		code int
+	}{
+		{"same version", `{"title":"Test Post","version_a":"2","version_b":"2"}`, http.StatusBadRequest},
+		{"split too large", `{"title":"Test Post","version_a":"2","version_b":"4","split":100}`, http.StatusBadRequest},
+		{"missing version", `{"title":"Test Post","version_a":"2","version_b":"9"}`, http.StatusNotFound},
+		{"missing post", `{"title":"Other Post","version_a":"2","version_b":"4"}`, http.StatusNotFound},
+		{"started", `{"title":"Test Post","version_a":"2","version_b":"4"}`, http.StatusOK},
+		{"already running", `{"title":"Test Post","version_a":"2","version_b":"5"}`, http.StatusConflict},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			HandleStartExperiment(rr, withUser(httptest.NewRequest("POST", "/post/experiment/start", strings.NewReader(tc.body))))
+			assert.Equal(t, tc.code, rr.Code)
+		})
+	}
+
+	if assert.Len(t, experiments.experiments, 1) {
+		experiment := experiments.experiments[0]
+		assert.Equal(t, "4", experiment.VersionB)
+		assert.Equal(t, 50, experiment.Split)
+		assert.True(t, experiment.Running())
+	}
+}
+
+func TestHandleFetchBlogPost_Experiment(t *testing.T) {
+	store := useTestBlobStore(t)
+	for version, body := range map[string]string{"2": "Version A", "4": "Version B"} {
+		err := store.Put(context.Background(), "testuser_test-post_"+version+".html", strings.NewReader(body), "text/html")
+		if err != nil {
+			t.Fatalf("store.Put failed: %v", err)
+		}
+	}
+	experiments := useTestExperimentDB(t)
+	experiment := runningTestExperiment(experiments)
+	blogPostDataDB = &mockBlogPostDataDB{
+		slugs: map[string]string{"test-post": "Test Post"},
+		FetchActiveBlogFunc: func(ctx context.Context, username, title string) (string, error) {
+			return "2", nil
+		},
+	}
+	userDB = &mockUserDB{}
+	analytics := &variantAnalyticsDB{}
+	AnalyticsDataDB = analytics
+
+	// new readers below the split get version B and keep it
+	useVariantRoll(t, 10)
+	rr := fetchTestPost()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Version B")
+	assert.Contains(t, rr.Body.String(), "/post/read")
+	cookies := rr.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, experimentCookie(&experiment), cookies[0].Name)
+		assert.True(t, strings.HasPrefix(cookies[0].Value, "b."), cookies[0].Value)
+	}
+
+	useVariantRoll(t, 90)
+	rr = fetchTestPost(cookies...)
+	assert.Contains(t, rr.Body.String(), "Version B")
+	assert.Empty(t, rr.Result().Cookies())
+
+	rr = fetchTestPost()
+	assert.Contains(t, rr.Body.String(), "Version A")
+
+	assert.Equal(t, []string{"4", "4", "2"}, analytics.views)
+}
+
+func TestHandleRecordRead(t *testing.T) {
+	experiments := useTestExperimentDB(t)
+	experiment := runningTestExperiment(experiments)
+	analytics := &variantAnalyticsDB{}
+	AnalyticsDataDB = analytics
+
+	body := `{"username":"testuser","title":"Test Post"}`
+	read := func(cookie string, requester string) {
+		req := httptest.NewRequest("POST", "/post/read", strings.NewReader(body))
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: experimentCookie(&experiment), Value: cookie})
+		}
+		if requester != "" {
+			req = req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, requester))
+		}
+		rr := httptest.NewRecorder()
+		HandleRecordRead(rr, req)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+	}
+
+	read("a.0001", "")
+	// the same reader reading again is counted once
+	read("a.0001", "")
+	read("b.0002", "")
+	// signed in readers are counted once whatever their cookie says
+	read("a.0003", "otheruser")
+	read("a.0004", "otheruser")
+	// readers that were never split, or have no id, are not counted
+	read("", "")
+	read("a", "")
+
+	assert.Equal(t, []string{"2", "4", "2"}, analytics.reads)
+}
+
+func TestHandleExperimentResults(t *testing.T) {
+	experiments := useTestExperimentDB(t)
+	experiment := runningTestExperiment(experiments)
+	before := experiment.StartedAt.Add(-time.Minute)
+	during := experiment.StartedAt.Add(time.Minute)
+	AnalyticsDataDB = &variantAnalyticsDB{analytics: map[string]db.PostAnalytics{
+		"2": {
+			Views:   []time.Time{before, during, during, during},
+			Reads:   []time.Time{during},
+			Likes:   []string{"a", "b", "c"},
+			LikedAt: []db.Like{{User: "a", At: before}, {User: "b", At: during}},
+		},
+		"4": {Views: []time.Time{during, during}, Reads: []time.Time{before, during}},
+	}}
+
+	req := withUser(httptest.NewRequest("GET", "/post/experiment?title=Test+Post", nil))
+	rr := httptest.NewRecorder()
+	HandleExperimentResults(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var results ExperimentResults
+	err := json.NewDecoder(rr.Body).Decode(&results)
+	assert.NoError(t, err)
+	assert.Equal(t, []VariantResults{
+		{Version: "2", Share: 70, Views: 3, Likes: 1, Reads: 1, ReadThrough: 1.0 / 3},
+		{Version: "4", Share: 30, Views: 2, Likes: 0, Reads: 1, ReadThrough: 0.5},
+	}, results.Variants)
+}
+
+func TestHandleEndExperiment(t *testing.T) {
+	experiments := useTestExperimentDB(t)
+	runningTestExperiment(experiments)
+	blogPostDataDB = &mockBlogPostDataDB{FetchAllPostVersionsFunc: manyVersions}
+
+	rr := httptest.NewRecorder()
+	HandleEndExperiment(rr, withUser(httptest.NewRequest("POST", "/post/experiment/end", strings.NewReader(`{"title":"Test Post","publish":"5"}`))))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	HandleEndExperiment(rr, withUser(httptest.NewRequest("POST", "/post/experiment/end", strings.NewReader(`{"title":"Test Post","publish":"4"}`))))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.False(t, experiments.experiments[0].Running())
+
+	rr = httptest.NewRecorder()
+	HandleEndExperiment(rr, withUser(httptest.NewRequest("POST", "/post/experiment/end", strings.NewReader(`{"title":"Test Post"}`))))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHandleEndExperiment_FailedPublishKeepsRunning(t *testing.T) {
+	experiments := useTestExperimentDB(t)
+	runningTestExperiment(experiments)
+	blogPostDataDB = &mockBlogPostDataDB{
+		FetchAllPostVersionsFunc: manyVersions,
+		ActivateVersionFunc: func(ctx context.Context, username, title, version string) error {
+			return errors.New("write conflict")
+		},
+	}
+
+	rr := httptest.NewRecorder()
+	HandleEndExperiment(rr, withUser(httptest.NewRequest("POST", "/post/experiment/end", strings.NewReader(`{"title":"Test Post","publish":"4"}`))))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.True(t, experiments.experiments[0].Running())
+}
+
+func TestHandleDeletePostVersion_InExperiment(t *testing.T) {
+	experiments := useTestExperimentDB(t)
+	runningTestExperiment(experiments)
+	mock := &mockBlogPostDataDB{FetchAllPostVersionsFunc: manyVersions}
+	blogPostDataDB = mock
+
+	rr := httptest.NewRecorder()
+	HandleDeletePostVersion(rr, withUser(httptest.NewRequest("POST", "/post/version/delete", strings.NewReader(`{"title":"Test Post","version":"4"}`))))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Empty(t, mock.deleted)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/frontmatter"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/tags"
+)
+
+// postTitle picks the title of an upload: the form field, then the front
+// matter, then fallback, usually taken from the file name.
+func postTitle(formTitle string, meta frontmatter.Meta, fallback string) string {
+	if formTitle != "" {
+		return formTitle
+	}
+	if meta.Title != "" {
+		return meta.Title
+	}
+	return fallback
+}
+
+// uploadVisibilityField is the visibility an upload asks for, the form field
+// overriding the front matter.
+func uploadVisibilityField(formVisibility string, meta frontmatter.Meta) string {
+	if formVisibility != "" {
+		return formVisibility
+	}
+	return meta.PostVisibility()
+}
+
+// uploadTags returns the normalized tags of an upload, the comma separated
+// form field overriding the front matter.
+func uploadTags(formTags string, meta frontmatter.Meta) ([]string, error) {
+	if formTags != "" {
+		return tags.Parse(formTags)
+	}
+	return tags.Normalize(meta.Tags)
+}
+
+// maxMessageLength caps version messages, longer ones are cut.
+const maxMessageLength = 500
+
+// uploadMessage returns the message of an upload, the form field overriding
+// the front matter and the front matter overriding fallback, which is the
+// commit message for GitHub imports.
+func uploadMessage(formMessage string, meta frontmatter.Meta, fallback string) string {
+	message := formMessage
+	if message == "" {
+		message = meta.Message
+	}
+	if message == "" {
+		message = fallback
+	}
+	message = strings.TrimSpace(message)
+	if runes := []rune(message); len(runes) > maxMessageLength {
+		message = strings.TrimSpace(string(runes[:maxMessageLength]))
+	}
+	return message
+}
+
+// applyFrontMatter copies the metadata of a version's front matter onto it,
+// except for the tags which go through uploadTags.
+func applyFrontMatter(post *db.BlogPostData, meta frontmatter.Meta) {
+	post.Description = meta.Description
+	post.Date = meta.Date
+	post.CanonicalURL = meta.CanonicalURL
+	post.CoverImage = meta.CoverImage
+	post.ShowHistory = meta.RevisionHistory
+}
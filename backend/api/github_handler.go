@@ -1,17 +1,21 @@
 package api
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/shrijan-swaminathan/markbyte/backend/auth"
 	"github.com/shrijan-swaminathan/markbyte/backend/db"
 	"github.com/shrijan-swaminathan/markbyte/backend/db/redisdb"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/frontmatter"
 	"github.com/shrijan-swaminathan/markbyte/backend/features/markdown_render"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
 )
 
 type GithubHandlerRequest struct {
@@ -33,8 +37,18 @@ type BlobResponse struct {
 	Encoding string `json:"encoding"`
 }
 
+type CommitResponse struct {
+	Commit struct {
+		Message string `json:"message"`
+	} `json:"commit"`
+}
+
 var githubToken string
 
+// githubClient makes the GitHub API calls of an import, which fail instead
+// of holding the request when GitHub does not answer.
+var githubClient = &http.Client{Timeout: 30 * time.Second}
+
 // func to set the github token from .env
 func SetGithubToken(token string) {
 	githubToken = token
@@ -61,7 +75,7 @@ func HandleGithubUpload(w http.ResponseWriter, r *http.Request) {
 
 	// make the github request
 	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/git/trees/%s?recursive=1", request.Owner, request.RepoName, request.Branch)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(r.Context(), "GET", url, nil)
 	if err != nil {
 		http.Error(w, "Failed to create request", http.StatusInternalServerError)
 		return
@@ -72,7 +86,7 @@ func HandleGithubUpload(w http.ResponseWriter, r *http.Request) {
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", githubToken))
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := githubClient.Do(req)
 	if err != nil {
 		http.Error(w, "Failed to make GH request", http.StatusInternalServerError)
 		return
@@ -104,9 +118,11 @@ func HandleGithubUpload(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// every file gets the message of the commit the branch points at
+	commit_message := fetchCommitMessage(r.Context(), request)
 	for _, file := range mdFiles {
 		url = file["url"]
-		req, err = http.NewRequest("GET", url, nil)
+		req, err = http.NewRequestWithContext(r.Context(), "GET", url, nil)
 		if err != nil {
 			http.Error(w, "Could not get File Content", http.StatusInternalServerError)
 			return
@@ -116,7 +132,7 @@ func HandleGithubUpload(w http.ResponseWriter, r *http.Request) {
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", githubToken))
 		req.Header.Set("Accept", "application/vnd.github.v3+json")
 
-		resp, err = http.DefaultClient.Do(req)
+		resp, err = githubClient.Do(req)
 		if err != nil {
 			http.Error(w, "Could not get File Content", http.StatusInternalServerError)
 			return
@@ -135,95 +151,111 @@ func HandleGithubUpload(w http.ResponseWriter, r *http.Request) {
 		}
 
 		file["md_content"] = string(decodedContent)
+		file["commit_message"] = commit_message
 		file["path"] = strings.ReplaceAll(file["path"], "_", "-")
 		file["path"] = file["path"][:len(file["path"])-3]
 		file["title"] = "docs " + strings.ReplaceAll(file["path"], "/", " ")
 	}
 
-	for _, file := range mdFiles {
-		html_content, err := markdown_render.ConvertMarkdown([]byte(file["md_content"]))
+	var uploadSize int64
+	// front matter of each file, by index in mdFiles
+	metas := make([]frontmatter.Meta, len(mdFiles))
+	for i, file := range mdFiles {
+		meta, md_body, err := frontmatter.Split([]byte(file["md_content"]))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s.md: %v", file["path"], err), http.StatusBadRequest)
+			return
+		}
+		requested := db.Visibility(meta.PostVisibility())
+		if requested != "" && !requested.Valid() {
+			http.Error(w, fmt.Sprintf("%s.md: invalid visibility %q", file["path"], requested), http.StatusBadRequest)
+			return
+		}
+		meta.Tags, err = uploadTags("", meta)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s.md: %v", file["path"], err), http.StatusBadRequest)
+			return
+		}
+		metas[i] = meta
+		file["title"] = postTitle("", meta, file["title"])
+		if strings.ContainsAny(file["title"], `\/:*?"<>|`) {
+			http.Error(w, fmt.Sprintf("%s.md: title contains invalid characters", file["path"]), http.StatusBadRequest)
+			return
+		}
+
+		html_content, err := markdown_render.ConvertMarkdown(md_body)
 		if err != nil {
 			http.Error(w, "Failed to convert markdown", http.StatusInternalServerError)
 			return
 		}
 		file["html_content"] = html_content
-		//file["html_file_name"] = username + "_" + strings.ReplaceAll(file["path"], " ", "_") + ".html"
-		//file["md_file_name"] = username + "_" + strings.ReplaceAll(file["path"], " ", "_") + ".md"
-		newVersion := 1
+		uploadSize += int64(len(html_content) + len(file["md_content"]))
+	}
+
+	// check the whole import up front so it is not cut off half way
+	err = checkQuota(r.Context(), username, uploadSize, int64(2*len(mdFiles)))
+	if writeQuotaError(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to check storage quota", http.StatusInternalServerError)
+		return
+	}
+
+	for i, file := range mdFiles {
 		existingPosts, err := blogPostDataDB.FetchAllPostVersions(r.Context(), username, file["title"])
 		if err != nil {
 			http.Error(w, "Failed to fetch existing posts", http.StatusInternalServerError)
 			return
 		}
 		existingPostsVersions := existingPosts.Versions
-		for _, post := range existingPostsVersions {
-			verNum := 1
-			_, err := fmt.Sscanf(post.Version, "%d", &verNum)
-			if err != nil {
-				http.Error(w, "Failed to parse version number", http.StatusInternalServerError)
-				return
-			}
-
-			if verNum >= newVersion {
-				newVersion = verNum + 1
-			}
-			if post.IsActive {
-				err = blogPostDataDB.UpdateActiveStatus(r.Context(), username, file["title"], post.Version, false)
-				if err != nil {
-					http.Error(w, "Failed to deactivate prev post", http.StatusInternalServerError)
-					return
-				}
-			}
+		if inTrash(existingPostsVersions) {
+			http.Error(w, fmt.Sprintf("Post %q is in the trash, restore it first", file["title"]), http.StatusConflict)
+			return
 		}
-		//WEIRD SHIT HERE
-		file["html_file_name"] = username + "_" + strings.ReplaceAll(file["title"], " ", "_") + "_" + fmt.Sprintf("%d", newVersion) + ".html"
-		file["md_file_name"] = username + "_" + strings.ReplaceAll(file["title"], " ", "_") + "_" + fmt.Sprintf("%d", newVersion) + ".md"
-		file["file_name"] = "docs_" + strings.ReplaceAll(file["path"], "/", "_")
-
-		var url string
-		cred, err := LoadCredentials()
+		post_slug, err := postSlug(r.Context(), username, file["title"], metas[i].Slug)
 		if err != nil {
-			fmt.Println("AWS CREDENTIALS NOT SET UP")
+			http.Error(w, "Failed to pick post slug", http.StatusInternalServerError)
+			return
 		}
-		if err == nil {
-			s3URL, err := UploadHTMLFile(r.Context(), file["html_content"], file["html_file_name"], cred)
-			if err != nil {
-				http.Error(w, "Failed to upload html file to s3", http.StatusInternalServerError)
-				fmt.Println(err)
-				return
-			}
-
-			_, err = UploadMDFile(r.Context(), file["md_content"], file["md_file_name"], cred)
-			if err != nil {
-				http.Error(w, "Failed to upload md file to s3", http.StatusInternalServerError)
-				fmt.Println(err)
-				return
-			}
-
-			url = s3URL
+		visibility, err := uploadVisibility(existingPostsVersions, metas[i].PostVisibility())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		endpoint := "/" + username + "/" + file["file_name"]
+		endpoint := slug.Path(username, post_slug)
 		post_time := time.Now()
 		newBlogPostData := db.BlogPostData{
 			User:         username,
 			Title:        file["title"],
+			Slug:         post_slug,
 			DateUploaded: post_time,
-			Version:      fmt.Sprintf("%d", newVersion),
-			IsActive:     true,
-			Link:         &url,
 			DirectLink:   &endpoint,
+			Visibility:   visibility,
+			Tags:         metas[i].Tags,
+			Message:      uploadMessage("", metas[i], file["commit_message"]),
 		}
+		applyFrontMatter(&newBlogPostData, metas[i])
 
-		_, err = blogPostDataDB.CreateBlogPost(r.Context(), &newBlogPostData)
+		version, err := createPostVersion(r.Context(), &newBlogPostData, file["html_content"], []byte(file["md_content"]))
+		if writeQuotaError(w, err) {
+			return
+		}
 		if err != nil {
 			http.Error(w, "Failed to save blog post data", http.StatusInternalServerError)
+			fmt.Println(err)
+			return
+		}
+		err = syncUploadVisibility(r.Context(), &newBlogPostData, existingPostsVersions)
+		if err != nil {
+			http.Error(w, "Failed to update visibility", http.StatusInternalServerError)
 			return
 		}
 
 		newPostAnalytics := db.PostAnalytics{
 			Username:  username,
 			Title:     file["title"],
-			Version:   fmt.Sprintf("%d", newVersion),
+			Version:   version,
 			Date:      post_time,
 			Views:     []time.Time{},
 			ViewCount: 0,
@@ -247,3 +279,37 @@ func HandleGithubUpload(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// fetchCommitMessage returns the subject of the commit the branch points at.
+// The message is optional, so failures only leave it out.
+func fetchCommitMessage(ctx context.Context, request GithubHandlerRequest) string {
+	commit_url := fmt.Sprintf("https://api.github.com/repos/%s/%s/commits/%s", request.Owner, request.RepoName, url.PathEscape(request.Branch))
+	req, err := http.NewRequestWithContext(ctx, "GET", commit_url, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("User-Agent", "markbyte")
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if githubToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", githubToken))
+	}
+
+	resp, err := githubClient.Do(req)
+	if err != nil {
+		fmt.Printf("failed to fetch commit of %s: %v\n", request.Branch, err)
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("failed to fetch commit of %s: %s\n", request.Branch, resp.Status)
+		return ""
+	}
+
+	var commit CommitResponse
+	err = json.NewDecoder(resp.Body).Decode(&commit)
+	if err != nil {
+		return ""
+	}
+	subject, _, _ := strings.Cut(commit.Commit.Message, "\n")
+	return subject
+}
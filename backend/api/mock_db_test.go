@@ -1,10 +1,21 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"slices"
+	"strconv"
+	"testing"
 	"time"
 
 	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/markdown_render"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
 )
 
 // --- MockUserDB ---
@@ -39,30 +50,98 @@ func (m *mockUserDB) UpdateUserProfilePicture(ctx context.Context, username stri
 func (m *mockUserDB) UpdateUserName(ctx context.Context, username string, name string) error {
 	return nil
 }
+func (m *mockUserDB) FetchAllProfilePictures(ctx context.Context) ([]string, error) {
+	return []string{"mockpfp.png"}, nil
+}
 
 // MockBlogPostDataDB
 type mockBlogPostDataDB struct {
-	FetchActiveBlogFunc func(ctx context.Context, username, title string) (string, error)
-	FetchBlogPostFunc   func(ctx context.Context, username, title, version string) (db.BlogPostData, error)
+	FetchActiveBlogFunc      func(ctx context.Context, username, title string) (string, error)
+	FetchBlogPostFunc        func(ctx context.Context, username, title, version string) (db.BlogPostData, error)
+	FetchAllPostVersionsFunc func(ctx context.Context, username, title string) (db.BlogPostVersionsData, error)
+	RenameBlogPostFunc       func(ctx context.Context, username, title, newTitle, newSlug string, links map[string]string) (int, error)
+	SchedulePublishFunc      func(ctx context.Context, username, title, version string, at *time.Time) error
+	ActivateVersionFunc      func(ctx context.Context, username, title, version string) error
+	// slugs maps the slug of every existing post to its title
+	slugs map[string]string
+	// previousSlugs maps slugs of renamed posts to their current slug
+	previousSlugs map[string]string
+	scheduled     []db.BlogPostData
+	// visibility records the visibility set per title
+	visibility map[string]db.Visibility
+	// created records the versions stored through CreateNextVersion, with
+	// IsActive set by ActivateVersion
+	created []db.BlogPostData
+	// active are the active versions of every user
+	active []db.BlogPostData
+	// trashed records the deleted_at set per title, nil once restored
+	trashed map[string]*time.Time
+	// revoked counts the RevokePreviews calls per title
+	revoked map[string]int
+	// deleted records the titles deleted for good, and title/version of
+	// single versions
+	deleted []string
 }
 
 func (m *mockBlogPostDataDB) CreateBlogPost(ctx context.Context, post *db.BlogPostData) (string, error) {
 	return "mockPostID", nil
 }
+func (m *mockBlogPostDataDB) CreateNextVersion(ctx context.Context, post *db.BlogPostData, link func(version string) string) (string, error) {
+	existing, err := m.FetchAllPostVersions(ctx, post.User, post.Title)
+	if err != nil {
+		return "", err
+	}
+	latest := 0
+	for _, version := range existing.Versions {
+		n, err := strconv.Atoi(version.Version)
+		if err != nil {
+			return "", err
+		}
+		latest = max(latest, n)
+	}
+	post.Version = strconv.Itoa(latest + 1)
+	post.IsActive = false
+	if link != nil {
+		url := link(post.Version)
+		post.Link = &url
+	}
+	m.created = append(m.created, *post)
+	return post.Version, nil
+}
+func (m *mockBlogPostDataDB) ActivateVersion(ctx context.Context, username string, title string, version string) error {
+	if m.ActivateVersionFunc != nil {
+		return m.ActivateVersionFunc(ctx, username, title, version)
+	}
+	for i, post := range m.created {
+		m.created[i].IsActive = post.User == username && post.Title == title && post.Version == version
+	}
+	return nil
+}
 func (m *mockBlogPostDataDB) DeleteBlogPost(ctx context.Context, username string, title string) (int, error) {
+	m.deleted = append(m.deleted, title)
 	return 1, nil
 }
-func (m *mockBlogPostDataDB) UpdateActiveStatus(ctx context.Context, username string, title string, version string, isActive bool) error {
-	return nil
+func (m *mockBlogPostDataDB) DeleteBlogPostVersion(ctx context.Context, username, title, version string) (int, error) {
+	m.deleted = append(m.deleted, title+"/"+version)
+	return 1, nil
 }
 func (m *mockBlogPostDataDB) FetchAllUserBlogPosts(ctx context.Context, username string) ([]db.BlogPostVersionsData, error) {
 	return []db.BlogPostVersionsData{}, nil
 }
 func (m *mockBlogPostDataDB) FetchAllPostVersions(ctx context.Context, username, title string) (db.BlogPostVersionsData, error) {
+	if m.FetchAllPostVersionsFunc != nil {
+		return m.FetchAllPostVersionsFunc(ctx, username, title)
+	}
 	return db.BlogPostVersionsData{}, nil
 }
 func (m *mockBlogPostDataDB) FetchAllActiveBlogPosts(ctx context.Context, username string) ([]db.BlogPostData, error) {
-	return []db.BlogPostData{}, nil
+	blogs := []db.BlogPostData{}
+	for _, blog := range m.active {
+		if blog.User == username && blog.DeletedAt == nil {
+			blogs = append(blogs, blog)
+		}
+	}
+	return blogs, nil
 }
 func (m *mockBlogPostDataDB) FetchActiveBlog(ctx context.Context, username, title string) (string, error) {
 	if m.FetchActiveBlogFunc != nil {
@@ -89,6 +168,112 @@ func (m *mockBlogPostDataDB) FetchBlogPost(ctx context.Context, username, title,
 	}, nil
 }
 
+func (m *mockBlogPostDataDB) FetchAllAssetRefs(ctx context.Context) ([]string, error) {
+	return []string{}, nil
+}
+func (m *mockBlogPostDataDB) FetchPostSlug(ctx context.Context, username, title string) (string, error) {
+	for slug, existing := range m.slugs {
+		if existing == title {
+			return slug, nil
+		}
+	}
+	return "", nil
+}
+func (m *mockBlogPostDataDB) FetchTitleBySlug(ctx context.Context, username, slug string) (string, error) {
+	return m.slugs[slug], nil
+}
+func (m *mockBlogPostDataDB) FetchPostsWithoutSlug(ctx context.Context) ([]db.BlogPostData, error) {
+	return []db.BlogPostData{}, nil
+}
+func (m *mockBlogPostDataDB) SetPostSlug(ctx context.Context, username, title, version, slug, link string) error {
+	return nil
+}
+func (m *mockBlogPostDataDB) RenameBlogPost(ctx context.Context, username, title, newTitle, newSlug string, links map[string]string) (int, error) {
+	if m.RenameBlogPostFunc != nil {
+		return m.RenameBlogPostFunc(ctx, username, title, newTitle, newSlug, links)
+	}
+	return len(links), nil
+}
+func (m *mockBlogPostDataDB) FetchSlugByPreviousSlug(ctx context.Context, username, slug string) (string, error) {
+	return m.previousSlugs[slug], nil
+}
+func (m *mockBlogPostDataDB) SchedulePublish(ctx context.Context, username, title, version string, at *time.Time) error {
+	if m.SchedulePublishFunc != nil {
+		return m.SchedulePublishFunc(ctx, username, title, version, at)
+	}
+	return nil
+}
+func (m *mockBlogPostDataDB) FetchScheduledPublishes(ctx context.Context, username string) ([]db.BlogPostData, error) {
+	return m.scheduled, nil
+}
+func (m *mockBlogPostDataDB) FetchDuePublishes(ctx context.Context, now time.Time) ([]db.BlogPostData, error) {
+	return []db.BlogPostData{}, nil
+}
+func (m *mockBlogPostDataDB) FetchUserTags(ctx context.Context, username string) ([]db.TagCount, error) {
+	counts := []db.TagCount{}
+	for _, blog := range m.active {
+		if blog.User != username || !blog.Visibility.Listed() {
+			continue
+		}
+		for _, tag := range blog.Tags {
+			found := false
+			for i := range counts {
+				if counts[i].Tag == tag {
+					counts[i].Count++
+					found = true
+				}
+			}
+			if !found {
+				counts = append(counts, db.TagCount{Tag: tag, Count: 1})
+			}
+		}
+	}
+	return counts, nil
+}
+func (m *mockBlogPostDataDB) FetchActivePostsByTag(ctx context.Context, username, tag string) ([]db.BlogPostData, error) {
+	blogs := []db.BlogPostData{}
+	for _, blog := range m.active {
+		if (username != "" && blog.User != username) || !blog.Visibility.Listed() || !slices.Contains(blog.Tags, tag) {
+			continue
+		}
+		blogs = append(blogs, blog)
+	}
+	return blogs, nil
+}
+func (m *mockBlogPostDataDB) SetPostVisibility(ctx context.Context, username, title string, visibility db.Visibility) (int, error) {
+	if m.visibility == nil {
+		m.visibility = make(map[string]db.Visibility)
+	}
+	m.visibility[title] = visibility
+	return 1, nil
+}
+func (m *mockBlogPostDataDB) TrashBlogPost(ctx context.Context, username, title string, at *time.Time) (int, error) {
+	if m.trashed == nil {
+		m.trashed = make(map[string]*time.Time)
+	}
+	m.trashed[title] = at
+	return 1, nil
+}
+func (m *mockBlogPostDataDB) RevokePreviews(ctx context.Context, username, title string) (int, error) {
+	if m.revoked == nil {
+		m.revoked = make(map[string]int)
+	}
+	m.revoked[title]++
+	return 1, nil
+}
+func (m *mockBlogPostDataDB) FetchTrashedPosts(ctx context.Context, username string) ([]db.BlogPostData, error) {
+	blogs := []db.BlogPostData{}
+	for _, blog := range m.active {
+		if blog.User == username && blog.DeletedAt != nil {
+			blogs = append(blogs, blog)
+		}
+	}
+	return blogs, nil
+}
+func (m *mockBlogPostDataDB) FetchExpiredTrash(ctx context.Context, before time.Time) ([]db.BlogPostData, error) {
+	return []db.BlogPostData{}, nil
+}
+
 // MockAnalyticsDataDB
 type mockAnalyticsDataDB struct{}
 
@@ -109,12 +294,21 @@ func (m *mockAnalyticsDataDB) GetPostAnalytics(ctx context.Context, username, ti
 func (m *mockAnalyticsDataDB) IncrementViews(ctx context.Context, username, title, version string) error {
 	return nil
 }
+func (m *mockAnalyticsDataDB) RecordRead(ctx context.Context, username, title, version, reader string, since time.Time) error {
+	return nil
+}
 func (m *mockAnalyticsDataDB) ToggleLike(ctx context.Context, postUsername, title, version, likingUsername string) (bool, error) {
 	return true, nil
 }
 func (m *mockAnalyticsDataDB) DeletePostAnalytics(ctx context.Context, username, title string) (int, error) {
 	return 1, nil
 }
+func (m *mockAnalyticsDataDB) DeleteVersionAnalytics(ctx context.Context, username, title, version string) (int, error) {
+	return 1, nil
+}
+func (m *mockAnalyticsDataDB) RenamePostAnalytics(ctx context.Context, username, title, newTitle string) (int, error) {
+	return 1, nil
+}
 func (m *mockAnalyticsDataDB) GetAllPostTimeStamps(ctx context.Context, username string, active_posts []db.BlogPostData) ([]time.Time, error) {
 	return []time.Time{time.Now()}, nil
 }
@@ -124,3 +318,342 @@ func (m *mockAnalyticsDataDB) GetPostViewCount(ctx context.Context, username, ti
 func (m *mockAnalyticsDataDB) GetMostViewedPosts(ctx context.Context, limit int) ([]db.PostAnalytics, error) {
 	return []db.PostAnalytics{}, nil
 }
+
+// MockAssetDB
+type mockAssetDB struct {
+	assets map[string]*db.Asset
+	saves  int
+	// err fails every lookup
+	err error
+}
+
+// useTestAssetDB swaps in an empty asset db for the duration of the test.
+func useTestAssetDB(t *testing.T) *mockAssetDB {
+	t.Helper()
+	assets := &mockAssetDB{assets: make(map[string]*db.Asset)}
+	origAssetDB := assetDB
+	assetDB = assets
+	t.Cleanup(func() { assetDB = origAssetDB })
+	return assets
+}
+
+func (m *mockAssetDB) SaveAsset(ctx context.Context, asset *db.Asset) error {
+	if _, ok := m.assets[asset.Hash]; !ok {
+		m.saves++
+		m.assets[asset.Hash] = asset
+	}
+	m.assets[asset.Hash].LastUsedAt = time.Now()
+	return nil
+}
+func (m *mockAssetDB) GetAsset(ctx context.Context, hash string) (*db.Asset, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.assets[hash], nil
+}
+func (m *mockAssetDB) DeleteAsset(ctx context.Context, hash string) error {
+	delete(m.assets, hash)
+	return nil
+}
+
+// useTestBlobStore points the handlers at a local store in a temp dir for
+// the duration of the test.
+func useTestBlobStore(t *testing.T) *storage.LocalStore {
+	t.Helper()
+	store, err := storage.NewLocalStore(t.TempDir(), "https://blobs.mock")
+	if err != nil {
+		t.Fatalf("NewLocalStore failed: %v", err)
+	}
+	origBlobStore := blobStore
+	blobStore = store
+	t.Cleanup(func() { blobStore = origBlobStore })
+	return store
+}
+
+// failingDeleteStore is a blob store whose deletes fail.
+type failingDeleteStore struct {
+	storage.BlobStore
+}
+
+func (s failingDeleteStore) Delete(ctx context.Context, key string) error {
+	return errors.New("delete failed")
+}
+
+// failingPutStore is a blob store whose writes fail.
+type failingPutStore struct {
+	storage.BlobStore
+}
+
+func (s failingPutStore) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	return errors.New("put failed")
+}
+
+// testPNG encodes a w x h png. Different shades give different bytes, and so
+// different asset hashes.
+func testPNG(t *testing.T, w, h int, shade uint8) string {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: shade, G: uint8(x), B: uint8(y), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode failed: %v", err)
+	}
+	return buf.String()
+}
+
+// --- mockUsageDB ---
+type mockUsageDB struct {
+	usage map[string]*db.Usage
+}
+
+func (m *mockUsageDB) GetUsage(ctx context.Context, username string) (*db.Usage, error) {
+	usage, ok := m.usage[username]
+	if !ok {
+		return &db.Usage{Username: username}, nil
+	}
+	copied := *usage
+	return &copied, nil
+}
+func (m *mockUsageDB) AddUsage(ctx context.Context, username string, bytes int64, objects int64) error {
+	usage, ok := m.usage[username]
+	if !ok {
+		usage = &db.Usage{Username: username}
+		m.usage[username] = usage
+	}
+	usage.Bytes += bytes
+	usage.Objects += objects
+	return nil
+}
+func (m *mockUsageDB) ReserveUsage(ctx context.Context, username string, bytes int64, objects int64, quota db.Quota) (bool, error) {
+	usage, _ := m.GetUsage(ctx, username)
+	if usage.Quota != nil {
+		quota = *usage.Quota
+	}
+	if quota.Bytes > 0 && bytes > 0 && usage.Bytes+bytes > quota.Bytes ||
+		quota.Objects > 0 && objects > 0 && usage.Objects+objects > quota.Objects {
+		return false, nil
+	}
+	return true, m.AddUsage(ctx, username, bytes, objects)
+}
+func (m *mockUsageDB) SetQuota(ctx context.Context, username string, quota *db.Quota) error {
+	if _, ok := m.usage[username]; !ok {
+		m.usage[username] = &db.Usage{Username: username}
+	}
+	m.usage[username].Quota = quota
+	return nil
+}
+
+// useTestUsageDB enables quota accounting with the given default quota for
+// the duration of the test.
+func useTestUsageDB(t *testing.T, quota db.Quota) *mockUsageDB {
+	t.Helper()
+	usage := &mockUsageDB{usage: make(map[string]*db.Usage)}
+	origUsageDB, origQuota := usageDB, defaultQuota
+	usageDB, defaultQuota = usage, quota
+	t.Cleanup(func() { usageDB, defaultQuota = origUsageDB, origQuota })
+	return usage
+}
+
+// --- mockCollectionDB ---
+type mockCollectionDB struct {
+	collections []db.Collection
+}
+
+func (m *mockCollectionDB) CreateCollection(ctx context.Context, collection *db.Collection) error {
+	m.collections = append(m.collections, *collection)
+	return nil
+}
+func (m *mockCollectionDB) FetchCollection(ctx context.Context, username string, slug string) (*db.Collection, error) {
+	for _, collection := range m.collections {
+		if collection.User == username && collection.Slug == slug {
+			return &collection, nil
+		}
+	}
+	return nil, nil
+}
+func (m *mockCollectionDB) FetchUserCollections(ctx context.Context, username string) ([]db.Collection, error) {
+	collections := []db.Collection{}
+	for _, collection := range m.collections {
+		if collection.User == username {
+			collections = append(collections, collection)
+		}
+	}
+	return collections, nil
+}
+func (m *mockCollectionDB) UpdateCollection(ctx context.Context, collection *db.Collection) error {
+	for i, existing := range m.collections {
+		if existing.User == collection.User && existing.Slug == collection.Slug {
+			m.collections[i] = *collection
+		}
+	}
+	return nil
+}
+func (m *mockCollectionDB) DeleteCollection(ctx context.Context, username string, slug string) (bool, error) {
+	for i, collection := range m.collections {
+		if collection.User == username && collection.Slug == slug {
+			m.collections = append(m.collections[:i], m.collections[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func (m *mockCollectionDB) FetchCollectionsWithPost(ctx context.Context, username string, title string) ([]db.Collection, error) {
+	collections := []db.Collection{}
+	for _, collection := range m.collections {
+		if collection.User == username && slices.Contains(collection.Posts, title) {
+			collections = append(collections, collection)
+		}
+	}
+	return collections, nil
+}
+func (m *mockCollectionDB) RenamePostInCollections(ctx context.Context, username string, title string, newTitle string) error {
+	for _, collection := range m.collections {
+		if collection.User != username {
+			continue
+		}
+		for i, post := range collection.Posts {
+			if post == title {
+				collection.Posts[i] = newTitle
+			}
+		}
+	}
+	return nil
+}
+func (m *mockCollectionDB) RemovePostFromCollections(ctx context.Context, username string, title string) error {
+	for i, collection := range m.collections {
+		if collection.User == username {
+			m.collections[i].Posts = slices.DeleteFunc(slices.Clone(collection.Posts), func(post string) bool { return post == title })
+		}
+	}
+	return nil
+}
+
+// useTestCollectionDB enables collections for the duration of the test.
+func useTestCollectionDB(t *testing.T) *mockCollectionDB {
+	t.Helper()
+	collections := &mockCollectionDB{}
+	origCollectionDB := collectionDB
+	collectionDB = collections
+	t.Cleanup(func() { collectionDB = origCollectionDB })
+	return collections
+}
+
+// MockExperimentDB
+type mockExperimentDB struct {
+	experiments []db.Experiment
+}
+
+func (m *mockExperimentDB) SaveExperiment(ctx context.Context, experiment *db.Experiment) error {
+	for i, existing := range m.experiments {
+		if existing.User == experiment.User && existing.Title == experiment.Title {
+			m.experiments[i] = *experiment
+			return nil
+		}
+	}
+	m.experiments = append(m.experiments, *experiment)
+	return nil
+}
+func (m *mockExperimentDB) FetchExperiment(ctx context.Context, username string, title string) (*db.Experiment, error) {
+	for _, experiment := range m.experiments {
+		if experiment.User == username && experiment.Title == title {
+			return &experiment, nil
+		}
+	}
+	return nil, nil
+}
+func (m *mockExperimentDB) EndExperiment(ctx context.Context, username string, title string, at time.Time) (bool, error) {
+	for i, experiment := range m.experiments {
+		if experiment.User == username && experiment.Title == title && experiment.EndedAt == nil {
+			m.experiments[i].EndedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func (m *mockExperimentDB) DeleteExperiment(ctx context.Context, username string, title string) (bool, error) {
+	for i, experiment := range m.experiments {
+		if experiment.User == username && experiment.Title == title {
+			m.experiments = append(m.experiments[:i], m.experiments[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func (m *mockExperimentDB) RenameExperiment(ctx context.Context, username string, title string, newTitle string) error {
+	for i, experiment := range m.experiments {
+		if experiment.User == username && experiment.Title == title {
+			m.experiments[i].Title = newTitle
+		}
+	}
+	return nil
+}
+
+// useTestExperimentDB enables experiments for the duration of the test.
+func useTestExperimentDB(t *testing.T) *mockExperimentDB {
+	t.Helper()
+	experiments := &mockExperimentDB{}
+	origExperimentDB := experimentDB
+	experimentDB = experiments
+	t.Cleanup(func() { experimentDB = origExperimentDB })
+	return experiments
+}
+
+// MockThemeDB
+type mockThemeDB struct {
+	themes []db.Theme
+}
+
+func (m *mockThemeDB) SaveTheme(ctx context.Context, theme *db.Theme) error {
+	for i, existing := range m.themes {
+		if existing.User == theme.User && existing.Name == theme.Name {
+			m.themes[i] = *theme
+			return nil
+		}
+	}
+	m.themes = append(m.themes, *theme)
+	return nil
+}
+func (m *mockThemeDB) FetchTheme(ctx context.Context, username string, name string) (*db.Theme, error) {
+	for _, theme := range m.themes {
+		if theme.User == username && theme.Name == name {
+			return &theme, nil
+		}
+	}
+	return nil, nil
+}
+func (m *mockThemeDB) FetchUserThemes(ctx context.Context, username string) ([]db.Theme, error) {
+	themes := []db.Theme{}
+	for _, theme := range m.themes {
+		if theme.User == username {
+			themes = append(themes, theme)
+		}
+	}
+	return themes, nil
+}
+func (m *mockThemeDB) DeleteTheme(ctx context.Context, username string, name string) (bool, error) {
+	for i, theme := range m.themes {
+		if theme.User == username && theme.Name == name {
+			m.themes = append(m.themes[:i], m.themes[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// useTestThemeDB enables custom themes for the duration of the test.
+func useTestThemeDB(t *testing.T) *mockThemeDB {
+	t.Helper()
+	themes := &mockThemeDB{}
+	origThemeDB := themeDB
+	themeDB = themes
+	markdown_render.SetThemeDB(themes)
+	t.Cleanup(func() {
+		themeDB = origThemeDB
+		markdown_render.SetThemeDB(origThemeDB)
+	})
+	return themes
+}
@@ -1,16 +1,19 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"path/filepath"
-	"strings"
 
 	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/attachment"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/imageproc"
 )
 
+const profilePictureSize = 512
+
 type UpdateUserProfilePictureResponse struct {
 	URL string `json:"url"`
 }
@@ -35,38 +38,43 @@ func HandleUpdateUserProfilePicture(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// Validate file type
-	ext := strings.ToLower(filepath.Ext(handler.Filename))
-	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+	// Read file content
+	fileBytes, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	// Validate file type from its content
+	checked, err := attachment.Check(handler.Filename, fileBytes)
+	if err != nil || !checked.Raster {
 		http.Error(w, "Only JPG and PNG files are allowed", http.StatusBadRequest)
 		return
 	}
 
-	// Read file content
-	fileBytes, err := io.ReadAll(file)
+	// Re-encode without metadata, capped at the size the site displays
+	processed, err := imageproc.Process(fileBytes, imageproc.Options{MaxDimension: profilePictureSize})
 	if err != nil {
-		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		http.Error(w, "Invalid image", http.StatusBadRequest)
 		return
 	}
 
 	// Generate unique filename
-	filename := fmt.Sprintf("profile_pictures/%s%s", username, ext)
-	images := map[string][]byte{filename: fileBytes}
+	filename := fmt.Sprintf("profile_pictures/%s%s", username, processed.Ext)
 
-	// Upload to S3
-	s3Creds, err := LoadCredentials()
-	if err != nil {
-		http.Error(w, "Failed to load s3 credentials", http.StatusInternalServerError)
+	// Upload to storage
+	err = putUserObject(r.Context(), blobStore, username, filename, bytes.NewReader(processed.Data), int64(len(processed.Data)), processed.ContentType)
+	if writeQuotaError(w, err) {
 		return
 	}
-	urls, err := UploadImages(r.Context(), images, s3Creds)
 	if err != nil {
 		http.Error(w, "Failed to upload image", http.StatusInternalServerError)
 		return
 	}
+	url := blobStore.URL(filename)
 
 	// Update user's profile picture URL in database
-	err = userDB.UpdateUserProfilePicture(r.Context(), username, urls[filename])
+	err = userDB.UpdateUserProfilePicture(r.Context(), username, url)
 	if err != nil {
 		http.Error(w, "Failed to update user profile picture", http.StatusInternalServerError)
 		return
@@ -75,7 +83,7 @@ func HandleUpdateUserProfilePicture(w http.ResponseWriter, r *http.Request) {
 	// Return the URL in response
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(UpdateUserProfilePictureResponse{
-		URL: urls[filename],
+		URL: url,
 	})
 	if err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"context"
+	"image"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -11,20 +12,67 @@ import (
 	"testing"
 
 	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestHandleUpdateUserProfilePicture(t *testing.T) {
-	origLoadCredentials := LoadCredentials
-	origUploadImages := UploadImages
-	LoadCredentials = func() (S3Credentials, error) { return S3Credentials{}, nil }
-	UploadImages = func(ctx context.Context, images map[string][]byte, cred S3Credentials) (map[string]string, error) {
-		return map[string]string{"profile_pictures/testuser.png": "https://s3.mock/pfp.png"}, nil
+	useTestBlobStore(t)
+
+	userDB = &mockUserDB{}
+
+	var b bytes.Buffer
+	wr := multipart.NewWriter(&b)
+	fw, _ := wr.CreateFormFile("profile_picture", "testuser.png")
+	if _, err := io.Copy(fw, strings.NewReader(testPNG(t, 16, 16, 1))); err != nil {
+		t.Fatalf("io.Copy failed: %v", err)
+	}
+	wr.Close()
+
+	req := httptest.NewRequest("POST", "/pfp", &b)
+	req.Header.Set("Content-Type", wr.FormDataContentType())
+	ctx := context.WithValue(req.Context(), auth.UsernameKey, "testuser")
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	HandleUpdateUserProfilePicture(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "https://blobs.mock/profile_pictures/testuser.png")
+}
+
+func TestHandleUpdateUserProfilePicture_Resizes(t *testing.T) {
+	store := useTestBlobStore(t)
+
+	userDB = &mockUserDB{}
+
+	var b bytes.Buffer
+	wr := multipart.NewWriter(&b)
+	fw, _ := wr.CreateFormFile("profile_picture", "testuser.png")
+	if _, err := io.Copy(fw, strings.NewReader(testPNG(t, 1024, 768, 1))); err != nil {
+		t.Fatalf("io.Copy failed: %v", err)
 	}
-	defer func() {
-		LoadCredentials = origLoadCredentials
-		UploadImages = origUploadImages
-	}()
+	wr.Close()
+
+	req := httptest.NewRequest("POST", "/pfp", &b)
+	req.Header.Set("Content-Type", wr.FormDataContentType())
+	ctx := context.WithValue(req.Context(), auth.UsernameKey, "testuser")
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	HandleUpdateUserProfilePicture(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	stored, err := storage.ReadString(context.Background(), store, "profile_pictures/testuser.png")
+	assert.NoError(t, err)
+	cfg, _, err := image.DecodeConfig(strings.NewReader(stored))
+	assert.NoError(t, err)
+	assert.Equal(t, profilePictureSize, cfg.Width)
+	assert.Equal(t, 384, cfg.Height)
+}
+
+func TestHandleUpdateUserProfilePicture_InvalidImage(t *testing.T) {
+	useTestBlobStore(t)
 
 	userDB = &mockUserDB{}
 
@@ -44,6 +92,5 @@ func TestHandleUpdateUserProfilePicture(t *testing.T) {
 
 	HandleUpdateUserProfilePicture(rr, req)
 
-	assert.Equal(t, http.StatusOK, rr.Code)
-	assert.Contains(t, rr.Body.String(), "https://s3.mock/pfp.png")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
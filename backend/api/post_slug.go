@@ -0,0 +1,29 @@
+package api
+
+import (
+	"context"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
+)
+
+// postSlug returns the slug of an existing post, or picks one no other post of
+// username uses for a new post. Titles can change their characters freely
+// since the slug is only derived once. A new post is based on requested when
+// it is set, e.g. by the front matter.
+func postSlug(ctx context.Context, username string, title string, requested string) (string, error) {
+	existing, err := blogPostDataDB.FetchPostSlug(ctx, username, title)
+	if err != nil {
+		return "", err
+	}
+	if existing != "" {
+		return existing, nil
+	}
+	base := slug.Make(title)
+	if requested != "" {
+		base = slug.Make(requested)
+	}
+	return slug.Unique(base, func(candidate string) (bool, error) {
+		owner, err := blogPostDataDB.FetchTitleBySlug(ctx, username, candidate)
+		return owner != "", err
+	})
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/db/redisdb"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
+)
+
+// keepVersions is how many of the newest versions of a post are kept when a
+// new one is uploaded, 0 keeps them all.
+var keepVersions int
+
+func SetKeepVersions(keep int) {
+	keepVersions = keep
+}
+
+// createPostVersion stores the html and markdown of post under the next
+// version of the post and makes it the active version. The version is stored
+// inactive first, which reserves its number and file keys, and only
+// activated once its files are written. A failed upload removes what it
+// stored again, so the post stays as it was.
+func createPostVersion(ctx context.Context, post *db.BlogPostData, htmlContent string, mdContent []byte) (string, error) {
+	version, err := blogPostDataDB.CreateNextVersion(ctx, post, func(version string) string {
+		return blobStore.URL(slug.Key(post.User, post.Slug, version, ".html"))
+	})
+	if err != nil {
+		return "", err
+	}
+
+	keyname := slug.Key(post.User, post.Slug, version, ".html")
+	md_keyname := slug.Key(post.User, post.Slug, version, ".md")
+	err = putUserObject(ctx, blobStore, post.User, keyname, strings.NewReader(htmlContent), int64(len(htmlContent)), "text/html")
+	if err != nil {
+		err = fmt.Errorf("failed to upload html file: %w", err)
+	} else {
+		err = putUserObject(ctx, blobStore, post.User, md_keyname, bytes.NewReader(mdContent), int64(len(mdContent)), "text/markdown")
+		if err != nil {
+			err = fmt.Errorf("failed to upload md file: %w", err)
+		}
+	}
+	if err == nil {
+		err = blogPostDataDB.ActivateVersion(ctx, post.User, post.Title, version)
+		if err != nil {
+			err = fmt.Errorf("failed to activate version %s: %w", version, err)
+		}
+	}
+	if err != nil {
+		// the version is still inactive, so it can go like any other
+		if cleanupErr := deletePostVersion(ctx, *post); cleanupErr != nil {
+			fmt.Printf("failed to remove version %s of %s/%s after a failed upload: %v\n", version, post.User, post.Title, cleanupErr)
+		}
+		return "", err
+	}
+	post.IsActive = true
+
+	if keepVersions > 0 {
+		// the upload went through either way, a failed prune is retried on
+		// the next one
+		_, err = pruneVersions(ctx, post.User, post.Title, keepVersions)
+		if err != nil {
+			fmt.Printf("failed to prune versions of %s/%s: %v\n", post.User, post.Title, err)
+		}
+	}
+	return version, nil
+}
+
+// deletePostVersion deletes an inactive version with its analytics and files.
+// The files go first and the version last, so a failed delete leaves the
+// version listed and deleting it again finishes the job.
+func deletePostVersion(ctx context.Context, post db.BlogPostData) error {
+	if post.IsActive {
+		return fmt.Errorf("version %s is active", post.Version)
+	}
+
+	// deleting a file that is already gone is not an error
+	for _, ext := range []string{".html", ".md"} {
+		err := deleteUserObject(ctx, blobStore, post.User, slug.Key(post.User, post.Slug, post.Version, ext))
+		if err != nil {
+			return fmt.Errorf("failed to delete %s file of version %s: %w", ext, post.Version, err)
+		}
+	}
+
+	_, err := AnalyticsDataDB.DeleteVersionAnalytics(ctx, post.User, post.Title, post.Version)
+	if err != nil {
+		return fmt.Errorf("failed to delete analytics of version %s: %w", post.Version, err)
+	}
+
+	deleted, err := blogPostDataDB.DeleteBlogPostVersion(ctx, post.User, post.Title, post.Version)
+	if err != nil {
+		return fmt.Errorf("failed to delete version %s: %w", post.Version, err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("version %s is active or gone", post.Version)
+	}
+
+	// the message of the version may be in the cached revision history
+	if redisdb.RedisActive {
+		err = redisdb.DeleteEndpoint(ctx, slug.Path(post.User, post.Slug))
+		if err != nil {
+			fmt.Printf("Error removing old endpoint from redis")
+		}
+	}
+	return nil
+}
+
+// pruneVersions deletes all but the keep newest versions of a post and
+// returns the deleted version numbers. The active version, scheduled ones and
+// those in a running experiment are always kept.
+func pruneVersions(ctx context.Context, username string, title string, keep int) ([]string, error) {
+	postVersions, err := blogPostDataDB.FetchAllPostVersions(ctx, username, title)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch post versions: %w", err)
+	}
+
+	versions := slices.Clone(postVersions.Versions)
+	slices.SortFunc(versions, func(a, b db.BlogPostData) int {
+		va, _ := strconv.Atoi(a.Version)
+		vb, _ := strconv.Atoi(b.Version)
+		return vb - va
+	})
+
+	experiment, err := runningExperiment(ctx, username, title)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch experiment: %w", err)
+	}
+
+	deleted := []string{}
+	for i, post := range versions {
+		if i < keep || post.IsActive || post.PublishAt != nil {
+			continue
+		}
+		if experiment != nil && (post.Version == experiment.VersionA || post.Version == experiment.VersionB) {
+			continue
+		}
+		err = deletePostVersion(ctx, post)
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, post.Version)
+	}
+	return deleted, nil
+}
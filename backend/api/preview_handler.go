@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/markdown_render"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/preview"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
+)
+
+const (
+	defaultPreviewHours = 72
+	maxPreviewHours     = 30 * 24
+)
+
+// previewSecret signs preview links, changing it revokes all of them.
+var previewSecret []byte
+
+func SetPreviewSecret(secret []byte) {
+	previewSecret = secret
+}
+
+type PreviewRequest struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+	// Hours until the link expires, 72 when left out.
+	Hours int `json:"hours,omitempty"`
+}
+
+type PreviewResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// HandleCreatePreview hands out a signed link to any version of one of the
+// user's posts, published or not.
+func HandleCreatePreview(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req PreviewRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+	if req.Hours == 0 {
+		req.Hours = defaultPreviewHours
+	}
+	if req.Hours < 0 || req.Hours > maxPreviewHours {
+		http.Error(w, fmt.Sprintf("Hours must be between 1 and %d", maxPreviewHours), http.StatusBadRequest)
+		return
+	}
+
+	postVersions, err := blogPostDataDB.FetchAllPostVersions(r.Context(), username, req.Title)
+	if err != nil {
+		http.Error(w, "Failed to fetch post versions", http.StatusInternalServerError)
+		return
+	}
+	if inTrash(postVersions.Versions) {
+		http.Error(w, "Post is in the trash, restore it first", http.StatusConflict)
+		return
+	}
+	for _, post := range postVersions.Versions {
+		if post.Version != req.Version {
+			continue
+		}
+		expires := time.Now().Add(time.Duration(req.Hours) * time.Hour).UTC().Truncate(time.Second)
+		token, err := preview.Sign(previewSecret, preview.Link{
+			User:     username,
+			Title:    req.Title,
+			Version:  post.Version,
+			Uploaded: post.DateUploaded.UnixNano(),
+			Epoch:    post.PreviewEpoch,
+			Expires:  expires,
+		})
+		if err != nil {
+			http.Error(w, "Failed to sign preview link", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(PreviewResponse{URL: "/preview/" + token, ExpiresAt: expires})
+		if err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+	http.Error(w, "No such version exists", http.StatusNotFound)
+}
+
+type RevokePreviewsRequest struct {
+	Title string `json:"title"`
+}
+
+func HandleRevokePreviews(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req RevokePreviewsRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+
+	revoked, err := blogPostDataDB.RevokePreviews(r.Context(), username, req.Title)
+	if err != nil {
+		http.Error(w, "Failed to revoke preview links", http.StatusInternalServerError)
+		return
+	}
+	if revoked == 0 {
+		http.Error(w, "No such Blog Post exists", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleFetchPreview renders the version a preview link points at. Previews
+// are kept out of search engines, the redis cache and the view counts.
+func HandleFetchPreview(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+	w.Header().Set("Cache-Control", "private, no-store")
+	// the token is the only thing guarding the page, keep it out of referers
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	link, err := preview.Verify(previewSecret, chi.URLParam(r, "token"), time.Now())
+	if errors.Is(err, preview.ErrExpired) {
+		http.Error(w, "This preview link has expired", http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, "No such preview exists", http.StatusNotFound)
+		return
+	}
+
+	b_p, err := blogPostDataDB.FetchBlogPost(r.Context(), link.User, link.Title, link.Version)
+	if err != nil || b_p.DeletedAt != nil || b_p.PreviewEpoch != link.Epoch || b_p.DateUploaded.UnixNano() != link.Uploaded {
+		http.Error(w, "No such preview exists", http.StatusNotFound)
+		return
+	}
+
+	htmlContent, err := storage.ReadString(r.Context(), blobStore, slug.Key(link.User, b_p.Slug, b_p.Version, ".html"))
+	if err != nil {
+		http.Error(w, "Failed to read HTML file", http.StatusInternalServerError)
+		return
+	}
+	user_details, err := userDB.GetUser(r.Context(), link.User)
+	if err != nil || user_details == nil {
+		http.Error(w, "Failed to get user details", http.StatusInternalServerError)
+		return
+	}
+	page := markdown_render.PostPage(b_p, user_details, htmlContent)
+	page.SEO.NoIndex = true
+	htmlContent, err = markdown_render.RenderUserPage(r.Context(), user_details.Style, page)
+	if err != nil {
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	_, err = w.Write([]byte(htmlContent))
+	if err != nil {
+		http.Error(w, "Failed to write HTML content", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/preview"
+	"github.com/stretchr/testify/assert"
+)
+
+// viewCountingAnalyticsDB counts views to check previews leave them alone.
+type viewCountingAnalyticsDB struct {
+	mockAnalyticsDataDB
+	views int
+}
+
+func (m *viewCountingAnalyticsDB) IncrementViews(ctx context.Context, username, title, version string) error {
+	m.views++
+	return nil
+}
+
+func usePreviewSecret(t *testing.T) {
+	t.Helper()
+	orig := previewSecret
+	SetPreviewSecret([]byte("test secret"))
+	t.Cleanup(func() { previewSecret = orig })
+}
+
+func fetchPreview(token string) *httptest.ResponseRecorder {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("token", token)
+	req := httptest.NewRequest("GET", "/preview/"+token, nil)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	rr := httptest.NewRecorder()
+	HandleFetchPreview(rr, req)
+	return rr
+}
+
+// previewPosts serves the versions of manyVersions, with epoch as their
+// preview epoch.
+func previewPosts(epoch *int) *mockBlogPostDataDB {
+	return &mockBlogPostDataDB{
+		FetchAllPostVersionsFunc: func(ctx context.Context, username, title string) (db.BlogPostVersionsData, error) {
+			versions, err := manyVersions(ctx, username, title)
+			for i := range versions.Versions {
+				versions.Versions[i].PreviewEpoch = *epoch
+			}
+			return versions, err
+		},
+		FetchBlogPostFunc: func(ctx context.Context, username, title, version string) (db.BlogPostData, error) {
+			versions, _ := manyVersions(ctx, username, title)
+			for _, post := range versions.Versions {
+				if post.Version == version {
+					post.PreviewEpoch = *epoch
+					return post, nil
+				}
+			}
+			return db.BlogPostData{}, assert.AnError
+		},
+	}
+}
+
+func TestHandlePreview(t *testing.T) {
+	usePreviewSecret(t)
+	store := useTestBlobStore(t)
+	err := store.Put(context.Background(), "testuser_test-post_5.html", strings.NewReader("<p>Version five</p>"), "text/html")
+	if err != nil {
+		t.Fatalf("store.Put failed: %v", err)
+	}
+	epoch := 0
+	blogPostDataDB = previewPosts(&epoch)
+	userDB = &mockUserDB{}
+	analytics := &viewCountingAnalyticsDB{}
+	AnalyticsDataDB = analytics
+
+	rr := httptest.NewRecorder()
+	HandleCreatePreview(rr, withUser(httptest.NewRequest("POST", "/post/preview", strings.NewReader(`{"title":"Test Post","version":"5","hours":1}`))))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp PreviewResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.True(t, strings.HasPrefix(resp.URL, "/preview/"))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), resp.ExpiresAt, time.Minute)
+
+	rr = fetchPreview(strings.TrimPrefix(resp.URL, "/preview/"))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Version five")
+	assert.Equal(t, "noindex, nofollow", rr.Header().Get("X-Robots-Tag"))
+	assert.Equal(t, 0, analytics.views)
+
+	// revoking bumps the epoch, which the old link no longer matches
+	rr = httptest.NewRecorder()
+	HandleRevokePreviews(rr, withUser(httptest.NewRequest("POST", "/post/preview/revoke", strings.NewReader(`{"title":"Test Post"}`))))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	epoch++
+	rr = fetchPreview(strings.TrimPrefix(resp.URL, "/preview/"))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHandleFetchPreview_Invalid(t *testing.T) {
+	usePreviewSecret(t)
+	epoch := 0
+	blogPostDataDB = previewPosts(&epoch)
+
+	expired, err := preview.Sign(previewSecret, preview.Link{User: "testuser", Title: "Test Post", Version: "5", Expires: time.Now().Add(-time.Minute)})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusGone, fetchPreview(expired).Code)
+
+	// signed, but for a version uploaded at another time
+	stale, err := preview.Sign(previewSecret, preview.Link{User: "testuser", Title: "Test Post", Version: "5", Uploaded: 1, Expires: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, fetchPreview(stale).Code)
+
+	assert.Equal(t, http.StatusNotFound, fetchPreview("not-a-token").Code)
+}
+
+func TestHandleCreatePreview_Invalid(t *testing.T) {
+	usePreviewSecret(t)
+	epoch := 0
+	blogPostDataDB = previewPosts(&epoch)
+
+	for _, tc := range []struct {
+		body string
+		code int
+	}{
+		{`{"title":"Test Post","version":"9"}`, http.StatusNotFound},
+		{`{"title":"Test Post","version":"5","hours":100000}`, http.StatusBadRequest},
+	} {
+		rr := httptest.NewRecorder()
+		HandleCreatePreview(rr, withUser(httptest.NewRequest("POST", "/post/preview", strings.NewReader(tc.body))))
+		assert.Equal(t, tc.code, rr.Code, tc.body)
+	}
+}
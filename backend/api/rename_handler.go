@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db/redisdb"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
+)
+
+type RenameRequest struct {
+	Title    string `json:"title"`
+	NewTitle string `json:"new_title"`
+}
+
+type RenameResponse struct {
+	Title      string `json:"title"`
+	Slug       string `json:"slug"`
+	DirectLink string `json:"direct_link"`
+}
+
+// HandleRenamePost gives a post a new title and slug. Its versions, analytics
+// and files move along, and the old url redirects to the new one.
+func HandleRenamePost(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req RenameRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+	req.NewTitle = strings.TrimSpace(req.NewTitle)
+	if req.Title == "" || req.NewTitle == "" {
+		http.Error(w, "Invalid title", http.StatusBadRequest)
+		return
+	}
+	if strings.ContainsAny(req.NewTitle, `\/:*?"<>|`) {
+		http.Error(w, "Title contains invalid characters", http.StatusBadRequest)
+		return
+	}
+
+	postVersions, err := blogPostDataDB.FetchAllPostVersions(r.Context(), username, req.Title)
+	if err != nil {
+		http.Error(w, "Failed to fetch post versions", http.StatusInternalServerError)
+		return
+	}
+	if len(postVersions.Versions) == 0 {
+		http.Error(w, "No such Blog Post exists", http.StatusNotFound)
+		return
+	}
+	if inTrash(postVersions.Versions) {
+		http.Error(w, "Post is in the trash, restore it first", http.StatusConflict)
+		return
+	}
+	old_slug := postVersions.Versions[0].Slug
+
+	if req.NewTitle != req.Title {
+		taken, err := blogPostDataDB.FetchPostSlug(r.Context(), username, req.NewTitle)
+		if err != nil {
+			http.Error(w, "Failed to fetch blog post", http.StatusInternalServerError)
+			return
+		}
+		if taken != "" {
+			http.Error(w, "A post with that title already exists", http.StatusConflict)
+			return
+		}
+	}
+
+	// the post may keep its slug, e.g. when only the case of the title changes
+	new_slug, err := slug.Unique(slug.Make(req.NewTitle), func(candidate string) (bool, error) {
+		owner, err := blogPostDataDB.FetchTitleBySlug(r.Context(), username, candidate)
+		return owner != "" && owner != req.Title, err
+	})
+	if err != nil {
+		http.Error(w, "Failed to pick post slug", http.StatusInternalServerError)
+		return
+	}
+
+	links := make(map[string]string, len(postVersions.Versions))
+	moved := make([]string, 0, 2*len(postVersions.Versions))
+	copied := make([]string, 0, 2*len(postVersions.Versions))
+	for _, post := range postVersions.Versions {
+		links[post.Version] = blobStore.URL(slug.Key(username, new_slug, post.Version, ".html"))
+		if new_slug == old_slug {
+			continue
+		}
+		for _, ext := range []string{".html", ".md"} {
+			from := slug.Key(username, old_slug, post.Version, ext)
+			to := slug.Key(username, new_slug, post.Version, ext)
+			err = copyPostObject(r.Context(), from, to)
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				http.Error(w, "Failed to move post files", http.StatusInternalServerError)
+				fmt.Println(err)
+				return
+			}
+			moved = append(moved, from)
+			copied = append(copied, to)
+		}
+	}
+
+	_, err = blogPostDataDB.RenameBlogPost(r.Context(), username, req.Title, req.NewTitle, new_slug, links)
+	if err != nil {
+		for _, key := range copied {
+			_ = blobStore.Delete(r.Context(), key)
+		}
+		http.Error(w, "Failed to rename blog post", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = AnalyticsDataDB.RenamePostAnalytics(r.Context(), username, req.Title, req.NewTitle)
+	if err != nil {
+		fmt.Printf("failed to rename analytics of %s: %v\n", req.Title, err)
+		// the post is renamed back so it stays with its analytics, the copies
+		// go only once nothing points at them
+		_, err = AnalyticsDataDB.RenamePostAnalytics(r.Context(), username, req.NewTitle, req.Title)
+		if err != nil {
+			fmt.Printf("failed to rename analytics of %s back: %v\n", req.NewTitle, err)
+		}
+		old_links := make(map[string]string, len(postVersions.Versions))
+		for _, post := range postVersions.Versions {
+			if post.Link != nil {
+				old_links[post.Version] = *post.Link
+			}
+		}
+		_, err = blogPostDataDB.RenameBlogPost(r.Context(), username, req.NewTitle, req.Title, old_slug, old_links)
+		if err != nil {
+			fmt.Printf("failed to rename %s back to %s: %v\n", req.NewTitle, req.Title, err)
+		} else {
+			for _, key := range copied {
+				_ = blobStore.Delete(r.Context(), key)
+			}
+		}
+		http.Error(w, "Failed to rename post analytics", http.StatusInternalServerError)
+		return
+	}
+	renamePostInCollections(r.Context(), username, req.Title, req.NewTitle)
+	if experimentDB != nil {
+		err = experimentDB.RenameExperiment(r.Context(), username, req.Title, req.NewTitle)
+		if err != nil {
+			fmt.Printf("failed to rename experiment of %s: %v\n", req.Title, err)
+		}
+	}
+
+	// the post points at the new keys by now, so a failure here only leaves
+	// an unused copy behind
+	for _, key := range moved {
+		err = blobStore.Delete(r.Context(), key)
+		if err != nil {
+			fmt.Printf("failed to delete %s after rename: %v\n", key, err)
+		}
+	}
+
+	if redisdb.RedisActive {
+		for _, endpoint := range []string{slug.Path(username, old_slug), slug.Path(username, new_slug)} {
+			err = redisdb.DeleteEndpoint(r.Context(), endpoint)
+			if err != nil {
+				fmt.Printf("Error removing old endpoint from redis")
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(RenameResponse{
+		Title:      req.NewTitle,
+		Slug:       new_slug,
+		DirectLink: slug.Path(username, new_slug),
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// copyPostObject stores a copy of a post file under a new key. Moving a file
+// does not change what its owner stores, so usage is left alone.
+func copyPostObject(ctx context.Context, from string, to string) error {
+	body, err := blobStore.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	contentType := "text/html"
+	if strings.HasSuffix(from, ".md") {
+		contentType = "text/markdown"
+	}
+	return blobStore.Put(ctx, to, body, contentType)
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func renameRequest(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/post/rename", strings.NewReader(body))
+	req = req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, "testuser"))
+	rr := httptest.NewRecorder()
+	HandleRenamePost(rr, req)
+	return rr
+}
+
+func oldPostVersions(ctx context.Context, username, title string) (db.BlogPostVersionsData, error) {
+	if title != "Old Title" {
+		return db.BlogPostVersionsData{}, nil
+	}
+	return db.BlogPostVersionsData{
+		User:  username,
+		Title: title,
+		Versions: []db.BlogPostData{
+			{User: username, Title: title, Slug: "old-title", Version: "1"},
+			{User: username, Title: title, Slug: "old-title", Version: "2"},
+		},
+	}, nil
+}
+
+func TestHandleRenamePost(t *testing.T) {
+	ctx := context.Background()
+	store := useTestBlobStore(t)
+	for _, key := range []string{"testuser_old-title_1.html", "testuser_old-title_1.md", "testuser_old-title_2.html", "testuser_old-title_2.md"} {
+		assert.NoError(t, store.Put(ctx, key, strings.NewReader(key), "text/plain"))
+	}
+
+	var renamedTo, renamedSlug string
+	var renamedLinks map[string]string
+	blogPostDataDB = &mockBlogPostDataDB{
+		slugs:                    map[string]string{"old-title": "Old Title"},
+		FetchAllPostVersionsFunc: oldPostVersions,
+		RenameBlogPostFunc: func(ctx context.Context, username, title, newTitle, newSlug string, links map[string]string) (int, error) {
+			renamedTo, renamedSlug, renamedLinks = newTitle, newSlug, links
+			return len(links), nil
+		},
+	}
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	rr := renameRequest(t, `{"title":"Old Title","new_title":"Brand New_Title"}`)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp RenameResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, RenameResponse{Title: "Brand New_Title", Slug: "brand-new-title", DirectLink: "/testuser/brand-new-title"}, resp)
+	assert.Equal(t, "Brand New_Title", renamedTo)
+	assert.Equal(t, "brand-new-title", renamedSlug)
+	assert.Equal(t, "https://blobs.mock/testuser_brand-new-title_2.html", renamedLinks["2"])
+
+	md, err := storage.ReadString(ctx, store, "testuser_brand-new-title_1.md")
+	assert.NoError(t, err)
+	assert.Equal(t, "testuser_old-title_1.md", md)
+	_, err = store.Stat(ctx, "testuser_old-title_2.html")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestHandleRenamePost_Rejects(t *testing.T) {
+	useTestBlobStore(t)
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+	blogPostDataDB = &mockBlogPostDataDB{
+		slugs:                    map[string]string{"old-title": "Old Title", "taken": "Taken"},
+		FetchAllPostVersionsFunc: oldPostVersions,
+	}
+
+	for _, tc := range []struct {
+		body string
+		code int
+	}{
+		{`{"title":"Old Title","new_title":""}`, http.StatusBadRequest},
+		{`{"title":"Old Title","new_title":"a/b"}`, http.StatusBadRequest},
+		{`{"title":"Missing","new_title":"New"}`, http.StatusNotFound},
+		{`{"title":"Old Title","new_title":"Taken"}`, http.StatusConflict},
+	} {
+		rr := renameRequest(t, tc.body)
+		assert.Equal(t, tc.code, rr.Code, tc.body)
+	}
+}
+
+func TestHandleRenamePost_FailedRenameRemovesCopies(t *testing.T) {
+	ctx := context.Background()
+	store := useTestBlobStore(t)
+	assert.NoError(t, store.Put(ctx, "testuser_old-title_1.html", strings.NewReader("v1"), "text/html"))
+
+	blogPostDataDB = &mockBlogPostDataDB{
+		slugs:                    map[string]string{"old-title": "Old Title"},
+		FetchAllPostVersionsFunc: oldPostVersions,
+		RenameBlogPostFunc: func(ctx context.Context, username, title, newTitle, newSlug string, links map[string]string) (int, error) {
+			return 0, assert.AnError
+		},
+	}
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	rr := renameRequest(t, `{"title":"Old Title","new_title":"New"}`)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	_, err := store.Stat(ctx, "testuser_old-title_1.html")
+	assert.NoError(t, err)
+	_, err = store.Stat(ctx, "testuser_new_1.html")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestHandleFetchBlogPost_RedirectsRenamedPost(t *testing.T) {
+	useTestBlobStore(t)
+	blogPostDataDB = &mockBlogPostDataDB{
+		slugs:         map[string]string{"new-title": "New Title"},
+		previousSlugs: map[string]string{"old-title": "new-title"},
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("username", "testuser")
+	rctx.URLParams.Add("post", "old-title")
+	req := httptest.NewRequest("GET", "/testuser/old-title", nil)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	rr := httptest.NewRecorder()
+
+	HandleFetchBlogPost(rr, req)
+
+	assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+	assert.Equal(t, "/testuser/new-title", rr.Header().Get("Location"))
+}
+
+// failingRenameAnalyticsDB fails to rename analytics to any title but
+// "Old Title".
+type failingRenameAnalyticsDB struct {
+	mockAnalyticsDataDB
+	renames []string
+}
+
+func (m *failingRenameAnalyticsDB) RenamePostAnalytics(ctx context.Context, username, title, newTitle string) (int, error) {
+	m.renames = append(m.renames, title+" -> "+newTitle)
+	if newTitle != "Old Title" {
+		return 0, assert.AnError
+	}
+	return 1, nil
+}
+
+func TestHandleRenamePost_FailedAnalyticsRenameRenamesBack(t *testing.T) {
+	ctx := context.Background()
+	store := useTestBlobStore(t)
+	assert.NoError(t, store.Put(ctx, "testuser_old-title_1.html", strings.NewReader("v1"), "text/html"))
+
+	var renames []string
+	blogPostDataDB = &mockBlogPostDataDB{
+		slugs:                    map[string]string{"old-title": "Old Title"},
+		FetchAllPostVersionsFunc: oldPostVersions,
+		RenameBlogPostFunc: func(ctx context.Context, username, title, newTitle, newSlug string, links map[string]string) (int, error) {
+			renames = append(renames, title+" -> "+newTitle+" at "+newSlug)
+			return len(links), nil
+		},
+	}
+	analytics := &failingRenameAnalyticsDB{}
+	AnalyticsDataDB = analytics
+
+	rr := renameRequest(t, `{"title":"Old Title","new_title":"New"}`)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, []string{"Old Title -> New at new", "New -> Old Title at old-title"}, renames)
+	assert.Equal(t, []string{"Old Title -> New", "New -> Old Title"}, analytics.renames)
+	_, err := store.Stat(ctx, "testuser_old-title_1.html")
+	assert.NoError(t, err)
+	_, err = store.Stat(ctx, "testuser_new_1.html")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
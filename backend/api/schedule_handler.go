@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+)
+
+type ScheduledPublish struct {
+	Title      string    `json:"title"`
+	Version    string    `json:"version"`
+	PublishAt  time.Time `json:"publish_at"`
+	DirectLink string    `json:"direct_link,omitempty"`
+}
+
+// schedulePublish records when a version should go live. The scheduler picks
+// it up from the database, so pending versions survive restarts. Posts in the
+// trash cannot be scheduled.
+func schedulePublish(w http.ResponseWriter, r *http.Request, req PublishPostVersion) {
+	publish_at := req.PublishAt.UTC()
+	if !publish_at.After(time.Now()) {
+		http.Error(w, "publish_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	postVersions, err := blogPostDataDB.FetchAllPostVersions(r.Context(), req.Username, req.Title)
+	if err != nil {
+		http.Error(w, "Failed to fetch post versions", http.StatusInternalServerError)
+		return
+	}
+	if inTrash(postVersions.Versions) {
+		http.Error(w, "Post is in the trash, restore it first", http.StatusConflict)
+		return
+	}
+
+	_, err = blogPostDataDB.FetchBlogPost(r.Context(), req.Username, req.Title, req.Version)
+	if err != nil {
+		http.Error(w, "No such Blog Post exists", http.StatusNotFound)
+		return
+	}
+
+	err = blogPostDataDB.SchedulePublish(r.Context(), req.Username, req.Title, req.Version, &publish_at)
+	if err != nil {
+		http.Error(w, "Failed to schedule version", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(ScheduledPublish{
+		Title:     req.Title,
+		Version:   req.Version,
+		PublishAt: publish_at,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func HandleFetchScheduledPublishes(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	posts, err := blogPostDataDB.FetchScheduledPublishes(r.Context(), username)
+	if err != nil {
+		http.Error(w, "Failed to fetch scheduled versions", http.StatusInternalServerError)
+		return
+	}
+
+	scheduled := make([]ScheduledPublish, 0, len(posts))
+	for _, post := range posts {
+		if post.PublishAt == nil {
+			continue
+		}
+		entry := ScheduledPublish{Title: post.Title, Version: post.Version, PublishAt: *post.PublishAt}
+		if post.DirectLink != nil {
+			entry.DirectLink = *post.DirectLink
+		}
+		scheduled = append(scheduled, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(scheduled)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+type CancelScheduleRequest struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+func HandleCancelScheduledPublish(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req CancelScheduleRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+
+	post, err := blogPostDataDB.FetchBlogPost(r.Context(), username, req.Title, req.Version)
+	if err != nil || post.PublishAt == nil {
+		http.Error(w, "No scheduled publish for this version", http.StatusNotFound)
+		return
+	}
+
+	err = blogPostDataDB.SchedulePublish(r.Context(), username, req.Title, req.Version, nil)
+	if err != nil {
+		http.Error(w, "Failed to cancel scheduled publish", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
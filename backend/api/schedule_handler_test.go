@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func withUser(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, "testuser"))
+}
+
+func TestHandlePublishPostVersion_Schedules(t *testing.T) {
+	var scheduledAt *time.Time
+	blogPostDataDB = &mockBlogPostDataDB{
+		SchedulePublishFunc: func(ctx context.Context, username, title, version string, at *time.Time) error {
+			scheduledAt = at
+			return nil
+		},
+	}
+	publishAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	body := fmt.Sprintf(`{"username":"testuser","title":"Test Title","version":"2","publish_at":%q}`, publishAt.Format(time.RFC3339))
+	rr := httptest.NewRecorder()
+	HandlePublishPostVersion(rr, withUser(httptest.NewRequest("POST", "/publish", strings.NewReader(body))))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	if assert.NotNil(t, scheduledAt) {
+		assert.True(t, publishAt.Equal(*scheduledAt))
+	}
+	var resp ScheduledPublish
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, "2", resp.Version)
+}
+
+func TestHandlePublishPostVersion_RejectsPastSchedule(t *testing.T) {
+	blogPostDataDB = &mockBlogPostDataDB{}
+	body := `{"username":"testuser","title":"Test Title","version":"2","publish_at":"2001-01-01T00:00:00Z"}`
+	rr := httptest.NewRecorder()
+	HandlePublishPostVersion(rr, withUser(httptest.NewRequest("POST", "/publish", strings.NewReader(body))))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestHandlePublishPostVersion_ScheduleTrashed(t *testing.T) {
+	scheduled := false
+	blogPostDataDB = &mockBlogPostDataDB{
+		FetchAllPostVersionsFunc: trashedVersions(time.Now()),
+		SchedulePublishFunc: func(ctx context.Context, username, title, version string, at *time.Time) error {
+			scheduled = true
+			return nil
+		},
+	}
+	publishAt := time.Now().Add(time.Hour).UTC()
+
+	body := fmt.Sprintf(`{"username":"testuser","title":"Test Post","version":"1","publish_at":%q}`, publishAt.Format(time.RFC3339))
+	rr := httptest.NewRecorder()
+	HandlePublishPostVersion(rr, withUser(httptest.NewRequest("POST", "/publish", strings.NewReader(body))))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.False(t, scheduled)
+}
+
+func TestHandleFetchScheduledPublishes(t *testing.T) {
+	at := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	link := "/testuser/test-title"
+	blogPostDataDB = &mockBlogPostDataDB{scheduled: []db.BlogPostData{
+		{User: "testuser", Title: "Test Title", Version: "3", PublishAt: &at, DirectLink: &link},
+	}}
+
+	rr := httptest.NewRecorder()
+	HandleFetchScheduledPublishes(rr, withUser(httptest.NewRequest("GET", "/publish/scheduled", nil)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp []ScheduledPublish
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, []ScheduledPublish{{Title: "Test Title", Version: "3", PublishAt: at, DirectLink: link}}, resp)
+}
+
+func TestHandleCancelScheduledPublish(t *testing.T) {
+	at := time.Now().Add(time.Hour)
+	cleared := false
+	blogPostDataDB = &mockBlogPostDataDB{
+		FetchBlogPostFunc: func(ctx context.Context, username, title, version string) (db.BlogPostData, error) {
+			post := db.BlogPostData{User: username, Title: title, Version: version}
+			if version == "2" {
+				post.PublishAt = &at
+			}
+			return post, nil
+		},
+		SchedulePublishFunc: func(ctx context.Context, username, title, version string, at *time.Time) error {
+			cleared = at == nil
+			return nil
+		},
+	}
+
+	rr := httptest.NewRecorder()
+	HandleCancelScheduledPublish(rr, withUser(httptest.NewRequest("POST", "/publish/cancel", strings.NewReader(`{"title":"Test Title","version":"1"}`))))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.False(t, cleared)
+
+	rr = httptest.NewRecorder()
+	HandleCancelScheduledPublish(rr, withUser(httptest.NewRequest("POST", "/publish/cancel", strings.NewReader(`{"title":"Test Title","version":"2"}`))))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, cleared)
+}
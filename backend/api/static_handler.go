@@ -1,7 +1,18 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"path"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
 )
 
 const staticDir = "cmd/static"
@@ -10,3 +21,89 @@ func HandleStatic(w http.ResponseWriter, r *http.Request) {
 	fileServer := http.StripPrefix("/static/", http.FileServer(http.Dir(staticDir)))
 	fileServer.ServeHTTP(w, r)
 }
+
+// HandleBlob serves objects straight from the blob store. The local backend
+// hands out URLs under /blobs/, so uploaded images and files resolve without s3.
+// Post files are only served to readers who may open the post.
+func HandleBlob(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "*")
+	if key == "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	allowed, err := canReadBlob(r, key)
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	body, err := blobStore.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if contentType == "image/svg+xml" {
+		// svg is sanitized on upload; this also stops anything that slipped
+		// through from running or loading when the file is opened directly
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src data:; sandbox")
+	}
+	_, _ = io.Copy(w, body)
+}
+
+// canReadBlob reports whether the requester may read the object at key. The
+// html and markdown of a post version follow the post page: the post must not
+// be trashed and the reader must be allowed to see it, and only its owner
+// reads versions that are neither active nor in a running experiment. Other
+// html or markdown files in the root are refused, except the about page.
+func canReadBlob(r *http.Request, key string) (bool, error) {
+	ext := path.Ext(key)
+	if strings.Contains(key, "/") || (ext != ".html" && ext != ".md") {
+		return true, nil
+	}
+	username, post_slug, version, _, ok := slug.ParseKey(key)
+	if !ok {
+		return strings.HasSuffix(key, "_about_file"+ext), nil
+	}
+	title, err := blogPostDataDB.FetchTitleBySlug(r.Context(), username, post_slug)
+	if err != nil || title == "" {
+		return false, err
+	}
+	post, err := blogPostDataDB.FetchBlogPost(r.Context(), username, title, version)
+	if err != nil {
+		// the version does not exist
+		return false, nil
+	}
+	requester, _ := r.Context().Value(auth.UsernameKey).(string)
+	if post.DeletedAt != nil || !canView(post.Visibility, username, requester) {
+		return false, nil
+	}
+	if requester == username {
+		return true, nil
+	}
+	active, err := blogPostDataDB.FetchActiveBlog(r.Context(), username, title)
+	if err == nil && version == active {
+		return true, nil
+	}
+	experiment, err := runningExperiment(r.Context(), username, title)
+	if err != nil || experiment == nil {
+		return false, err
+	}
+	return version == experiment.VersionA || version == experiment.VersionB, nil
+}
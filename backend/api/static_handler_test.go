@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func blobRequest(key string, requester string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("*", key)
+	req := httptest.NewRequest("GET", "/blobs/"+key, nil)
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	if requester != "" {
+		ctx = context.WithValue(ctx, auth.UsernameKey, requester)
+	}
+	return req.WithContext(ctx)
+}
+
+func TestHandleBlob_PostFiles(t *testing.T) {
+	store := useTestBlobStore(t)
+	experiments := useTestExperimentDB(t)
+	trashedAt := time.Now()
+	posts := map[string]db.BlogPostData{
+		"Public":  {Visibility: db.VisibilityPublic},
+		"Private": {Visibility: db.VisibilityPrivate},
+		"Draft":   {Visibility: db.VisibilityDraft},
+		"Trashed": {Visibility: db.VisibilityPublic, DeletedAt: &trashedAt},
+	}
+	blogPostDataDB = &mockBlogPostDataDB{
+		slugs: map[string]string{"public": "Public", "private": "Private", "draft": "Draft", "trashed": "Trashed"},
+		// every post has versions 1 to 3, 2 being active
+		FetchBlogPostFunc: func(ctx context.Context, username, title, version string) (db.BlogPostData, error) {
+			post, ok := posts[title]
+			if !ok || version < "1" || version > "3" {
+				return db.BlogPostData{}, assert.AnError
+			}
+			post.User, post.Title, post.Version = username, title, version
+			return post, nil
+		},
+		FetchActiveBlogFunc: func(ctx context.Context, username, title string) (string, error) {
+			return "2", nil
+		},
+	}
+	for _, key := range []string{
+		"testuser_public_1.html", "testuser_public_2.html", "testuser_public_2.md", "testuser_public_3.html",
+		"testuser_private_2.html", "testuser_draft_2.html", "testuser_trashed_2.html",
+		"testuser_about_file.html", "notes.html", "assets/abc.png",
+	} {
+		if err := store.Put(context.Background(), key, strings.NewReader("content"), ""); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		key          string
+		requester    string
+		expectedCode int
+	}{
+		{"testuser_public_2.html", "", http.StatusOK},
+		{"testuser_public_2.md", "", http.StatusOK},
+		{"testuser_public_1.html", "", http.StatusNotFound},
+		{"testuser_public_1.html", "otheruser", http.StatusNotFound},
+		{"testuser_public_1.html", "testuser", http.StatusOK},
+		{"testuser_public_4.html", "testuser", http.StatusNotFound},
+		{"testuser_private_2.html", "", http.StatusNotFound},
+		{"testuser_private_2.html", "otheruser", http.StatusNotFound},
+		{"testuser_private_2.html", "testuser", http.StatusOK},
+		{"testuser_draft_2.html", "testuser", http.StatusNotFound},
+		{"testuser_trashed_2.html", "testuser", http.StatusNotFound},
+		{"testuser_about_file.html", "", http.StatusOK},
+		{"notes.html", "", http.StatusNotFound},
+		{"assets/abc.png", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+" as "+tt.requester, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			HandleBlob(rr, blobRequest(tt.key, tt.requester))
+			assert.Equal(t, tt.expectedCode, rr.Code)
+		})
+	}
+
+	// both versions of a running experiment are served to readers
+	experiments.experiments = []db.Experiment{{User: "testuser", Title: "Public", VersionA: "2", VersionB: "3", StartedAt: time.Now()}}
+	rr := httptest.NewRecorder()
+	HandleBlob(rr, blobRequest("testuser_public_3.html", ""))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = httptest.NewRecorder()
+	HandleBlob(rr, blobRequest("testuser_public_1.html", ""))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,11 @@
+package api
+
+import (
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
+)
+
+var blobStore storage.BlobStore
+
+func SetBlobStore(store storage.BlobStore) {
+	blobStore = store
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/shrijan-swaminathan/markbyte/backend/auth"
 	"github.com/shrijan-swaminathan/markbyte/backend/db/redisdb"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/markdown_render"
 )
 
 func HandleFetchUserStyle(w http.ResponseWriter, r *http.Request) {
@@ -44,6 +45,15 @@ func HandleUpdateUserStyle(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to decode request", http.StatusBadRequest)
 		return
 	}
+	exists, err := markdown_render.StyleExists(r.Context(), username, req.Style)
+	if err != nil {
+		http.Error(w, "Failed to check style", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "No such style exists", http.StatusBadRequest)
+		return
+	}
 	err = userDB.UpdateUserStyle(r.Context(), username, req.Style)
 	if err != nil {
 		http.Error(w, "Failed to update user style", http.StatusInternalServerError)
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/db/redisdb"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/tags"
+)
+
+// tagFeedKey is the redis key caching the discover feed of tag.
+func tagFeedKey(tag string) string {
+	return "discover:tag:" + tag
+}
+
+// normalizeTag turns a tag from a url into the stored form, "" when it
+// cannot be a tag.
+func normalizeTag(raw string) string {
+	normalized, err := tags.Normalize([]string{raw})
+	if err != nil || len(normalized) != 1 {
+		return ""
+	}
+	return normalized[0]
+}
+
+type UserTagsResponse struct {
+	Username string        `json:"username"`
+	Tags     []db.TagCount `json:"tags"`
+}
+
+func HandleFetchUserTags(w http.ResponseWriter, r *http.Request) {
+	username := r.URL.Query().Get("user")
+	if username == "" {
+		http.Error(w, "No user provided", http.StatusBadRequest)
+		return
+	}
+
+	user, err := userDB.GetUser(r.Context(), username)
+	if err != nil || user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	user_tags, err := blogPostDataDB.FetchUserTags(r.Context(), username)
+	if err != nil {
+		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(UserTagsResponse{Username: username, Tags: user_tags})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+func HandleDiscoverTagPosts(w http.ResponseWriter, r *http.Request) {
+	tag := normalizeTag(chi.URLParam(r, "tag"))
+	if tag == "" {
+		http.Error(w, "Invalid tag", http.StatusBadRequest)
+		return
+	}
+
+	if redisdb.RedisActive {
+		cacheHit, err := redisdb.GetEndpoint(r.Context(), tagFeedKey(tag))
+		if err == nil && cacheHit != "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, err = w.Write([]byte(cacheHit))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			return
+		}
+	}
+
+	blogs, err := blogPostDataDB.FetchActivePostsByTag(r.Context(), "", tag)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	post_data, err := discoverPostData(r.Context(), blogs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := HandleDiscoverPostsResponse{
+		Posts: post_data,
+	}
+
+	if redisdb.RedisActive {
+		respJSON, err := json.Marshal(response)
+		if err == nil {
+			str := string(respJSON)
+			_ = redisdb.SetWithTTL(r.Context(), tagFeedKey(tag), &str, 20*time.Minute)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func taggedPosts() *mockBlogPostDataDB {
+	return &mockBlogPostDataDB{active: []db.BlogPostData{
+		{User: "testuser", Title: "One", Version: "1", IsActive: true, Tags: []string{"go", "web"}},
+		{User: "testuser", Title: "Two", Version: "2", IsActive: true, Tags: []string{"go"}},
+		{User: "testuser", Title: "Hidden", Version: "1", IsActive: true, Tags: []string{"go"}, Visibility: db.VisibilityUnlisted},
+		{User: "otheruser", Title: "Three", Version: "1", IsActive: true, Tags: []string{"go"}},
+	}}
+}
+
+func TestHandleFetchUserTags(t *testing.T) {
+	blogPostDataDB = taggedPosts()
+	userDB = &mockUserDB{}
+
+	rr := httptest.NewRecorder()
+	HandleFetchUserTags(rr, httptest.NewRequest("GET", "/user/tags?user=testuser", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp UserTagsResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, []db.TagCount{{Tag: "go", Count: 2}, {Tag: "web", Count: 1}}, resp.Tags)
+}
+
+func TestHandleFetchUserActivePosts_ByTag(t *testing.T) {
+	blogPostDataDB = taggedPosts()
+	userDB = &mockUserDB{}
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	rr := httptest.NewRecorder()
+	HandleFetchUserActivePosts(rr, httptest.NewRequest("GET", "/user/posts?user=testuser&tag=Web", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp BlogPostDataResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	if assert.Len(t, resp.Posts, 1) {
+		assert.Equal(t, "One", resp.Posts[0].Post.Title)
+	}
+
+	rr = httptest.NewRecorder()
+	HandleFetchUserActivePosts(rr, httptest.NewRequest("GET", "/user/posts?user=testuser&tag=a/b", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestHandleDiscoverTagPosts(t *testing.T) {
+	blogPostDataDB = taggedPosts()
+	userDB = &mockUserDB{}
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("tag", "go")
+	req := httptest.NewRequest("GET", "/discover/tag/go", nil)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	rr := httptest.NewRecorder()
+
+	HandleDiscoverTagPosts(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp HandleDiscoverPostsResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	titles := []string{}
+	for _, post := range resp.Posts {
+		titles = append(titles, post.Blog.Title)
+	}
+	assert.ElementsMatch(t, []string{"One", "Two", "Three"}, titles)
+}
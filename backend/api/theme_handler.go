@@ -0,0 +1,425 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/db/redisdb"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/attachment"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/markdown_render"
+)
+
+// maxThemeUploadSize caps the request body of /user/theme/upload.
+const maxThemeUploadSize = 10 << 20
+
+const themePrefix = "themes/"
+
+// themeZipLimits bounds a theme package, which is far smaller than a post.
+var themeZipLimits = ZipLimits{
+	MaxEntries:   50,
+	MaxEntrySize: 2 << 20,
+	MaxTotalSize: 10 << 20,
+	MaxRatio:     100,
+}
+
+var themeNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// fonts are not attachments, they are only told apart by their signature
+var themeFonts = map[string]struct {
+	magic       string
+	contentType string
+}{
+	".woff":  {"wOFF", "font/woff"},
+	".woff2": {"wOF2", "font/woff2"},
+}
+
+// themeDB stores uploaded themes, uploads are off while it is nil.
+var themeDB db.ThemeDB
+
+func SetThemeDB(repo db.ThemeDB) {
+	themeDB = repo
+}
+
+// themeFile is a checked file of a theme package other than its template.
+type themeFile struct {
+	name        string
+	data        []byte
+	contentType string
+}
+
+// readThemePackage reads a theme zip within themeZipLimits. The package is
+// theme.html, optionally style.css and other stylesheets, and images or fonts
+// to link from them, all relative to the folder holding theme.html.
+func readThemePackage(zr io.ReaderAt, size int64) (string, []themeFile, error) {
+	zipReader, err := zip.NewReader(zr, size)
+	if err != nil {
+		return "", nil, err
+	}
+	limits := themeZipLimits
+	if len(zipReader.File) > limits.MaxEntries {
+		return "", nil, &ZipEntryError{Entry: zipReader.File[limits.MaxEntries].Name, Err: ErrZipTooManyEntries}
+	}
+
+	// zipping a folder puts everything below it, so the package starts where
+	// the template is
+	root := ""
+	found := false
+	for _, file := range zipReader.File {
+		fpath := path.Clean(strings.TrimPrefix(strings.ReplaceAll(file.Name, `\`, "/"), "./"))
+		if path.Base(fpath) != "theme.html" || isArchiveMetadata(fpath) {
+			continue
+		}
+		if dir := path.Dir(fpath); !found || len(dir) < len(root) {
+			root, found = dir, true
+		}
+	}
+	if !found {
+		return "", nil, &markdown_render.ThemeError{Name: "theme.html", Reason: "the package has no theme.html"}
+	}
+
+	var source string
+	files := []themeFile{}
+	remaining := limits.MaxTotalSize
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		err = checkZipEntry(file, limits)
+		if err != nil {
+			return "", nil, err
+		}
+		fpath := path.Clean(strings.TrimPrefix(strings.ReplaceAll(file.Name, `\`, "/"), "./"))
+		if isArchiveMetadata(fpath) {
+			continue
+		}
+		name := fpath
+		if root != "." {
+			var ok bool
+			name, ok = strings.CutPrefix(fpath, root+"/")
+			if !ok {
+				return "", nil, &markdown_render.ThemeError{Name: fpath, Reason: "file is outside the theme folder"}
+			}
+		}
+
+		buf := new(bytes.Buffer)
+		n, err := readZipEntry(file, limits, remaining, buf)
+		if err != nil {
+			return "", nil, err
+		}
+		remaining -= n
+
+		if name == "theme.html" {
+			if !utf8.Valid(buf.Bytes()) {
+				return "", nil, &markdown_render.ThemeError{Name: name, Reason: "template is not utf-8"}
+			}
+			source = buf.String()
+			continue
+		}
+		checked, err := checkThemeFile(name, buf.Bytes())
+		if err != nil {
+			return "", nil, err
+		}
+		files = append(files, *checked)
+	}
+	return source, files, nil
+}
+
+// checkThemeFile accepts stylesheets, fonts and images, with the type
+// detected from the content like post attachments.
+func checkThemeFile(name string, content []byte) (*themeFile, error) {
+	ext := strings.ToLower(path.Ext(name))
+	if ext == ".css" {
+		if !utf8.Valid(content) {
+			return nil, &markdown_render.ThemeError{Name: name, Reason: "stylesheet is not utf-8"}
+		}
+		err := markdown_render.CheckStylesheet(name, content)
+		if err != nil {
+			return nil, err
+		}
+		return &themeFile{name: name, data: content, contentType: "text/css"}, nil
+	}
+	if font, ok := themeFonts[ext]; ok {
+		if !bytes.HasPrefix(content, []byte(font.magic)) {
+			return nil, &markdown_render.ThemeError{Name: name, Reason: "file is not a " + ext + " font"}
+		}
+		return &themeFile{name: name, data: content, contentType: font.contentType}, nil
+	}
+	checked, err := attachment.Check(name, content)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(checked.ContentType, "image/") {
+		return nil, &markdown_render.ThemeError{Name: name, Reason: "themes may only hold stylesheets, fonts and images"}
+	}
+	return &themeFile{name: name, data: checked.Data, contentType: checked.ContentType}, nil
+}
+
+// themeKey addresses a theme file by its content, so a new upload never
+// serves stale copies from a cache.
+func themeKey(username string, theme string, file themeFile) string {
+	sum := sha256.Sum256(file.data)
+	return themePrefix + username + "/" + theme + "/" + hex.EncodeToString(sum[:8]) + strings.ToLower(path.Ext(file.name))
+}
+
+// invalidateThemePages drops the cached pages of username when they use the
+// theme, they are rendered with it again on the next request.
+func invalidateThemePages(ctx context.Context, username string, theme string) {
+	if !redisdb.RedisActive {
+		return
+	}
+	style, err := userDB.GetUserStyle(ctx, username)
+	if err != nil || style != markdown_render.CustomThemePrefix+theme {
+		return
+	}
+	err = redisdb.DeleteEndpointByPrefix(ctx, "/"+username)
+	if err != nil {
+		fmt.Printf("Error removing old endpoint from redis")
+	}
+}
+
+// HandleUploadTheme stores a theme package under a name. Uploading the same
+// name again replaces the theme.
+func HandleUploadTheme(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if themeDB == nil {
+		http.Error(w, "Custom themes are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxThemeUploadSize)
+	err := r.ParseMultipartForm(maxThemeUploadSize)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, fmt.Sprintf("Upload is larger than %d MB", maxThemeUploadSize>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+	name := strings.ToLower(strings.TrimSpace(r.FormValue("name")))
+	if !themeNamePattern.MatchString(name) {
+		http.Error(w, "Theme names are 1 to 32 lowercase letters, digits or dashes", http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("themefile")
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	source, files, err := readThemePackage(file, header.Size)
+	var entryErr *ZipEntryError
+	var themeErr *markdown_render.ThemeError
+	var rejection *attachment.RejectedError
+	if errors.As(err, &entryErr) {
+		http.Error(w, err.Error(), entryErr.StatusCode())
+		return
+	}
+	if errors.As(err, &themeErr) || errors.As(err, &rejection) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, zip.ErrFormat) {
+		http.Error(w, "Upload is not a valid zip file", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read theme package", http.StatusInternalServerError)
+		return
+	}
+
+	theme := db.Theme{
+		User:       username,
+		Name:       name,
+		Template:   source,
+		Assets:     make([]db.ThemeAsset, 0, len(files)),
+		UploadedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+	var uploadSize int64
+	for _, f := range files {
+		key := themeKey(username, name, f)
+		theme.Assets = append(theme.Assets, db.ThemeAsset{
+			Name:        f.name,
+			Key:         key,
+			URL:         blobStore.URL(key),
+			ContentType: f.contentType,
+			Size:        int64(len(f.data)),
+		})
+		uploadSize += int64(len(f.data))
+	}
+	// the template is checked against the final urls before anything is stored
+	_, err = markdown_render.ParseTheme(source, theme.Assets)
+	if errors.As(err, &themeErr) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to check theme", http.StatusInternalServerError)
+		return
+	}
+
+	err = checkQuota(r.Context(), username, uploadSize, int64(len(files)))
+	if writeQuotaError(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to check storage quota", http.StatusInternalServerError)
+		return
+	}
+	previous, err := themeDB.FetchTheme(r.Context(), username, name)
+	if err != nil {
+		http.Error(w, "Failed to fetch theme", http.StatusInternalServerError)
+		return
+	}
+	for i, f := range files {
+		err = putUserObject(r.Context(), blobStore, username, theme.Assets[i].Key, bytes.NewReader(f.data), int64(len(f.data)), f.contentType)
+		if writeQuotaError(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to store theme files", http.StatusInternalServerError)
+			fmt.Println(err)
+			return
+		}
+	}
+	err = themeDB.SaveTheme(r.Context(), &theme)
+	if err != nil {
+		http.Error(w, "Failed to save theme", http.StatusInternalServerError)
+		return
+	}
+	if previous != nil {
+		deleteThemeFiles(r.Context(), username, previous, theme.Assets)
+	}
+	invalidateThemePages(r.Context(), username, name)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(theme)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// deleteThemeFiles deletes the files of theme that are not in keep. The theme
+// is already replaced or gone, so failures are only logged.
+func deleteThemeFiles(ctx context.Context, username string, theme *db.Theme, keep []db.ThemeAsset) {
+	kept := make(map[string]bool, len(keep))
+	for _, asset := range keep {
+		kept[asset.Key] = true
+	}
+	for _, asset := range theme.Assets {
+		if kept[asset.Key] {
+			continue
+		}
+		err := deleteUserObject(ctx, blobStore, username, asset.Key)
+		if err != nil {
+			fmt.Printf("failed to delete theme file %s: %v\n", asset.Key, err)
+		}
+	}
+}
+
+type ThemesResponse struct {
+	// BuiltIn are the styles every user can pick.
+	BuiltIn []string `json:"built_in"`
+	// Custom are the user's uploaded themes, picked with the "custom:" prefix.
+	Custom []db.Theme `json:"custom"`
+}
+
+func HandleFetchUserThemes(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	response := ThemesResponse{BuiltIn: markdown_render.Themes(), Custom: []db.Theme{}}
+	if themeDB != nil {
+		themes, err := themeDB.FetchUserThemes(r.Context(), username)
+		if err != nil {
+			http.Error(w, "Failed to fetch themes", http.StatusInternalServerError)
+			return
+		}
+		response.Custom = themes
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+type DeleteThemeRequest struct {
+	Name string `json:"name"`
+}
+
+// HandleDeleteTheme deletes an uploaded theme and its files. A user whose
+// style was the theme is switched back to the default one.
+func HandleDeleteTheme(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if themeDB == nil {
+		http.Error(w, "Custom themes are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	var req DeleteThemeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+	theme, err := themeDB.FetchTheme(r.Context(), username, req.Name)
+	if err != nil {
+		http.Error(w, "Failed to fetch theme", http.StatusInternalServerError)
+		return
+	}
+	if theme == nil {
+		http.Error(w, "No such theme exists", http.StatusNotFound)
+		return
+	}
+
+	// pages are invalidated while the style still names the theme
+	invalidateThemePages(r.Context(), username, req.Name)
+	style, err := userDB.GetUserStyle(r.Context(), username)
+	if err == nil && style == markdown_render.CustomThemePrefix+req.Name {
+		err = userDB.UpdateUserStyle(r.Context(), username, markdown_render.DefaultTheme)
+		if err != nil {
+			http.Error(w, "Failed to update user style", http.StatusInternalServerError)
+			return
+		}
+	}
+	_, err = themeDB.DeleteTheme(r.Context(), username, req.Name)
+	if err != nil {
+		http.Error(w, "Failed to delete theme", http.StatusInternalServerError)
+		return
+	}
+	deleteThemeFiles(r.Context(), username, theme, nil)
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,312 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/markdown_render"
+	"github.com/stretchr/testify/assert"
+)
+
+const testThemeTemplate = `<!DOCTYPE html>
+<html>
+<head>
+    {{template "head" .}}
+    <link rel="stylesheet" href="{{asset "style.css"}}">
+</head>
+<body>
+    <img src="{{asset "images/logo.png"}}" alt="">
+    {{template "article" .}}
+</body>
+</html>`
+
+func themeUploadRequest(t *testing.T, name string, zipData []byte) *http.Request {
+	t.Helper()
+	var b bytes.Buffer
+	wr := multipart.NewWriter(&b)
+	if err := wr.WriteField("name", name); err != nil {
+		t.Fatalf("wr.WriteField failed: %v", err)
+	}
+	fw, _ := wr.CreateFormFile("themefile", "theme.zip")
+	if _, err := fw.Write(zipData); err != nil {
+		t.Fatalf("fw.Write failed: %v", err)
+	}
+	wr.Close()
+	req := httptest.NewRequest("POST", "/user/theme/upload", &b)
+	req.Header.Set("Content-Type", wr.FormDataContentType())
+	return withUser(req)
+}
+
+func TestHandleUploadTheme(t *testing.T) {
+	store := useTestBlobStore(t)
+	themes := useTestThemeDB(t)
+	userDB = &mockUserDB{}
+
+	// a folder around the package is fine, theme.html marks the root
+	zipData := buildZip(t, map[string]string{
+		"paper/theme.html":       testThemeTemplate,
+		"paper/style.css":        "body { font-family: serif; }",
+		"paper/images/logo.png":  testPNG(t, 4, 4, 10),
+		"__MACOSX/paper/._style": "",
+	})
+	rr := httptest.NewRecorder()
+	HandleUploadTheme(rr, themeUploadRequest(t, "paper", zipData))
+	if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		return
+	}
+
+	var theme db.Theme
+	if err := json.NewDecoder(rr.Body).Decode(&theme); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	assert.Equal(t, "paper", theme.Name)
+	if !assert.Len(t, theme.Assets, 2) {
+		return
+	}
+	for _, asset := range theme.Assets {
+		assert.True(t, strings.HasPrefix(asset.Key, "themes/testuser/paper/"), asset.Key)
+		assert.Equal(t, "https://blobs.mock/"+asset.Key, asset.URL)
+		_, err := store.Stat(context.Background(), asset.Key)
+		assert.NoError(t, err, asset.Name)
+	}
+	if !assert.Len(t, themes.themes, 1) {
+		return
+	}
+	assert.Equal(t, testThemeTemplate, themes.themes[0].Template)
+
+	// the uploaded theme renders posts with its asset urls
+	page := markdown_render.Page{
+		Title:   "Hello",
+		Content: "<p>hello world</p>",
+		Author:  markdown_render.Author{Username: "testuser", Name: "Test User"},
+	}
+	html, err := markdown_render.RenderUserPage(context.Background(), "custom:paper", page)
+	assert.NoError(t, err)
+	assert.Contains(t, html, "<p>hello world</p>")
+	assert.Contains(t, html, theme.Assets[0].URL)
+
+	// replacing the theme removes files the new version no longer has
+	oldKeys := []string{theme.Assets[0].Key, theme.Assets[1].Key}
+	zipData = buildZip(t, map[string]string{
+		"theme.html":      strings.Replace(testThemeTemplate, "images/logo.png", "style.css", 1),
+		"style.css":       "body { font-family: sans-serif; }",
+		"images/logo.png": testPNG(t, 4, 4, 10),
+	})
+	rr = httptest.NewRecorder()
+	HandleUploadTheme(rr, themeUploadRequest(t, "paper", zipData))
+	if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		return
+	}
+	if !assert.Len(t, themes.themes, 1) {
+		return
+	}
+	var kept int
+	for _, key := range oldKeys {
+		if _, err := store.Stat(context.Background(), key); err == nil {
+			kept++
+		}
+	}
+	// the logo is unchanged and keeps its key, the stylesheet is new
+	assert.Equal(t, 1, kept)
+}
+
+func TestHandleUploadTheme_Rejected(t *testing.T) {
+	useTestBlobStore(t)
+	useTestThemeDB(t)
+	userDB = &mockUserDB{}
+
+	tests := []struct {
+		name         string
+		theme        string
+		files        map[string]string
+		expectedBody string
+	}{
+		{
+			name:         "invalid name",
+			theme:        "My Theme",
+			files:        map[string]string{"theme.html": testThemeTemplate},
+			expectedBody: "Theme names",
+		},
+		{
+			name:         "no template",
+			theme:        "paper",
+			files:        map[string]string{"style.css": "body {}"},
+			expectedBody: "theme.html",
+		},
+		{
+			name:  "script",
+			theme: "paper",
+			files: map[string]string{
+				"theme.html": `{{template "article" .}}<script>alert(1)</script>`,
+			},
+			expectedBody: "<script",
+		},
+		{
+			name:  "event handler",
+			theme: "paper",
+			files: map[string]string{
+				"theme.html": `<body onload="steal()">{{template "article" .}}</body>`,
+			},
+			expectedBody: "not allowed",
+		},
+		{
+			name:  "call",
+			theme: "paper",
+			files: map[string]string{
+				"theme.html": `{{call .Title}}{{template "article" .}}`,
+			},
+			expectedBody: `function "call" is not allowed`,
+		},
+		{
+			name:  "no content",
+			theme: "paper",
+			files: map[string]string{
+				"theme.html": `<h1>{{.Title}}</h1>`,
+			},
+			expectedBody: "does not render the post",
+		},
+		{
+			name:  "unknown asset",
+			theme: "paper",
+			files: map[string]string{
+				"theme.html": `<link rel="stylesheet" href="{{asset "missing.css"}}">{{template "article" .}}`,
+			},
+			expectedBody: "missing.css",
+		},
+		{
+			name:  "file outside the root",
+			theme: "paper",
+			files: map[string]string{
+				"paper/theme.html": `{{template "article" .}}`,
+				"other/style.css":  "body {}",
+			},
+			expectedBody: "other/style.css",
+		},
+		{
+			name:  "css import",
+			theme: "paper",
+			files: map[string]string{
+				"theme.html": `{{template "article" .}}`,
+				"style.css":  `@import url("https://example.com/evil.css");`,
+			},
+			expectedBody: "@import",
+		},
+		{
+			name:  "script file",
+			theme: "paper",
+			files: map[string]string{
+				"theme.html": `{{template "article" .}}`,
+				"theme.js":   "alert(1)",
+			},
+			expectedBody: "theme.js",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			themes := useTestThemeDB(t)
+			rr := httptest.NewRecorder()
+			HandleUploadTheme(rr, themeUploadRequest(t, tt.theme, buildZip(t, tt.files)))
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.expectedBody)
+			assert.Empty(t, themes.themes)
+		})
+	}
+}
+
+func TestHandleUploadTheme_Disabled(t *testing.T) {
+	origThemeDB := themeDB
+	themeDB = nil
+	t.Cleanup(func() { themeDB = origThemeDB })
+
+	rr := httptest.NewRecorder()
+	HandleUploadTheme(rr, themeUploadRequest(t, "paper", buildZip(t, map[string]string{"theme.html": testThemeTemplate})))
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+}
+
+func TestHandleDeleteTheme(t *testing.T) {
+	store := useTestBlobStore(t)
+	themes := useTestThemeDB(t)
+	userDB = &mockUserDB{}
+
+	zipData := buildZip(t, map[string]string{
+		"theme.html":      testThemeTemplate,
+		"style.css":       "body {}",
+		"images/logo.png": testPNG(t, 4, 4, 20),
+	})
+	rr := httptest.NewRecorder()
+	HandleUploadTheme(rr, themeUploadRequest(t, "paper", zipData))
+	if !assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String()) {
+		return
+	}
+	assets := themes.themes[0].Assets
+
+	req := withUser(httptest.NewRequest("POST", "/user/theme/delete", strings.NewReader(`{"name": "missing"}`)))
+	rr = httptest.NewRecorder()
+	HandleDeleteTheme(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	req = withUser(httptest.NewRequest("POST", "/user/theme/delete", strings.NewReader(`{"name": "paper"}`)))
+	rr = httptest.NewRecorder()
+	HandleDeleteTheme(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, themes.themes)
+	for _, asset := range assets {
+		_, err := store.Stat(context.Background(), asset.Key)
+		assert.Error(t, err, asset.Name)
+	}
+}
+
+func TestHandleFetchUserThemes(t *testing.T) {
+	themes := useTestThemeDB(t)
+	themes.themes = []db.Theme{
+		{User: "testuser", Name: "paper"},
+		{User: "otheruser", Name: "ink"},
+	}
+
+	rr := httptest.NewRecorder()
+	HandleFetchUserThemes(rr, withUser(httptest.NewRequest("GET", "/user/themes", nil)))
+	if !assert.Equal(t, http.StatusOK, rr.Code) {
+		return
+	}
+	var response ThemesResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	assert.Equal(t, markdown_render.Themes(), response.BuiltIn)
+	if !assert.Len(t, response.Custom, 1) {
+		return
+	}
+	assert.Equal(t, "paper", response.Custom[0].Name)
+}
+
+func TestHandleUpdateUserStyle_CustomTheme(t *testing.T) {
+	themes := useTestThemeDB(t)
+	themes.themes = []db.Theme{{User: "testuser", Name: "paper"}, {User: "otheruser", Name: "ink"}}
+	userDB = &mockUserDB{}
+
+	tests := []struct {
+		style        string
+		expectedCode int
+	}{
+		{"pink", http.StatusOK},
+		{"custom:paper", http.StatusOK},
+		{"custom:ink", http.StatusBadRequest},
+		{"custom:missing", http.StatusBadRequest},
+		{"missing", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.style, func(t *testing.T) {
+			body := strings.NewReader(`{"style": "` + tt.style + `"}`)
+			rr := httptest.NewRecorder()
+			HandleUpdateUserStyle(rr, withUser(httptest.NewRequest("POST", "/user/style", body)))
+			assert.Equal(t, tt.expectedCode, rr.Code)
+		})
+	}
+}
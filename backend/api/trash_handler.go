@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/db/redisdb"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/trash"
+)
+
+// trashRetention is how long a post stays in the trash before it is purged.
+var trashRetention = trash.DefaultRetention
+
+func SetTrashRetention(retention time.Duration) {
+	trashRetention = retention
+}
+
+// inTrash reports whether the post with these versions is in the trash.
+func inTrash(versions []db.BlogPostData) bool {
+	return len(versions) > 0 && versions[0].DeletedAt != nil
+}
+
+// invalidatePost drops every cached page a post shows up on after it was
+// trashed or restored.
+func invalidatePost(ctx context.Context, username string, title string, versions []db.BlogPostData) {
+	var post_tags []string
+	for _, version := range versions {
+		post_tags = append(post_tags, version.Tags...)
+	}
+	if redisdb.RedisActive && len(versions) > 0 {
+		err := redisdb.DeleteEndpoint(ctx, slug.Path(username, versions[0].Slug))
+		if err != nil {
+			fmt.Printf("Error removing old endpoint from redis")
+		}
+	}
+	invalidateListings(ctx, post_tags)
+	invalidateSeriesPages(ctx, username, title)
+}
+
+// PurgePost permanently deletes every version of a post with its analytics
+// and files. The trash purge calls it for posts past their retention. The
+// files go first and the versions last, so a purge failing halfway leaves
+// the post in the trash and running it again finishes the job.
+func PurgePost(ctx context.Context, username string, title string) error {
+	postVersions, err := blogPostDataDB.FetchAllPostVersions(ctx, username, title)
+	if err != nil {
+		return fmt.Errorf("failed to fetch post versions: %w", err)
+	}
+
+	// every version shares the slug of the post
+	post_slug := ""
+	if len(postVersions.Versions) > 0 {
+		post_slug = postVersions.Versions[0].Slug
+	}
+
+	// a scheduled publish must not fire on a half purged post
+	for _, post := range postVersions.Versions {
+		if post.PublishAt == nil {
+			continue
+		}
+		err = blogPostDataDB.SchedulePublish(ctx, username, title, post.Version, nil)
+		if err != nil {
+			return fmt.Errorf("failed to clear scheduled publish: %w", err)
+		}
+	}
+
+	// deleting a file that is already gone is not an error
+	for _, post := range postVersions.Versions {
+		html_keyname := slug.Key(username, post_slug, post.Version, ".html")
+		md_keyname := slug.Key(username, post_slug, post.Version, ".md")
+		err = deleteUserObject(ctx, blobStore, username, html_keyname)
+		if err != nil {
+			return fmt.Errorf("failed to delete html file: %w", err)
+		}
+		err = deleteUserObject(ctx, blobStore, username, md_keyname)
+		if err != nil {
+			return fmt.Errorf("failed to delete md file: %w", err)
+		}
+	}
+
+	_, err = AnalyticsDataDB.DeletePostAnalytics(ctx, username, title)
+	if err != nil {
+		return fmt.Errorf("failed to delete post analytics: %w", err)
+	}
+	removePostFromCollections(ctx, username, title)
+	if experimentDB != nil {
+		_, err = experimentDB.DeleteExperiment(ctx, username, title)
+		if err != nil {
+			return fmt.Errorf("failed to delete experiment: %w", err)
+		}
+	}
+
+	_, err = blogPostDataDB.DeleteBlogPost(ctx, username, title)
+	if err != nil {
+		return fmt.Errorf("failed to delete blog post: %w", err)
+	}
+
+	if redisdb.RedisActive && post_slug != "" {
+		endpoint := slug.Path(username, post_slug)
+		err = redisdb.DeleteEndpoint(ctx, endpoint)
+		if err != nil {
+			fmt.Printf("Error removing old endpoint from redis")
+		}
+	}
+	return nil
+}
+
+type TrashedPost struct {
+	Title     string    `json:"title"`
+	Slug      string    `json:"slug"`
+	Version   string    `json:"version"`
+	DeletedAt time.Time `json:"deleted_at"`
+	// PurgeAt is when the post gets deleted for good.
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+func HandleFetchTrash(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	blogs, err := blogPostDataDB.FetchTrashedPosts(r.Context(), username)
+	if err != nil {
+		http.Error(w, "Failed to fetch trash", http.StatusInternalServerError)
+		return
+	}
+
+	trashed := make([]TrashedPost, 0, len(blogs))
+	for _, blog := range blogs {
+		if blog.DeletedAt == nil {
+			continue
+		}
+		trashed = append(trashed, TrashedPost{
+			Title:     blog.Title,
+			Slug:      blog.Slug,
+			Version:   blog.Version,
+			DeletedAt: *blog.DeletedAt,
+			PurgeAt:   blog.DeletedAt.Add(trashRetention),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(trashed)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+type RestoreRequest struct {
+	Title string `json:"title"`
+}
+
+func HandleRestorePost(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req RestoreRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+
+	postVersions, err := blogPostDataDB.FetchAllPostVersions(r.Context(), username, req.Title)
+	if err != nil {
+		http.Error(w, "Failed to fetch post versions", http.StatusInternalServerError)
+		return
+	}
+	if !inTrash(postVersions.Versions) {
+		http.Error(w, "No such Blog Post in the trash", http.StatusNotFound)
+		return
+	}
+
+	_, err = blogPostDataDB.TrashBlogPost(r.Context(), username, req.Title, nil)
+	if err != nil {
+		http.Error(w, "Failed to restore blog post", http.StatusInternalServerError)
+		return
+	}
+	invalidatePost(r.Context(), username, req.Title, postVersions.Versions)
+
+	w.WriteHeader(http.StatusOK)
+}
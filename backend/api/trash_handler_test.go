@@ -0,0 +1,171 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/trash"
+	"github.com/stretchr/testify/assert"
+)
+
+// trashedVersions serves "Test Post" as a post in the trash.
+func trashedVersions(deletedAt time.Time) func(ctx context.Context, username, title string) (db.BlogPostVersionsData, error) {
+	return func(ctx context.Context, username, title string) (db.BlogPostVersionsData, error) {
+		if title != "Test Post" {
+			return db.BlogPostVersionsData{}, nil
+		}
+		return db.BlogPostVersionsData{Title: title, Versions: []db.BlogPostData{
+			{User: username, Title: title, Slug: "test-post", Version: "1", IsActive: true, DeletedAt: &deletedAt},
+		}}, nil
+	}
+}
+
+func TestHandleFetchTrash(t *testing.T) {
+	deletedAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	blogPostDataDB = &mockBlogPostDataDB{active: []db.BlogPostData{
+		{User: "testuser", Title: "Test Post", Slug: "test-post", Version: "2", IsActive: true, DeletedAt: &deletedAt},
+		{User: "testuser", Title: "Live Post", Slug: "live-post", Version: "1", IsActive: true},
+	}}
+	SetTrashRetention(24 * time.Hour)
+	t.Cleanup(func() { SetTrashRetention(trash.DefaultRetention) })
+
+	rr := httptest.NewRecorder()
+	HandleFetchTrash(rr, withUser(httptest.NewRequest("GET", "/user/trash", nil)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var trashed []TrashedPost
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&trashed))
+	assert.Equal(t, []TrashedPost{{
+		Title:     "Test Post",
+		Slug:      "test-post",
+		Version:   "2",
+		DeletedAt: deletedAt,
+		PurgeAt:   deletedAt.Add(24 * time.Hour),
+	}}, trashed)
+}
+
+func TestHandleRestorePost(t *testing.T) {
+	mock := &mockBlogPostDataDB{FetchAllPostVersionsFunc: trashedVersions(time.Now())}
+	blogPostDataDB = mock
+
+	rr := httptest.NewRecorder()
+	HandleRestorePost(rr, withUser(httptest.NewRequest("POST", "/trash/restore", strings.NewReader(`{"title":"Test Post"}`))))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	if assert.Contains(t, mock.trashed, "Test Post") {
+		assert.Nil(t, mock.trashed["Test Post"])
+	}
+
+	// posts that are not in the trash cannot be restored
+	blogPostDataDB = &mockBlogPostDataDB{FetchAllPostVersionsFunc: postVersions}
+	rr = httptest.NewRecorder()
+	HandleRestorePost(rr, withUser(httptest.NewRequest("POST", "/trash/restore", strings.NewReader(`{"title":"Test Post"}`))))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHandleFetchBlogPost_Trashed(t *testing.T) {
+	useTestBlobStore(t)
+	deletedAt := time.Now()
+	blogPostDataDB = &mockBlogPostDataDB{
+		slugs: map[string]string{"test-post": "Test Post"},
+		FetchBlogPostFunc: func(ctx context.Context, username, title, version string) (db.BlogPostData, error) {
+			return db.BlogPostData{User: username, Title: title, Version: version, IsActive: true, DeletedAt: &deletedAt}, nil
+		},
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("username", "testuser")
+	rctx.URLParams.Add("post", "test-post")
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	rr := httptest.NewRecorder()
+
+	HandleFetchBlogPost(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHandleUpload_Trashed(t *testing.T) {
+	useTestBlobStore(t)
+	t.Cleanup(func() { os.RemoveAll("cmd/") })
+	mock := &mockBlogPostDataDB{
+		slugs:                    map[string]string{"test-post": "Test Post"},
+		FetchAllPostVersionsFunc: trashedVersions(time.Now()),
+	}
+	blogPostDataDB = mock
+
+	var b bytes.Buffer
+	wr := multipart.NewWriter(&b)
+	fw, _ := wr.CreateFormFile("file", "test.md")
+	if _, err := io.Copy(fw, strings.NewReader("# Hello")); err != nil {
+		t.Fatalf("io.Copy failed: %v", err)
+	}
+	if err := wr.WriteField("title", "Test Post"); err != nil {
+		t.Fatalf("wr.WriteField failed: %v", err)
+	}
+	wr.Close()
+
+	req := httptest.NewRequest("POST", "/upload", &b)
+	req.Header.Set("Content-Type", wr.FormDataContentType())
+	rr := httptest.NewRecorder()
+
+	HandleUpload(rr, withUser(req))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Empty(t, mock.created)
+}
+
+func TestPurgePost_FailedFileDeleteKeepsPost(t *testing.T) {
+	store := useTestBlobStore(t)
+	err := store.Put(context.Background(), "testuser_test-post_1.html", strings.NewReader("<p>hi</p>"), "text/html")
+	if err != nil {
+		t.Fatalf("store.Put failed: %v", err)
+	}
+	mock := &mockBlogPostDataDB{FetchAllPostVersionsFunc: trashedVersions(time.Now())}
+	blogPostDataDB = mock
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	// the post stays in the trash, so the next purge can retry
+	blobStore = failingDeleteStore{store}
+	err = PurgePost(context.Background(), "testuser", "Test Post")
+	assert.Error(t, err)
+	assert.Empty(t, mock.deleted)
+
+	blobStore = store
+	err = PurgePost(context.Background(), "testuser", "Test Post")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Test Post"}, mock.deleted)
+	_, err = store.Stat(context.Background(), "testuser_test-post_1.html")
+	assert.Error(t, err)
+}
+
+func TestPurgePost_ClearsSchedule(t *testing.T) {
+	useTestBlobStore(t)
+	var cleared []string
+	mock := &mockBlogPostDataDB{
+		FetchAllPostVersionsFunc: manyVersions,
+		SchedulePublishFunc: func(ctx context.Context, username, title, version string, at *time.Time) error {
+			if at == nil {
+				cleared = append(cleared, version)
+			}
+			return nil
+		},
+	}
+	blogPostDataDB = mock
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	err := PurgePost(context.Background(), "testuser", "Test Post")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3"}, cleared)
+	assert.Equal(t, []string{"Test Post"}, mock.deleted)
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
+)
+
+const (
+	DefaultQuotaBytes   = 512 << 20
+	DefaultQuotaObjects = 10000
+)
+
+var usageDB db.UsageDB
+
+// defaultQuota applies to every user without an admin override.
+var defaultQuota db.Quota
+
+func SetUsageDB(repo db.UsageDB) {
+	usageDB = repo
+}
+
+func SetDefaultQuota(quota db.Quota) {
+	defaultQuota = quota
+}
+
+// QuotaExceededError is returned when a write would take a user past their
+// storage quota.
+type QuotaExceededError struct {
+	Username string
+	Quota    db.Quota
+	Bytes    int64
+	Objects  int64
+	// AddBytes and AddObjects are what the rejected write needed.
+	AddBytes   int64
+	AddObjects int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	if e.Quota.Bytes > 0 && e.Bytes+e.AddBytes > e.Quota.Bytes {
+		return fmt.Sprintf("Storage quota exceeded: %s of %s used, this upload needs %s more",
+			formatBytes(e.Bytes), formatBytes(e.Quota.Bytes), formatBytes(e.AddBytes))
+	}
+	return fmt.Sprintf("Storage quota exceeded: %d of %d files used, this upload adds %d",
+		e.Objects, e.Quota.Objects, e.AddObjects)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func effectiveQuota(usage *db.Usage) db.Quota {
+	if usage.Quota != nil {
+		return *usage.Quota
+	}
+	return defaultQuota
+}
+
+// checkQuota returns a *QuotaExceededError when storing bytes and objects
+// more would take the user past their quota. Nothing is enforced without a
+// usage db.
+func checkQuota(ctx context.Context, username string, bytes int64, objects int64) error {
+	if usageDB == nil {
+		return nil
+	}
+	usage, err := usageDB.GetUsage(ctx, username)
+	if err != nil {
+		return fmt.Errorf("failed to fetch storage usage: %w", err)
+	}
+	quota := effectiveQuota(usage)
+	overBytes := quota.Bytes > 0 && bytes > 0 && usage.Bytes+bytes > quota.Bytes
+	overObjects := quota.Objects > 0 && objects > 0 && usage.Objects+objects > quota.Objects
+	if overBytes || overObjects {
+		return quotaExceeded(usage, bytes, objects)
+	}
+	return nil
+}
+
+func quotaExceeded(usage *db.Usage, bytes int64, objects int64) *QuotaExceededError {
+	return &QuotaExceededError{
+		Username:   usage.Username,
+		Quota:      effectiveQuota(usage),
+		Bytes:      usage.Bytes,
+		Objects:    usage.Objects,
+		AddBytes:   bytes,
+		AddObjects: objects,
+	}
+}
+
+// putUserObject stores an object on behalf of username and charges them for
+// it. Overwriting an existing key only charges the size difference. The
+// charge is reserved against the quota before the write and given back if
+// the write fails, so concurrent writes cannot go over the quota together.
+func putUserObject(ctx context.Context, store storage.BlobStore, username string, key string, body io.Reader, size int64, contentType string) error {
+	if usageDB == nil {
+		return store.Put(ctx, key, body, contentType)
+	}
+
+	var prevSize, prevObjects int64
+	info, err := store.Stat(ctx, key)
+	if err == nil {
+		prevSize, prevObjects = info.Size, 1
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	addBytes, addObjects := size-prevSize, 1-prevObjects
+	if addBytes == 0 && addObjects == 0 {
+		return store.Put(ctx, key, body, contentType)
+	}
+
+	reserved, err := usageDB.ReserveUsage(ctx, username, addBytes, addObjects, defaultQuota)
+	if err != nil {
+		return fmt.Errorf("failed to reserve storage usage: %w", err)
+	}
+	if !reserved {
+		usage, err := usageDB.GetUsage(ctx, username)
+		if err != nil {
+			return fmt.Errorf("failed to fetch storage usage: %w", err)
+		}
+		return quotaExceeded(usage, addBytes, addObjects)
+	}
+	err = store.Put(ctx, key, body, contentType)
+	if err != nil {
+		if err := usageDB.AddUsage(ctx, username, -addBytes, -addObjects); err != nil {
+			fmt.Printf("failed to release storage usage for %s: %v\n", username, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// deleteUserObject removes an object and credits its size back to username.
+func deleteUserObject(ctx context.Context, store storage.BlobStore, username string, key string) error {
+	if usageDB == nil {
+		return store.Delete(ctx, key)
+	}
+
+	info, err := store.Stat(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = store.Delete(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := usageDB.AddUsage(ctx, username, -info.Size, -1); err != nil {
+		fmt.Printf("failed to record storage usage for %s: %v\n", username, err)
+	}
+	return nil
+}
+
+// writeQuotaError answers 413 when err is a quota rejection and reports
+// whether it did.
+func writeQuotaError(w http.ResponseWriter, err error) bool {
+	var quotaErr *QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	http.Error(w, quotaErr.Error(), http.StatusRequestEntityTooLarge)
+	return true
+}
+
+type UsageResponse struct {
+	Bytes   int64    `json:"bytes"`
+	Objects int64    `json:"objects"`
+	Quota   db.Quota `json:"quota"`
+	// Override is set when an admin changed this user's quota.
+	Override bool `json:"override"`
+}
+
+func HandleUserUsage(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	response := UsageResponse{Quota: defaultQuota}
+	if usageDB != nil {
+		usage, err := usageDB.GetUsage(r.Context(), username)
+		if err != nil {
+			http.Error(w, "Failed to fetch storage usage", http.StatusInternalServerError)
+			return
+		}
+		response = UsageResponse{
+			Bytes:    usage.Bytes,
+			Objects:  usage.Objects,
+			Quota:    effectiveQuota(usage),
+			Override: usage.Quota != nil,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutUserObject_ChargesAndCredits(t *testing.T) {
+	store := useTestBlobStore(t)
+	usage := useTestUsageDB(t, db.Quota{})
+	ctx := context.Background()
+
+	assert.NoError(t, putUserObject(ctx, store, "alice", "alice_post_1.md", strings.NewReader("12345"), 5, "text/markdown"))
+	assert.Equal(t, int64(5), usage.usage["alice"].Bytes)
+	assert.Equal(t, int64(1), usage.usage["alice"].Objects)
+
+	// overwriting only charges the difference
+	assert.NoError(t, putUserObject(ctx, store, "alice", "alice_post_1.md", strings.NewReader("12"), 2, "text/markdown"))
+	assert.Equal(t, int64(2), usage.usage["alice"].Bytes)
+	assert.Equal(t, int64(1), usage.usage["alice"].Objects)
+
+	assert.NoError(t, deleteUserObject(ctx, store, "alice", "alice_post_1.md"))
+	assert.Equal(t, int64(0), usage.usage["alice"].Bytes)
+	assert.Equal(t, int64(0), usage.usage["alice"].Objects)
+
+	// a missing object is not credited twice
+	assert.NoError(t, deleteUserObject(ctx, store, "alice", "alice_post_1.md"))
+	assert.Equal(t, int64(0), usage.usage["alice"].Objects)
+}
+
+func TestPutUserObject_RejectsOverQuota(t *testing.T) {
+	store := useTestBlobStore(t)
+	usage := useTestUsageDB(t, db.Quota{Bytes: 10, Objects: 5})
+	ctx := context.Background()
+
+	assert.NoError(t, putUserObject(ctx, store, "alice", "a.md", strings.NewReader("12345678"), 8, "text/markdown"))
+
+	err := putUserObject(ctx, store, "alice", "b.md", strings.NewReader("123"), 3, "text/markdown")
+	var quotaErr *QuotaExceededError
+	if assert.True(t, errors.As(err, &quotaErr)) {
+		assert.Equal(t, "Storage quota exceeded: 8 B of 10 B used, this upload needs 3 B more", quotaErr.Error())
+	}
+	_, err = store.Stat(ctx, "b.md")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// shrinking an object is always allowed
+	assert.NoError(t, putUserObject(ctx, store, "alice", "a.md", strings.NewReader("1"), 1, "text/markdown"))
+
+	// an admin override replaces the default
+	assert.NoError(t, usage.SetQuota(ctx, "alice", &db.Quota{Bytes: 100, Objects: 1}))
+	err = putUserObject(ctx, store, "alice", "b.md", strings.NewReader("123"), 3, "text/markdown")
+	assert.ErrorContains(t, err, "1 of 1 files used")
+}
+
+func TestPutUserObject_FailedWriteReleasesUsage(t *testing.T) {
+	store := useTestBlobStore(t)
+	usage := useTestUsageDB(t, db.Quota{Bytes: 10})
+	ctx := context.Background()
+
+	err := putUserObject(ctx, failingPutStore{store}, "alice", "a.md", strings.NewReader("12345678"), 8, "text/markdown")
+	assert.ErrorContains(t, err, "put failed")
+	assert.Equal(t, int64(0), usage.usage["alice"].Bytes)
+	assert.Equal(t, int64(0), usage.usage["alice"].Objects)
+
+	// the released bytes can be used again
+	assert.NoError(t, putUserObject(ctx, store, "alice", "a.md", strings.NewReader("12345678"), 8, "text/markdown"))
+}
+
+func TestHandleUpload_OverQuota(t *testing.T) {
+	store := useTestBlobStore(t)
+	useTestUsageDB(t, db.Quota{Bytes: 10})
+
+	blogPostDataDB = &mockBlogPostDataDB{}
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	var b bytes.Buffer
+	wr := multipart.NewWriter(&b)
+	fw, _ := wr.CreateFormFile("file", "test.md")
+	if _, err := io.Copy(fw, strings.NewReader("# Hello\nTest")); err != nil {
+		t.Fatalf("io.Copy failed: %v", err)
+	}
+	wr.Close()
+
+	req := httptest.NewRequest("POST", "/upload", &b)
+	req.Header.Set("Content-Type", wr.FormDataContentType())
+	req = req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, "testuser"))
+	rr := httptest.NewRecorder()
+
+	HandleUpload(rr, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Storage quota exceeded")
+	objects, err := store.List(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+}
+
+func TestExtractZip_ChargesNewAssetsOnce(t *testing.T) {
+	store := useTestBlobStore(t)
+	usage := useTestUsageDB(t, db.Quota{})
+	useTestAssetDB(t)
+
+	upload := buildZip(t, map[string]string{
+		"post.md": "![img](pic.png)",
+		"pic.png": testPNG(t, 8, 8, 1),
+	})
+	_, err := extractZip(context.Background(), bytes.NewReader(upload), int64(len(upload)), store, "alice")
+	assert.NoError(t, err)
+	charged := *usage.usage["alice"]
+	assert.Positive(t, charged.Bytes)
+
+	// a second user reusing the same file is not charged for it
+	_, err = extractZip(context.Background(), bytes.NewReader(upload), int64(len(upload)), store, "bob")
+	assert.NoError(t, err)
+	assert.NotContains(t, usage.usage, "bob")
+	assert.Equal(t, charged.Bytes, usage.usage["alice"].Bytes)
+}
+
+func TestExtractZip_FailedAssetLookup(t *testing.T) {
+	store := useTestBlobStore(t)
+	usage := useTestUsageDB(t, db.Quota{})
+	assets := useTestAssetDB(t)
+	assets.err = errors.New("connection reset")
+
+	// a lookup that failed is not a miss, the file is neither stored nor charged
+	upload := buildZip(t, map[string]string{
+		"post.md": "![img](pic.png)",
+		"pic.png": testPNG(t, 8, 8, 1),
+	})
+	_, err := extractZip(context.Background(), bytes.NewReader(upload), int64(len(upload)), store, "alice")
+	assert.Error(t, err)
+	assert.NotContains(t, usage.usage, "alice")
+	assert.Zero(t, assets.saves)
+}
+
+func TestHandleUserUsage(t *testing.T) {
+	usage := useTestUsageDB(t, db.Quota{Bytes: 1000, Objects: 10})
+	assert.NoError(t, usage.AddUsage(context.Background(), "testuser", 250, 3))
+
+	req := httptest.NewRequest("GET", "/user/usage", nil)
+	req = req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, "testuser"))
+	rr := httptest.NewRecorder()
+
+	HandleUserUsage(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response UsageResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.Equal(t, UsageResponse{Bytes: 250, Objects: 3, Quota: db.Quota{Bytes: 1000, Objects: 10}}, response)
+}
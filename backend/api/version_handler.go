@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/markdown_render"
+)
+
+// postRevisions lists the versions up to the active one that have a message,
+// newest first. Newer versions are not public yet and stay out.
+func postRevisions(ctx context.Context, username string, title string, active string) ([]markdown_render.Revision, error) {
+	postVersions, err := blogPostDataDB.FetchAllPostVersions(ctx, username, title)
+	if err != nil {
+		return nil, err
+	}
+	activeNum, _ := strconv.Atoi(active)
+
+	revisions := []markdown_render.Revision{}
+	for _, post := range postVersions.Versions {
+		num, _ := strconv.Atoi(post.Version)
+		if num > activeNum || post.Message == "" {
+			continue
+		}
+		revisions = append(revisions, markdown_render.Revision{Version: post.Version, Date: post.DateUploaded, Message: post.Message})
+	}
+	slices.SortFunc(revisions, func(a, b markdown_render.Revision) int {
+		va, _ := strconv.Atoi(a.Version)
+		vb, _ := strconv.Atoi(b.Version)
+		return vb - va
+	})
+	return revisions, nil
+}
+
+type DeleteVersionRequest struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// HandleDeletePostVersion deletes one version of a post. The active version
+// cannot be deleted, publish another one or delete the whole post instead.
+func HandleDeletePostVersion(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req DeleteVersionRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+
+	postVersions, err := blogPostDataDB.FetchAllPostVersions(r.Context(), username, req.Title)
+	if err != nil {
+		http.Error(w, "Failed to fetch post versions", http.StatusInternalServerError)
+		return
+	}
+	found := false
+	for _, post := range postVersions.Versions {
+		if post.Version != req.Version {
+			continue
+		}
+		found = true
+		if post.IsActive {
+			http.Error(w, "The active version cannot be deleted", http.StatusConflict)
+			return
+		}
+		running, err := inExperiment(r.Context(), username, req.Title, post.Version)
+		if err != nil {
+			http.Error(w, "Failed to fetch experiment", http.StatusInternalServerError)
+			return
+		}
+		if running {
+			http.Error(w, "The version is part of a running experiment", http.StatusConflict)
+			return
+		}
+		err = deletePostVersion(r.Context(), post)
+		if err != nil {
+			http.Error(w, "Failed to delete version", http.StatusInternalServerError)
+			fmt.Println(err)
+			return
+		}
+	}
+	if !found {
+		http.Error(w, "No such version exists", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+type PruneVersionsRequest struct {
+	Title string `json:"title"`
+	// Keep is how many of the newest versions survive.
+	Keep int `json:"keep"`
+}
+
+type PruneVersionsResponse struct {
+	Deleted []string `json:"deleted"`
+}
+
+func HandlePrunePostVersions(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req PruneVersionsRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+	if req.Keep < 1 {
+		http.Error(w, "Keep at least one version", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := pruneVersions(r.Context(), username, req.Title, req.Keep)
+	if err != nil {
+		http.Error(w, "Failed to prune versions", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(PruneVersionsResponse{Deleted: deleted})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// manyVersions serves "Test Post" with versions 1 to 6, 2 active and 3
+// scheduled.
+func manyVersions(ctx context.Context, username, title string) (db.BlogPostVersionsData, error) {
+	if title != "Test Post" {
+		return db.BlogPostVersionsData{}, nil
+	}
+	later := time.Now().Add(time.Hour)
+	versions := []db.BlogPostData{}
+	for _, version := range []string{"1", "2", "3", "4", "5", "6"} {
+		post := db.BlogPostData{User: username, Title: title, Slug: "test-post", Version: version}
+		post.IsActive = version == "2"
+		if version == "3" {
+			post.PublishAt = &later
+		}
+		versions = append(versions, post)
+	}
+	return db.BlogPostVersionsData{Title: title, Versions: versions, LatestVersion: "6", ActiveVersion: "2"}, nil
+}
+
+func TestHandleDeletePostVersion(t *testing.T) {
+	store := useTestBlobStore(t)
+	for _, key := range []string{"testuser_test-post_4.html", "testuser_test-post_4.md"} {
+		err := store.Put(context.Background(), key, strings.NewReader("v4"), "text/plain")
+		if err != nil {
+			t.Fatalf("store.Put failed: %v", err)
+		}
+	}
+	mock := &mockBlogPostDataDB{FetchAllPostVersionsFunc: manyVersions}
+	blogPostDataDB = mock
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	rr := httptest.NewRecorder()
+	HandleDeletePostVersion(rr, withUser(httptest.NewRequest("POST", "/post/version/delete", strings.NewReader(`{"title":"Test Post","version":"4"}`))))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []string{"Test Post/4"}, mock.deleted)
+	_, err := storage.ReadString(context.Background(), store, "testuser_test-post_4.html")
+	assert.Error(t, err)
+	_, err = storage.ReadString(context.Background(), store, "testuser_test-post_4.md")
+	assert.Error(t, err)
+}
+
+func TestHandleDeletePostVersion_FailedFileDeleteKeepsVersion(t *testing.T) {
+	store := useTestBlobStore(t)
+	mock := &mockBlogPostDataDB{FetchAllPostVersionsFunc: manyVersions}
+	blogPostDataDB = mock
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	// the version stays listed with its files, so deleting it can be retried
+	blobStore = failingDeleteStore{store}
+	rr := httptest.NewRecorder()
+	HandleDeletePostVersion(rr, withUser(httptest.NewRequest("POST", "/post/version/delete", strings.NewReader(`{"title":"Test Post","version":"4"}`))))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Empty(t, mock.deleted)
+}
+
+func TestHandleDeletePostVersion_Refused(t *testing.T) {
+	useTestBlobStore(t)
+	mock := &mockBlogPostDataDB{FetchAllPostVersionsFunc: manyVersions}
+	blogPostDataDB = mock
+
+	for _, tc := range []struct {
+		body string
+		code int
+	}{
+		{`{"title":"Test Post","version":"2"}`, http.StatusConflict},
+		{`{"title":"Test Post","version":"9"}`, http.StatusNotFound},
+		{`{"title":"Missing","version":"1"}`, http.StatusNotFound},
+	} {
+		rr := httptest.NewRecorder()
+		HandleDeletePostVersion(rr, withUser(httptest.NewRequest("POST", "/post/version/delete", strings.NewReader(tc.body))))
+		assert.Equal(t, tc.code, rr.Code, tc.body)
+	}
+	assert.Empty(t, mock.deleted)
+}
+
+func TestHandlePrunePostVersions(t *testing.T) {
+	useTestBlobStore(t)
+	mock := &mockBlogPostDataDB{FetchAllPostVersionsFunc: manyVersions}
+	blogPostDataDB = mock
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	rr := httptest.NewRecorder()
+	HandlePrunePostVersions(rr, withUser(httptest.NewRequest("POST", "/post/prune", strings.NewReader(`{"title":"Test Post","keep":2}`))))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp PruneVersionsResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	// 6 and 5 are the newest, 2 is active and 3 scheduled
+	assert.Equal(t, []string{"4", "1"}, resp.Deleted)
+	assert.Equal(t, []string{"Test Post/4", "Test Post/1"}, mock.deleted)
+
+	rr = httptest.NewRecorder()
+	HandlePrunePostVersions(rr, withUser(httptest.NewRequest("POST", "/post/prune", strings.NewReader(`{"title":"Test Post","keep":0}`))))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestHandleFetchBlogPost_RevisionHistory(t *testing.T) {
+	store := useTestBlobStore(t)
+	err := store.Put(context.Background(), "testuser_test-post_2.html", strings.NewReader("<p>Body</p>"), "text/html")
+	if err != nil {
+		t.Fatalf("store.Put failed: %v", err)
+	}
+	uploaded := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	blogPostDataDB = &mockBlogPostDataDB{
+		slugs: map[string]string{"test-post": "Test Post"},
+		FetchActiveBlogFunc: func(ctx context.Context, username, title string) (string, error) {
+			return "2", nil
+		},
+		FetchBlogPostFunc: func(ctx context.Context, username, title, version string) (db.BlogPostData, error) {
+			return db.BlogPostData{User: username, Title: title, Slug: "test-post", Version: version, IsActive: true, ShowHistory: true}, nil
+		},
+		FetchAllPostVersionsFunc: func(ctx context.Context, username, title string) (db.BlogPostVersionsData, error) {
+			return db.BlogPostVersionsData{Title: title, Versions: []db.BlogPostData{
+				{Version: "1", DateUploaded: uploaded, Message: "First draft"},
+				{Version: "2", DateUploaded: uploaded, Message: "Fix typos", IsActive: true},
+				{Version: "3", DateUploaded: uploaded, Message: "Not out yet"},
+			}}, nil
+		},
+	}
+	userDB = &mockUserDB{}
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("username", "testuser")
+	rctx.URLParams.Add("post", "test-post")
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	rr := httptest.NewRecorder()
+
+	HandleFetchBlogPost(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	page := rr.Body.String()
+	assert.Contains(t, page, "Revision history")
+	assert.Contains(t, page, "v2: Fix typos")
+	assert.Contains(t, page, "v1: First draft")
+	assert.NotContains(t, page, "Not out yet")
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/db/redisdb"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
+)
+
+// uploadVisibility is the visibility of a newly uploaded version: the requested
+// one when given, otherwise that of the existing post, or public for a new post.
+func uploadVisibility(existing []db.BlogPostData, requested string) (db.Visibility, error) {
+	if requested == "" {
+		if len(existing) > 0 {
+			return existing[0].Visibility, nil
+		}
+		return db.VisibilityPublic, nil
+	}
+	visibility := db.Visibility(requested)
+	if !visibility.Valid() {
+		return "", fmt.Errorf("invalid visibility %q", requested)
+	}
+	return visibility, nil
+}
+
+// syncUploadVisibility applies the visibility of a new version to the older
+// versions of its post, so a re-upload asking for another visibility changes
+// the whole post the way the visibility endpoint does.
+func syncUploadVisibility(ctx context.Context, post *db.BlogPostData, existing []db.BlogPostData) error {
+	if len(existing) == 0 || existing[0].Visibility == post.Visibility {
+		return nil
+	}
+	_, err := blogPostDataDB.SetPostVisibility(ctx, post.User, post.Title, post.Visibility)
+	if err != nil {
+		return err
+	}
+	post_tags := append([]string{}, post.Tags...)
+	for _, version := range existing {
+		post_tags = append(post_tags, version.Tags...)
+	}
+	invalidateListings(ctx, post_tags)
+	return nil
+}
+
+// canView reports whether the requester, "" when anonymous, may read a post
+// of owner with this visibility.
+func canView(visibility db.Visibility, owner string, requester string) bool {
+	switch visibility {
+	case db.VisibilityDraft:
+		return false
+	case db.VisibilityPrivate:
+		return requester != "" && requester == owner
+	}
+	return true
+}
+
+// invalidateListings drops the cached discover feeds, including those of
+// post_tags, which a visibility change can add a post to or remove it from.
+func invalidateListings(ctx context.Context, post_tags []string) {
+	if !redisdb.RedisActive {
+		return
+	}
+	keys := []string{"discover:new", "discover:top"}
+	for _, tag := range post_tags {
+		keys = append(keys, tagFeedKey(tag))
+	}
+	for _, key := range keys {
+		err := redisdb.DeleteEndpoint(ctx, key)
+		if err != nil {
+			fmt.Printf("Error removing %s from redis\n", key)
+		}
+	}
+}
+
+type VisibilityRequest struct {
+	Title      string        `json:"title"`
+	Visibility db.Visibility `json:"visibility"`
+}
+
+func HandleSetPostVisibility(w http.ResponseWriter, r *http.Request) {
+	username, ok := r.Context().Value(auth.UsernameKey).(string)
+	if !ok || username == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req VisibilityRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+	if !req.Visibility.Valid() {
+		http.Error(w, "Visibility must be draft, unlisted, public or private", http.StatusBadRequest)
+		return
+	}
+
+	versions, err := blogPostDataDB.FetchAllPostVersions(r.Context(), username, req.Title)
+	if err != nil {
+		http.Error(w, "Failed to fetch blog post", http.StatusInternalServerError)
+		return
+	}
+	if len(versions.Versions) == 0 {
+		http.Error(w, "No such Blog Post exists", http.StatusNotFound)
+		return
+	}
+	post_slug := versions.Versions[0].Slug
+	var post_tags []string
+	for _, version := range versions.Versions {
+		post_tags = append(post_tags, version.Tags...)
+	}
+
+	_, err = blogPostDataDB.SetPostVisibility(r.Context(), username, req.Title, req.Visibility)
+	if err != nil {
+		http.Error(w, "Failed to update visibility", http.StatusInternalServerError)
+		return
+	}
+
+	if redisdb.RedisActive {
+		err = redisdb.DeleteEndpoint(r.Context(), slug.Path(username, post_slug))
+		if err != nil {
+			fmt.Printf("Error removing old endpoint from redis")
+		}
+	}
+	invalidateListings(r.Context(), post_tags)
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleFetchBlogPost_Visibility(t *testing.T) {
+	store := useTestBlobStore(t)
+	err := store.Put(context.Background(), "testuser_test-post_1.html", strings.NewReader("Test Blog Content"), "text/html")
+	if err != nil {
+		t.Fatalf("store.Put failed: %v", err)
+	}
+	userDB = &mockUserDB{}
+	AnalyticsDataDB = &mockAnalyticsDataDB{}
+
+	for _, tc := range []struct {
+		visibility db.Visibility
+		requester  string
+		code       int
+	}{
+		{db.VisibilityPublic, "", http.StatusOK},
+		{db.VisibilityUnlisted, "", http.StatusOK},
+		{db.VisibilityDraft, "", http.StatusNotFound},
+		{db.VisibilityDraft, "testuser", http.StatusNotFound},
+		{db.VisibilityPrivate, "", http.StatusNotFound},
+		{db.VisibilityPrivate, "otheruser", http.StatusNotFound},
+		{db.VisibilityPrivate, "testuser", http.StatusOK},
+	} {
+		visibility := tc.visibility
+		blogPostDataDB = &mockBlogPostDataDB{
+			slugs: map[string]string{"test-post": "Test Post"},
+			FetchBlogPostFunc: func(ctx context.Context, username, title, version string) (db.BlogPostData, error) {
+				return db.BlogPostData{
+					User:         username,
+					Title:        title,
+					Version:      version,
+					DateUploaded: time.Now(),
+					IsActive:     true,
+					Visibility:   visibility,
+				}, nil
+			},
+		}
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("username", "testuser")
+		rctx.URLParams.Add("post", "test-post")
+		ctx := context.WithValue(context.Background(), chi.RouteCtxKey, rctx)
+		if tc.requester != "" {
+			ctx = context.WithValue(ctx, auth.UsernameKey, tc.requester)
+		}
+		req := httptest.NewRequest("GET", "/testuser/test-post", nil).WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		HandleFetchBlogPost(rr, req)
+
+		assert.Equal(t, tc.code, rr.Code, "%s as %q", tc.visibility, tc.requester)
+	}
+}
+
+// postVersions returns the versions of the post titled "Test Post", no
+// versions for any other title.
+func postVersions(ctx context.Context, username, title string) (db.BlogPostVersionsData, error) {
+	if title != "Test Post" {
+		return db.BlogPostVersionsData{}, nil
+	}
+	return db.BlogPostVersionsData{Title: title, Versions: []db.BlogPostData{
+		{User: username, Title: title, Slug: "test-post", Version: "1", IsActive: true, Tags: []string{"go"}},
+	}}, nil
+}
+
+func TestHandleSetPostVisibility(t *testing.T) {
+	mock := &mockBlogPostDataDB{FetchAllPostVersionsFunc: postVersions}
+	blogPostDataDB = mock
+
+	body := `{"title":"Test Post","visibility":"private"}`
+	rr := httptest.NewRecorder()
+	HandleSetPostVisibility(rr, withUser(httptest.NewRequest("POST", "/post/visibility", strings.NewReader(body))))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, db.VisibilityPrivate, mock.visibility["Test Post"])
+}
+
+func TestHandleSetPostVisibility_Invalid(t *testing.T) {
+	blogPostDataDB = &mockBlogPostDataDB{FetchAllPostVersionsFunc: postVersions}
+
+	for body, code := range map[string]int{
+		`{"title":"Test Post","visibility":"secret"}`: http.StatusBadRequest,
+		`{"title":"Other Post","visibility":"draft"}`: http.StatusNotFound,
+	} {
+		rr := httptest.NewRecorder()
+		HandleSetPostVisibility(rr, withUser(httptest.NewRequest("POST", "/post/visibility", strings.NewReader(body))))
+		assert.Equal(t, code, rr.Code, body)
+	}
+}
+
+func TestUploadVisibility(t *testing.T) {
+	visibility, err := uploadVisibility(nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, db.VisibilityPublic, visibility)
+
+	visibility, err = uploadVisibility(nil, "draft")
+	assert.NoError(t, err)
+	assert.Equal(t, db.VisibilityDraft, visibility)
+
+	_, err = uploadVisibility(nil, "secret")
+	assert.Error(t, err)
+
+	// later versions keep the visibility of the post unless asked otherwise
+	existing := []db.BlogPostData{{Version: "1", Visibility: db.VisibilityUnlisted}}
+	visibility, err = uploadVisibility(existing, "")
+	assert.NoError(t, err)
+	assert.Equal(t, db.VisibilityUnlisted, visibility)
+
+	visibility, err = uploadVisibility(existing, "public")
+	assert.NoError(t, err)
+	assert.Equal(t, db.VisibilityPublic, visibility)
+
+	_, err = uploadVisibility(existing, "secret")
+	assert.Error(t, err)
+}
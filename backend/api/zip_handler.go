@@ -4,24 +4,50 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"path/filepath"
+	"os"
+	"path"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/shrijan-swaminathan/markbyte/backend/auth"
 	"github.com/shrijan-swaminathan/markbyte/backend/db"
 	"github.com/shrijan-swaminathan/markbyte/backend/db/redisdb"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/attachment"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/frontmatter"
 	"github.com/shrijan-swaminathan/markbyte/backend/features/markdown_render"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
 )
 
+// RejectedAttachmentsError lists every zip entry that is not an allowed
+// attachment type.
+type RejectedAttachmentsError struct {
+	Files []*attachment.RejectedError
+}
+
+func (e *RejectedAttachmentsError) Error() string {
+	lines := make([]string, 0, len(e.Files)+1)
+	lines = append(lines, "Unsupported attachments:")
+	for _, file := range e.Files {
+		lines = append(lines, file.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
 type ZipData struct {
 	md_content   []byte
 	html_content string
 	image_urls   []string
+	asset_hashes []string
 	post_name    string
+	meta         frontmatter.Meta
 }
 
 func HandleZipUpload(w http.ResponseWriter, r *http.Request) {
@@ -32,50 +58,59 @@ func HandleZipUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := r.ParseMultipartForm(20 << 20) // 20 MB
+	r.Body = http.MaxBytesReader(w, r.Body, maxZipUploadSize)
+	err := r.ParseMultipartForm(20 << 20) // 20 MB in memory, the rest on disk
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, fmt.Sprintf("Upload is larger than %d MB", maxZipUploadSize>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to parse form, size issue", http.StatusBadRequest)
 		return
 	}
 
-	file, _, err := r.FormFile("zipfile")
+	file, header, err := r.FormFile("zipfile")
 	if err != nil {
 		http.Error(w, "Failed to read file", http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
-	buf := new(bytes.Buffer)
 
-	//read title
-	title := r.FormValue("title")
-	if strings.ContainsAny(title, `\/:*?"<>|_`) {
-		http.Error(w, "Title contains invalid characters", http.StatusBadRequest)
+	// multipart.File is an io.ReaderAt, so the archive is read in place
+	zip_file_data, err := extractZip(r.Context(), file, header.Size, blobStore, username)
+	var rejection *attachment.RejectedError
+	var rejections *RejectedAttachmentsError
+	var entryErr *ZipEntryError
+	if errors.As(err, &entryErr) {
+		http.Error(w, err.Error(), entryErr.StatusCode())
 		return
 	}
-
-	_, err = io.Copy(buf, file)
-	if err != nil {
-		http.Error(w, "Failed to read ZIP", http.StatusInternalServerError)
+	if errors.As(err, &rejections) || errors.As(err, &rejection) || errors.Is(err, frontmatter.ErrInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	cred, s3err := LoadCredentials()
-	if s3err != nil {
-		fmt.Println("AWS CREDENTIALS NOT SET UP")
+	if writeQuotaError(w, err) {
+		return
+	}
+	if errors.Is(err, zip.ErrFormat) {
+		http.Error(w, "Upload is not a valid zip file", http.StatusBadRequest)
+		return
 	}
-
-	zip_file_data, err := extractZip(r.Context(), buf.Bytes(), cred, username)
 	if err != nil {
 		http.Error(w, "Failed to extract zip", http.StatusInternalServerError)
 		return
 	}
-	if title != "" {
-		zip_file_data.post_name = title
-	} else {
-		title = zip_file_data.post_name
+	zip_file_data.post_name = postTitle(r.FormValue("title"), zip_file_data.meta, zip_file_data.post_name)
+	if strings.ContainsAny(zip_file_data.post_name, `\/:*?"<>|`) {
+		http.Error(w, "Title contains invalid characters", http.StatusBadRequest)
+		return
+	}
+	post_tags, err := uploadTags(r.FormValue("tags"), zip_file_data.meta)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-
-	processed_title := strings.ReplaceAll(title, " ", "_")
 
 	existingPosts, err := blogPostDataDB.FetchAllPostVersions(r.Context(), username, zip_file_data.post_name)
 	existingPostsVersions := existingPosts.Versions
@@ -83,72 +118,57 @@ func HandleZipUpload(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to fetch existing blog posts", http.StatusInternalServerError)
 		return
 	}
-	new_version := 1
-	for _, post := range existingPostsVersions {
-		verNum := 1
-		_, err := fmt.Sscanf(post.Version, "%d", &verNum)
-		if err != nil {
-			http.Error(w, "Failed to parse existing version", http.StatusInternalServerError)
-			return
-		}
-		if verNum >= new_version {
-			new_version = verNum + 1
-		}
-		if post.IsActive {
-			err = blogPostDataDB.UpdateActiveStatus(r.Context(), username, zip_file_data.post_name, post.Version, false)
-			if err != nil {
-				http.Error(w, "Failed to deactivate prev post", http.StatusInternalServerError)
-				return
-			}
-		}
+	if inTrash(existingPostsVersions) {
+		http.Error(w, "Post is in the trash, restore it first", http.StatusConflict)
+		return
 	}
 
-	var url string
-
-	html_keyname := fmt.Sprintf("%s_%s_%d.html", username, processed_title, new_version)
-	md_keyname := fmt.Sprintf("%s_%s_%d.md", username, processed_title, new_version)
-
-	if s3err == nil {
-		s3URL, err := UploadHTMLFile(r.Context(), zip_file_data.html_content, html_keyname, cred)
-		if err != nil {
-			http.Error(w, "Failed to upload html file to s3", http.StatusInternalServerError)
-			fmt.Println(err)
-			return
-		}
-
-		_, err = UploadMDFile(r.Context(), string(zip_file_data.md_content), md_keyname, cred)
-		if err != nil {
-			http.Error(w, "Failed to upload md file to s3", http.StatusInternalServerError)
-			fmt.Println(err)
-			return
-		}
-
-		url = s3URL
+	post_slug, err := postSlug(r.Context(), username, zip_file_data.post_name, zip_file_data.meta.Slug)
+	if err != nil {
+		http.Error(w, "Failed to pick post slug", http.StatusInternalServerError)
+		return
 	}
 
-	endpoint := "/" + username + "/" + processed_title
+	visibility, err := uploadVisibility(existingPostsVersions, uploadVisibilityField(r.FormValue("visibility"), zip_file_data.meta))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	endpoint := slug.Path(username, post_slug)
 	post_time := time.Now()
 
 	new_post := db.BlogPostData{
 		User:         username,
 		Title:        zip_file_data.post_name,
+		Slug:         post_slug,
 		DateUploaded: post_time,
-		Version:      fmt.Sprintf("%d", new_version),
-		IsActive:     true,
-		Link:         &url,
 		DirectLink:   &endpoint,
+		Assets:       zip_file_data.asset_hashes,
+		Visibility:   visibility,
+		Tags:         post_tags,
+		Message:      uploadMessage(r.FormValue("message"), zip_file_data.meta, ""),
 	}
+	applyFrontMatter(&new_post, zip_file_data.meta)
 
-	_, err = blogPostDataDB.CreateBlogPost(r.Context(), &new_post)
+	version, err := createPostVersion(r.Context(), &new_post, zip_file_data.html_content, zip_file_data.md_content)
+	if writeQuotaError(w, err) {
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to create blog post", http.StatusInternalServerError)
+		fmt.Println(err)
+		return
+	}
+	err = syncUploadVisibility(r.Context(), &new_post, existingPostsVersions)
+	if err != nil {
+		http.Error(w, "Failed to update visibility", http.StatusInternalServerError)
 		return
 	}
 
 	newPostAnalytics := db.PostAnalytics{
 		Username:  username,
 		Title:     zip_file_data.post_name,
-		Version:   fmt.Sprintf("%d", new_version),
+		Version:   version,
 		Date:      post_time,
 		Views:     []time.Time{},
 		ViewCount: 0,
@@ -172,74 +192,206 @@ func HandleZipUpload(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func extractZip(ctx context.Context, zipBytes []byte, cred S3Credentials, username string) (ZipData, error) {
-	zipReader, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+// spooledAsset is an attachment that passed its checks and waits on disk
+// until every other entry has been checked too.
+type spooledAsset struct {
+	name string
+	hash string
+	file *attachment.File
+	path string
+	size int64
+}
+
+// extractZip reads the upload one entry at a time within zipLimits. The
+// markdown file is kept in memory, attachments are checked as they are read
+// and spooled to a temp dir, then streamed to the store once all of them
+// passed.
+func extractZip(ctx context.Context, zr io.ReaderAt, size int64, store storage.BlobStore, username string) (ZipData, error) {
+	zipReader, err := zip.NewReader(zr, size)
+	if err != nil {
+		return ZipData{}, err
+	}
+	limits := zipLimits
+	if len(zipReader.File) > limits.MaxEntries {
+		return ZipData{}, &ZipEntryError{Entry: zipReader.File[limits.MaxEntries].Name, Err: ErrZipTooManyEntries}
+	}
+
+	spoolDir, err := os.MkdirTemp("", "markbyte-zip-*")
 	if err != nil {
 		return ZipData{}, err
 	}
+	defer os.RemoveAll(spoolDir)
 
-	var md_name string
+	var md_path string
 	var md_content []byte
 
-	attachments := make(map[string][]byte)
+	// attachments keyed by their cleaned path inside the zip
+	attachments := make(map[string]*spooledAsset)
+	rejected := make([]*attachment.RejectedError, 0)
+	remaining := limits.MaxTotalSize
 	for _, file := range zipReader.File {
 		if file.FileInfo().IsDir() {
 			continue
 		}
-		fname := filepath.Base(file.Name)
-		fileReader, err := file.Open()
+		err = checkZipEntry(file, limits)
 		if err != nil {
 			return ZipData{}, err
 		}
-
-		buf := new(bytes.Buffer)
-		_, err = io.Copy(buf, fileReader)
-		if err != nil {
-			return ZipData{}, err
+		fpath := path.Clean(strings.TrimPrefix(strings.ReplaceAll(file.Name, `\`, "/"), "./"))
+		if isArchiveMetadata(fpath) {
+			continue
 		}
-		fileReader.Close()
-		ext := strings.ToLower(filepath.Ext(fname))
 
-		if ext == ".md" && md_name == "" {
-			md_name = fname
+		ext := strings.ToLower(path.Ext(fpath))
+		if ext == ".md" && md_path == "" {
+			buf := new(bytes.Buffer)
+			n, err := readZipEntry(file, limits, remaining, buf)
+			if err != nil {
+				return ZipData{}, err
+			}
+			remaining -= n
+			md_path = fpath
 			md_content = buf.Bytes()
+			continue
 		} else if ext == ".md" {
 			return ZipData{}, fmt.Errorf("multiple markdown files found")
-		} else {
-			fname = fmt.Sprintf("%s_%s", username, fname)
-			attachments[fname] = buf.Bytes()
 		}
+
+		spooled, n, err := spoolZipEntry(file, fpath, limits, remaining, spoolDir)
+		remaining -= n
+		// check every attachment before storing any, so one bad file reports
+		// all the others too and leaves nothing behind
+		var rejection *attachment.RejectedError
+		if errors.As(err, &rejection) {
+			rejected = append(rejected, rejection)
+			continue
+		} else if err != nil {
+			return ZipData{}, err
+		}
+		attachments[fpath] = spooled
 	}
-	if md_name == "" {
+	if md_path == "" {
 		return ZipData{}, fmt.Errorf("no markdown file found")
 	}
+	meta, md_body, err := frontmatter.Split(md_content)
+	if err != nil {
+		return ZipData{}, err
+	}
+	if len(rejected) > 0 {
+		sort.Slice(rejected, func(i, j int) bool { return rejected[i].Name < rejected[j].Name })
+		return ZipData{}, &RejectedAttachmentsError{Files: rejected}
+	}
 
-	image_urls, err := UploadImages(ctx, attachments, cred)
+	// a rough check before anything is stored: the post files plus every
+	// attachment, ignoring image variants and assets that already exist
+	uploadSize := int64(2 * len(md_content))
+	for _, spooled := range attachments {
+		uploadSize += spooled.size
+	}
+	err = checkQuota(ctx, username, uploadSize, int64(len(attachments)+2))
 	if err != nil {
 		return ZipData{}, err
 	}
 
+	image_urls := make(map[string]string)
+	assets_by_url := make(map[string]*db.Asset)
+	asset_hashes := make([]string, 0, len(attachments))
+	for fpath, spooled := range attachments {
+		asset, err := storeSpooledAsset(ctx, store, username, spooled)
+		if err != nil {
+			return ZipData{}, err
+		}
+		image_urls[fpath] = store.URL(asset.Key)
+		assets_by_url[image_urls[fpath]] = asset
+		asset_hashes = append(asset_hashes, asset.Hash)
+	}
+	sort.Strings(asset_hashes)
+
 	image_url_list := make([]string, 0)
 	for _, value := range image_urls {
 		image_url_list = append(image_url_list, value)
 	}
 
-	for key, value := range image_urls {
-		filename := key[strings.Index(key, "_")+1:]
-		md_content = bytes.ReplaceAll(md_content, []byte(filename), []byte(value))
+	// links are only rewritten in the body, the front matter is kept as is
+	front_matter := md_content[:len(md_content)-len(md_body)]
+	md_body = rewriteAssetLinks(md_body, path.Dir(md_path), image_urls)
+	md_content = append(bytes.Clone(front_matter), md_body...)
+	if cover, ok := image_urls[path.Join(path.Dir(md_path), meta.CoverImage)]; ok && meta.CoverImage != "" {
+		meta.CoverImage = cover
 	}
 
-	htmlContent, err := markdown_render.ConvertMarkdown(md_content)
+	htmlContent, err := markdown_render.ConvertMarkdown(md_body)
 	if err != nil {
 		return ZipData{}, err
 	}
+	htmlContent = addImageVariants(htmlContent, assets_by_url, store)
 
-	postname := strings.TrimSuffix(md_name, ".md")
+	postname := strings.TrimSuffix(path.Base(md_path), path.Ext(md_path))
 
 	return ZipData{
 		md_content:   md_content,
 		html_content: htmlContent,
 		image_urls:   image_url_list,
+		asset_hashes: asset_hashes,
 		post_name:    postname,
+		meta:         meta,
 	}, nil
 }
+
+// spoolZipEntry streams an attachment into a file in spoolDir, hashing it on
+// the way, and checks it from there. Only svg and text files, which are
+// checked throughout, are read back into memory. It returns how much of the
+// zip budget the entry used.
+func spoolZipEntry(file *zip.File, fpath string, limits ZipLimits, remaining int64, spoolDir string) (*spooledAsset, int64, error) {
+	spool, err := os.CreateTemp(spoolDir, "entry-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer spool.Close()
+	hash := sha256.New()
+	n, err := readZipEntry(file, limits, remaining, io.MultiWriter(spool, hash))
+	if err != nil {
+		return nil, n, err
+	}
+
+	checked, err := attachment.CheckReader(fpath, spool, n)
+	if err != nil {
+		return nil, n, err
+	}
+	size := n
+	if checked.Data != nil {
+		// the checked content differs from the upload for sanitized svgs
+		err = spool.Truncate(0)
+		if err == nil {
+			_, err = spool.WriteAt(checked.Data, 0)
+		}
+		if err != nil {
+			return nil, n, err
+		}
+		size = int64(len(checked.Data))
+		checked.Data = nil
+	}
+	return &spooledAsset{
+		name: fpath,
+		hash: hex.EncodeToString(hash.Sum(nil)),
+		file: checked,
+		path: spool.Name(),
+		size: size,
+	}, n, nil
+}
+
+func storeSpooledAsset(ctx context.Context, store storage.BlobStore, username string, spooled *spooledAsset) (*db.Asset, error) {
+	body, err := os.Open(spooled.path)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return storeAsset(ctx, store, username, spooled.name, spooled.hash, spooled.file, body, spooled.size)
+}
+
+// isArchiveMetadata matches the resource forks and folder settings macOS and
+// Windows add when zipping a folder.
+func isArchiveMetadata(fpath string) bool {
+	base := path.Base(fpath)
+	return strings.HasPrefix(fpath, "__MACOSX/") || base == ".DS_Store" || base == "Thumbs.db"
+}
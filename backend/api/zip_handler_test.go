@@ -4,19 +4,25 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"testing"
 
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/frontmatter"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestExtractZip_SingleMarkdown(t *testing.T) {
-	origUploadImages := UploadImages
-	UploadImages = func(ctx context.Context, images map[string][]byte, cred S3Credentials) (map[string]string, error) {
-		return map[string]string{}, nil
-	}
-	defer func() { UploadImages = origUploadImages }()
+// assetHash is the hash an uploaded file is stored under.
+func assetHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
 
-	cred := S3Credentials{}
+func TestExtractZip_SingleMarkdown(t *testing.T) {
+	store := useTestBlobStore(t)
 	username := "testuser"
 
 	// Create an in-memory ZIP with a single .md file
@@ -28,7 +34,7 @@ func TestExtractZip_SingleMarkdown(t *testing.T) {
 	}
 	zipWriter.Close()
 
-	zipData, err := extractZip(context.Background(), zipBuf.Bytes(), cred, username)
+	zipData, err := extractZip(context.Background(), bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()), store, username)
 	assert.NoError(t, err)
 	assert.Equal(t, "test", zipData.post_name)
 	assert.Contains(t, string(zipData.md_content), "Hello")
@@ -36,7 +42,7 @@ func TestExtractZip_SingleMarkdown(t *testing.T) {
 }
 
 func TestExtractZip_NoMarkdown(t *testing.T) {
-	cred := S3Credentials{}
+	store := useTestBlobStore(t)
 	username := "testuser"
 
 	var zipBuf bytes.Buffer
@@ -47,13 +53,13 @@ func TestExtractZip_NoMarkdown(t *testing.T) {
 	}
 	zipWriter.Close()
 
-	_, err := extractZip(context.Background(), zipBuf.Bytes(), cred, username)
+	_, err := extractZip(context.Background(), bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()), store, username)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no markdown file found")
 }
 
 func TestExtractZip_MultipleMarkdown(t *testing.T) {
-	cred := S3Credentials{}
+	store := useTestBlobStore(t)
 	username := "testuser"
 
 	var zipBuf bytes.Buffer
@@ -68,7 +74,261 @@ func TestExtractZip_MultipleMarkdown(t *testing.T) {
 	}
 	zipWriter.Close()
 
-	_, err := extractZip(context.Background(), zipBuf.Bytes(), cred, username)
+	_, err := extractZip(context.Background(), bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()), store, username)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "multiple markdown files found")
 }
+
+func buildZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var zipBuf bytes.Buffer
+	zipWriter := zip.NewWriter(&zipBuf)
+	for name, content := range files {
+		f, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatalf("zipWriter.Create failed: %v", err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatalf("f.Write failed: %v", err)
+		}
+	}
+	zipWriter.Close()
+	return zipBuf.Bytes()
+}
+
+func TestExtractZip_ContentAddressedAssets(t *testing.T) {
+	store := useTestBlobStore(t)
+	useTestAssetDB(t)
+
+	firstImage, sharedImage, secondImage := testPNG(t, 8, 8, 1), testPNG(t, 8, 8, 2), testPNG(t, 8, 8, 3)
+	first := buildZip(t, map[string]string{
+		"post/first.md":           "![diagram](images/diagram.png)\n![other](../shared/diagram.png)",
+		"post/images/diagram.png": firstImage,
+		"shared/diagram.png":      sharedImage,
+	})
+	second := buildZip(t, map[string]string{
+		"second.md":   "![diagram](./diagram.png)",
+		"diagram.png": secondImage,
+	})
+
+	firstData, err := extractZip(context.Background(), bytes.NewReader(first), int64(len(first)), store, "testuser")
+	assert.NoError(t, err)
+	assert.Equal(t, "first", firstData.post_name)
+	assert.Len(t, firstData.asset_hashes, 2)
+
+	secondData, err := extractZip(context.Background(), bytes.NewReader(second), int64(len(second)), store, "testuser")
+	assert.NoError(t, err)
+	assert.Len(t, secondData.asset_hashes, 1)
+
+	// same file name in two posts no longer collides
+	firstKey := "assets/" + assetHash([]byte(firstImage)) + ".png"
+	sharedKey := "assets/" + assetHash([]byte(sharedImage)) + ".png"
+	secondKey := "assets/" + assetHash([]byte(secondImage)) + ".png"
+	assert.Contains(t, string(firstData.md_content), "https://blobs.mock/"+firstKey)
+	assert.Contains(t, string(firstData.md_content), "https://blobs.mock/"+sharedKey)
+	assert.Contains(t, string(secondData.md_content), "https://blobs.mock/"+secondKey)
+
+	for _, key := range []string{firstKey, sharedKey, secondKey} {
+		_, err := storage.ReadString(context.Background(), store, key)
+		assert.NoError(t, err, key)
+	}
+}
+
+func TestExtractZip_FrontMatter(t *testing.T) {
+	store := useTestBlobStore(t)
+	useTestAssetDB(t)
+
+	image := testPNG(t, 8, 8, 4)
+	archive := buildZip(t, map[string]string{
+		"post/notes.md":         "---\ntitle: Release Notes\ncover_image: images/cover.png\n---\n![cover](images/cover.png)",
+		"post/images/cover.png": image,
+	})
+
+	zipData, err := extractZip(context.Background(), bytes.NewReader(archive), int64(len(archive)), store, "testuser")
+	assert.NoError(t, err)
+	assert.Equal(t, "Release Notes", zipData.meta.Title)
+	coverURL := "https://blobs.mock/assets/" + assetHash([]byte(image)) + ".png"
+	assert.Equal(t, coverURL, zipData.meta.CoverImage)
+	// the stored markdown keeps its front matter, the html does not show it
+	assert.True(t, bytes.HasPrefix(zipData.md_content, []byte("---\ntitle: Release Notes\ncover_image: images/cover.png\n---\n")))
+	assert.Contains(t, string(zipData.md_content), "![cover]("+coverURL+")")
+	assert.NotContains(t, zipData.html_content, "Release Notes")
+
+	broken := buildZip(t, map[string]string{"notes.md": "---\ntitle: [a, b]\n---\n"})
+	_, err = extractZip(context.Background(), bytes.NewReader(broken), int64(len(broken)), store, "testuser")
+	assert.ErrorIs(t, err, frontmatter.ErrInvalid)
+}
+
+func TestExtractZip_DeduplicatesUnchangedAssets(t *testing.T) {
+	store := useTestBlobStore(t)
+	assets := useTestAssetDB(t)
+
+	pic := testPNG(t, 8, 8, 1)
+	upload := buildZip(t, map[string]string{
+		"post.md":     "![img](pic.png)",
+		"pic.png":     pic,
+		"img/pic.png": pic,
+	})
+
+	first, err := extractZip(context.Background(), bytes.NewReader(upload), int64(len(upload)), store, "testuser")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, assets.saves)
+
+	second, err := extractZip(context.Background(), bytes.NewReader(upload), int64(len(upload)), store, "testuser")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, assets.saves)
+	assert.Equal(t, first.asset_hashes, second.asset_hashes)
+}
+
+func TestExtractZip_ImageVariants(t *testing.T) {
+	store := useTestBlobStore(t)
+	assets := useTestAssetDB(t)
+
+	photo := testPNG(t, 1000, 500, 1)
+	upload := buildZip(t, map[string]string{
+		"post.md":   "![photo](photo.png)",
+		"photo.png": photo,
+	})
+
+	data, err := extractZip(context.Background(), bytes.NewReader(upload), int64(len(upload)), store, "testuser")
+	assert.NoError(t, err)
+
+	hash := assetHash([]byte(photo))
+	asset := assets.assets[hash]
+	if assert.NotNil(t, asset) {
+		assert.Equal(t, 1000, asset.Width)
+		assert.Equal(t, 500, asset.Height)
+	}
+
+	base := "https://blobs.mock/assets/" + hash
+	assert.Contains(t, data.html_content, `width="1000" height="500"`)
+	assert.Contains(t, data.html_content, base+"_w480.png 480w")
+	assert.Contains(t, data.html_content, base+"_w960.png 960w")
+	assert.Contains(t, data.html_content, base+".png 1000w")
+
+	for _, key := range []string{"assets/" + hash + "_w480.png", "assets/" + hash + "_w960.png", "assets/" + hash + "_thumb.png"} {
+		_, err := storage.ReadString(context.Background(), store, key)
+		assert.NoError(t, err, key)
+	}
+}
+
+func TestExtractZip_RejectsUndecodableImage(t *testing.T) {
+	store := useTestBlobStore(t)
+	useTestAssetDB(t)
+
+	upload := buildZip(t, map[string]string{
+		"post.md": "![img](pic.png)",
+		"pic.png": "not a png",
+	})
+
+	_, err := extractZip(context.Background(), bytes.NewReader(upload), int64(len(upload)), store, "testuser")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "pic.png")
+}
+
+func TestExtractZip_StoresOtherAttachmentTypes(t *testing.T) {
+	store := useTestBlobStore(t)
+	assets := useTestAssetDB(t)
+
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"><rect width="2" height="2"/></svg>`
+	upload := buildZip(t, map[string]string{
+		"post.md":             "![icon](icon.svg)\n[paper](paper.pdf)\n[data](data.csv)",
+		"icon.svg":            svg,
+		"paper.pdf":           "%PDF-1.7\n",
+		"data.csv":            "a,b\n1,2\n",
+		"__MACOSX/._data.csv": "\x00\x05\x16\x07",
+		".DS_Store":           "\x00\x00\x00\x01Bud1",
+	})
+
+	data, err := extractZip(context.Background(), bytes.NewReader(upload), int64(len(upload)), store, "testuser")
+	assert.NoError(t, err)
+	assert.Len(t, data.asset_hashes, 3)
+
+	byType := make(map[string]string)
+	for _, asset := range assets.assets {
+		byType[asset.ContentType] = asset.Key
+	}
+	assert.Equal(t, "assets/"+assetHash([]byte(svg))+".svg", byType["image/svg+xml"])
+	assert.Contains(t, byType, "application/pdf")
+	assert.Contains(t, byType, "text/csv")
+
+	stored, err := storage.ReadString(context.Background(), store, byType["image/svg+xml"])
+	assert.NoError(t, err)
+	assert.NotContains(t, stored, "onload")
+	assert.Contains(t, data.html_content, "https://blobs.mock/"+byType["application/pdf"])
+}
+
+func TestExtractZip_ListsEveryRejectedAttachment(t *testing.T) {
+	store := useTestBlobStore(t)
+	useTestAssetDB(t)
+
+	upload := buildZip(t, map[string]string{
+		"post.md":   "![ok](ok.png)",
+		"ok.png":    testPNG(t, 8, 8, 1),
+		"tool.exe":  "MZ\x90\x00\x03\x00\x00\x00",
+		"page.html": "<html><body></body></html>",
+	})
+
+	_, err := extractZip(context.Background(), bytes.NewReader(upload), int64(len(upload)), store, "testuser")
+	var rejected *RejectedAttachmentsError
+	if assert.True(t, errors.As(err, &rejected)) {
+		assert.Len(t, rejected.Files, 2)
+		assert.Equal(t, "page.html", rejected.Files[0].Name)
+		assert.Equal(t, "tool.exe", rejected.Files[1].Name)
+	}
+
+	// nothing was stored for the accepted image either
+	objects, err := store.List(context.Background(), "assets/")
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+}
+
+func TestAddImageVariants(t *testing.T) {
+	store := useTestBlobStore(t)
+	asset := &db.Asset{
+		Key:    "assets/abc.jpg",
+		Width:  1200,
+		Height: 800,
+		Variants: []db.AssetVariant{
+			{Key: "assets/abc_w480.jpg", ContentType: "image/jpeg", Width: 480, Height: 320},
+			{Key: "assets/abc_thumb.jpg", ContentType: "image/jpeg", Width: 320, Height: 213, Thumbnail: true},
+			{Key: "assets/abc.webp", ContentType: "image/webp", Width: 1200, Height: 800},
+			{Key: "assets/abc_w480.webp", ContentType: "image/webp", Width: 480, Height: 320},
+		},
+	}
+	assets := map[string]*db.Asset{"https://blobs.mock/assets/abc.jpg": asset}
+
+	out := addImageVariants(`<p><img src="https://blobs.mock/assets/abc.jpg" alt="a"></p>`+
+		`<img src="https://blobs.mock/assets/abc.jpg" width="50">`+
+		`<img src="https://example.com/other.jpg">`, assets, store)
+
+	assert.Contains(t, out, `<picture><source type="image/webp" srcset="https://blobs.mock/assets/abc.webp 1200w, https://blobs.mock/assets/abc_w480.webp 480w"`)
+	assert.Contains(t, out, `<img width="1200" height="800" srcset="https://blobs.mock/assets/abc_w480.jpg 480w, https://blobs.mock/assets/abc.jpg 1200w"`)
+	assert.NotContains(t, out, "abc_thumb")
+	// explicit sizes are left alone
+	assert.Contains(t, out, `<img srcset=`)
+	assert.Contains(t, out, `<img src="https://example.com/other.jpg">`)
+}
+
+func TestRewriteAssetLinks(t *testing.T) {
+	urls := map[string]string{
+		"post/img/a.png": "https://cdn/a",
+		"post/b.png":     "https://cdn/b",
+		"other/b.png":    "https://cdn/other-b",
+		"c file.png":     "https://cdn/c",
+	}
+	md := []byte(`![a](img/a.png "title")
+![b](b.png)
+<img src="img/a.png">
+[ref]: <../c%20file.png>
+![ext](https://example.com/img/a.png)
+![missing](nope.png)`)
+
+	out := string(rewriteAssetLinks(md, "post", urls))
+	assert.Contains(t, out, `![a](https://cdn/a "title")`)
+	assert.Contains(t, out, `![b](https://cdn/b)`)
+	assert.Contains(t, out, `<img src="https://cdn/a">`)
+	assert.Contains(t, out, `[ref]: <https://cdn/c>`)
+	assert.Contains(t, out, `![ext](https://example.com/img/a.png)`)
+	assert.Contains(t, out, `![missing](nope.png)`)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// ZipLimits bounds what a single zip upload may expand to.
+type ZipLimits struct {
+	MaxEntries   int
+	MaxEntrySize int64
+	MaxTotalSize int64
+	// MaxRatio is the largest uncompressed to compressed size ratio allowed
+	// for entries bigger than ratioMinSize.
+	MaxRatio int64
+}
+
+// maxZipUploadSize caps the request body of /zipupload.
+const maxZipUploadSize = 64 << 20
+
+// small entries such as a run of blank lines compress extremely well, so the
+// ratio is only enforced once an entry is large enough to matter
+const ratioMinSize = 1 << 20
+
+var zipLimits = ZipLimits{
+	MaxEntries:   500,
+	MaxEntrySize: 25 << 20,
+	MaxTotalSize: 100 << 20,
+	MaxRatio:     100,
+}
+
+var (
+	ErrZipTooManyEntries = errors.New("zip has too many entries")
+	ErrZipEntryTooLarge  = errors.New("entry is too large")
+	ErrZipTooLarge       = errors.New("zip contents are too large")
+	ErrZipRatio          = errors.New("entry compression ratio is too high")
+	ErrZipSymlink        = errors.New("symlinks are not allowed")
+	ErrZipUnsafePath     = errors.New("entry path leaves the archive")
+)
+
+// ZipEntryError names the zip entry that broke one of the ingestion rules.
+type ZipEntryError struct {
+	Entry string
+	Err   error
+}
+
+func (e *ZipEntryError) Error() string {
+	return fmt.Sprintf("zip entry %q: %v", e.Entry, e.Err)
+}
+
+func (e *ZipEntryError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode is the response status a violation maps to.
+func (e *ZipEntryError) StatusCode() int {
+	if errors.Is(e.Err, ErrZipEntryTooLarge) || errors.Is(e.Err, ErrZipTooLarge) || errors.Is(e.Err, ErrZipRatio) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// checkZipEntry rejects entries that are symlinks or whose path is absolute
+// or climbs out of the archive, before anything is read from them.
+func checkZipEntry(file *zip.File, limits ZipLimits) error {
+	if file.Mode()&fs.ModeSymlink != 0 {
+		return &ZipEntryError{Entry: file.Name, Err: ErrZipSymlink}
+	}
+	name := strings.ReplaceAll(file.Name, `\`, "/")
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return &ZipEntryError{Entry: file.Name, Err: ErrZipUnsafePath}
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return &ZipEntryError{Entry: file.Name, Err: ErrZipUnsafePath}
+		}
+	}
+	// the header is only a claim, readZipEntry enforces the real size
+	if file.UncompressedSize64 > uint64(limits.MaxEntrySize) {
+		return &ZipEntryError{Entry: file.Name, Err: ErrZipEntryTooLarge}
+	}
+	return nil
+}
+
+// readZipEntry decompresses an entry into w, stopping as soon as it passes
+// the per-entry limit, the remaining total budget or the compression ratio.
+func readZipEntry(file *zip.File, limits ZipLimits, remaining int64, w io.Writer) (int64, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return 0, &ZipEntryError{Entry: file.Name, Err: err}
+	}
+	defer rc.Close()
+
+	limit := min(limits.MaxEntrySize, remaining)
+	n, err := io.Copy(w, io.LimitReader(rc, limit+1))
+	if err != nil {
+		return n, &ZipEntryError{Entry: file.Name, Err: err}
+	}
+	if n > limits.MaxEntrySize {
+		return n, &ZipEntryError{Entry: file.Name, Err: ErrZipEntryTooLarge}
+	}
+	if n > remaining {
+		return n, &ZipEntryError{Entry: file.Name, Err: ErrZipTooLarge}
+	}
+	if n > ratioMinSize && n > int64(file.CompressedSize64)*limits.MaxRatio {
+		return n, &ZipEntryError{Entry: file.Name, Err: ErrZipRatio}
+	}
+	return n, nil
+}
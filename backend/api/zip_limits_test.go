@@ -0,0 +1,181 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"errors"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func useZipLimits(t *testing.T, limits ZipLimits) {
+	t.Helper()
+	orig := zipLimits
+	zipLimits = limits
+	t.Cleanup(func() { zipLimits = orig })
+}
+
+func assertZipEntryError(t *testing.T, err error, entry string, target error) {
+	t.Helper()
+	var entryErr *ZipEntryError
+	if assert.True(t, errors.As(err, &entryErr), "got %v", err) {
+		assert.Equal(t, entry, entryErr.Entry)
+		assert.ErrorIs(t, err, target)
+	}
+}
+
+func extractTestZip(t *testing.T, upload []byte) error {
+	t.Helper()
+	store := useTestBlobStore(t)
+	useTestAssetDB(t)
+	_, err := extractZip(context.Background(), bytes.NewReader(upload), int64(len(upload)), store, "testuser")
+	return err
+}
+
+func TestExtractZip_TooManyEntries(t *testing.T) {
+	useZipLimits(t, ZipLimits{MaxEntries: 2, MaxEntrySize: 1 << 20, MaxTotalSize: 1 << 20, MaxRatio: 100})
+
+	var zipBuf bytes.Buffer
+	zipWriter := zip.NewWriter(&zipBuf)
+	for _, name := range []string{"post.md", "a.txt", "b.txt"} {
+		f, _ := zipWriter.Create(name)
+		_, _ = f.Write([]byte("x"))
+	}
+	zipWriter.Close()
+
+	err := extractTestZip(t, zipBuf.Bytes())
+	assertZipEntryError(t, err, "b.txt", ErrZipTooManyEntries)
+}
+
+func TestExtractZip_EntryTooLarge(t *testing.T) {
+	useZipLimits(t, ZipLimits{MaxEntries: 10, MaxEntrySize: 1024, MaxTotalSize: 1 << 20, MaxRatio: 100})
+
+	err := extractTestZip(t, buildZip(t, map[string]string{
+		"post.md":  "# hi",
+		"data.txt": strings.Repeat("a", 2048),
+	}))
+	assertZipEntryError(t, err, "data.txt", ErrZipEntryTooLarge)
+}
+
+func TestExtractZip_EntryLargerThanHeaderClaims(t *testing.T) {
+	useZipLimits(t, ZipLimits{MaxEntries: 10, MaxEntrySize: 1024, MaxTotalSize: 1 << 20, MaxRatio: 100})
+
+	var compressed bytes.Buffer
+	fw, _ := flate.NewWriter(&compressed, flate.BestCompression)
+	_, _ = fw.Write(bytes.Repeat([]byte("a"), 64<<10))
+	fw.Close()
+
+	var zipBuf bytes.Buffer
+	zipWriter := zip.NewWriter(&zipBuf)
+	f, _ := zipWriter.Create("post.md")
+	_, _ = f.Write([]byte("# hi"))
+	raw, err := zipWriter.CreateRaw(&zip.FileHeader{
+		Name:               "liar.txt",
+		Method:             zip.Deflate,
+		CompressedSize64:   uint64(compressed.Len()),
+		UncompressedSize64: 10,
+	})
+	assert.NoError(t, err)
+	_, _ = raw.Write(compressed.Bytes())
+	zipWriter.Close()
+
+	// archive/zip stops reading past the declared size, so the lie surfaces
+	// as a format error on that entry instead of an unbounded read
+	err = extractTestZip(t, zipBuf.Bytes())
+	assertZipEntryError(t, err, "liar.txt", zip.ErrFormat)
+}
+
+func TestExtractZip_TotalTooLarge(t *testing.T) {
+	useZipLimits(t, ZipLimits{MaxEntries: 10, MaxEntrySize: 1024, MaxTotalSize: 1500, MaxRatio: 100})
+
+	var zipBuf bytes.Buffer
+	zipWriter := zip.NewWriter(&zipBuf)
+	for _, name := range []string{"post.md", "a.txt", "b.txt"} {
+		f, _ := zipWriter.Create(name)
+		_, _ = f.Write([]byte(strings.Repeat("a", 700)))
+	}
+	zipWriter.Close()
+
+	err := extractTestZip(t, zipBuf.Bytes())
+	assertZipEntryError(t, err, "b.txt", ErrZipTooLarge)
+}
+
+func TestExtractZip_CompressionRatio(t *testing.T) {
+	useZipLimits(t, ZipLimits{MaxEntries: 10, MaxEntrySize: 8 << 20, MaxTotalSize: 16 << 20, MaxRatio: 100})
+
+	err := extractTestZip(t, buildZip(t, map[string]string{
+		"post.md":   "# hi",
+		"zeros.txt": strings.Repeat("0", 2<<20),
+	}))
+	assertZipEntryError(t, err, "zeros.txt", ErrZipRatio)
+}
+
+func TestExtractZip_RejectsUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name   string
+		header *zip.FileHeader
+		target error
+	}{
+		{"parent dir", &zip.FileHeader{Name: "../evil.txt"}, ErrZipUnsafePath},
+		{"nested parent dir", &zip.FileHeader{Name: "img/../../evil.txt"}, ErrZipUnsafePath},
+		{"backslashes", &zip.FileHeader{Name: `img\..\..\evil.txt`}, ErrZipUnsafePath},
+		{"absolute", &zip.FileHeader{Name: "/etc/evil.txt"}, ErrZipUnsafePath},
+		{"drive letter", &zip.FileHeader{Name: "C:/evil.txt"}, ErrZipUnsafePath},
+		{"symlink", func() *zip.FileHeader {
+			h := &zip.FileHeader{Name: "link.txt"}
+			h.SetMode(fs.ModeSymlink | 0o777)
+			return h
+		}(), ErrZipSymlink},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var zipBuf bytes.Buffer
+			zipWriter := zip.NewWriter(&zipBuf)
+			f, _ := zipWriter.Create("post.md")
+			_, _ = f.Write([]byte("# hi"))
+			f, err := zipWriter.CreateHeader(tt.header)
+			assert.NoError(t, err)
+			_, _ = f.Write([]byte("/etc/passwd"))
+			zipWriter.Close()
+
+			err = extractTestZip(t, zipBuf.Bytes())
+			assertZipEntryError(t, err, tt.header.Name, tt.target)
+		})
+	}
+}
+
+func TestHandleZipUpload_NamesOffendingEntry(t *testing.T) {
+	useTestBlobStore(t)
+	useTestAssetDB(t)
+
+	var zipBuf bytes.Buffer
+	zipWriter := zip.NewWriter(&zipBuf)
+	f, _ := zipWriter.Create("../post.md")
+	_, _ = f.Write([]byte("# hi"))
+	zipWriter.Close()
+
+	var body bytes.Buffer
+	wr := multipart.NewWriter(&body)
+	fw, _ := wr.CreateFormFile("zipfile", "post.zip")
+	_, _ = fw.Write(zipBuf.Bytes())
+	wr.Close()
+
+	req := httptest.NewRequest("POST", "/zipupload", &body)
+	req.Header.Set("Content-Type", wr.FormDataContentType())
+	req = req.WithContext(context.WithValue(req.Context(), auth.UsernameKey, "testuser"))
+	rr := httptest.NewRecorder()
+
+	HandleZipUpload(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"../post.md"`)
+}
@@ -82,38 +82,59 @@ func ValidateJWT(tokenStr string) (*jwt.Token, error) {
 	return token, nil
 }
 
-func JWTAuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var tokenStr string
-		cookie, err := r.Cookie("markbyte_login_token")
-		if err == nil {
-			tokenStr = cookie.Value
-		} else {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader != "" {
-				tokenStr = strings.TrimPrefix(authHeader, "Bearer ")
-
-			}
-		}
-		if tokenStr == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+// usernameFromRequest returns the user of a valid login token sent as the
+// login cookie or a bearer token.
+func usernameFromRequest(r *http.Request) (string, bool) {
+	var tokenStr string
+	cookie, err := r.Cookie("markbyte_login_token")
+	if err == nil {
+		tokenStr = cookie.Value
+	} else {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader != "" {
+			tokenStr = strings.TrimPrefix(authHeader, "Bearer ")
 
-		token, err := ValidateJWT(tokenStr)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
 		}
+	}
+	if tokenStr == "" {
+		return "", false
+	}
+
+	token, err := ValidateJWT(tokenStr)
+	if err != nil {
+		return "", false
+	}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || claims["username"] == nil {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["username"] == nil {
+		return "", false
+	}
+	username, ok := claims["username"].(string)
+	return username, ok
+}
+
+func JWTAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, ok := usernameFromRequest(r)
+		if !ok {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), UsernameKey, claims["username"].(string))
+		ctx := context.WithValue(r.Context(), UsernameKey, username)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// OptionalJWTAuthMiddleware sets the username like JWTAuthMiddleware when the
+// request carries a valid token, and lets anonymous requests through.
+func OptionalJWTAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, ok := usernameFromRequest(r)
+		if ok {
+			r = r.WithContext(context.WithValue(r.Context(), UsernameKey, username))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -57,6 +57,14 @@ func (m *MockUserDB) UpdateUserName(ctx context.Context, username string, name s
 	return args.Error(0)
 }
 
+func (m *MockUserDB) FetchAllProfilePictures(ctx context.Context) ([]string, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
 func TestHashPassword(t *testing.T) {
 	password := "testPassword123"
 	hash, err := HashPassword(password)
@@ -221,3 +229,36 @@ func TestJWTAuthMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestOptionalJWTAuthMiddleware(t *testing.T) {
+	token, _, _ := GenerateJWT("testuser")
+	tests := []struct {
+		name         string
+		header       string
+		expectedUser string
+	}{
+		{name: "Valid JWT", header: "Bearer " + token, expectedUser: "testuser"},
+		{name: "Missing JWT", header: "", expectedUser: ""},
+		{name: "Invalid JWT", header: "Bearer invalid.token.here", expectedUser: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var username string
+			handler := OptionalJWTAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				username, _ = r.Context().Value(UsernameKey).(string)
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expectedUser, username)
+		})
+	}
+}
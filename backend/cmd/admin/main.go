@@ -0,0 +1,213 @@
+// Command admin runs maintenance tasks against the markbyte databases and
+// blob store. It reads the same environment as the server.
+//
+//	go run ./cmd/admin dedupe [-dry-run]
+//	go run ./cmd/admin gc [-dry-run] [-grace 72h]
+//	go run ./cmd/admin quota -user <username> [-bytes n] [-objects n] [-reset]
+//	go run ./cmd/admin slugs [-dry-run]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/db/mdb"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/assetgc"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: admin <command> [flags]\n\ncommands:\n")
+	fmt.Fprintf(os.Stderr, "  dedupe remove duplicate post versions so the unique indexes can be built\n")
+	fmt.Fprintf(os.Stderr, "  gc    delete assets and profile pictures nothing references\n")
+	fmt.Fprintf(os.Stderr, "  quota show a user's storage usage or override their quota\n")
+	fmt.Fprintf(os.Stderr, "  slugs give posts from before slugs a slug and move their files\n")
+	os.Exit(2)
+}
+
+func main() {
+	_ = godotenv.Load()
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "dedupe":
+		err = runDedupe(os.Args[2:])
+	case "gc":
+		err = runGC(os.Args[2:])
+	case "quota":
+		err = runQuota(os.Args[2:])
+	case "slugs":
+		err = runSlugs(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatalf("%s failed: %v\n", os.Args[1], err)
+	}
+}
+
+// runDedupe cleans up posts that uploads from before the unique indexes
+// stored twice, and creates the indexes the server could not.
+func runDedupe(args []string) error {
+	flags := flag.NewFlagSet("dedupe", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only report what would be changed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := mdb.DedupeBlogPosts(mdb.URIFromEnv(), "markbyte", "blog_post_data", *dryRun)
+	if report != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(report); encodeErr != nil && err == nil {
+			err = encodeErr
+		}
+	}
+	return err
+}
+
+func runGC(args []string) error {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only report what would be deleted")
+	grace := flags.Duration("grace", assetgc.DefaultGrace, "keep unreferenced objects younger than this")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	MONGO_URL := mdb.URIFromEnv()
+
+	userDB, err := mdb.NewUserDB(MONGO_URL, "markbyte", "users")
+	if err != nil {
+		return err
+	}
+	blogPostDataDB, err := mdb.NewBlogPostDataDB(MONGO_URL, "markbyte", "blog_post_data")
+	if err != nil {
+		return err
+	}
+	assetDB, err := mdb.NewMongoAssetDB(MONGO_URL, "markbyte", "assets")
+	if err != nil {
+		return err
+	}
+	usageDB, err := mdb.NewMongoUsageDB(MONGO_URL, "markbyte", "usage")
+	if err != nil {
+		return err
+	}
+	blobStore, err := storage.NewFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+
+	collector := &assetgc.Collector{
+		Store:  blobStore,
+		Posts:  blogPostDataDB,
+		Users:  userDB,
+		Assets: assetDB,
+		Usage:  usageDB,
+		Grace:  *grace,
+	}
+	report, err := collector.Run(ctx, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// runQuota prints a user's usage. With -bytes or -objects it overrides their
+// quota first (0 is unlimited), -reset goes back to the server default.
+func runQuota(args []string) error {
+	flags := flag.NewFlagSet("quota", flag.ExitOnError)
+	username := flags.String("user", "", "username to show or change")
+	bytes := flags.Int64("bytes", -1, "byte quota to set, 0 for unlimited")
+	objects := flags.Int64("objects", -1, "object quota to set, 0 for unlimited")
+	reset := flags.Bool("reset", false, "drop the override and use the default quota")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return fmt.Errorf("-user is required")
+	}
+
+	ctx := context.Background()
+	usageDB, err := mdb.NewMongoUsageDB(mdb.URIFromEnv(), "markbyte", "usage")
+	if err != nil {
+		return err
+	}
+
+	if *reset {
+		err = usageDB.SetQuota(ctx, *username, nil)
+	} else if *bytes >= 0 || *objects >= 0 {
+		// a flag left unset keeps the current override value
+		var current *db.Usage
+		current, err = usageDB.GetUsage(ctx, *username)
+		if err != nil {
+			return err
+		}
+		quota := db.Quota{}
+		if current.Quota != nil {
+			quota = *current.Quota
+		}
+		if *bytes >= 0 {
+			quota.Bytes = *bytes
+		}
+		if *objects >= 0 {
+			quota.Objects = *objects
+		}
+		err = usageDB.SetQuota(ctx, *username, &quota)
+	}
+	if err != nil {
+		return err
+	}
+
+	usage, err := usageDB.GetUsage(ctx, *username)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(usage)
+}
+
+// runSlugs migrates posts stored before slugs existed. It is safe to run again
+// after a partial run or when every post already has a slug.
+func runSlugs(args []string) error {
+	flags := flag.NewFlagSet("slugs", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only report the slugs that would be assigned")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	blogPostDataDB, err := mdb.NewBlogPostDataDB(mdb.URIFromEnv(), "markbyte", "blog_post_data")
+	if err != nil {
+		return err
+	}
+	blobStore, err := storage.NewFromEnv(ctx)
+	if err != nil {
+		return err
+	}
+
+	migrator := &slug.Migrator{Posts: blogPostDataDB, Store: blobStore}
+	report, err := migrator.Run(ctx, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
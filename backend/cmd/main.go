@@ -1,34 +1,34 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/shrijan-swaminathan/markbyte/backend/api"
 	"github.com/shrijan-swaminathan/markbyte/backend/auth"
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
 	"github.com/shrijan-swaminathan/markbyte/backend/db/mdb"
 	"github.com/shrijan-swaminathan/markbyte/backend/db/redisdb"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/assetgc"
 	"github.com/shrijan-swaminathan/markbyte/backend/features/markdown_render"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/scheduler"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/slug"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/trash"
 	"github.com/shrijan-swaminathan/markbyte/backend/server"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
 )
 
 func main() {
 	_ = godotenv.Load()
 
-	var MONGO_URL string
-	if os.Getenv("RUNNING_IN_DOCKER") == "true" {
-		env_mongo_url := os.Getenv("MONGO_URL")
-		if env_mongo_url != "" {
-			MONGO_URL = env_mongo_url
-		} else {
-			MONGO_URL = "mongodb://mongo:27017"
-		}
-	} else {
-		MONGO_URL = "mongodb://localhost:27017"
-	}
+	MONGO_URL := mdb.URIFromEnv()
 	userDB, err := mdb.NewUserDB(MONGO_URL, "markbyte", "users")
 	if err != nil {
 		log.Fatalf("Failed to create userDB: %v\n", err)
@@ -49,12 +49,106 @@ func main() {
 	}
 	api.SetAnalyticsDB(analyticsDB)
 
+	assetDB, err := mdb.NewMongoAssetDB(MONGO_URL, "markbyte", "assets")
+	if err != nil {
+		log.Fatalf("Failed to create assetDB: %v\n", err)
+	}
+	api.SetAssetDB(assetDB)
+
+	usageDB, err := mdb.NewMongoUsageDB(MONGO_URL, "markbyte", "usage")
+	if err != nil {
+		log.Fatalf("Failed to create usageDB: %v\n", err)
+	}
+	api.SetUsageDB(usageDB)
+
+	collectionDB, err := mdb.NewMongoCollectionDB(MONGO_URL, "markbyte", "collections")
+	if err != nil {
+		log.Fatalf("Failed to create collectionDB: %v\n", err)
+	}
+	api.SetCollectionDB(collectionDB)
+
+	experimentDB, err := mdb.NewMongoExperimentDB(MONGO_URL, "markbyte", "experiments")
+	if err != nil {
+		log.Fatalf("Failed to create experimentDB: %v\n", err)
+	}
+	api.SetExperimentDB(experimentDB)
+
+	themeDB, err := mdb.NewMongoThemeDB(MONGO_URL, "markbyte", "themes")
+	if err != nil {
+		log.Fatalf("Failed to create themeDB: %v\n", err)
+	}
+	api.SetThemeDB(themeDB)
+	markdown_render.SetThemeDB(themeDB)
+	// "0" lifts the limit
+	api.SetDefaultQuota(db.Quota{
+		Bytes:   int64FromEnv("USER_QUOTA_BYTES", api.DefaultQuotaBytes),
+		Objects: int64FromEnv("USER_QUOTA_OBJECTS", api.DefaultQuotaObjects),
+	})
+
+	// every version is kept unless KEEP_VERSIONS says how many
+	api.SetKeepVersions(int(int64FromEnv("KEEP_VERSIONS", 0)))
+
+	blobStore, err := storage.NewFromEnv(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create blob store: %v\n", err)
+	}
+	api.SetBlobStore(blobStore)
+
+	// posts from before slugs get theirs before any request is served, runs
+	// after the first find nothing left to do
+	migrator := &slug.Migrator{Posts: blogPostDataDB, Store: blobStore}
+	report, err := migrator.Run(context.Background(), false)
+	if err != nil {
+		fmt.Printf("Failed to migrate post slugs: %v\n", err)
+	} else if len(report.Posts) > 0 || len(report.Errors) > 0 {
+		fmt.Printf("Migrated %d posts to slugs, moved %d files, %d errors\n", len(report.Posts), report.Moved, len(report.Errors))
+		for _, migrationErr := range report.Errors {
+			fmt.Printf("  %s\n", migrationErr)
+		}
+	}
+
+	// orphaned assets are collected daily by default, "0" disables it
+	if interval := durationFromEnv("ASSET_GC_INTERVAL", 24*time.Hour); interval > 0 {
+		collector := &assetgc.Collector{
+			Store:  blobStore,
+			Posts:  blogPostDataDB,
+			Users:  userDB,
+			Assets: assetDB,
+			Usage:  usageDB,
+			Grace:  durationFromEnv("ASSET_GC_GRACE", assetgc.DefaultGrace),
+		}
+		collector.Start(context.Background(), interval)
+	}
+
+	// trashed posts are purged after 30 days, checked hourly by default,
+	// "0" disables the purge
+	retention := durationFromEnv("TRASH_RETENTION", trash.DefaultRetention)
+	api.SetTrashRetention(retention)
+	if interval := durationFromEnv("TRASH_PURGE_INTERVAL", trash.DefaultInterval); interval > 0 {
+		purger := &trash.Purger{
+			Posts:     blogPostDataDB,
+			Retention: retention,
+			Purge:     api.PurgePost,
+		}
+		purger.Start(context.Background(), interval)
+	}
+
+	// scheduled versions are checked every minute by default, "0" disables it
+	if interval := durationFromEnv("PUBLISH_SCHEDULER_INTERVAL", scheduler.DefaultInterval); interval > 0 {
+		publisher := &scheduler.Scheduler{
+			Posts:   blogPostDataDB,
+			Publish: api.PublishVersion,
+		}
+		publisher.Start(context.Background(), interval)
+	}
+
 	err = redisdb.Init()
 	if err != nil {
 		fmt.Printf("\nFailed to create Redis Instance\n")
 	}
 
 	api.SetGithubToken(os.Getenv("GITHUB_TOKEN"))
+	api.SetPreviewSecret(previewSecret())
 
 	port := ":8080"
 	fmt.Printf("Starting server on %s\n", port)
@@ -63,3 +157,46 @@ func main() {
 		fmt.Printf("Failed to start server: %v\n", err)
 	}
 }
+
+// durationFromEnv parses a Go duration such as "72h" from the environment.
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Printf("Invalid %s %q, using %s\n", name, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// int64FromEnv parses a whole number such as a byte count from the environment.
+func int64FromEnv(name string, fallback int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || parsed < 0 {
+		fmt.Printf("Invalid %s %q, using %d\n", name, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// previewSecret is PREVIEW_SECRET, or a random one when it is not set, in
+// which case preview links stop working on a restart.
+func previewSecret() []byte {
+	if secret := os.Getenv("PREVIEW_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		log.Fatalf("Failed to generate preview secret: %v\n", err)
+	}
+	fmt.Printf("PREVIEW_SECRET is not set, preview links will not survive a restart\n")
+	return secret
+}
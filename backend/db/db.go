@@ -22,16 +22,72 @@ type UserDB interface {
 	UpdateUserStyle(ctx context.Context, username string, style string) error
 	UpdateUserProfilePicture(ctx context.Context, username string, profilePicture string) error
 	UpdateUserName(ctx context.Context, username string, name string) error
+	FetchAllProfilePictures(ctx context.Context) ([]string, error)
+}
+
+// Visibility controls who can see a post and where it is listed. It is set
+// on every version of a post, posts without one are public.
+type Visibility string
+
+const (
+	// VisibilityDraft posts are never served.
+	VisibilityDraft Visibility = "draft"
+	// VisibilityUnlisted posts are served by url but left out of discover
+	// feeds and profile listings.
+	VisibilityUnlisted Visibility = "unlisted"
+	VisibilityPublic   Visibility = "public"
+	// VisibilityPrivate posts are only served to their owner.
+	VisibilityPrivate Visibility = "private"
+)
+
+func (v Visibility) Valid() bool {
+	switch v {
+	case VisibilityDraft, VisibilityUnlisted, VisibilityPublic, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// Listed reports whether posts with this visibility show up in feeds and on
+// profiles.
+func (v Visibility) Listed() bool {
+	return v == "" || v == VisibilityPublic
 }
 
 type BlogPostData struct {
 	User         string    `json:"user" bson:"user"`
 	Title        string    `json:"title" bson:"title"`
+	Slug         string    `json:"slug,omitempty" bson:"slug,omitempty"`
 	DateUploaded time.Time `json:"date_uploaded" bson:"date_uploaded"`
 	Version      string    `json:"version" bson:"version"`
 	Link         *string   `json:"link,omitempty" bson:"link,omitempty"`
 	IsActive     bool      `json:"is_active" bson:"is_active"`
 	DirectLink   *string   `json:"direct_link,omitempty" bson:"direct_link,omitempty"`
+	Assets       []string  `json:"assets,omitempty" bson:"assets,omitempty"`
+	// PreviousSlugs are the slugs the post had before it was renamed, old
+	// links to them redirect to the current slug.
+	PreviousSlugs []string `json:"previous_slugs,omitempty" bson:"previous_slugs,omitempty"`
+	// PublishAt is set while the version waits to be published by the
+	// scheduler.
+	PublishAt  *time.Time `json:"publish_at,omitempty" bson:"publish_at,omitempty"`
+	Visibility Visibility `json:"visibility,omitempty" bson:"visibility,omitempty"`
+	// DeletedAt is set on every version while the post is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	// Message says what the version changed, like a commit message.
+	Message string `json:"message,omitempty" bson:"message,omitempty"`
+	// ShowHistory adds the messages of the published versions to the page.
+	ShowHistory bool `json:"show_history,omitempty" bson:"show_history,omitempty"`
+	// PreviewEpoch is bumped to revoke every preview link of the post.
+	PreviewEpoch int `json:"preview_epoch,omitempty" bson:"preview_epoch,omitempty"`
+	// The rest is taken from the front matter of the version, Tags can also
+	// come from the upload form.
+	Description string   `json:"description,omitempty" bson:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty" bson:"tags,omitempty"`
+	// Date is when the author says the post was written, DateUploaded is
+	// when this version was stored.
+	Date         *time.Time `json:"date,omitempty" bson:"date,omitempty"`
+	CanonicalURL string     `json:"canonical_url,omitempty" bson:"canonical_url,omitempty"`
+	CoverImage   string     `json:"cover_image,omitempty" bson:"cover_image,omitempty"`
 }
 
 type BlogPostVersionsData struct {
@@ -44,8 +100,17 @@ type BlogPostVersionsData struct {
 
 type BlogPostDataDB interface {
 	CreateBlogPost(ctx context.Context, post *BlogPostData) (string, error)
+	// CreateNextVersion stores post, inactive, as the next version of its post
+	// and returns the version, with post.Link set to link(version). Version
+	// numbers are never handed out twice, so the files of the version can be
+	// written once it is stored without another upload overwriting them.
+	CreateNextVersion(ctx context.Context, post *BlogPostData, link func(version string) string) (string, error)
+	// ActivateVersion makes version the only active version of its post.
+	ActivateVersion(ctx context.Context, username string, title string, version string) error
 	DeleteBlogPost(ctx context.Context, username string, title string) (int, error)
-	UpdateActiveStatus(ctx context.Context, username string, title string, version string, isActive bool) error
+	// DeleteBlogPostVersion deletes one inactive version of a post. The
+	// version number is not handed out again.
+	DeleteBlogPostVersion(ctx context.Context, username string, title string, version string) (int, error)
 	FetchAllUserBlogPosts(ctx context.Context, username string) ([]BlogPostVersionsData, error)
 	FetchAllPostVersions(ctx context.Context, username string, title string) (BlogPostVersionsData, error)
 	FetchAllActiveBlogPosts(ctx context.Context, username string) ([]BlogPostData, error)
@@ -53,6 +118,56 @@ type BlogPostDataDB interface {
 	FetchFiftyNewestPosts(ctx context.Context) ([]BlogPostData, error)
 	IsPostActive(ctx context.Context, username string, title string, version string) (bool, error)
 	FetchBlogPost(ctx context.Context, username string, title string, version string) (BlogPostData, error)
+	FetchAllAssetRefs(ctx context.Context) ([]string, error)
+	// FetchPostSlug returns the slug shared by every version of a post, "" when
+	// the post has no versions yet.
+	FetchPostSlug(ctx context.Context, username string, title string) (string, error)
+	// FetchTitleBySlug returns the title of the post using slug, "" when no
+	// post of username does.
+	FetchTitleBySlug(ctx context.Context, username string, slug string) (string, error)
+	// FetchPostsWithoutSlug returns the versions stored before posts had slugs.
+	FetchPostsWithoutSlug(ctx context.Context) ([]BlogPostData, error)
+	SetPostSlug(ctx context.Context, username string, title string, version string, slug string, link string) error
+	// RenameBlogPost moves every version of a post to a new title and slug,
+	// keeping the old slug for redirects. links maps each version to the url
+	// of its html under the new slug.
+	RenameBlogPost(ctx context.Context, username string, title string, newTitle string, newSlug string, links map[string]string) (int, error)
+	// FetchSlugByPreviousSlug returns the current slug of the post that used to
+	// be at slug, "" when none did.
+	FetchSlugByPreviousSlug(ctx context.Context, username string, slug string) (string, error)
+	// SchedulePublish sets when a version gets published, nil cancels it.
+	SchedulePublish(ctx context.Context, username string, title string, version string, at *time.Time) error
+	// FetchScheduledPublishes returns the user's pending versions, soonest first.
+	FetchScheduledPublishes(ctx context.Context, username string) ([]BlogPostData, error)
+	// FetchDuePublishes returns the versions of every user due by now, in the
+	// order they were scheduled for.
+	FetchDuePublishes(ctx context.Context, now time.Time) ([]BlogPostData, error)
+	// SetPostVisibility changes the visibility of every version of a post and
+	// returns how many versions there are.
+	SetPostVisibility(ctx context.Context, username string, title string, visibility Visibility) (int, error)
+	// FetchUserTags counts the tags of the user's listed active posts, most
+	// used first.
+	FetchUserTags(ctx context.Context, username string) ([]TagCount, error)
+	// FetchActivePostsByTag returns the listed active posts with tag, newest
+	// first. An empty username returns the fifty newest of every user.
+	FetchActivePostsByTag(ctx context.Context, username string, tag string) ([]BlogPostData, error)
+	// TrashBlogPost moves every version of a post to the trash at the given
+	// time and drops their scheduled publishes, nil restores it.
+	TrashBlogPost(ctx context.Context, username string, title string, at *time.Time) (int, error)
+	// RevokePreviews bumps the preview epoch of every version of a post, which
+	// invalidates the preview links handed out so far.
+	RevokePreviews(ctx context.Context, username string, title string) (int, error)
+	// FetchTrashedPosts returns one version, the active one where there is
+	// one, of every post of the user in the trash.
+	FetchTrashedPosts(ctx context.Context, username string) ([]BlogPostData, error)
+	// FetchExpiredTrash returns one version of every post of any user that
+	// went to the trash before the given time.
+	FetchExpiredTrash(ctx context.Context, before time.Time) ([]BlogPostData, error)
+}
+
+type TagCount struct {
+	Tag   string `json:"tag" bson:"_id"`
+	Count int    `json:"count" bson:"count"`
 }
 
 type PostAnalytics struct {
@@ -63,15 +178,181 @@ type PostAnalytics struct {
 	Views     []time.Time `json:"views" bson:"views"`
 	Likes     []string    `json:"likes" bson:"likes"`
 	ViewCount int         `json:"view_count" bson:"view_count"`
+	// Reads are the times readers reached the end of the post.
+	Reads []time.Time `json:"reads,omitempty" bson:"reads,omitempty"`
+	// Readers are who the reads came from, each reads a version once.
+	Readers []string `json:"-" bson:"readers,omitempty"`
+	// LikedAt is when each user in Likes liked the post. Likes from before
+	// like times were recorded have no entry.
+	LikedAt []Like `json:"liked_at,omitempty" bson:"liked_at,omitempty"`
+}
+
+type Like struct {
+	User string    `json:"user" bson:"user"`
+	At   time.Time `json:"at" bson:"at"`
 }
 
 type AnalyticsDB interface {
 	CreatePostAnalytics(ctx context.Context, post *PostAnalytics) (string, error)
 	GetPostAnalytics(ctx context.Context, username string, title string, version string) (PostAnalytics, error)
 	IncrementViews(ctx context.Context, username string, title string, version string) error
+	// RecordRead counts a read by reader, unless they read this version
+	// before or it would make more reads than views since since.
+	RecordRead(ctx context.Context, username string, title string, version string, reader string, since time.Time) error
 	ToggleLike(ctx context.Context, postUsername string, title string, version string, likingUsername string) (bool, error)
 	DeletePostAnalytics(ctx context.Context, username string, title string) (int, error)
+	DeleteVersionAnalytics(ctx context.Context, username string, title string, version string) (int, error)
+	RenamePostAnalytics(ctx context.Context, username string, title string, newTitle string) (int, error)
 	GetAllPostTimeStamps(ctx context.Context, username string, active_posts []BlogPostData) ([]time.Time, error)
 	GetPostViewCount(ctx context.Context, username string, title string, version string) (int, error)
 	GetMostViewedPosts(ctx context.Context, limit int) ([]PostAnalytics, error)
 }
+
+// Asset is an attachment stored under the hash of its content, so the same
+// file uploaded by several posts is kept once.
+type Asset struct {
+	Hash        string         `json:"hash" bson:"hash"`
+	Key         string         `json:"key" bson:"key"`
+	ContentType string         `json:"content_type" bson:"content_type"`
+	Size        int64          `json:"size" bson:"size"`
+	Uploader    string         `json:"uploader" bson:"uploader"`
+	CreatedAt   time.Time      `json:"created_at" bson:"created_at"`
+	LastUsedAt  time.Time      `json:"last_used_at" bson:"last_used_at"`
+	Width       int            `json:"width,omitempty" bson:"width,omitempty"`
+	Height      int            `json:"height,omitempty" bson:"height,omitempty"`
+	Variants    []AssetVariant `json:"variants,omitempty" bson:"variants,omitempty"`
+}
+
+// AssetVariant is a resized or re-encoded copy of an image asset.
+type AssetVariant struct {
+	Key         string `json:"key" bson:"key"`
+	ContentType string `json:"content_type" bson:"content_type"`
+	Width       int    `json:"width" bson:"width"`
+	Height      int    `json:"height" bson:"height"`
+	Size        int64  `json:"size" bson:"size"`
+	Thumbnail   bool   `json:"thumbnail,omitempty" bson:"thumbnail,omitempty"`
+}
+
+type AssetDB interface {
+	// SaveAsset records the asset if its hash is new and marks it as used.
+	SaveAsset(ctx context.Context, asset *Asset) error
+	// GetAsset returns nil when no asset has the hash.
+	GetAsset(ctx context.Context, hash string) (*Asset, error)
+	DeleteAsset(ctx context.Context, hash string) error
+}
+
+// Quota limits what a user may keep in storage. A zero field is unlimited.
+type Quota struct {
+	Bytes   int64 `json:"bytes" bson:"bytes"`
+	Objects int64 `json:"objects" bson:"objects"`
+}
+
+// Usage is the running total of what a user has stored. Quota is set when an
+// admin has overridden the default for this user.
+type Usage struct {
+	Username  string    `json:"username" bson:"username"`
+	Bytes     int64     `json:"bytes" bson:"bytes"`
+	Objects   int64     `json:"objects" bson:"objects"`
+	Quota     *Quota    `json:"quota,omitempty" bson:"quota,omitempty"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type UsageDB interface {
+	// GetUsage returns a zero usage for users that have not stored anything.
+	GetUsage(ctx context.Context, username string) (*Usage, error)
+	AddUsage(ctx context.Context, username string, bytes int64, objects int64) error
+	// ReserveUsage adds bytes and objects like AddUsage, but only if that
+	// keeps the user within their quota, or within quota when they have none
+	// of their own. It reports whether it did.
+	ReserveUsage(ctx context.Context, username string, bytes int64, objects int64, quota Quota) (bool, error)
+	// SetQuota overrides the default quota for a user, nil restores it.
+	SetQuota(ctx context.Context, username string, quota *Quota) error
+}
+
+// Collection is an ordered series of a user's posts, such as the parts of a
+// tutorial.
+type Collection struct {
+	User        string `json:"user" bson:"user"`
+	Name        string `json:"name" bson:"name"`
+	Slug        string `json:"slug" bson:"slug"`
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+	// Posts are the titles of the posts in reading order.
+	Posts     []string  `json:"posts" bson:"posts"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type CollectionDB interface {
+	CreateCollection(ctx context.Context, collection *Collection) error
+	// FetchCollection returns nil when the user has no collection at slug.
+	FetchCollection(ctx context.Context, username string, slug string) (*Collection, error)
+	FetchUserCollections(ctx context.Context, username string) ([]Collection, error)
+	// UpdateCollection replaces the name, description and posts of the
+	// collection at collection.Slug.
+	UpdateCollection(ctx context.Context, collection *Collection) error
+	DeleteCollection(ctx context.Context, username string, slug string) (bool, error)
+	// FetchCollectionsWithPost returns the user's collections containing title.
+	FetchCollectionsWithPost(ctx context.Context, username string, title string) ([]Collection, error)
+	// RenamePostInCollections replaces title by newTitle in every collection
+	// of the user.
+	RenamePostInCollections(ctx context.Context, username string, title string, newTitle string) error
+	// RemovePostFromCollections drops title from every collection of the user.
+	RemovePostFromCollections(ctx context.Context, username string, title string) error
+}
+
+// Experiment splits the readers of a post between two of its versions.
+type Experiment struct {
+	User     string `json:"user" bson:"user"`
+	Title    string `json:"title" bson:"title"`
+	VersionA string `json:"version_a" bson:"version_a"`
+	VersionB string `json:"version_b" bson:"version_b"`
+	// Split is the share of readers, in percent, served VersionB.
+	Split     int        `json:"split" bson:"split"`
+	StartedAt time.Time  `json:"started_at" bson:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty" bson:"ended_at,omitempty"`
+}
+
+// Running reports whether readers are still being split.
+func (e *Experiment) Running() bool {
+	return e != nil && e.EndedAt == nil
+}
+
+type ExperimentDB interface {
+	// SaveExperiment stores the experiment of a post, replacing the last one.
+	SaveExperiment(ctx context.Context, experiment *Experiment) error
+	// FetchExperiment returns the last experiment of a post, nil when it never
+	// had one.
+	FetchExperiment(ctx context.Context, username string, title string) (*Experiment, error)
+	EndExperiment(ctx context.Context, username string, title string, at time.Time) (bool, error)
+	DeleteExperiment(ctx context.Context, username string, title string) (bool, error)
+	RenameExperiment(ctx context.Context, username string, title string, newTitle string) error
+}
+
+// ThemeAsset is a file of a theme package, its stylesheet included.
+type ThemeAsset struct {
+	// Name is the path of the file inside the package.
+	Name        string `json:"name" bson:"name"`
+	Key         string `json:"key" bson:"key"`
+	URL         string `json:"url" bson:"url"`
+	ContentType string `json:"content_type" bson:"content_type"`
+	Size        int64  `json:"size" bson:"size"`
+}
+
+// Theme is a theme package a user uploaded. They pick it as their style by
+// its name with the "custom:" prefix.
+type Theme struct {
+	User       string       `json:"user" bson:"user"`
+	Name       string       `json:"name" bson:"name"`
+	Template   string       `json:"template" bson:"template"`
+	Assets     []ThemeAsset `json:"assets" bson:"assets"`
+	UploadedAt time.Time    `json:"uploaded_at" bson:"uploaded_at"`
+}
+
+type ThemeDB interface {
+	// SaveTheme stores a theme, replacing the one of the user with that name.
+	SaveTheme(ctx context.Context, theme *Theme) error
+	// FetchTheme returns nil when the user has no theme with that name.
+	FetchTheme(ctx context.Context, username string, name string) (*Theme, error)
+	FetchUserThemes(ctx context.Context, username string) ([]Theme, error)
+	DeleteTheme(ctx context.Context, username string, name string) (bool, error)
+}
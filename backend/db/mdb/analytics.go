@@ -63,6 +63,26 @@ func (r *MongoAnalyticsRepository) IncrementViews(ctx context.Context, username
 	return nil
 }
 
+// RecordRead adds a read unless reader already read the version, or the
+// version has as many reads as views since since. Skipped reads are not an
+// error.
+func (r *MongoAnalyticsRepository) RecordRead(ctx context.Context, username string, title string, version string, reader string, since time.Time) error {
+	countSince := func(field string) bson.M {
+		return bson.M{"$size": bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$" + field, bson.A{}}},
+			"cond":  bson.M{"$gte": bson.A{"$$this", since}},
+		}}}
+	}
+	filter := bson.M{
+		"username": username, "title": title, "version": version,
+		"readers": bson.M{"$ne": reader},
+		"$expr":   bson.M{"$lt": bson.A{countSince("reads"), countSince("views")}},
+	}
+	update := bson.M{"$push": bson.M{"reads": time.Now(), "readers": reader}}
+	_, err := r.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
 // func (r *MongoAnalyticsRepository) IncrementLikes(ctx context.Context, username string, title string, version string) error {
 // 	filter := bson.M{"username": username, "title": title, "version": version}
 // 	update := bson.M{"$inc": bson.M{"likes": 1}}
@@ -79,15 +99,22 @@ func (r *MongoAnalyticsRepository) IncrementViews(ctx context.Context, username
 func (r *MongoAnalyticsRepository) ToggleLike(ctx context.Context, postUsername string, title string, version string, likingUsername string) (bool, error) {
 	filter := bson.M{"username": postUsername, "title": title, "version": version}
 
-	// Try to add the like first
-	update := bson.M{"$addToSet": bson.M{"likes": likingUsername}}
-	res, err := r.collection.UpdateOne(ctx, filter, update)
+	// Try to add the like first, together with when it was made
+	notLiked := bson.M{"username": postUsername, "title": title, "version": version, "likes": bson.M{"$ne": likingUsername}}
+	update := bson.M{"$push": bson.M{
+		"likes":    likingUsername,
+		"liked_at": db.Like{User: likingUsername, At: time.Now()},
+	}}
+	res, err := r.collection.UpdateOne(ctx, notLiked, update)
 	if err != nil {
 		return false, err
 	}
 	if res.ModifiedCount == 0 {
 		// If no document was modified, try to remove the like
-		update = bson.M{"$pull": bson.M{"likes": likingUsername}}
+		update = bson.M{"$pull": bson.M{
+			"likes":    likingUsername,
+			"liked_at": bson.M{"user": likingUsername},
+		}}
 		res, err = r.collection.UpdateOne(ctx, filter, update)
 		if err != nil {
 			return false, err
@@ -109,6 +136,25 @@ func (r *MongoAnalyticsRepository) DeletePostAnalytics(ctx context.Context, user
 	return int(res.DeletedCount), nil
 }
 
+func (r *MongoAnalyticsRepository) DeleteVersionAnalytics(ctx context.Context, username string, title string, version string) (int, error) {
+	filter := bson.M{"username": username, "title": title, "version": version}
+	res, err := r.collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
+
+func (r *MongoAnalyticsRepository) RenamePostAnalytics(ctx context.Context, username string, title string, newTitle string) (int, error) {
+	filter := bson.M{"username": username, "title": title}
+	update := bson.M{"$set": bson.M{"title": newTitle}}
+	res, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
+
 func (r *MongoAnalyticsRepository) GetAllPostTimeStamps(ctx context.Context, username string, active_posts []db.BlogPostData) ([]time.Time, error) {
 	post_timestamps := []time.Time{}
 	for _, post := range active_posts {
@@ -0,0 +1,71 @@
+package mdb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type MongoAssetRepository struct {
+	collection *mongo.Collection
+}
+
+var _ db.AssetDB = (*MongoAssetRepository)(nil)
+
+func NewMongoAssetRepository(client *mongo.Client, dbName, collectionName string) *MongoAssetRepository {
+	collection := client.Database(dbName).Collection(collectionName)
+	return &MongoAssetRepository{collection}
+}
+
+func (r *MongoAssetRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// SaveAsset records the asset once per hash. Saving an already known hash only
+// bumps last_used_at, so two uploads racing on the same file both succeed and
+// the garbage collector leaves recently reused assets alone.
+func (r *MongoAssetRepository) SaveAsset(ctx context.Context, asset *db.Asset) error {
+	filter := bson.M{"hash": asset.Hash}
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"hash":         asset.Hash,
+			"key":          asset.Key,
+			"content_type": asset.ContentType,
+			"size":         asset.Size,
+			"uploader":     asset.Uploader,
+			"created_at":   asset.CreatedAt,
+			"width":        asset.Width,
+			"height":       asset.Height,
+			"variants":     asset.Variants,
+		},
+		"$set": bson.M{"last_used_at": time.Now()},
+	}
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	return err
+}
+
+func (r *MongoAssetRepository) GetAsset(ctx context.Context, hash string) (*db.Asset, error) {
+	var asset db.Asset
+	err := r.collection.FindOne(ctx, bson.M{"hash": hash}).Decode(&asset)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func (r *MongoAssetRepository) DeleteAsset(ctx context.Context, hash string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"hash": hash})
+	return err
+}
@@ -3,8 +3,10 @@ package mdb
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/shrijan-swaminathan/markbyte/backend/db"
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -13,14 +15,95 @@ import (
 )
 
 type MongoBlogPostDataRepository struct {
+	client     *mongo.Client
 	collection *mongo.Collection
+	// counters holds the last version number handed out for each post
+	counters *mongo.Collection
 }
 
 var _ db.BlogPostDataDB = (*MongoBlogPostDataRepository)(nil)
 
 func NewMongoBlogPostDataRepository(client *mongo.Client, dbName, collectionName string) *MongoBlogPostDataRepository {
-	collection := client.Database(dbName).Collection(collectionName)
-	return &MongoBlogPostDataRepository{collection}
+	database := client.Database(dbName)
+	return &MongoBlogPostDataRepository{
+		client:     client,
+		collection: database.Collection(collectionName),
+		counters:   database.Collection(collectionName + "_counters"),
+	}
+}
+
+// ErrDuplicateVersions is returned by EnsureIndexes when stored posts break
+// one of its unique indexes, which uploads from before the indexes could
+// leave behind. The other indexes are still created.
+var ErrDuplicateVersions = errors.New("blog posts have duplicate versions, run `go run ./cmd/admin dedupe`")
+
+// EnsureIndexes indexes posts by slug and pending publish time. The slug index
+// is unique per version, so two uploads racing to claim the same slug cannot
+// both store version 1 under it. Versions are unique per post and only one of
+// them can be active.
+func (r *MongoBlogPostDataRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.counters.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user", Value: 1}, {Key: "title", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "tags", Value: 1}, {Key: "date_uploaded", Value: -1}},
+			Options: options.Index().
+				SetPartialFilterExpression(bson.M{"is_active": true}),
+		},
+		{
+			// only scheduled versions have publish_at, which keeps the
+			// scheduler's poll cheap
+			Keys:    bson.D{{Key: "publish_at", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			// likewise only trashed posts have deleted_at, for the purge
+			Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// each unique index is built on its own, so duplicates breaking one of
+	// them leave the others in place
+	var duplicates []error
+	for _, index := range []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user", Value: 1}, {Key: "title", Value: 1}, {Key: "version", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user", Value: 1}, {Key: "title", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"is_active": true}),
+		},
+		{
+			Keys: bson.D{{Key: "user", Value: 1}, {Key: "slug", Value: 1}, {Key: "version", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"slug": bson.M{"$exists": true}}),
+		},
+	} {
+		_, err = r.collection.Indexes().CreateOne(ctx, index)
+		if mongo.IsDuplicateKeyError(err) {
+			duplicates = append(duplicates, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("%w: %w", ErrDuplicateVersions, errors.Join(duplicates...))
+	}
+	return nil
 }
 
 func (r *MongoBlogPostDataRepository) CreateBlogPost(ctx context.Context, post *db.BlogPostData) (string, error) {
@@ -37,34 +120,150 @@ func (r *MongoBlogPostDataRepository) CreateBlogPost(ctx context.Context, post *
 	return string(idBytes), err
 }
 
+// CreateNextVersion stores post, inactive, as the next version of its post.
+// Numbering and the insert run in one transaction, so concurrent uploads get
+// distinct versions, and the unique slug index refuses a second post claiming
+// the same slug before either writes files. The transaction is retried on
+// write conflicts, which calls link again, possibly with another version.
+func (r *MongoBlogPostDataRepository) CreateNextVersion(ctx context.Context, post *db.BlogPostData, link func(version string) string) (string, error) {
+	session, err := r.client.StartSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.EndSession(ctx)
+
+	version, err := session.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		seq, err := r.nextVersion(ctx, post.User, post.Title)
+		if err != nil {
+			return nil, err
+		}
+		next := *post
+		next.Version = strconv.Itoa(seq)
+		next.IsActive = false
+		if link != nil {
+			url := link(next.Version)
+			next.Link = &url
+		}
+		_, err = r.collection.InsertOne(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		return next, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	*post = version.(db.BlogPostData)
+	return post.Version, nil
+}
+
+// ActivateVersion makes version the only active version of its post, in one
+// transaction so the post always has an active version.
+func (r *MongoBlogPostDataRepository) ActivateVersion(ctx context.Context, username string, title string, version string) error {
+	session, err := r.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		_, err := r.collection.UpdateMany(ctx,
+			bson.M{"user": username, "title": title, "version": bson.M{"$ne": version}, "is_active": true},
+			bson.M{"$set": bson.M{"is_active": false}})
+		if err != nil {
+			return nil, err
+		}
+		res, err := r.collection.UpdateOne(ctx,
+			bson.M{"user": username, "title": title, "version": version},
+			bson.M{"$set": bson.M{"is_active": true}})
+		if err != nil {
+			return nil, err
+		}
+		if res.MatchedCount == 0 {
+			return nil, fmt.Errorf("no version %s of %s", version, title)
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// nextVersion increments the post's counter. A post without a counter starts
+// after its highest stored version, which covers posts uploaded before the
+// counters existed.
+func (r *MongoBlogPostDataRepository) nextVersion(ctx context.Context, username string, title string) (int, error) {
+	filter := bson.M{"user": username, "title": title}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var counter struct {
+		Seq int `bson:"seq"`
+	}
+	err := r.counters.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"seq": 1}}, opts).Decode(&counter)
+	if err != nil {
+		return 0, err
+	}
+	if counter.Seq > 1 {
+		return counter.Seq, nil
+	}
+
+	existing, err := r.FetchAllPostVersions(ctx, username, title)
+	if err != nil {
+		return 0, err
+	}
+	next, err := versionAfter(existing.Versions)
+	if err != nil || next == 1 {
+		return next, err
+	}
+
+	_, err = r.counters.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"seq": next}})
+	if err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// versionAfter returns the number following the highest of versions, 1 when
+// there are none.
+func versionAfter(versions []db.BlogPostData) (int, error) {
+	latest := 0
+	for _, post := range versions {
+		version, err := strconv.Atoi(post.Version)
+		if err != nil {
+			return 0, fmt.Errorf("invalid version %q of %s: %w", post.Version, post.Title, err)
+		}
+		latest = max(latest, version)
+	}
+	return latest + 1, nil
+}
+
 func (r *MongoBlogPostDataRepository) DeleteBlogPost(ctx context.Context, username string, title string) (int, error) {
 	filter := bson.M{"user": username, "title": title}
 	res, err := r.collection.DeleteMany(ctx, filter)
 	if err != nil {
 		return 0, err
 	}
+	// a post uploaded again under this title starts over at version 1
+	_, err = r.counters.DeleteOne(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
 	return int(res.DeletedCount), nil
 }
 
-func (r *MongoBlogPostDataRepository) UpdateActiveStatus(ctx context.Context, username string, title string, version string, isActive bool) error {
-	filter := bson.M{"user": username, "title": title, "version": version}
-	update := bson.M{"$set": bson.M{"is_active": isActive}}
-	res, err := r.collection.UpdateOne(ctx, filter, update)
+func (r *MongoBlogPostDataRepository) DeleteBlogPostVersion(ctx context.Context, username string, title string, version string) (int, error) {
+	// the counter is left alone, so the number stays taken
+	filter := bson.M{"user": username, "title": title, "version": version, "is_active": false}
+	res, err := r.collection.DeleteOne(ctx, filter)
 	if err != nil {
-		return err
-	}
-
-	if res.ModifiedCount == 0 {
-		return fmt.Errorf("no blog post found with the given details")
+		return 0, err
 	}
-	return nil
+	return int(res.DeletedCount), nil
 }
 
 func (r *MongoBlogPostDataRepository) FetchAllUserBlogPosts(ctx context.Context, username string) ([]db.BlogPostVersionsData, error) {
 
 	var titles []string
 
-	err := r.collection.Distinct(ctx, "title", bson.M{"user": username}).Decode(&titles)
+	err := r.collection.Distinct(ctx, "title", bson.M{"user": username, "deleted_at": nil}).Decode(&titles)
 	if err != nil {
 		return nil, err
 	}
@@ -121,7 +320,7 @@ func (r *MongoBlogPostDataRepository) FetchAllPostVersions(ctx context.Context,
 }
 
 func (r *MongoBlogPostDataRepository) FetchAllActiveBlogPosts(ctx context.Context, username string) ([]db.BlogPostData, error) {
-	filter := bson.M{"is_active": true, "user": username}
+	filter := bson.M{"is_active": true, "user": username, "deleted_at": nil}
 	opts := options.Find().SetSort(bson.D{{Key: "date_uploaded", Value: -1}})
 	cursor, err := r.collection.Find(ctx, filter, opts)
 	if err != nil {
@@ -138,7 +337,7 @@ func (r *MongoBlogPostDataRepository) FetchAllActiveBlogPosts(ctx context.Contex
 }
 
 func (r *MongoBlogPostDataRepository) FetchActiveBlog(ctx context.Context, username string, title string) (string, error) {
-	filter := bson.M{"user": username, "title": title, "is_active": true}
+	filter := bson.M{"user": username, "title": title, "is_active": true, "deleted_at": nil}
 	var blog db.BlogPostData
 	err := r.collection.FindOne(ctx, filter).Decode(&blog)
 	if err != nil {
@@ -148,8 +347,18 @@ func (r *MongoBlogPostDataRepository) FetchActiveBlog(ctx context.Context, usern
 	return blog.Version, nil
 }
 
+// listedFilter matches the active versions shown in feeds and on profiles.
+// null also matches posts from before visibility existed.
+func listedFilter() bson.M {
+	return bson.M{
+		"is_active":  true,
+		"visibility": bson.M{"$in": bson.A{db.VisibilityPublic, nil}},
+		"deleted_at": nil,
+	}
+}
+
 func (r *MongoBlogPostDataRepository) FetchFiftyNewestPosts(ctx context.Context) ([]db.BlogPostData, error) {
-	filter := bson.M{"is_active": true}
+	filter := listedFilter()
 	findOptions := options.Find()
 	findOptions.SetSort(bson.D{{Key: "date_uploaded", Value: -1}})
 	findOptions.SetLimit(50)
@@ -184,3 +393,278 @@ func (r *MongoBlogPostDataRepository) FetchBlogPost(ctx context.Context, usernam
 	}
 	return blog, nil
 }
+
+// FetchAllAssetRefs returns the hash of every asset referenced by any version
+// of any post.
+func (r *MongoBlogPostDataRepository) FetchAllAssetRefs(ctx context.Context) ([]string, error) {
+	var hashes []string
+	err := r.collection.Distinct(ctx, "assets", bson.M{}).Decode(&hashes)
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+func (r *MongoBlogPostDataRepository) FetchPostSlug(ctx context.Context, username string, title string) (string, error) {
+	filter := bson.M{"user": username, "title": title, "slug": bson.M{"$exists": true}}
+	var blog db.BlogPostData
+	err := r.collection.FindOne(ctx, filter).Decode(&blog)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return blog.Slug, nil
+}
+
+func (r *MongoBlogPostDataRepository) FetchTitleBySlug(ctx context.Context, username string, slug string) (string, error) {
+	filter := bson.M{"user": username, "slug": slug}
+	var blog db.BlogPostData
+	err := r.collection.FindOne(ctx, filter).Decode(&blog)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return blog.Title, nil
+}
+
+func (r *MongoBlogPostDataRepository) FetchPostsWithoutSlug(ctx context.Context) ([]db.BlogPostData, error) {
+	filter := bson.M{"$or": bson.A{bson.M{"slug": bson.M{"$exists": false}}, bson.M{"slug": ""}}}
+	opts := options.Find().SetSort(bson.D{{Key: "user", Value: 1}, {Key: "date_uploaded", Value: 1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var blogs []db.BlogPostData
+	if err = cursor.All(ctx, &blogs); err != nil {
+		return nil, err
+	}
+	return blogs, nil
+}
+
+// SetPostSlug moves one version of a post to slug, pointing its links at the
+// slug based keys.
+func (r *MongoBlogPostDataRepository) SetPostSlug(ctx context.Context, username string, title string, version string, slug string, link string) error {
+	filter := bson.M{"user": username, "title": title, "version": version}
+	directLink := "/" + username + "/" + slug
+	update := bson.M{"$set": bson.M{"slug": slug, "link": link, "direct_link": directLink}}
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("no blog post found with the given details")
+	}
+	return nil
+}
+
+// RenameBlogPost updates all versions in one ordered bulk write. A version
+// missing from links keeps its old link.
+func (r *MongoBlogPostDataRepository) RenameBlogPost(ctx context.Context, username string, title string, newTitle string, newSlug string, links map[string]string) (int, error) {
+	existing, err := r.FetchAllPostVersions(ctx, username, title)
+	if err != nil {
+		return 0, err
+	}
+	if len(existing.Versions) == 0 {
+		return 0, fmt.Errorf("no blog post found with the given details")
+	}
+
+	directLink := "/" + username + "/" + newSlug
+	models := make([]mongo.WriteModel, 0, len(existing.Versions))
+	for _, version := range existing.Versions {
+		set := bson.M{"title": newTitle, "slug": newSlug, "direct_link": directLink}
+		if link, ok := links[version.Version]; ok {
+			set["link"] = link
+		}
+		update := bson.M{"$set": set}
+		if version.Slug != "" && version.Slug != newSlug {
+			update["$addToSet"] = bson.M{"previous_slugs": version.Slug}
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"user": username, "title": title, "version": version.Version}).
+			SetUpdate(update))
+	}
+	res, err := r.collection.BulkWrite(ctx, models)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = r.counters.UpdateOne(ctx,
+		bson.M{"user": username, "title": title},
+		bson.M{"$set": bson.M{"title": newTitle}})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.MatchedCount), nil
+}
+
+func (r *MongoBlogPostDataRepository) FetchSlugByPreviousSlug(ctx context.Context, username string, slug string) (string, error) {
+	filter := bson.M{"user": username, "previous_slugs": slug}
+	opts := options.FindOne().SetSort(bson.D{{Key: "date_uploaded", Value: -1}})
+	var blog db.BlogPostData
+	err := r.collection.FindOne(ctx, filter, opts).Decode(&blog)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return blog.Slug, nil
+}
+
+func (r *MongoBlogPostDataRepository) SchedulePublish(ctx context.Context, username string, title string, version string, at *time.Time) error {
+	filter := bson.M{"user": username, "title": title, "version": version}
+	update := bson.M{"$set": bson.M{"publish_at": at}}
+	if at == nil {
+		update = bson.M{"$unset": bson.M{"publish_at": ""}}
+	}
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("no blog post found with the given details")
+	}
+	return nil
+}
+
+func (r *MongoBlogPostDataRepository) FetchScheduledPublishes(ctx context.Context, username string) ([]db.BlogPostData, error) {
+	filter := bson.M{"user": username, "publish_at": bson.M{"$exists": true}, "deleted_at": nil}
+	return r.findScheduled(ctx, filter)
+}
+
+func (r *MongoBlogPostDataRepository) FetchDuePublishes(ctx context.Context, now time.Time) ([]db.BlogPostData, error) {
+	// trashing clears schedules, this only skips a post trashed mid-poll
+	filter := bson.M{"publish_at": bson.M{"$lte": now}, "deleted_at": nil}
+	return r.findScheduled(ctx, filter)
+}
+
+func (r *MongoBlogPostDataRepository) findScheduled(ctx context.Context, filter bson.M) ([]db.BlogPostData, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "publish_at", Value: 1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	blogs := make([]db.BlogPostData, 0)
+	if err = cursor.All(ctx, &blogs); err != nil {
+		return nil, err
+	}
+	return blogs, nil
+}
+
+func (r *MongoBlogPostDataRepository) SetPostVisibility(ctx context.Context, username string, title string, visibility db.Visibility) (int, error) {
+	filter := bson.M{"user": username, "title": title}
+	update := bson.M{"$set": bson.M{"visibility": visibility}}
+	res, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.MatchedCount), nil
+}
+
+func (r *MongoBlogPostDataRepository) FetchUserTags(ctx context.Context, username string) ([]db.TagCount, error) {
+	match := listedFilter()
+	match["user"] = username
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	tags := []db.TagCount{}
+	if err = cursor.All(ctx, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (r *MongoBlogPostDataRepository) FetchActivePostsByTag(ctx context.Context, username string, tag string) ([]db.BlogPostData, error) {
+	filter := listedFilter()
+	filter["tags"] = tag
+	findOptions := options.Find().SetSort(bson.D{{Key: "date_uploaded", Value: -1}})
+	if username != "" {
+		filter["user"] = username
+	} else {
+		findOptions.SetLimit(50)
+	}
+	cursor, err := r.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	blogs := []db.BlogPostData{}
+	if err = cursor.All(ctx, &blogs); err != nil {
+		return nil, err
+	}
+	return blogs, nil
+}
+
+func (r *MongoBlogPostDataRepository) TrashBlogPost(ctx context.Context, username string, title string, at *time.Time) (int, error) {
+	filter := bson.M{"user": username, "title": title}
+	// trashing drops pending schedules, a restored post is not published
+	// behind its owner's back
+	update := bson.M{"$set": bson.M{"deleted_at": at}, "$unset": bson.M{"publish_at": ""}}
+	if at == nil {
+		update = bson.M{"$unset": bson.M{"deleted_at": ""}}
+	}
+	res, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.MatchedCount), nil
+}
+
+func (r *MongoBlogPostDataRepository) RevokePreviews(ctx context.Context, username string, title string) (int, error) {
+	filter := bson.M{"user": username, "title": title}
+	update := bson.M{"$inc": bson.M{"preview_epoch": 1}}
+	res, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.MatchedCount), nil
+}
+
+func (r *MongoBlogPostDataRepository) FetchTrashedPosts(ctx context.Context, username string) ([]db.BlogPostData, error) {
+	return r.findTrashed(ctx, bson.M{"user": username, "deleted_at": bson.M{"$ne": nil}})
+}
+
+func (r *MongoBlogPostDataRepository) FetchExpiredTrash(ctx context.Context, before time.Time) ([]db.BlogPostData, error) {
+	return r.findTrashed(ctx, bson.M{"deleted_at": bson.M{"$lte": before}})
+}
+
+// findTrashed collapses the matching versions to one per post, preferring
+// the active one, oldest trash first.
+func (r *MongoBlogPostDataRepository) findTrashed(ctx context.Context, match bson.M) ([]db.BlogPostData, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.D{{Key: "is_active", Value: -1}, {Key: "date_uploaded", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":  bson.D{{Key: "user", Value: "$user"}, {Key: "title", Value: "$title"}},
+			"post": bson.M{"$first": "$$ROOT"},
+		}}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$post"}}},
+		{{Key: "$sort", Value: bson.D{{Key: "deleted_at", Value: 1}}}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	blogs := []db.BlogPostData{}
+	if err = cursor.All(ctx, &blogs); err != nil {
+		return nil, err
+	}
+	return blogs, nil
+}
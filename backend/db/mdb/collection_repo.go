@@ -0,0 +1,124 @@
+package mdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type MongoCollectionRepository struct {
+	collection *mongo.Collection
+}
+
+var _ db.CollectionDB = (*MongoCollectionRepository)(nil)
+
+func NewMongoCollectionRepository(client *mongo.Client, dbName, collectionName string) *MongoCollectionRepository {
+	collection := client.Database(dbName).Collection(collectionName)
+	return &MongoCollectionRepository{collection}
+}
+
+// EnsureIndexes makes slugs unique per user and finds the collections of a
+// post without a scan.
+func (r *MongoCollectionRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user", Value: 1}, {Key: "slug", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user", Value: 1}, {Key: "posts", Value: 1}},
+		},
+	})
+	return err
+}
+
+func (r *MongoCollectionRepository) CreateCollection(ctx context.Context, collection *db.Collection) error {
+	_, err := r.collection.InsertOne(ctx, collection)
+	return err
+}
+
+func (r *MongoCollectionRepository) FetchCollection(ctx context.Context, username string, slug string) (*db.Collection, error) {
+	var collection db.Collection
+	err := r.collection.FindOne(ctx, bson.M{"user": username, "slug": slug}).Decode(&collection)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+func (r *MongoCollectionRepository) FetchUserCollections(ctx context.Context, username string) ([]db.Collection, error) {
+	return r.find(ctx, bson.M{"user": username})
+}
+
+func (r *MongoCollectionRepository) UpdateCollection(ctx context.Context, collection *db.Collection) error {
+	filter := bson.M{"user": collection.User, "slug": collection.Slug}
+	update := bson.M{"$set": bson.M{
+		"name":        collection.Name,
+		"description": collection.Description,
+		"posts":       collection.Posts,
+		"updated_at":  collection.UpdatedAt,
+	}}
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("no collection found with the given details")
+	}
+	return nil
+}
+
+func (r *MongoCollectionRepository) DeleteCollection(ctx context.Context, username string, slug string) (bool, error) {
+	res, err := r.collection.DeleteOne(ctx, bson.M{"user": username, "slug": slug})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
+func (r *MongoCollectionRepository) FetchCollectionsWithPost(ctx context.Context, username string, title string) ([]db.Collection, error) {
+	return r.find(ctx, bson.M{"user": username, "posts": title})
+}
+
+func (r *MongoCollectionRepository) RenamePostInCollections(ctx context.Context, username string, title string, newTitle string) error {
+	filter := bson.M{"user": username, "posts": title}
+	update := bson.M{
+		"$set": bson.M{"posts.$[post]": newTitle, "updated_at": time.Now()},
+	}
+	opts := options.UpdateMany().SetArrayFilters([]any{bson.M{"post": title}})
+	_, err := r.collection.UpdateMany(ctx, filter, update, opts)
+	return err
+}
+
+func (r *MongoCollectionRepository) RemovePostFromCollections(ctx context.Context, username string, title string) error {
+	filter := bson.M{"user": username, "posts": title}
+	update := bson.M{
+		"$pull": bson.M{"posts": title},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+	_, err := r.collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+func (r *MongoCollectionRepository) find(ctx context.Context, filter bson.M) ([]db.Collection, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	collections := []db.Collection{}
+	if err = cursor.All(ctx, &collections); err != nil {
+		return nil, err
+	}
+	return collections, nil
+}
@@ -0,0 +1,152 @@
+package mdb
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// DedupeReport lists what DedupeVersions changed, or would change on a dry
+// run. Versions are written as user/title@version.
+type DedupeReport struct {
+	// Deleted are extra rows of a version that was stored more than once.
+	// They point at the same files as the row that is kept.
+	Deleted []string `json:"deleted"`
+	// Deactivated were active next to a newer active version of their post.
+	Deactivated []string `json:"deactivated"`
+	// SlugConflicts are versions of different posts stored under the same
+	// slug, so under the same file keys. They are left for an admin to sort
+	// out, as only one of them still has its own files.
+	SlugConflicts []string `json:"slug_conflicts"`
+}
+
+// versionRow is the part of a stored version the dedupe looks at.
+type versionRow struct {
+	ID       bson.ObjectID `bson:"_id"`
+	User     string        `bson:"user"`
+	Title    string        `bson:"title"`
+	Slug     string        `bson:"slug"`
+	Version  string        `bson:"version"`
+	IsActive bool          `bson:"is_active"`
+	// Uploaded orders copies of a version, the newest is kept.
+	Uploaded bson.DateTime `bson:"date_uploaded"`
+}
+
+func (v versionRow) String() string {
+	return v.User + "/" + v.Title + "@" + v.Version
+}
+
+// DedupeVersions deletes extra copies of a version and leaves only the newest
+// active version of each post active, which is what the unique indexes of
+// EnsureIndexes need. It can be run again at any time.
+func (r *MongoBlogPostDataRepository) DedupeVersions(ctx context.Context, dryRun bool) (*DedupeReport, error) {
+	projection := bson.M{"user": 1, "title": 1, "slug": 1, "version": 1, "is_active": 1, "date_uploaded": 1}
+	cursor, err := r.collection.Find(ctx, bson.M{}, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	var rows []versionRow
+	err = cursor.All(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, deactivated, report := planDedupe(rows)
+	if dryRun {
+		return report, nil
+	}
+	if len(deleted) > 0 {
+		_, err = r.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": deleted}})
+		if err != nil {
+			return report, err
+		}
+	}
+	if len(deactivated) > 0 {
+		_, err = r.collection.UpdateMany(ctx,
+			bson.M{"_id": bson.M{"$in": deactivated}},
+			bson.M{"$set": bson.M{"is_active": false}})
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// planDedupe picks the rows DedupeVersions deletes and deactivates. Of the
+// copies of a version the active one is kept, else the newest. Of the active
+// versions of a post the highest is kept active.
+func planDedupe(rows []versionRow) (deleted []bson.ObjectID, deactivated []bson.ObjectID, report *DedupeReport) {
+	report = &DedupeReport{Deleted: []string{}, Deactivated: []string{}, SlugConflicts: []string{}}
+
+	type versionKey struct{ user, title, version string }
+	kept := map[versionKey]versionRow{}
+	// rows in a stable order keep reports and picks repeatable
+	slices.SortFunc(rows, func(a, b versionRow) int {
+		return cmp.Or(cmp.Compare(a.User, b.User), cmp.Compare(a.Title, b.Title),
+			compareVersions(a.Version, b.Version), cmp.Compare(a.ID.Hex(), b.ID.Hex()))
+	})
+	for _, row := range rows {
+		key := versionKey{row.User, row.Title, row.Version}
+		previous, ok := kept[key]
+		if !ok {
+			kept[key] = row
+			continue
+		}
+		keep, drop := previous, row
+		if row.IsActive && !previous.IsActive || row.IsActive == previous.IsActive && row.Uploaded > previous.Uploaded {
+			keep, drop = row, previous
+		}
+		kept[key] = keep
+		deleted = append(deleted, drop.ID)
+		report.Deleted = append(report.Deleted, drop.String())
+	}
+
+	type postKey struct{ user, title string }
+	active := map[postKey]versionRow{}
+	type slugKey struct{ user, slug, version string }
+	slugTitles := map[slugKey]versionRow{}
+	for _, row := range rows {
+		if kept[versionKey{row.User, row.Title, row.Version}].ID != row.ID {
+			continue
+		}
+		if row.Slug != "" {
+			key := slugKey{row.User, row.Slug, row.Version}
+			if other, ok := slugTitles[key]; ok && other.Title != row.Title {
+				report.SlugConflicts = append(report.SlugConflicts, row.String()+" and "+other.String())
+			} else {
+				slugTitles[key] = row
+			}
+		}
+		if !row.IsActive {
+			continue
+		}
+		// rows are sorted by version, so a later active row is newer
+		key := postKey{row.User, row.Title}
+		if previous, ok := active[key]; ok {
+			deactivated = append(deactivated, previous.ID)
+			report.Deactivated = append(report.Deactivated, previous.String())
+		}
+		active[key] = row
+	}
+	return deleted, deactivated, report
+}
+
+// compareVersions orders versions by number, versions that are not numbers
+// come first.
+func compareVersions(a string, b string) int {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	switch {
+	case errA != nil && errB != nil:
+		return cmp.Compare(a, b)
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+	return cmp.Compare(x, y)
+}
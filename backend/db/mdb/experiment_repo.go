@@ -0,0 +1,73 @@
+package mdb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type MongoExperimentRepository struct {
+	collection *mongo.Collection
+}
+
+var _ db.ExperimentDB = (*MongoExperimentRepository)(nil)
+
+func NewMongoExperimentRepository(client *mongo.Client, dbName, collectionName string) *MongoExperimentRepository {
+	collection := client.Database(dbName).Collection(collectionName)
+	return &MongoExperimentRepository{collection}
+}
+
+// EnsureIndexes keeps one experiment per post.
+func (r *MongoExperimentRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user", Value: 1}, {Key: "title", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (r *MongoExperimentRepository) SaveExperiment(ctx context.Context, experiment *db.Experiment) error {
+	filter := bson.M{"user": experiment.User, "title": experiment.Title}
+	_, err := r.collection.ReplaceOne(ctx, filter, experiment, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *MongoExperimentRepository) FetchExperiment(ctx context.Context, username string, title string) (*db.Experiment, error) {
+	var experiment db.Experiment
+	err := r.collection.FindOne(ctx, bson.M{"user": username, "title": title}).Decode(&experiment)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &experiment, nil
+}
+
+func (r *MongoExperimentRepository) EndExperiment(ctx context.Context, username string, title string, at time.Time) (bool, error) {
+	filter := bson.M{"user": username, "title": title, "ended_at": nil}
+	res, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"ended_at": at}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (r *MongoExperimentRepository) DeleteExperiment(ctx context.Context, username string, title string) (bool, error) {
+	res, err := r.collection.DeleteOne(ctx, bson.M{"user": username, "title": title})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
+func (r *MongoExperimentRepository) RenameExperiment(ctx context.Context, username string, title string, newTitle string) error {
+	filter := bson.M{"user": username, "title": title}
+	_, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"title": newTitle}})
+	return err
+}
@@ -2,7 +2,9 @@ package mdb
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/shrijan-swaminathan/markbyte/backend/db"
@@ -39,7 +41,44 @@ func NewBlogPostDataDB(uri, dbName, collectionName string) (db.BlogPostDataDB, e
 		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
 	}
 
-	return NewMongoBlogPostDataRepository(client, dbName, collectionName), nil
+	repo := NewMongoBlogPostDataRepository(client, dbName, collectionName)
+	err = repo.EnsureIndexes(ctx)
+	if errors.Is(err, ErrDuplicateVersions) {
+		// the server still works without the unique indexes, uploads are
+		// numbered through the counters either way
+		fmt.Printf("Warning: %v\n", err)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to create blog post indexes: %w", err)
+	}
+	return repo, nil
+}
+
+// DedupeBlogPosts removes the duplicate versions that keep EnsureIndexes from
+// creating its unique indexes, then creates them. A dry run only reports what
+// would change.
+func DedupeBlogPosts(uri, dbName, collectionName string, dryRun bool) (*DedupeReport, error) {
+	ctx := context.Background()
+	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+
+	if err := client.Ping(pingCtx, nil); err != nil {
+		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
+	}
+
+	repo := NewMongoBlogPostDataRepository(client, dbName, collectionName)
+	report, err := repo.DedupeVersions(ctx, dryRun)
+	if err != nil || dryRun {
+		return report, err
+	}
+	if err := repo.EnsureIndexes(ctx); err != nil {
+		return report, fmt.Errorf("failed to create blog post indexes: %w", err)
+	}
+	return report, nil
 }
 
 func NewMongoAnalyticsDB(uri, dbName, collectionName string) (db.AnalyticsDB, error) {
@@ -57,3 +96,118 @@ func NewMongoAnalyticsDB(uri, dbName, collectionName string) (db.AnalyticsDB, er
 
 	return NewMongoAnalyticsRepository(client, dbName, collectionName), nil
 }
+
+func NewMongoAssetDB(uri, dbName, collectionName string) (db.AssetDB, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+
+	if err := client.Ping(ctx, nil); err != nil {
+		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
+	}
+
+	repo := NewMongoAssetRepository(client, dbName, collectionName)
+	if err := repo.EnsureIndexes(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create asset indexes: %w", err)
+	}
+	return repo, nil
+}
+
+func NewMongoUsageDB(uri, dbName, collectionName string) (db.UsageDB, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+
+	if err := client.Ping(ctx, nil); err != nil {
+		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
+	}
+
+	repo := NewMongoUsageRepository(client, dbName, collectionName)
+	if err := repo.EnsureIndexes(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create usage indexes: %w", err)
+	}
+	return repo, nil
+}
+
+func NewMongoCollectionDB(uri, dbName, collectionName string) (db.CollectionDB, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+
+	if err := client.Ping(ctx, nil); err != nil {
+		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
+	}
+
+	repo := NewMongoCollectionRepository(client, dbName, collectionName)
+	if err := repo.EnsureIndexes(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create collection indexes: %w", err)
+	}
+	return repo, nil
+}
+
+func NewMongoExperimentDB(uri, dbName, collectionName string) (db.ExperimentDB, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+
+	if err := client.Ping(ctx, nil); err != nil {
+		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
+	}
+
+	repo := NewMongoExperimentRepository(client, dbName, collectionName)
+	if err := repo.EnsureIndexes(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create experiment indexes: %w", err)
+	}
+	return repo, nil
+}
+
+func NewMongoThemeDB(uri, dbName, collectionName string) (db.ThemeDB, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+
+	if err := client.Ping(ctx, nil); err != nil {
+		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
+	}
+
+	repo := NewMongoThemeRepository(client, dbName, collectionName)
+	if err := repo.EnsureIndexes(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create theme indexes: %w", err)
+	}
+	return repo, nil
+}
+
+// URIFromEnv returns the mongo uri for the current environment: MONGO_URL or
+// the compose service inside docker, localhost otherwise. The compose replica
+// set names its member localhost, so the defaults connect directly instead of
+// discovering it.
+func URIFromEnv() string {
+	if os.Getenv("RUNNING_IN_DOCKER") == "true" {
+		env_mongo_url := os.Getenv("MONGO_URL")
+		if env_mongo_url != "" {
+			return env_mongo_url
+		}
+		return "mongodb://mongo:27017/?directConnection=true"
+	}
+	return "mongodb://localhost:27017/?directConnection=true"
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/shrijan-swaminathan/markbyte/backend/db"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
 func TestMongoBlogPostDataConversion(t *testing.T) {
@@ -45,3 +46,55 @@ func TestMongoPostAnalyticsConversion(t *testing.T) {
 	assert.Equal(t, 42, analytics.ViewCount)
 	assert.Equal(t, []string{"alice", "bob"}, analytics.Likes)
 }
+
+func TestPlanDedupe(t *testing.T) {
+	now := time.Now()
+	row := func(title string, version string, active bool, uploaded time.Time) versionRow {
+		return versionRow{
+			ID:       bson.NewObjectID(),
+			User:     "testuser",
+			Title:    title,
+			Slug:     "post",
+			Version:  version,
+			IsActive: active,
+			Uploaded: bson.NewDateTimeFromTime(uploaded),
+		}
+	}
+	// version 2 was stored twice and both 2 and 10 ended up active
+	older := row("Post", "2", true, now.Add(-time.Hour))
+	newer := row("Post", "2", true, now)
+	first := row("Post", "1", false, now.Add(-2*time.Hour))
+	latest := row("Post", "10", true, now)
+	// another post took the same slug for its version 1
+	other := row("Other", "1", true, now)
+
+	deleted, deactivated, report := planDedupe([]versionRow{latest, newer, first, older, other})
+	assert.Equal(t, []bson.ObjectID{older.ID}, deleted)
+	assert.Equal(t, []bson.ObjectID{newer.ID}, deactivated)
+	assert.Equal(t, []string{"testuser/Post@2"}, report.Deleted)
+	assert.Equal(t, []string{"testuser/Post@2"}, report.Deactivated)
+	assert.Equal(t, []string{"testuser/Post@1 and testuser/Other@1"}, report.SlugConflicts)
+
+	// once applied there is nothing left to do
+	deleted, deactivated, report = planDedupe([]versionRow{latest, first, other, {
+		ID: newer.ID, User: "testuser", Title: "Post", Slug: "post", Version: "2", Uploaded: newer.Uploaded,
+	}})
+	assert.Empty(t, deleted)
+	assert.Empty(t, deactivated)
+	assert.Empty(t, report.Deleted)
+}
+
+func TestVersionAfter(t *testing.T) {
+	// posts from before the counters continue after their highest version,
+	// gaps left by deleted versions included
+	next, err := versionAfter([]db.BlogPostData{{Version: "2"}, {Version: "10"}, {Version: "9"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 11, next)
+
+	next, err = versionAfter(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, next)
+
+	_, err = versionAfter([]db.BlogPostData{{Title: "Post", Version: "v2"}})
+	assert.Error(t, err)
+}
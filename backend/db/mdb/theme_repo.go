@@ -0,0 +1,71 @@
+package mdb
+
+import (
+	"context"
+	"errors"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type MongoThemeRepository struct {
+	collection *mongo.Collection
+}
+
+var _ db.ThemeDB = (*MongoThemeRepository)(nil)
+
+func NewMongoThemeRepository(client *mongo.Client, dbName, collectionName string) *MongoThemeRepository {
+	collection := client.Database(dbName).Collection(collectionName)
+	return &MongoThemeRepository{collection}
+}
+
+// EnsureIndexes keeps theme names unique per user.
+func (r *MongoThemeRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (r *MongoThemeRepository) SaveTheme(ctx context.Context, theme *db.Theme) error {
+	filter := bson.M{"user": theme.User, "name": theme.Name}
+	_, err := r.collection.ReplaceOne(ctx, filter, theme, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *MongoThemeRepository) FetchTheme(ctx context.Context, username string, name string) (*db.Theme, error) {
+	var theme db.Theme
+	err := r.collection.FindOne(ctx, bson.M{"user": username, "name": name}).Decode(&theme)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &theme, nil
+}
+
+func (r *MongoThemeRepository) FetchUserThemes(ctx context.Context, username string) ([]db.Theme, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"user": username}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	themes := []db.Theme{}
+	if err = cursor.All(ctx, &themes); err != nil {
+		return nil, err
+	}
+	return themes, nil
+}
+
+func (r *MongoThemeRepository) DeleteTheme(ctx context.Context, username string, name string) (bool, error) {
+	res, err := r.collection.DeleteOne(ctx, bson.M{"user": username, "name": name})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
@@ -0,0 +1,114 @@
+package mdb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type MongoUsageRepository struct {
+	collection *mongo.Collection
+}
+
+var _ db.UsageDB = (*MongoUsageRepository)(nil)
+
+func NewMongoUsageRepository(client *mongo.Client, dbName, collectionName string) *MongoUsageRepository {
+	collection := client.Database(dbName).Collection(collectionName)
+	return &MongoUsageRepository{collection}
+}
+
+func (r *MongoUsageRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (r *MongoUsageRepository) GetUsage(ctx context.Context, username string) (*db.Usage, error) {
+	var usage db.Usage
+	err := r.collection.FindOne(ctx, bson.M{"username": username}).Decode(&usage)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &db.Usage{Username: username}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// AddUsage applies a delta with $inc, so concurrent uploads by the same user
+// never lose an update.
+func (r *MongoUsageRepository) AddUsage(ctx context.Context, username string, bytes int64, objects int64) error {
+	filter := bson.M{"username": username}
+	update := bson.M{
+		"$inc": bson.M{"bytes": bytes, "objects": objects},
+		"$set": bson.M{"updated_at": time.Now()},
+	}
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	return err
+}
+
+// ReserveUsage checks the quota and applies the delta in one conditional
+// update, so concurrent uploads cannot both pass the check and go over it.
+func (r *MongoUsageRepository) ReserveUsage(ctx context.Context, username string, bytes int64, objects int64, quota db.Quota) (bool, error) {
+	// the conditional update needs a row to match
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"username": username},
+		bson.M{"$setOnInsert": bson.M{"bytes": int64(0), "objects": int64(0), "updated_at": time.Now()}},
+		options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		return false, err
+	}
+
+	filter := bson.M{"username": username}
+	within := bson.A{}
+	if bytes > 0 {
+		within = append(within, withinLimit("bytes", bytes, quota.Bytes))
+	}
+	if objects > 0 {
+		within = append(within, withinLimit("objects", objects, quota.Objects))
+	}
+	if len(within) > 0 {
+		filter["$expr"] = bson.M{"$and": within}
+	}
+	update := bson.M{
+		"$inc": bson.M{"bytes": bytes, "objects": objects},
+		"$set": bson.M{"updated_at": time.Now()},
+	}
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// withinLimit holds when adding add to field stays within the user's own
+// quota for it, or within fallback when they have none. A limit of 0 is no
+// limit.
+func withinLimit(field string, add int64, fallback int64) bson.M {
+	limit := bson.M{"$ifNull": bson.A{"$quota." + field, fallback}}
+	total := bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$" + field, 0}}, add}}
+	return bson.M{"$or": bson.A{
+		bson.M{"$lte": bson.A{limit, 0}},
+		bson.M{"$lte": bson.A{total, limit}},
+	}}
+}
+
+func (r *MongoUsageRepository) SetQuota(ctx context.Context, username string, quota *db.Quota) error {
+	filter := bson.M{"username": username}
+	update := bson.M{"$set": bson.M{"quota": quota, "updated_at": time.Now()}}
+	if quota == nil {
+		update = bson.M{
+			"$unset": bson.M{"quota": ""},
+			"$set":   bson.M{"updated_at": time.Now()},
+		}
+	}
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	return err
+}
@@ -75,3 +75,13 @@ func (r *MongoUserRepository) UpdateUserName(ctx context.Context, username strin
 	_, err := r.collection.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{"name": name}})
 	return err
 }
+
+func (r *MongoUserRepository) FetchAllProfilePictures(ctx context.Context) ([]string, error) {
+	var pictures []string
+	filter := bson.M{"profile_picture": bson.M{"$nin": bson.A{nil, ""}}}
+	err := r.collection.Distinct(ctx, "profile_picture", filter).Decode(&pictures)
+	if err != nil {
+		return nil, err
+	}
+	return pictures, nil
+}
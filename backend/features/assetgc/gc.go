@@ -0,0 +1,238 @@
+package assetgc
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
+)
+
+const (
+	AssetPrefix          = "assets/"
+	ProfilePicturePrefix = "profile_pictures/"
+
+	DefaultGrace = 72 * time.Hour
+)
+
+// Collector finds objects under the asset and profile picture prefixes that no
+// post version or user references any more, and deletes them once they were
+// neither uploaded nor reused within the grace period.
+type Collector struct {
+	Store  storage.BlobStore
+	Posts  db.BlogPostDataDB
+	Users  db.UserDB
+	Assets db.AssetDB
+	// Usage is credited for every deleted object when set.
+	Usage db.UsageDB
+	Grace time.Duration
+	Now   func() time.Time
+}
+
+type Orphan struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+type Report struct {
+	DryRun     bool      `json:"dry_run"`
+	StartedAt  time.Time `json:"started_at"`
+	Scanned    int       `json:"scanned"`
+	Referenced int       `json:"referenced"`
+	InGrace    int       `json:"in_grace"`
+	Orphans    []Orphan  `json:"orphans"`
+	Deleted    int       `json:"deleted"`
+	FreedBytes int64     `json:"freed_bytes"`
+	Errors     []string  `json:"errors,omitempty"`
+}
+
+// AssetHashFromKey returns the content hash an asset key was stored under.
+// Variant keys carry a suffix after the hash, e.g. <hash>_w480.jpg.
+func AssetHashFromKey(key string) string {
+	name := path.Base(key)
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if idx := strings.Index(name, "_"); idx != -1 {
+		name = name[:idx]
+	}
+	return name
+}
+
+// profilePictureKey maps a stored profile picture url back to its key. URLs
+// made under a different public base url still match on the key suffix.
+func profilePictureKey(url string) string {
+	idx := strings.Index(url, ProfilePicturePrefix)
+	if idx == -1 {
+		return ""
+	}
+	return url[idx:]
+}
+
+// profilePictureOwner returns the username a profile_pictures/<username><ext>
+// key belongs to.
+func profilePictureOwner(key string) string {
+	name := strings.TrimPrefix(key, ProfilePicturePrefix)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// latest returns the latest of times.
+func latest(times ...time.Time) time.Time {
+	var t time.Time
+	for _, candidate := range times {
+		if candidate.After(t) {
+			t = candidate
+		}
+	}
+	return t
+}
+
+// Run scans the store once. With dryRun set it only reports what would be
+// deleted.
+func (c *Collector) Run(ctx context.Context, dryRun bool) (Report, error) {
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+	grace := c.Grace
+	if grace == 0 {
+		grace = DefaultGrace
+	}
+	report := Report{DryRun: dryRun, StartedAt: now(), Orphans: make([]Orphan, 0)}
+	cutoff := report.StartedAt.Add(-grace)
+
+	hashes, err := c.Posts.FetchAllAssetRefs(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to fetch asset references: %w", err)
+	}
+	referencedAssets := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		referencedAssets[hash] = true
+	}
+
+	pictures, err := c.Users.FetchAllProfilePictures(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to fetch profile pictures: %w", err)
+	}
+	referencedPictures := make(map[string]bool, len(pictures))
+	for _, url := range pictures {
+		if key := profilePictureKey(url); key != "" {
+			referencedPictures[key] = true
+		}
+	}
+
+	assetObjects, err := c.Store.List(ctx, AssetPrefix)
+	if err != nil {
+		return report, err
+	}
+	pictureObjects, err := c.Store.List(ctx, ProfilePicturePrefix)
+	if err != nil {
+		return report, err
+	}
+
+	records := make(map[string]*db.Asset)
+	for _, obj := range append(assetObjects, pictureObjects...) {
+		report.Scanned++
+
+		isAsset := strings.HasPrefix(obj.Key, AssetPrefix)
+		hash := AssetHashFromKey(obj.Key)
+		if (isAsset && referencedAssets[hash]) || (!isAsset && referencedPictures[obj.Key]) {
+			report.Referenced++
+			continue
+		}
+
+		lastUsed := obj.LastModified
+		owner := ""
+		if isAsset {
+			asset, ok := records[hash]
+			if !ok {
+				asset, err = c.Assets.GetAsset(ctx, hash)
+				if err != nil {
+					// without the record its last use is unknown
+					report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", obj.Key, err))
+					continue
+				}
+				// variants share the record, which is gone once the first
+				// of them is deleted
+				records[hash] = asset
+			}
+			if asset != nil {
+				owner = asset.Uploader
+				lastUsed = latest(lastUsed, asset.CreatedAt, asset.LastUsedAt)
+			}
+		} else {
+			owner = profilePictureOwner(obj.Key)
+		}
+		if lastUsed.After(cutoff) {
+			report.InGrace++
+			continue
+		}
+		if !dryRun && isAsset && records[hash] != nil {
+			// an upload may have reused the asset since it was looked up, the
+			// post referencing it is not saved yet
+			asset, err := c.Assets.GetAsset(ctx, hash)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", obj.Key, err))
+				continue
+			}
+			if asset != nil && latest(asset.CreatedAt, asset.LastUsedAt).After(cutoff) {
+				report.InGrace++
+				continue
+			}
+		}
+
+		report.Orphans = append(report.Orphans, Orphan{
+			Key:          obj.Key,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+		})
+		if dryRun {
+			continue
+		}
+
+		if isAsset {
+			// drop the record first so a concurrent upload re-stores the object
+			if err := c.Assets.DeleteAsset(ctx, hash); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", obj.Key, err))
+				continue
+			}
+		}
+		if err := c.Store.Delete(ctx, obj.Key); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", obj.Key, err))
+			continue
+		}
+		report.Deleted++
+		report.FreedBytes += obj.Size
+		if c.Usage != nil && owner != "" {
+			if err := c.Usage.AddUsage(ctx, owner, -obj.Size, -1); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: failed to credit %s: %v", obj.Key, owner, err))
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// Start runs the collector every interval until ctx is cancelled.
+func (c *Collector) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := c.Run(ctx, false)
+				if err != nil {
+					fmt.Printf("asset gc failed: %v\n", err)
+					continue
+				}
+				fmt.Printf("asset gc: scanned %d, deleted %d (%d bytes), %d errors\n",
+					report.Scanned, report.Deleted, report.FreedBytes, len(report.Errors))
+			}
+		}
+	}()
+}
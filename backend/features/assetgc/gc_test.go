@@ -0,0 +1,219 @@
+package assetgc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePosts struct {
+	db.BlogPostDataDB
+	refs []string
+}
+
+func (f *fakePosts) FetchAllAssetRefs(ctx context.Context) ([]string, error) {
+	return f.refs, nil
+}
+
+type fakeUsers struct {
+	db.UserDB
+	pictures []string
+}
+
+func (f *fakeUsers) FetchAllProfilePictures(ctx context.Context) ([]string, error) {
+	return f.pictures, nil
+}
+
+type fakeAssets struct {
+	db.AssetDB
+	assets map[string]*db.Asset
+}
+
+func (f *fakeAssets) GetAsset(ctx context.Context, hash string) (*db.Asset, error) {
+	return f.assets[hash], nil
+}
+
+func (f *fakeAssets) DeleteAsset(ctx context.Context, hash string) error {
+	delete(f.assets, hash)
+	return nil
+}
+
+type fakeUsage struct {
+	db.UsageDB
+	credited map[string]int64
+}
+
+func (f *fakeUsage) AddUsage(ctx context.Context, username string, bytes int64, objects int64) error {
+	f.credited[username] += bytes
+	return nil
+}
+
+func newTestCollector(t *testing.T) (*Collector, *storage.LocalStore, *fakeAssets) {
+	t.Helper()
+	ctx := context.Background()
+	store, err := storage.NewLocalStore(t.TempDir(), "https://blobs.mock")
+	assert.NoError(t, err)
+
+	for _, key := range []string{
+		"assets/aaa.png",
+		"assets/bbb.png",
+		"profile_pictures/alice.png",
+		"profile_pictures/alice.jpg",
+		"alice_post_1.html",
+	} {
+		assert.NoError(t, store.Put(ctx, key, strings.NewReader("0123456789"), "application/octet-stream"))
+	}
+
+	assets := &fakeAssets{assets: map[string]*db.Asset{
+		"aaa": {Hash: "aaa", Key: "assets/aaa.png"},
+		"bbb": {Hash: "bbb", Key: "assets/bbb.png"},
+	}}
+	collector := &Collector{
+		Store:  store,
+		Posts:  &fakePosts{refs: []string{"aaa"}},
+		Users:  &fakeUsers{pictures: []string{"https://old-bucket.example.com/profile_pictures/alice.jpg"}},
+		Assets: assets,
+		Grace:  time.Hour,
+		Now:    func() time.Time { return time.Now().Add(2 * time.Hour) },
+	}
+	return collector, store, assets
+}
+
+func TestCollector_DryRunReportsOnly(t *testing.T) {
+	collector, store, assets := newTestCollector(t)
+
+	report, err := collector.Run(context.Background(), true)
+	assert.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 4, report.Scanned)
+	assert.Equal(t, 2, report.Referenced)
+	assert.Equal(t, 0, report.Deleted)
+
+	orphaned := make([]string, 0)
+	for _, orphan := range report.Orphans {
+		orphaned = append(orphaned, orphan.Key)
+	}
+	assert.ElementsMatch(t, []string{"assets/bbb.png", "profile_pictures/alice.png"}, orphaned)
+
+	objects, err := store.List(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Len(t, objects, 5)
+	assert.Contains(t, assets.assets, "bbb")
+}
+
+func TestCollector_DeletesOrphans(t *testing.T) {
+	collector, store, assets := newTestCollector(t)
+
+	report, err := collector.Run(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Deleted)
+	assert.Equal(t, int64(20), report.FreedBytes)
+
+	_, err = store.Get(context.Background(), "assets/bbb.png")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = store.Get(context.Background(), "profile_pictures/alice.png")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.NotContains(t, assets.assets, "bbb")
+
+	// referenced objects and post files are untouched
+	for _, key := range []string{"assets/aaa.png", "profile_pictures/alice.jpg", "alice_post_1.html"} {
+		_, err = store.Get(context.Background(), key)
+		assert.NoError(t, err, key)
+	}
+}
+
+func TestCollector_RespectsGracePeriod(t *testing.T) {
+	collector, _, assets := newTestCollector(t)
+	collector.Now = time.Now
+	assets.assets["bbb"].LastUsedAt = time.Now()
+
+	report, err := collector.Run(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.InGrace)
+	assert.Equal(t, 0, report.Deleted)
+}
+
+func TestCollector_DeletesVariantsWithTheirAsset(t *testing.T) {
+	collector, store, _ := newTestCollector(t)
+	ctx := context.Background()
+	for _, key := range []string{"assets/aaa_w480.png", "assets/bbb_w480.png", "assets/bbb.webp"} {
+		assert.NoError(t, store.Put(ctx, key, strings.NewReader("0123456789"), "application/octet-stream"))
+	}
+
+	report, err := collector.Run(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, report.Deleted)
+
+	_, err = store.Get(ctx, "assets/aaa_w480.png")
+	assert.NoError(t, err)
+	for _, key := range []string{"assets/bbb_w480.png", "assets/bbb.webp"} {
+		_, err = store.Get(ctx, key)
+		assert.ErrorIs(t, err, storage.ErrNotFound, key)
+	}
+}
+
+func TestAssetHashFromKey(t *testing.T) {
+	assert.Equal(t, "abc", AssetHashFromKey("assets/abc.png"))
+	assert.Equal(t, "abc", AssetHashFromKey("assets/abc_w480.jpg"))
+	assert.Equal(t, "abc", AssetHashFromKey("assets/abc_thumb.webp"))
+}
+
+func TestCollector_CreditsOwners(t *testing.T) {
+	collector, store, assets := newTestCollector(t)
+	ctx := context.Background()
+	assets.assets["bbb"].Uploader = "bob"
+	assert.NoError(t, store.Put(ctx, "assets/bbb_w480.png", strings.NewReader("01234"), "image/png"))
+	usage := &fakeUsage{credited: make(map[string]int64)}
+	collector.Usage = usage
+
+	_, err := collector.Run(ctx, false)
+	assert.NoError(t, err)
+	// the variant is credited to the uploader even after the record is gone
+	assert.Equal(t, map[string]int64{"bob": -15, "alice": -10}, usage.credited)
+}
+
+func TestCollector_KeepsRecentlyUploadedAssets(t *testing.T) {
+	collector, store, assets := newTestCollector(t)
+	// the object looks old, but the asset was uploaded within the grace period
+	assets.assets["bbb"].CreatedAt = time.Now().Add(90 * time.Minute)
+
+	report, err := collector.Run(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.InGrace)
+	assert.Equal(t, 1, report.Deleted)
+	_, err = store.Get(context.Background(), "assets/bbb.png")
+	assert.NoError(t, err)
+	assert.Contains(t, assets.assets, "bbb")
+}
+
+type reusedAssets struct {
+	*fakeAssets
+	lookups int
+	now     time.Time
+}
+
+// GetAsset reports the asset as reused after the first lookup.
+func (r *reusedAssets) GetAsset(ctx context.Context, hash string) (*db.Asset, error) {
+	asset, err := r.fakeAssets.GetAsset(ctx, hash)
+	r.lookups++
+	if asset != nil && r.lookups > 1 {
+		asset.LastUsedAt = r.now
+	}
+	return asset, err
+}
+
+func TestCollector_KeepsAssetsReusedDuringRun(t *testing.T) {
+	collector, store, assets := newTestCollector(t)
+	collector.Assets = &reusedAssets{fakeAssets: assets, now: collector.Now()}
+
+	report, err := collector.Run(context.Background(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.InGrace)
+	_, err = store.Get(context.Background(), "assets/bbb.png")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,157 @@
+package attachment
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	_ "golang.org/x/image/webp"
+)
+
+// File is an upload that passed Check, with the type detected from its bytes.
+type File struct {
+	ContentType string
+	Ext         string
+	// Data is the content to store. For svg it is the sanitized document.
+	Data []byte
+	// Raster is set for jpeg and png, which go through the image pipeline.
+	// Other formats are stored as they are.
+	Raster bool
+	Width  int
+	Height int
+}
+
+// RejectedError explains why a single file was not accepted.
+type RejectedError struct {
+	Name   string
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return e.Name + ": " + e.Reason
+}
+
+type imageType struct {
+	ext    string
+	raster bool
+}
+
+// images are matched on the sniffed content type
+var images = map[string]imageType{
+	"image/jpeg": {ext: ".jpg", raster: true},
+	"image/png":  {ext: ".png", raster: true},
+	"image/gif":  {ext: ".gif"},
+	"image/webp": {ext: ".webp"},
+}
+
+// data files sniff as plain text, so the extension only picks which text
+// type it is once the bytes have been checked
+var dataFiles = map[string]string{
+	".csv":  "text/csv",
+	".tsv":  "text/tab-separated-values",
+	".txt":  "text/plain",
+	".json": "application/json",
+}
+
+// Check detects what a file is from its content and returns it ready to store,
+// or a *RejectedError when the type is not on the allowlist.
+func Check(name string, content []byte) (*File, error) {
+	file, err := CheckReader(name, bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+	if file.Data == nil {
+		file.Data = content
+	}
+	return file, nil
+}
+
+// CheckReader is Check for a file that need not be in memory. Images and pdfs
+// are detected from their first bytes and come back without Data, they are
+// stored from r as they are. Svg and text files are read whole, since they
+// are checked throughout.
+func CheckReader(name string, r io.ReaderAt, size int64) (*File, error) {
+	reject := func(format string, args ...any) error {
+		return &RejectedError{Name: name, Reason: fmt.Sprintf(format, args...)}
+	}
+	if size == 0 {
+		return nil, reject("file is empty")
+	}
+
+	// enough for the sniffer and for looksLikeSVG
+	head := make([]byte, min(size, 1024))
+	_, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	sniffed := http.DetectContentType(head)
+	mediaType := strings.TrimSpace(strings.Split(sniffed, ";")[0])
+
+	if img, ok := images[mediaType]; ok {
+		cfg, _, err := image.DecodeConfig(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return nil, reject("invalid %s: %v", mediaType, err)
+		}
+		return &File{
+			ContentType: mediaType,
+			Ext:         img.ext,
+			Raster:      img.raster,
+			Width:       cfg.Width,
+			Height:      cfg.Height,
+		}, nil
+	}
+
+	if mediaType == "application/pdf" {
+		return &File{ContentType: mediaType, Ext: ".pdf"}, nil
+	}
+
+	if mediaType != "text/xml" && mediaType != "text/plain" {
+		return nil, reject("unsupported file type %s", mediaType)
+	}
+	content, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	if looksLikeSVG(content) {
+		clean, err := SanitizeSVG(content)
+		if err != nil {
+			return nil, reject("invalid svg: %v", err)
+		}
+		return &File{ContentType: "image/svg+xml", Ext: ".svg", Data: clean}, nil
+	}
+
+	if mediaType == "text/plain" {
+		ext := strings.ToLower(path.Ext(name))
+		contentType, ok := dataFiles[ext]
+		if !ok {
+			return nil, reject("unsupported text file type %q, allowed are .csv, .tsv, .txt and .json", ext)
+		}
+		if !utf8.Valid(content) {
+			return nil, reject("text file is not valid utf-8")
+		}
+		if contentType == "application/json" && !json.Valid(content) {
+			return nil, reject("invalid json")
+		}
+		return &File{ContentType: contentType, Ext: ext, Data: content}, nil
+	}
+
+	return nil, reject("unsupported file type %s", mediaType)
+}
+
+func looksLikeSVG(content []byte) bool {
+	head := content
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	return bytes.Contains(bytes.ToLower(head), []byte("<svg"))
+}
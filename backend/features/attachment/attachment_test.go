@@ -0,0 +1,127 @@
+package attachment
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testGIF(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewPaletted(image.Rect(0, 0, 4, 3), color.Palette{color.Black, color.White})
+	var buf bytes.Buffer
+	assert.NoError(t, gif.Encode(&buf, img, nil))
+	return buf.Bytes()
+}
+
+func TestCheck_DetectsFromContent(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     []byte
+		contentType string
+		ext         string
+	}{
+		// the extension does not decide the type
+		{"anim.png", testGIF(t), "image/gif", ".gif"},
+		{"doc.pdf", []byte("%PDF-1.7\n1 0 obj\n"), "application/pdf", ".pdf"},
+		{"data.csv", []byte("a,b\n1,2\n"), "text/csv", ".csv"},
+		{"DATA.JSON", []byte(`{"a": 1}`), "application/json", ".json"},
+		{"notes.txt", []byte("hello"), "text/plain", ".txt"},
+		{"icon.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><rect width="1"/></svg>`), "image/svg+xml", ".svg"},
+		{"icon.svg", []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`), "image/svg+xml", ".svg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := Check(tt.name, tt.content)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.contentType, file.ContentType)
+				assert.Equal(t, tt.ext, file.Ext)
+				assert.False(t, file.Raster)
+			}
+		})
+	}
+}
+
+func TestCheck_GIFDimensions(t *testing.T) {
+	file, err := Check("a.gif", testGIF(t))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, file.Width)
+	assert.Equal(t, 3, file.Height)
+}
+
+func TestCheckReader(t *testing.T) {
+	// images are only looked at, their data stays with the reader
+	content := testGIF(t)
+	file, err := CheckReader("anim.gif", bytes.NewReader(content), int64(len(content)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "image/gif", file.ContentType)
+		assert.Nil(t, file.Data)
+		assert.Equal(t, 4, file.Width)
+	}
+
+	// svgs come back sanitized
+	content = []byte(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"><rect width="1"/></svg>`)
+	file, err = CheckReader("icon.svg", bytes.NewReader(content), int64(len(content)))
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(file.Data), "onload")
+	}
+
+	_, err = CheckReader("empty.txt", bytes.NewReader(nil), 0)
+	var rejected *RejectedError
+	assert.True(t, errors.As(err, &rejected))
+}
+
+func TestCheck_Rejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		reason  string
+	}{
+		{"empty.png", nil, "file is empty"},
+		{"fake.png", []byte("not really a png"), `unsupported text file type ".png"`},
+		{"page.html", []byte("<html><body>hi</body></html>"), "unsupported file type text/html"},
+		{"run.exe", []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00"), "unsupported file type application/octet-stream"},
+		{"bad.json", []byte("{nope"), "invalid json"},
+		{"trunc.gif", []byte("GIF89a"), "invalid image/gif"},
+		{"page.svg", []byte(`<root><svg></svg></root>`), "invalid svg: root element is <root>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Check(tt.name, tt.content)
+			var rejection *RejectedError
+			if assert.True(t, errors.As(err, &rejection)) {
+				assert.Equal(t, tt.name, rejection.Name)
+				assert.Contains(t, rejection.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestSanitizeSVG(t *testing.T) {
+	dirty := `<?xml version="1.0"?>
+<!DOCTYPE svg [<!ENTITY x "boom">]>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" onload="alert(1)">
+  <!-- comment -->
+  <script>alert(2)</script>
+  <foreignObject><div xmlns="http://www.w3.org/1999/xhtml">html</div></foreignObject>
+  <a xlink:href="javascript:alert(3)"><text>click &amp; go</text></a>
+  <a href="#local"><circle r="4" onclick="alert(4)" fill="url(#g)"/></a>
+  <a><set attributeName="href" to="javascript:alert(5)"/></a>
+  <image href="https://tracker.example.com/pixel.png"/>
+</svg>`
+
+	clean, err := SanitizeSVG([]byte(dirty))
+	assert.NoError(t, err)
+	out := string(clean)
+	for _, banned := range []string{"alert", "script", "foreignObject", "DOCTYPE", "comment", "tracker.example.com", "<set"} {
+		assert.NotContains(t, out, banned)
+	}
+	assert.Contains(t, out, `xmlns:xlink="http://www.w3.org/1999/xlink"`)
+	assert.Contains(t, out, `<a href="#local"><circle r="4" fill="url(#g)"></circle></a>`)
+	assert.Contains(t, out, `click &amp; go`)
+}
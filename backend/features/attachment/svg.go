@@ -0,0 +1,140 @@
+package attachment
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// elements dropped together with everything inside them
+var svgBlockedElements = map[string]bool{
+	"script":        true,
+	"foreignobject": true,
+	"iframe":        true,
+	"object":        true,
+	"embed":         true,
+	"handler":       true,
+	"listener":      true,
+}
+
+// SanitizeSVG re-serializes an svg document without scripts, event handler
+// attributes, embedded html or links outside the document, data urls aside.
+// Doctypes are dropped as well, which rules out entity expansion.
+func SanitizeSVG(content []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Strict = true
+
+	var out bytes.Buffer
+	depth := 0
+	// depth at which a blocked element started, 0 when not inside one
+	skipping := 0
+	sawRoot := false
+
+	for {
+		tok, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if skipping != 0 {
+				continue
+			}
+			if !sawRoot {
+				if strings.ToLower(t.Name.Local) != "svg" {
+					return nil, fmt.Errorf("root element is <%s>, not <svg>", t.Name.Local)
+				}
+				sawRoot = true
+			}
+			if svgBlockedElements[strings.ToLower(t.Name.Local)] || animatesHref(t) {
+				skipping = depth
+				continue
+			}
+			out.WriteString("<" + qualifiedName(t.Name))
+			for _, attr := range t.Attr {
+				if !allowedSVGAttr(attr) {
+					continue
+				}
+				out.WriteString(" " + qualifiedName(attr.Name) + `="`)
+				escapeText(&out, attr.Value)
+				out.WriteString(`"`)
+			}
+			out.WriteString(">")
+		case xml.EndElement:
+			if skipping != 0 {
+				if depth == skipping {
+					skipping = 0
+				}
+				depth--
+				continue
+			}
+			depth--
+			out.WriteString("</" + qualifiedName(t.Name) + ">")
+		case xml.CharData:
+			if skipping != 0 || !sawRoot {
+				continue
+			}
+			escapeText(&out, string(t))
+		case xml.ProcInst:
+			if t.Target == "xml" && out.Len() == 0 {
+				out.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+			}
+		case xml.Comment, xml.Directive:
+			// dropped
+		}
+	}
+
+	if !sawRoot {
+		return nil, errors.New("no <svg> element found")
+	}
+	return out.Bytes(), nil
+}
+
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+func allowedSVGAttr(attr xml.Attr) bool {
+	local := strings.ToLower(attr.Name.Local)
+	if strings.HasPrefix(local, "on") {
+		return false
+	}
+	if local == "href" || local == "src" || local == "action" || local == "formaction" {
+		value := strings.ToLower(strings.TrimSpace(attr.Value))
+		return strings.HasPrefix(value, "#") || strings.HasPrefix(value, "data:image/png") ||
+			strings.HasPrefix(value, "data:image/jpeg") || strings.HasPrefix(value, "data:image/gif") ||
+			strings.HasPrefix(value, "data:image/webp")
+	}
+	return true
+}
+
+// animatesHref catches <animate attributeName="href" values="javascript:...">,
+// which would otherwise swap a link target in after sanitizing.
+func animatesHref(el xml.StartElement) bool {
+	switch strings.ToLower(el.Name.Local) {
+	case "animate", "set", "animatemotion", "animatetransform":
+	default:
+		return false
+	}
+	for _, attr := range el.Attr {
+		if strings.ToLower(attr.Name.Local) == "attributename" && strings.HasSuffix(strings.ToLower(attr.Value), "href") {
+			return true
+		}
+	}
+	return false
+}
+
+func escapeText(out *bytes.Buffer, s string) {
+	_ = xml.EscapeText(out, []byte(s))
+}
@@ -0,0 +1,167 @@
+// Package frontmatter reads the metadata block at the top of a markdown file,
+// in the yaml (---) or toml (+++) style of Jekyll and Hugo.
+package frontmatter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Meta is the post metadata a front matter block can set. Unknown keys are
+// ignored, so files written for other generators upload as they are.
+type Meta struct {
+	Title        string     `yaml:"title" toml:"title"`
+	Description  string     `yaml:"description" toml:"description"`
+	Tags         Tags       `yaml:"tags" toml:"tags"`
+	Date         *time.Time `yaml:"date" toml:"date"`
+	Slug         string     `yaml:"slug" toml:"slug"`
+	Draft        bool       `yaml:"draft" toml:"draft"`
+	Visibility   string     `yaml:"visibility" toml:"visibility"`
+	CanonicalURL string     `yaml:"canonical_url" toml:"canonical_url"`
+	CoverImage   string     `yaml:"cover_image" toml:"cover_image"`
+	// Message says what the upload changed, like a commit message.
+	Message string `yaml:"message" toml:"message"`
+	// RevisionHistory shows the messages of earlier versions on the post.
+	RevisionHistory bool `yaml:"revision_history" toml:"revision_history"`
+}
+
+// PostVisibility is the visibility asked for, "" when the front matter does
+// not say. draft: true wins over a visibility key.
+func (m Meta) PostVisibility() string {
+	if m.Draft {
+		return "draft"
+	}
+	return m.Visibility
+}
+
+// Tags accepts a list or a single comma separated string.
+type Tags []string
+
+func (t *Tags) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*t = splitTags(value.Value)
+		return nil
+	}
+	var tags []string
+	err := value.Decode(&tags)
+	if err != nil {
+		return err
+	}
+	*t = cleanTags(tags)
+	return nil
+}
+
+func (t *Tags) UnmarshalTOML(data any) error {
+	switch v := data.(type) {
+	case string:
+		*t = splitTags(v)
+	case []any:
+		tags := make([]string, 0, len(v))
+		for _, tag := range v {
+			s, ok := tag.(string)
+			if !ok {
+				return fmt.Errorf("tag %v is not a string", tag)
+			}
+			tags = append(tags, s)
+		}
+		*t = cleanTags(tags)
+	default:
+		return fmt.Errorf("tags must be a list or a string")
+	}
+	return nil
+}
+
+func splitTags(s string) Tags {
+	return cleanTags(strings.Split(s, ","))
+}
+
+func cleanTags(tags []string) Tags {
+	cleaned := make(Tags, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			cleaned = append(cleaned, tag)
+		}
+	}
+	return cleaned
+}
+
+// ErrInvalid is returned for a front matter block that cannot be read.
+var ErrInvalid = errors.New("invalid front matter")
+
+// Split separates the front matter from the markdown body. Content without a
+// front matter block is returned unchanged with an empty Meta. A leading ---
+// that is not closed or does not enclose a yaml mapping is a thematic break. The body is
+// always a suffix of content.
+func Split(content []byte) (Meta, []byte, error) {
+	var meta Meta
+
+	// editors on windows add a byte order mark and crlf line endings
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	first, rest, found := cutLine(content)
+	if !found {
+		return meta, content, nil
+	}
+	delim := string(bytes.TrimRight(first, " \t"))
+	if delim != "---" && delim != "+++" {
+		return meta, content, nil
+	}
+
+	var block []byte
+	for {
+		line, next, ok := cutLine(rest)
+		if string(bytes.TrimRight(line, " \t")) == delim {
+			rest = next
+			break
+		}
+		if !ok {
+			if delim == "---" {
+				// a thematic break at the top of the markdown
+				return meta, content, nil
+			}
+			return meta, content, fmt.Errorf("%w: not closed with %s", ErrInvalid, delim)
+		}
+		block = append(block, line...)
+		block = append(block, '\n')
+		rest = next
+	}
+
+	var err error
+	if delim == "---" {
+		// two thematic breaks around markdown, not a yaml mapping
+		var doc yaml.Node
+		if yaml.Unmarshal(block, &doc) != nil || !isMapping(&doc) {
+			return meta, content, nil
+		}
+		err = doc.Decode(&meta)
+	} else {
+		_, err = toml.Decode(string(block), &meta)
+	}
+	if err != nil {
+		return meta, content, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return meta, rest, nil
+}
+
+// isMapping reports whether doc is empty or holds a mapping, as front
+// matter does.
+func isMapping(doc *yaml.Node) bool {
+	if len(doc.Content) == 0 {
+		return true
+	}
+	node := doc.Content[0]
+	return node.Kind == yaml.MappingNode || (node.Kind == yaml.ScalarNode && node.Tag == "!!null")
+}
+
+// cutLine splits off the first line without its line ending. found is false
+// when there is no line ending left.
+func cutLine(content []byte) (line []byte, rest []byte, found bool) {
+	line, rest, found = bytes.Cut(content, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r")), rest, found
+}
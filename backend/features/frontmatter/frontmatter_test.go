@@ -0,0 +1,73 @@
+package frontmatter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplit_YAML(t *testing.T) {
+	content := "---\r\ntitle: Hello World\r\ndescription: A first post\r\ntags: [go, web]\r\ndate: 2024-03-01\r\nslug: hello\r\ndraft: true\r\ncanonical_url: https://example.com/hello\r\ncover_image: cover.png\r\nlayout: post\r\n---\r\n# Hello\r\n"
+
+	meta, body, err := Split([]byte(content))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "# Hello\r\n", string(body))
+	assert.Equal(t, "Hello World", meta.Title)
+	assert.Equal(t, "A first post", meta.Description)
+	assert.Equal(t, Tags{"go", "web"}, meta.Tags)
+	if assert.NotNil(t, meta.Date) {
+		assert.True(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC).Equal(*meta.Date))
+	}
+	assert.Equal(t, "hello", meta.Slug)
+	assert.Equal(t, "draft", meta.PostVisibility())
+	assert.Equal(t, "https://example.com/hello", meta.CanonicalURL)
+	assert.Equal(t, "cover.png", meta.CoverImage)
+}
+
+func TestSplit_TOML(t *testing.T) {
+	content := "+++\ntitle = \"Hello World\"\ntags = \"go, web\"\ndate = 2024-03-01T10:00:00Z\nvisibility = \"unlisted\"\nmessage = \"Add benchmarks\"\nrevision_history = true\n+++\n\nBody"
+
+	meta, body, err := Split([]byte(content))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "\nBody", string(body))
+	assert.Equal(t, "Hello World", meta.Title)
+	assert.Equal(t, Tags{"go", "web"}, meta.Tags)
+	if assert.NotNil(t, meta.Date) {
+		assert.True(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC).Equal(*meta.Date))
+	}
+	assert.Equal(t, "unlisted", meta.PostVisibility())
+	assert.Equal(t, "Add benchmarks", meta.Message)
+	assert.True(t, meta.RevisionHistory)
+}
+
+func TestSplit_NoFrontMatter(t *testing.T) {
+	for _, content := range []string{
+		"# Title\n\n---\n", "", "---",
+		// thematic breaks at the top
+		"---\ntitle: Hello\n# Body\n",
+		"---\n\nSome text\n\n---\n\nMore text\n",
+		"---\ntitle: [unclosed\n---\n",
+		"---\n- one\n- two\n---\n",
+	} {
+		meta, body, err := Split([]byte(content))
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(body))
+		assert.Equal(t, Meta{}, meta)
+	}
+}
+
+func TestSplit_Invalid(t *testing.T) {
+	for _, content := range []string{
+		"---\ntitle: [a, b]\n---\n",
+		"---\ndate: someday\n---\n",
+		"+++\ntitle = \n+++\n",
+		"+++\ntitle = \"Hello\"\n",
+	} {
+		_, body, err := Split([]byte(content))
+		assert.Error(t, err, content)
+		assert.Equal(t, content, string(body))
+	}
+}
@@ -0,0 +1,76 @@
+// Package htmldiff marks up the words that changed between two rendered html
+// documents, keeping the markup of the newer one.
+package htmldiff
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// a token is a whole tag, a run of whitespace or a word. Raw text elements
+// are a single token with their content, a <del> or <ins> inside them would
+// be read as text or code.
+var tokenPattern = regexp.MustCompile(`(?is)<script\b[^>]*>.*?</script\s*>|<style\b[^>]*>.*?</style\s*>|` +
+	`<textarea\b[^>]*>.*?</textarea\s*>|<title\b[^>]*>.*?</title\s*>|<[^>]*>|\s+|[^\s<]+`)
+
+func tokenize(html string) []string {
+	return tokenPattern.FindAllString(html, -1)
+}
+
+func isTag(token string) bool {
+	return strings.HasPrefix(token, "<")
+}
+
+// Diff returns new with removed words in <del> and added words in <ins>. Tags
+// only found in old are dropped so the result keeps a valid structure, tags
+// added in new are kept as they are.
+func Diff(old string, new string) string {
+	a, b := tokenize(old), tokenize(new)
+	// whitespace tokens are everywhere, autojunk would ignore them and match
+	// words across paragraphs instead
+	matcher := difflib.NewMatcherWithJunk(a, b, false, nil)
+
+	var out strings.Builder
+	for _, op := range matcher.GetOpCodes() {
+		switch op.Tag {
+		case 'e':
+			out.WriteString(strings.Join(b[op.J1:op.J2], ""))
+		case 'd':
+			writeMarked(&out, "del", a[op.I1:op.I2], false)
+		case 'i':
+			writeMarked(&out, "ins", b[op.J1:op.J2], true)
+		case 'r':
+			writeMarked(&out, "del", a[op.I1:op.I2], false)
+			writeMarked(&out, "ins", b[op.J1:op.J2], true)
+		}
+	}
+	return out.String()
+}
+
+// writeMarked wraps each run of text tokens in <mark>. Tags end a run and are
+// written only when keepTags is set.
+func writeMarked(out *strings.Builder, mark string, tokens []string, keepTags bool) {
+	open := false
+	for _, token := range tokens {
+		if isTag(token) {
+			if open {
+				out.WriteString("</" + mark + ">")
+				open = false
+			}
+			if keepTags {
+				out.WriteString(token)
+			}
+			continue
+		}
+		if !open {
+			out.WriteString("<" + mark + ">")
+			open = true
+		}
+		out.WriteString(token)
+	}
+	if open {
+		out.WriteString("</" + mark + ">")
+	}
+}
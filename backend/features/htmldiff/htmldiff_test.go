@@ -0,0 +1,74 @@
+package htmldiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{
+			name: "unchanged",
+			old:  "<p>same text</p>",
+			new:  "<p>same text</p>",
+			want: "<p>same text</p>",
+		},
+		{
+			name: "word replaced",
+			old:  "<p>the quick fox</p>",
+			new:  "<p>the slow fox</p>",
+			want: "<p>the <del>quick</del><ins>slow</ins> fox</p>",
+		},
+		{
+			name: "words added",
+			old:  "<p>hello</p>",
+			new:  "<p>hello big world</p>",
+			want: "<p>hello<ins> big world</ins></p>",
+		},
+		{
+			name: "formatting added keeps the new tags",
+			old:  "<p>very important</p>",
+			new:  "<p>very <strong>important</strong></p>",
+			want: "<p>very <strong>important</strong></p>",
+		},
+		{
+			name: "paragraph removed drops its tags",
+			old:  "<p>one</p><p>two</p>",
+			new:  "<p>one</p>",
+			want: "<p>one</p><del>two</del>",
+		},
+		{
+			name: "new paragraph",
+			old:  "<h1>Title</h1>",
+			new:  "<h1>Title</h1>\n<p>body</p>",
+			want: "<h1>Title</h1><ins>\n</ins><p><ins>body</ins></p>",
+		},
+		{
+			name: "style changed is not marked inside",
+			old:  "<style>p { color: red; }</style><p>text</p>",
+			new:  "<style>p { color: blue; }</style><p>text</p>",
+			want: "<style>p { color: blue; }</style><p>text</p>",
+		},
+		{
+			name: "script added is kept whole",
+			old:  "<p>text</p>",
+			new:  "<p>text</p><script type=\"module\">let a = 1 < 2;</script>",
+			want: "<p>text</p><script type=\"module\">let a = 1 < 2;</script>",
+		},
+		{
+			name: "script removed is dropped",
+			old:  "<p>text</p><SCRIPT>run()</SCRIPT>",
+			new:  "<p>text</p>",
+			want: "<p>text</p>",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Diff(tc.old, tc.new))
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+)
+
+const (
+	DefaultMaxDimension = 2048
+	DefaultThumbSize    = 320
+
+	// MaxPixels bounds the decoded size so a small file claiming huge
+	// dimensions cannot exhaust memory.
+	MaxPixels = 50_000_000
+
+	jpegQuality = 85
+	webpQuality = 80
+)
+
+var DefaultWidths = []int{480, 960, 1600}
+
+var ErrTooLarge = errors.New("image dimensions too large")
+
+type Options struct {
+	// MaxDimension caps the longest side of the stored image.
+	MaxDimension int
+	// Widths lists the resized copies to generate. Widths at or above the
+	// stored image's width are skipped.
+	Widths []int
+	// ThumbSize is the bounding box of the thumbnail. Zero disables it.
+	ThumbSize int
+	// WebP also encodes each size as webp, lossy unless the image has
+	// transparency.
+	WebP bool
+}
+
+// DefaultOptions is what post attachments are processed with.
+var DefaultOptions = Options{
+	MaxDimension: DefaultMaxDimension,
+	Widths:       DefaultWidths,
+	ThumbSize:    DefaultThumbSize,
+	WebP:         true,
+}
+
+type Variant struct {
+	// Suffix is appended to the asset name, e.g. "_w480" or "_thumb".
+	Suffix      string
+	Ext         string
+	ContentType string
+	Width       int
+	Height      int
+	Thumbnail   bool
+	Data        []byte
+}
+
+// Result is the re-encoded image plus its variants. Re-encoding drops EXIF
+// and any other metadata the upload carried.
+type Result struct {
+	Ext         string
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+	Variants    []Variant
+}
+
+// Process decodes a jpeg or png, applies its EXIF orientation, caps it at
+// opts.MaxDimension and generates the configured variants.
+func Process(content []byte, opts Options) (*Result, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	// the cap is a square box, so scaling before rotating gives the same
+	// result and keeps the rotation cheap
+	if opts.MaxDimension > 0 {
+		img = fit(img, opts.MaxDimension, opts.MaxDimension)
+	}
+	ext, contentType := ".png", "image/png"
+	if format == "jpeg" {
+		ext, contentType = ".jpg", "image/jpeg"
+		img = orient(img, exifOrientation(content))
+	}
+	data, err := encode(img, format)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	result := &Result{
+		Ext:         ext,
+		ContentType: contentType,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		Data:        data,
+	}
+
+	type size struct {
+		suffix string
+		img    image.Image
+		thumb  bool
+	}
+	sizes := []size{{suffix: "", img: img}}
+	for _, width := range opts.Widths {
+		if width >= result.Width {
+			continue
+		}
+		sizes = append(sizes, size{suffix: fmt.Sprintf("_w%d", width), img: fit(img, width, 0)})
+	}
+	if opts.ThumbSize > 0 && (result.Width > opts.ThumbSize || result.Height > opts.ThumbSize) {
+		sizes = append(sizes, size{suffix: "_thumb", img: fit(img, opts.ThumbSize, opts.ThumbSize), thumb: true})
+	}
+
+	for _, s := range sizes[1:] {
+		data, err := encode(s.img, format)
+		if err != nil {
+			return nil, err
+		}
+		b := s.img.Bounds()
+		result.Variants = append(result.Variants, Variant{
+			Suffix:      s.suffix,
+			Ext:         ext,
+			ContentType: contentType,
+			Width:       b.Dx(),
+			Height:      b.Dy(),
+			Thumbnail:   s.thumb,
+			Data:        data,
+		})
+	}
+
+	if !opts.WebP {
+		return result, nil
+	}
+	// a webp is only kept for the sizes it comes out smaller at, the
+	// lossless one for transparent images often does not
+	opaque := isOpaque(img)
+	resized := result.Variants
+	for i, s := range sizes {
+		data, err := encodeWebP(s.img, opaque)
+		if err != nil {
+			return nil, err
+		}
+		original := result.Data
+		if i > 0 {
+			original = resized[i-1].Data
+		}
+		if len(data) >= len(original) {
+			continue
+		}
+		b := s.img.Bounds()
+		result.Variants = append(result.Variants, Variant{
+			Suffix:      s.suffix,
+			Ext:         ".webp",
+			ContentType: "image/webp",
+			Width:       b.Dx(),
+			Height:      b.Dy(),
+			Thumbnail:   s.thumb,
+			Data:        data,
+		})
+	}
+
+	return result, nil
+}
+
+func encodeWebP(img image.Image, opaque bool) ([]byte, error) {
+	if opaque {
+		data, err := encodeLossyWebP(img, webpQuality)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode webp: %w", err)
+		}
+		return data, nil
+	}
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, img, nil); err != nil {
+		return nil, fmt.Errorf("failed to encode webp: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+func encode(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// fit scales img down to fit within maxW x maxH, keeping its aspect ratio. A
+// zero bound is unconstrained. Images already inside the box are returned
+// as is.
+func fit(img image.Image, maxW, maxH int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	scale := 1.0
+	if maxW > 0 && w > maxW {
+		scale = float64(maxW) / float64(w)
+	}
+	if maxH > 0 && float64(h)*scale > float64(maxH) {
+		scale = float64(maxH) / float64(h)
+	}
+	if scale == 1.0 {
+		return img
+	}
+	nw := max(1, int(float64(w)*scale+0.5))
+	nh := max(1, int(float64(h)*scale+0.5))
+	dst := image.NewNRGBA(image.Rect(0, 0, nw, nh))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
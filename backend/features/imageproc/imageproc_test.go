@@ -0,0 +1,192 @@
+package imageproc
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/webp"
+)
+
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+// photoImage looks like a photo to an encoder: smooth shading, texture and
+// some sensor noise.
+func photoImage(w, h int) *image.NRGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			shade := 60 * math.Sin(float64(x)/90) * math.Cos(float64(y)/70)
+			texture := 20 * math.Sin(float64(x*y)/500)
+			noise := rng.NormFloat64() * 3
+			img.Set(x, y, color.NRGBA{
+				R: uint8(max(0, min(255, 120+shade+texture+noise))),
+				G: uint8(max(0, min(255, 100+shade/2-texture+noise))),
+				B: uint8(max(0, min(255, 80+float64(y)/10+noise))),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// withOrientation splices an EXIF APP1 segment carrying the given orientation
+// in after the jpeg's SOI marker.
+func withOrientation(t *testing.T, img image.Image, orientation uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, nil))
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08,
+		0x00, 0x01,
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, byte(orientation >> 8), byte(orientation), 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	segment = append(segment, payload...)
+
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+func TestProcess_ResizesAndBuildsVariants(t *testing.T) {
+	opts := DefaultOptions
+	opts.WebP = false
+	result, err := Process(encodePNG(t, testImage(3000, 1500)), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, ".png", result.Ext)
+	assert.Equal(t, DefaultMaxDimension, result.Width)
+	assert.Equal(t, 1024, result.Height)
+
+	widths := make(map[string]int)
+	for _, v := range result.Variants {
+		if v.ContentType == "image/png" {
+			widths[v.Suffix] = v.Width
+		}
+	}
+	assert.Equal(t, map[string]int{"_w480": 480, "_w960": 960, "_w1600": 1600, "_thumb": 320}, widths)
+
+	cfg, err := png.DecodeConfig(bytes.NewReader(result.Data))
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultMaxDimension, cfg.Width)
+}
+
+func TestProcess_SmallImageHasNoVariants(t *testing.T) {
+	result, err := Process(encodePNG(t, testImage(100, 50)), Options{MaxDimension: 512, Widths: DefaultWidths, ThumbSize: DefaultThumbSize})
+	assert.NoError(t, err)
+	assert.Equal(t, 100, result.Width)
+	assert.Empty(t, result.Variants)
+}
+
+func TestProcess_AppliesAndStripsOrientation(t *testing.T) {
+	content := withOrientation(t, testImage(40, 20), 6)
+	assert.Equal(t, 6, exifOrientation(content))
+
+	result, err := Process(content, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, ".jpg", result.Ext)
+	assert.Equal(t, 20, result.Width)
+	assert.Equal(t, 40, result.Height)
+	// the re-encoded file carries no EXIF block
+	assert.Equal(t, 1, exifOrientation(result.Data))
+	assert.NotContains(t, string(result.Data), "Exif")
+}
+
+func TestProcess_WebPOnlyWhenSmaller(t *testing.T) {
+	// a flat image compresses far better as lossless webp than as png
+	flat := image.NewNRGBA(image.Rect(0, 0, 600, 600))
+	for i := range flat.Pix {
+		flat.Pix[i] = 200
+	}
+	result, err := Process(encodePNG(t, flat), DefaultOptions)
+	assert.NoError(t, err)
+
+	webps := 0
+	for _, v := range result.Variants {
+		if v.ContentType == "image/webp" {
+			webps++
+			assert.Equal(t, ".webp", v.Ext)
+		}
+	}
+	assert.Equal(t, 3, webps) // full size, _w480 and _thumb
+}
+
+func TestProcess_PhotoGetsLossyWebP(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, photoImage(1200, 800), &jpeg.Options{Quality: 90}))
+	result, err := Process(buf.Bytes(), DefaultOptions)
+	assert.NoError(t, err)
+
+	jpegs := map[string]int{"": len(result.Data)}
+	webps := make(map[string]int)
+	for _, v := range result.Variants {
+		if v.ContentType == "image/jpeg" {
+			jpegs[v.Suffix] = len(v.Data)
+			continue
+		}
+		webps[v.Suffix] = len(v.Data)
+		decoded, err := webp.Decode(bytes.NewReader(v.Data))
+		if assert.NoError(t, err, v.Suffix) {
+			assert.Equal(t, image.Pt(v.Width, v.Height), decoded.Bounds().Size(), v.Suffix)
+		}
+	}
+	assert.Len(t, webps, 4) // full size, _w480, _w960 and _thumb
+	for suffix, size := range webps {
+		assert.Less(t, size, jpegs[suffix], suffix)
+	}
+}
+
+func TestEncodeLossyWebP_RoundTrip(t *testing.T) {
+	// odd sizes leave partial macroblocks at the edges
+	img := photoImage(203, 97)
+	data, err := encodeLossyWebP(img, webpQuality)
+	assert.NoError(t, err)
+	decoded, err := webp.Decode(bytes.NewReader(data))
+	if !assert.NoError(t, err) {
+		return
+	}
+	ycbcr := decoded.(*image.YCbCr)
+	assert.Equal(t, img.Bounds(), ycbcr.Bounds())
+
+	var sse float64
+	for y := 0; y < 97; y++ {
+		for x := 0; x < 203; x++ {
+			c := img.NRGBAAt(x, y)
+			want := (16839*int(c.R) + 33059*int(c.G) + 6420*int(c.B) + 1<<15 + 16<<16) >> 16
+			d := float64(want) - float64(ycbcr.Y[ycbcr.YOffset(x, y)])
+			sse += d * d
+		}
+	}
+	psnr := 10 * math.Log10(255*255/(sse/(203*97)))
+	assert.Greater(t, psnr, 35.0)
+}
+
+func TestProcess_RejectsInvalidImage(t *testing.T) {
+	_, err := Process([]byte("not an image"), DefaultOptions)
+	assert.Error(t, err)
+}
@@ -0,0 +1,672 @@
+package imageproc
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// encodeLossyWebP encodes img as a lossy webp holding a single VP8 key frame.
+// Only the whole macroblock intra modes are used, which is enough for still
+// images at a fraction of the size of a lossless one. Transparency is not
+// kept, so it is only used for opaque images.
+func encodeLossyWebP(img image.Image, quality int) ([]byte, error) {
+	b := img.Bounds()
+	if b.Dx() > 1<<14-1 || b.Dy() > 1<<14-1 {
+		return nil, errors.New("image too large for webp")
+	}
+	e := newVP8Encoder(img, quality)
+	for mby := 0; mby < e.mbh; mby++ {
+		e.leftNZ = vp8NZ{}
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			e.encodeMacroblock(mbx, mby)
+		}
+	}
+	first, tokens := e.header.finish(), e.tokens.finish()
+
+	frame := make([]byte, 0, 10+len(first)+len(tokens))
+	// key frame, version 0, shown, followed by the size of the first partition
+	tag := uint32(1<<4) | uint32(len(first))<<5
+	frame = append(frame, byte(tag), byte(tag>>8), byte(tag>>16), 0x9d, 0x01, 0x2a)
+	frame = binary.LittleEndian.AppendUint16(frame, uint16(b.Dx()))
+	frame = binary.LittleEndian.AppendUint16(frame, uint16(b.Dy()))
+	frame = append(frame, first...)
+	frame = append(frame, tokens...)
+
+	out := make([]byte, 0, 20+len(frame)+1)
+	out = append(out, "RIFF"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(12+len(frame)+len(frame)%2))
+	out = append(out, "WEBPVP8 "...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(frame)))
+	out = append(out, frame...)
+	if len(frame)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out, nil
+}
+
+// vp8BoolEncoder is the boolean entropy encoder of RFC 6386 section 7.
+type vp8BoolEncoder struct {
+	buf      []byte
+	rng      uint32
+	bottom   uint32
+	bitCount int
+}
+
+func newVP8BoolEncoder() vp8BoolEncoder {
+	return vp8BoolEncoder{rng: 255, bitCount: 24}
+}
+
+func (e *vp8BoolEncoder) putBit(prob uint8, bit bool) {
+	split := 1 + (((e.rng - 1) * uint32(prob)) >> 8)
+	if bit {
+		e.bottom += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+	for e.rng < 128 {
+		e.rng <<= 1
+		if e.bottom&(1<<31) != 0 {
+			// carry into the bytes already written
+			i := len(e.buf) - 1
+			for ; e.buf[i] == 255; i-- {
+				e.buf[i] = 0
+			}
+			e.buf[i]++
+		}
+		e.bottom <<= 1
+		e.bitCount--
+		if e.bitCount == 0 {
+			e.buf = append(e.buf, byte(e.bottom>>24))
+			e.bottom &= 1<<24 - 1
+			e.bitCount = 8
+		}
+	}
+}
+
+// putLiteral writes the n low bits of v, most significant first.
+func (e *vp8BoolEncoder) putLiteral(n int, v int) {
+	for i := n - 1; i >= 0; i-- {
+		e.putBit(128, v>>i&1 == 1)
+	}
+}
+
+func (e *vp8BoolEncoder) finish() []byte {
+	// pushes the pending bits out, as libvpx does
+	for i := 0; i < 32; i++ {
+		e.putBit(128, false)
+	}
+	return e.buf
+}
+
+// The whole macroblock prediction modes.
+const (
+	vp8PredDC = iota
+	vp8PredV
+	vp8PredH
+	vp8PredTM
+)
+
+// The coefficient probability tables per block type.
+const (
+	vp8PlaneYAfterY2 = iota
+	vp8PlaneY2
+	vp8PlaneUV
+)
+
+var (
+	vp8Bands  = [17]uint8{0, 1, 2, 3, 6, 4, 5, 6, 6, 6, 6, 6, 6, 6, 6, 7, 0}
+	vp8Zigzag = [16]uint8{0, 1, 4, 8, 5, 2, 3, 6, 9, 12, 13, 10, 7, 11, 14, 15}
+	// extra bits of the dct_cat3 to dct_cat6 tokens
+	vp8CatProbs = [4][]uint8{
+		{173, 148, 140},
+		{176, 155, 140, 135},
+		{180, 157, 141, 134, 130},
+		{254, 254, 243, 230, 196, 177, 153, 140, 133, 130, 129},
+	}
+)
+
+// vp8NZ records which blocks along a macroblock edge had coefficients, the
+// context for the first token of the neighbouring blocks.
+type vp8NZ struct {
+	y    [4]uint8
+	u, v [2]uint8
+	y2   uint8
+}
+
+type vp8Encoder struct {
+	mbw, mbh int
+	// source and reconstructed planes, padded to whole macroblocks
+	y, u, v    []uint8
+	ry, ru, rv []uint8
+	// dc and ac step sizes
+	qY1, qY2, qUV [2]int32
+	header        vp8BoolEncoder
+	tokens        vp8BoolEncoder
+	upNZ          []vp8NZ
+	leftNZ        vp8NZ
+}
+
+func newVP8Encoder(img image.Image, quality int) *vp8Encoder {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	e := &vp8Encoder{
+		mbw:    (w + 15) / 16,
+		mbh:    (h + 15) / 16,
+		header: newVP8BoolEncoder(),
+		tokens: newVP8BoolEncoder(),
+	}
+	e.upNZ = make([]vp8NZ, e.mbw)
+
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	e.toYUV(rgba)
+
+	qi := int32(max(0, min(127, (100-quality)*127/100)))
+	e.qY1 = [2]int32{int32(vp8DCQuant[qi]), int32(vp8ACQuant[qi])}
+	e.qY2 = [2]int32{2 * int32(vp8DCQuant[qi]), max(8, int32(vp8ACQuant[qi])*155/100)}
+	e.qUV = [2]int32{int32(vp8DCQuant[min(qi, 117)]), int32(vp8ACQuant[qi])}
+	e.writeFrameHeader(int(qi))
+	return e
+}
+
+// toYUV fills the planes with the BT.601 limited range values libwebp would
+// use, repeating the last row and column into the padding.
+func (e *vp8Encoder) toYUV(rgba *image.RGBA) {
+	w, h := rgba.Rect.Dx(), rgba.Rect.Dy()
+	pw, ph := 16*e.mbw, 16*e.mbh
+	e.y, e.ry = make([]uint8, pw*ph), make([]uint8, pw*ph)
+	e.u, e.ru = make([]uint8, pw*ph/4), make([]uint8, pw*ph/4)
+	e.v, e.rv = make([]uint8, pw*ph/4), make([]uint8, pw*ph/4)
+	rgb := func(x, y int) (int, int, int) {
+		i := rgba.PixOffset(min(x, w-1), min(y, h-1))
+		return int(rgba.Pix[i]), int(rgba.Pix[i+1]), int(rgba.Pix[i+2])
+	}
+	for y := 0; y < ph; y++ {
+		for x := 0; x < pw; x++ {
+			r, g, b := rgb(x, y)
+			e.y[y*pw+x] = uint8((16839*r + 33059*g + 6420*b + 1<<15 + 16<<16) >> 16)
+		}
+	}
+	for y := 0; y < ph/2; y++ {
+		for x := 0; x < pw/2; x++ {
+			var r, g, b int
+			for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				pr, pg, pb := rgb(2*x+d[0], 2*y+d[1])
+				r, g, b = r+pr, g+pg, b+pb
+			}
+			e.u[y*pw/2+x] = clampUV(-9719*r - 19081*g + 28800*b)
+			e.v[y*pw/2+x] = clampUV(28800*r - 24116*g - 4684*b)
+		}
+	}
+}
+
+// clampUV scales a chroma value computed from the sum of four pixels.
+func clampUV(uv int) uint8 {
+	return clip8((uv + 1<<17 + 128<<18) >> 18)
+}
+
+func clip8(v int) uint8 {
+	return uint8(max(0, min(255, v)))
+}
+
+// writeFrameHeader writes the start of the first partition: no segments, a
+// normal loop filter, one token partition, the default coefficient
+// probabilities and no skipped macroblocks.
+func (e *vp8Encoder) writeFrameHeader(qi int) {
+	h := &e.header
+	h.putLiteral(1, 0)      // color space
+	h.putLiteral(1, 0)      // clamping required
+	h.putLiteral(1, 0)      // segmentation
+	h.putLiteral(1, 0)      // normal loop filter
+	h.putLiteral(6, qi/4+2) // loop filter level
+	h.putLiteral(3, 0)      // sharpness
+	h.putLiteral(1, 0)      // loop filter deltas
+	h.putLiteral(2, 0)      // one token partition
+	h.putLiteral(7, qi)
+	for i := 0; i < 5; i++ {
+		h.putLiteral(1, 0) // quantizer deltas
+	}
+	h.putLiteral(1, 0) // refresh entropy probs
+	for i := range vp8CoeffUpdateProbs {
+		for j := range vp8CoeffUpdateProbs[i] {
+			for k := range vp8CoeffUpdateProbs[i][j] {
+				for l := range vp8CoeffUpdateProbs[i][j][k] {
+					h.putBit(vp8CoeffUpdateProbs[i][j][k][l], false)
+				}
+			}
+		}
+	}
+	h.putLiteral(1, 0) // no skip flags
+}
+
+// edges returns the pixels above and left of the size x size block at x, y
+// of a plane, and the one above left, as the decoder sees them.
+func edges(plane []uint8, stride, x, y, size int) (above, left []int32, corner int32) {
+	above, left = make([]int32, size), make([]int32, size)
+	for i := 0; i < size; i++ {
+		above[i], left[i] = 127, 129
+		if y > 0 {
+			above[i] = int32(plane[(y-1)*stride+x+i])
+		}
+		if x > 0 {
+			left[i] = int32(plane[(y+i)*stride+x-1])
+		}
+	}
+	switch {
+	case y == 0:
+		corner = 127
+	case x == 0:
+		corner = 129
+	default:
+		corner = int32(plane[(y-1)*stride+x-1])
+	}
+	return above, left, corner
+}
+
+// predict fills a size x size block predicted with mode from its edges.
+func predict(mode int, above, left []int32, corner int32, hasAbove, hasLeft bool) []int32 {
+	size := len(above)
+	pred := make([]int32, size*size)
+	shift := 3
+	if size == 16 {
+		shift = 4
+	}
+	// dc averages the edges inside the frame
+	dc := int32(128)
+	switch {
+	case hasAbove && hasLeft:
+		var sum int32
+		for i := 0; i < size; i++ {
+			sum += above[i] + left[i]
+		}
+		dc = (sum + int32(size)) >> (shift + 1)
+	case hasAbove || hasLeft:
+		edge := left
+		if hasAbove {
+			edge = above
+		}
+		var sum int32
+		for i := 0; i < size; i++ {
+			sum += edge[i]
+		}
+		dc = (sum + int32(size/2)) >> shift
+	}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			var p int32
+			switch mode {
+			case vp8PredDC:
+				p = dc
+			case vp8PredV:
+				p = above[x]
+			case vp8PredH:
+				p = left[y]
+			case vp8PredTM:
+				p = int32(clip8(int(left[y] + above[x] - corner)))
+			}
+			pred[y*size+x] = p
+		}
+	}
+	return pred
+}
+
+// bestMode picks the prediction mode closest to the source block.
+func bestMode(src []uint8, stride, x, y, size int, plane []uint8) (int, []int32) {
+	above, left, corner := edges(plane, stride, x, y, size)
+	best, bestPred, bestErr := 0, []int32(nil), int64(math.MaxInt64)
+	for mode := vp8PredDC; mode <= vp8PredTM; mode++ {
+		pred := predict(mode, above, left, corner, y > 0, x > 0)
+		var sse int64
+		for j := 0; j < size; j++ {
+			for i := 0; i < size; i++ {
+				d := int64(src[(y+j)*stride+x+i]) - int64(pred[j*size+i])
+				sse += d * d
+			}
+		}
+		if sse < bestErr {
+			best, bestPred, bestErr = mode, pred, sse
+		}
+	}
+	return best, bestPred
+}
+
+// chromaPred predicts both chroma blocks of a macroblock with mode.
+func (e *vp8Encoder) chromaPred(mode int, x, y int) (u, v []int32) {
+	stride := 8 * e.mbw
+	au, lu, cu := edges(e.ru, stride, x, y, 8)
+	av, lv, cv := edges(e.rv, stride, x, y, 8)
+	return predict(mode, au, lu, cu, y > 0, x > 0), predict(mode, av, lv, cv, y > 0, x > 0)
+}
+
+// encodeMacroblock picks the modes of a macroblock, writes it and keeps its
+// reconstruction, which the following macroblocks are predicted from.
+func (e *vp8Encoder) encodeMacroblock(mbx, mby int) {
+	yStride, cStride := 16*e.mbw, 8*e.mbw
+	x, y := 16*mbx, 16*mby
+	yMode, yPred := bestMode(e.y, yStride, x, y, 16, e.ry)
+
+	cx, cy := 8*mbx, 8*mby
+	uvMode, bestErr := 0, int64(math.MaxInt64)
+	var uPred, vPred []int32
+	for mode := vp8PredDC; mode <= vp8PredTM; mode++ {
+		u, v := e.chromaPred(mode, cx, cy)
+		var sse int64
+		for j := 0; j < 8; j++ {
+			for i := 0; i < 8; i++ {
+				du := int64(e.u[(cy+j)*cStride+cx+i]) - int64(u[j*8+i])
+				dv := int64(e.v[(cy+j)*cStride+cx+i]) - int64(v[j*8+i])
+				sse += du*du + dv*dv
+			}
+		}
+		if sse < bestErr {
+			uvMode, bestErr, uPred, vPred = mode, sse, u, v
+		}
+	}
+	e.writeModes(yMode, uvMode)
+
+	// luma: the dc of each 4x4 block goes through the second order y2 block
+	var yCoeffs [16][16]int32
+	var dcs [16]int32
+	for n := 0; n < 16; n++ {
+		bx, by := 4*(n%4), 4*(n/4)
+		yCoeffs[n] = forwardDCT(residual(e.y, yStride, x+bx, y+by, yPred, 16, bx, by))
+		dcs[n] = yCoeffs[n][0]
+	}
+	y2Levels, y2Deq := quantize(forwardWHT(dcs), e.qY2, 0)
+	up, left := &e.upNZ[mbx], &e.leftNZ
+	nz := e.writeBlock(vp8PlaneY2, up.y2+left.y2, y2Levels, 0)
+	up.y2, left.y2 = nz, nz
+	dcOut := inverseWHT(y2Deq)
+	for n := 0; n < 16; n++ {
+		levels, deq := quantize(yCoeffs[n], e.qY1, 1)
+		deq[0] = dcOut[n]
+		bx, by := n%4, n/4
+		nz := e.writeBlock(vp8PlaneYAfterY2, up.y[bx]+left.y[by], levels, 1)
+		up.y[bx], left.y[by] = nz, nz
+		reconstruct(e.ry, yStride, x+4*bx, y+4*by, yPred, 16, 4*bx, 4*by, deq)
+	}
+
+	// chroma, all of u before v
+	for _, p := range []struct {
+		src, rec []uint8
+		pred     []int32
+		up, left *[2]uint8
+	}{
+		{e.u, e.ru, uPred, &up.u, &left.u},
+		{e.v, e.rv, vPred, &up.v, &left.v},
+	} {
+		for n := 0; n < 4; n++ {
+			bx, by := n%2, n/2
+			coeffs := forwardDCT(residual(p.src, cStride, cx+4*bx, cy+4*by, p.pred, 8, 4*bx, 4*by))
+			levels, deq := quantize(coeffs, e.qUV, 0)
+			nz := e.writeBlock(vp8PlaneUV, p.up[bx]+p.left[by], levels, 0)
+			p.up[bx], p.left[by] = nz, nz
+			reconstruct(p.rec, cStride, cx+4*bx, cy+4*by, p.pred, 8, 4*bx, 4*by, deq)
+		}
+	}
+}
+
+// writeModes writes the 16x16 luma and the chroma mode of a macroblock with
+// the fixed key frame probabilities.
+func (e *vp8Encoder) writeModes(yMode, uvMode int) {
+	h := &e.header
+	h.putBit(145, true) // not split into 4x4 blocks
+	switch yMode {
+	case vp8PredDC, vp8PredV:
+		h.putBit(156, false)
+		h.putBit(163, yMode == vp8PredV)
+	default:
+		h.putBit(156, true)
+		h.putBit(128, yMode == vp8PredTM)
+	}
+	h.putBit(142, uvMode != vp8PredDC)
+	if uvMode != vp8PredDC {
+		h.putBit(114, uvMode != vp8PredV)
+		if uvMode != vp8PredV {
+			h.putBit(183, uvMode == vp8PredTM)
+		}
+	}
+}
+
+// residual returns the 4x4 block at x, y of src minus its prediction, which
+// starts at px, py in the size x size pred.
+func residual(src []uint8, stride, x, y int, pred []int32, size, px, py int) [16]int32 {
+	var r [16]int32
+	for j := 0; j < 4; j++ {
+		for i := 0; i < 4; i++ {
+			r[4*j+i] = int32(src[(y+j)*stride+x+i]) - pred[(py+j)*size+px+i]
+		}
+	}
+	return r
+}
+
+// vp8IDCTBasis holds the basis vectors of the decoder's inverse transform:
+// pixel n is the sum over k of coefficient k times vp8IDCTBasis[n][k].
+var vp8IDCTBasis = func() [4][4]float64 {
+	c1, c2 := 85627.0/65536, 35468.0/65536
+	return [4][4]float64{
+		{1, c1, 1, c2},
+		{1, c2, -1, -c1},
+		{1, -c2, -1, c1},
+		{1, -c1, 1, -c2},
+	}
+}()
+
+// forwardDCT inverts the decoder's transform, which scales by 1/8 and whose
+// basis vectors have a squared length of 4.
+func forwardDCT(r [16]int32) [16]int32 {
+	var cols [4][4]float64
+	for u := 0; u < 4; u++ {
+		for i := 0; i < 4; i++ {
+			for j := 0; j < 4; j++ {
+				cols[u][i] += vp8IDCTBasis[j][u] * float64(r[4*j+i])
+			}
+		}
+	}
+	var out [16]int32
+	for u := 0; u < 4; u++ {
+		for v := 0; v < 4; v++ {
+			var sum float64
+			for i := 0; i < 4; i++ {
+				sum += cols[u][i] * vp8IDCTBasis[i][v]
+			}
+			out[4*u+v] = int32(math.Round(sum / 2))
+		}
+	}
+	return out
+}
+
+// forwardWHT turns the dc of the 16 luma blocks into the y2 block.
+func forwardWHT(dcs [16]int32) [16]int32 {
+	h := [4][4]int32{{1, 1, 1, 1}, {1, 1, -1, -1}, {1, -1, -1, 1}, {1, -1, 1, -1}}
+	var out [16]int32
+	for u := 0; u < 4; u++ {
+		for v := 0; v < 4; v++ {
+			var sum int32
+			for j := 0; j < 4; j++ {
+				for i := 0; i < 4; i++ {
+					sum += h[u][j] * h[v][i] * dcs[4*j+i]
+				}
+			}
+			out[4*u+v] = int32(math.Round(float64(sum) / 2))
+		}
+	}
+	return out
+}
+
+// quantize returns the levels of coeffs in zigzag order from first on, and
+// the coefficients the decoder will see. q holds the dc and ac step sizes.
+func quantize(coeffs [16]int32, q [2]int32, first int) (levels [16]int32, deq [16]int32) {
+	for n := first; n < 16; n++ {
+		pos := vp8Zigzag[n]
+		step := q[1]
+		bias := step * 3 / 8
+		if pos == 0 {
+			step = q[0]
+			bias = step / 2
+		}
+		c := coeffs[pos]
+		level := (abs32(c) + bias) / step
+		// levels above 2048 have no token, and the decoder keeps the
+		// product in 16 bits
+		level = min(level, 2048, 32767/step)
+		if c < 0 {
+			level = -level
+		}
+		levels[n] = level
+		deq[pos] = level * step
+	}
+	return levels, deq
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// inverseWHT is the decoder's y2 transform, giving the dc of each luma block.
+func inverseWHT(in [16]int32) [16]int32 {
+	var m, out [16]int32
+	for i := 0; i < 4; i++ {
+		a0 := in[0+i] + in[12+i]
+		a1 := in[4+i] + in[8+i]
+		a2 := in[4+i] - in[8+i]
+		a3 := in[0+i] - in[12+i]
+		m[0+i] = a0 + a1
+		m[8+i] = a0 - a1
+		m[4+i] = a3 + a2
+		m[12+i] = a3 - a2
+	}
+	for i := 0; i < 4; i++ {
+		dc := m[0+i*4] + 3
+		a0 := dc + m[3+i*4]
+		a1 := m[1+i*4] + m[2+i*4]
+		a2 := m[1+i*4] - m[2+i*4]
+		a3 := dc - m[3+i*4]
+		out[4*i+0] = int32(int16((a0 + a1) >> 3))
+		out[4*i+1] = int32(int16((a3 + a2) >> 3))
+		out[4*i+2] = int32(int16((a0 - a1) >> 3))
+		out[4*i+3] = int32(int16((a3 - a2) >> 3))
+	}
+	return out
+}
+
+// reconstruct writes the prediction plus the decoder's inverse transform of
+// coeffs to the 4x4 block at x, y of rec.
+func reconstruct(rec []uint8, stride, x, y int, pred []int32, size, px, py int, coeffs [16]int32) {
+	const (
+		c1 = 85627
+		c2 = 35468
+	)
+	var m [4][4]int32
+	for i := 0; i < 4; i++ {
+		a := coeffs[i] + coeffs[8+i]
+		b := coeffs[i] - coeffs[8+i]
+		c := (coeffs[4+i]*c2)>>16 - (coeffs[12+i]*c1)>>16
+		d := (coeffs[4+i]*c1)>>16 + (coeffs[12+i]*c2)>>16
+		m[i] = [4]int32{a + d, b + c, b - c, a - d}
+	}
+	for j := 0; j < 4; j++ {
+		dc := m[0][j] + 4
+		a := dc + m[2][j]
+		b := dc - m[2][j]
+		c := (m[1][j]*c2)>>16 - (m[3][j]*c1)>>16
+		d := (m[1][j]*c1)>>16 + (m[3][j]*c2)>>16
+		row := [4]int32{(a + d) >> 3, (b + c) >> 3, (b - c) >> 3, (a - d) >> 3}
+		for i := 0; i < 4; i++ {
+			p := pred[(py+j)*size+px+i]
+			rec[(y+j)*stride+x+i] = clip8(int(p + row[i]))
+		}
+	}
+}
+
+// writeBlock writes the tokens of one block, the levels in zigzag order from
+// first on, and returns 1 when it had a non-zero level.
+func (e *vp8Encoder) writeBlock(plane int, ctx uint8, levels [16]int32, first int) uint8 {
+	last := -1
+	for n := first; n < 16; n++ {
+		if levels[n] != 0 {
+			last = n
+		}
+	}
+	t := &e.tokens
+	probs := &vp8CoeffProbs[plane]
+	p := &probs[vp8Bands[first]][ctx]
+	if last < 0 {
+		t.putBit(p[0], false)
+		return 0
+	}
+	t.putBit(p[0], true)
+	for n := first; n < 16; {
+		level := levels[n]
+		v := abs32(level)
+		n++
+		if v == 0 {
+			t.putBit(p[1], false)
+			p = &probs[vp8Bands[n]][0]
+			continue
+		}
+		t.putBit(p[1], true)
+		if v == 1 {
+			t.putBit(p[2], false)
+		} else {
+			t.putBit(p[2], true)
+			switch {
+			case v <= 4:
+				t.putBit(p[3], false)
+				t.putBit(p[4], v != 2)
+				if v != 2 {
+					t.putBit(p[5], v == 4)
+				}
+			case v <= 10:
+				t.putBit(p[3], true)
+				t.putBit(p[6], false)
+				t.putBit(p[7], v > 6)
+				if v <= 6 {
+					t.putBit(159, v == 6)
+				} else {
+					t.putBit(165, (v-7)>>1 == 1)
+					t.putBit(145, (v-7)&1 == 1)
+				}
+			default:
+				t.putBit(p[3], true)
+				t.putBit(p[6], true)
+				cat := 3
+				for c := 0; c < 3; c++ {
+					if v < 3+(16<<c) {
+						cat = c
+						break
+					}
+				}
+				t.putBit(p[8], cat >= 2)
+				t.putBit(p[9+cat/2], cat%2 == 1)
+				extra := v - 3 - (8 << cat)
+				bits := vp8CatProbs[cat]
+				for i, prob := range bits {
+					t.putBit(prob, extra>>(len(bits)-1-i)&1 == 1)
+				}
+			}
+		}
+		t.putBit(128, level < 0)
+		if v == 1 {
+			p = &probs[vp8Bands[n]][1]
+		} else {
+			p = &probs[vp8Bands[n]][2]
+		}
+		if n == 16 {
+			break
+		}
+		t.putBit(p[0], n <= last)
+		if n > last {
+			break
+		}
+	}
+	return 1
+}
@@ -0,0 +1,331 @@
+package markdown_render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template/parse"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+)
+
+// CustomThemePrefix marks a style naming one of the user's uploaded themes,
+// "custom:paper" picks their theme called paper.
+const CustomThemePrefix = "custom:"
+
+const (
+	MaxThemeTemplateSize   = 64 << 10
+	MaxThemeStylesheetSize = 256 << 10
+	// MaxThemeOutputSize is what a custom theme may render on top of the
+	// post content.
+	MaxThemeOutputSize = 1 << 20
+	// ThemeRenderTimeout bounds a single render of a custom theme.
+	ThemeRenderTimeout = 2 * time.Second
+)
+
+var errThemeOutputTooLarge = errors.New("theme renders more than the output limit")
+
+var themeDB db.ThemeDB
+
+func SetThemeDB(repo db.ThemeDB) {
+	themeDB = repo
+}
+
+// ThemeError explains why an uploaded theme was refused.
+type ThemeError struct {
+	Name   string
+	Reason string
+}
+
+func (e *ThemeError) Error() string {
+	return e.Name + ": " + e.Reason
+}
+
+// customFuncs are the only functions an uploaded template may call: the ones
+// built in themes use, asset, and the builtins that just compare or print
+// values. call is left out, everything a theme sees is the page model, and
+// so is printf, whose widths can blow up a value.
+var customFuncs = map[string]bool{
+	"date": true, "isoDate": true, "join": true, "asset": true,
+	"and": true, "or": true, "not": true, "len": true, "index": true, "slice": true,
+	"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true,
+	"print": true, "println": true,
+}
+
+var unsafeStylesheet = regexp.MustCompile(`(?i)expression\s*\(|javascript:|behavior\s*:|-moz-binding|</style|@import`)
+
+// ParseTheme checks an uploaded template and compiles it with the shared
+// partials. {{asset "name"}} in the template links to a file of the package.
+// The template has to render the page content, every function it calls has
+// to be in the restricted set, it may only loop over the page model and its
+// markup may only use the elements and attributes of checkThemeMarkup.
+func ParseTheme(source string, assets []db.ThemeAsset) (*template.Template, error) {
+	reject := func(format string, args ...any) error {
+		return &ThemeError{Name: "theme.html", Reason: fmt.Sprintf(format, args...)}
+	}
+	if len(source) > MaxThemeTemplateSize {
+		return nil, reject("template is larger than %d KB", MaxThemeTemplateSize>>10)
+	}
+
+	urls := make(map[string]string, len(assets))
+	for _, asset := range assets {
+		urls[asset.Name] = asset.URL
+	}
+	funcs := template.FuncMap{
+		"asset": func(name string) (template.URL, error) {
+			url, ok := urls[name]
+			if !ok {
+				return "", fmt.Errorf("no asset %q in the theme", name)
+			}
+			return template.URL(url), nil
+		},
+	}
+
+	theme, err := template.Must(themePartials.Clone()).Funcs(funcs).New("theme.html").Parse(source)
+	if err != nil {
+		return nil, reject("%v", err)
+	}
+	for _, tmpl := range theme.Templates() {
+		if tmpl.Tree == nil {
+			continue
+		}
+		if reason := disallowedNode(tmpl.Tree.Root); reason != "" {
+			return nil, reject("%s", reason)
+		}
+	}
+	err = checkThemeMarkup(source)
+	if err != nil {
+		return nil, reject("%v", err)
+	}
+
+	// render a page with every field set, which also catches templates that
+	// only fail once they run
+	const marker = "<p>markbyte theme check</p>"
+	output, err := executeTheme(context.Background(), theme, samplePage(template.HTML(marker)))
+	if err != nil {
+		return nil, reject("%v", err)
+	}
+	if !strings.Contains(output, marker) {
+		return nil, reject("template does not render the post, add {{template \"article\" .}}")
+	}
+	return theme, nil
+}
+
+// CheckStylesheet refuses stylesheets that could run scripts or pull in
+// other stylesheets.
+func CheckStylesheet(name string, css []byte) error {
+	if len(css) > MaxThemeStylesheetSize {
+		return &ThemeError{Name: name, Reason: fmt.Sprintf("stylesheet is larger than %d KB", MaxThemeStylesheetSize>>10)}
+	}
+	if match := unsafeStylesheet.Find(css); match != nil {
+		return &ThemeError{Name: name, Reason: fmt.Sprintf("%q is not allowed", strings.TrimSpace(string(match)))}
+	}
+	return nil
+}
+
+// disallowedNode explains why node may not be in an uploaded template, ""
+// when it may. Besides calls outside customFuncs this refuses number
+// literals and loops or variables over anything but the page model, since
+// ranging over a number, or a variable holding one, repeats the body that
+// many times.
+func disallowedNode(node parse.Node) string {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return ""
+		}
+		for _, child := range n.Nodes {
+			if reason := disallowedNode(child); reason != "" {
+				return reason
+			}
+		}
+	case *parse.ActionNode:
+		return disallowedNode(n.Pipe)
+	case *parse.IfNode:
+		return disallowedBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		if !modelPipe(n.Pipe) {
+			return fmt.Sprintf("range over %s is not allowed, only over fields and variables", n.Pipe)
+		}
+		return disallowedBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return disallowedBranch(&n.BranchNode)
+	case *parse.TemplateNode:
+		return disallowedNode(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return ""
+		}
+		if len(n.Decl) > 0 && !modelPipe(n) {
+			return fmt.Sprintf("variable %s is not allowed, only fields and variables can be assigned", n.Decl[0])
+		}
+		for _, cmd := range n.Cmds {
+			if reason := disallowedNode(cmd); reason != "" {
+				return reason
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if reason := disallowedNode(arg); reason != "" {
+				return reason
+			}
+		}
+	case *parse.ChainNode:
+		return disallowedNode(n.Node)
+	case *parse.NumberNode:
+		return fmt.Sprintf("number %s is not allowed", n.Text)
+	case *parse.IdentifierNode:
+		if !customFuncs[n.Ident] {
+			return fmt.Sprintf("function %q is not allowed", n.Ident)
+		}
+	}
+	return ""
+}
+
+func disallowedBranch(n *parse.BranchNode) string {
+	if reason := disallowedNode(n.Pipe); reason != "" {
+		return reason
+	}
+	if reason := disallowedNode(n.List); reason != "" {
+		return reason
+	}
+	return disallowedNode(n.ElseList)
+}
+
+// modelPipe reports whether pipe is just a field or variable, like .Tags,
+// $part.Title or ., so its value comes from the page model.
+func modelPipe(pipe *parse.PipeNode) bool {
+	if pipe == nil || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	switch pipe.Cmds[0].Args[0].(type) {
+	case *parse.FieldNode, *parse.VariableNode, *parse.DotNode:
+		return true
+	}
+	return false
+}
+
+func samplePage(content template.HTML) Page {
+	published := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	return Page{
+		Title:     "Sample post",
+		Content:   content,
+		Author:    AuthorOf(&db.User{Username: "sample", Name: "Sample Author"}),
+		Published: published,
+		Updated:   published.Add(24 * time.Hour),
+		Tags:      []string{"sample"},
+		TOC:       []Heading{{Level: 1, ID: "sample", Text: "Sample"}},
+		Series: []Series{{
+			Name:  "Sample series",
+			Parts: []SeriesPart{{Title: "Sample post", Link: "/sample/sample-post"}, {Title: "Next post", Link: "/sample/next-post"}},
+		}},
+		History: []Revision{{Version: "1", Date: published, Message: "First version"}},
+		SEO:     SEO{Description: "A sample post", CanonicalURL: "https://example.com/sample", Image: "https://example.com/sample.png"},
+	}
+}
+
+type compiledTheme struct {
+	uploadedAt time.Time
+	template   *template.Template
+}
+
+// compiledThemes keeps parsed uploaded themes by user and name, an upload
+// replaces the entry through its new UploadedAt.
+var compiledThemes sync.Map
+
+func customTheme(ctx context.Context, username string, name string) (*template.Template, error) {
+	if themeDB == nil {
+		return nil, nil
+	}
+	theme, err := themeDB.FetchTheme(ctx, username, name)
+	if err != nil || theme == nil {
+		return nil, err
+	}
+	key := username + "\x00" + name
+	if cached, ok := compiledThemes.Load(key); ok && cached.(compiledTheme).uploadedAt.Equal(theme.UploadedAt) {
+		return cached.(compiledTheme).template, nil
+	}
+	compiled, err := ParseTheme(theme.Template, theme.Assets)
+	if err != nil {
+		return nil, err
+	}
+	compiledThemes.Store(key, compiledTheme{uploadedAt: theme.UploadedAt, template: compiled})
+	return compiled, nil
+}
+
+// StyleExists reports whether username can pick style: a built in theme or
+// one of their uploaded ones.
+func StyleExists(ctx context.Context, username string, style string) (bool, error) {
+	name, custom := strings.CutPrefix(style, CustomThemePrefix)
+	if !custom {
+		return HasTheme(style), nil
+	}
+	if themeDB == nil {
+		return false, nil
+	}
+	theme, err := themeDB.FetchTheme(ctx, username, name)
+	return theme != nil, err
+}
+
+// RenderUserPage renders page like RenderPage and also knows the uploaded
+// themes of the page's author. A custom theme that is gone or fails to render
+// falls back to the default theme, so the post is still served.
+func RenderUserPage(ctx context.Context, style string, page Page) (string, error) {
+	name, custom := strings.CutPrefix(style, CustomThemePrefix)
+	if !custom {
+		return RenderPage(style, page)
+	}
+	theme, err := customTheme(ctx, page.Author.Username, name)
+	if err != nil {
+		fmt.Printf("failed to load theme %s of %s: %v\n", name, page.Author.Username, err)
+	}
+	if theme == nil {
+		return RenderPage(DefaultTheme, page)
+	}
+	if page.TOC == nil {
+		page.TOC = TableOfContents(string(page.Content))
+	}
+	output, err := executeTheme(ctx, theme, page)
+	if err != nil {
+		fmt.Printf("failed to render theme %s of %s: %v\n", name, page.Author.Username, err)
+		return RenderPage(DefaultTheme, page)
+	}
+	return output, nil
+}
+
+// themeWriter collects the output of a custom theme and fails the render
+// once it grows past limit or ctx is done.
+type themeWriter struct {
+	ctx   context.Context
+	buf   bytes.Buffer
+	limit int
+}
+
+func (w *themeWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if w.buf.Len()+len(p) > w.limit {
+		return 0, errThemeOutputTooLarge
+	}
+	return w.buf.Write(p)
+}
+
+// executeTheme renders page with an uploaded theme within
+// ThemeRenderTimeout and MaxThemeOutputSize past the post content.
+func executeTheme(ctx context.Context, theme *template.Template, page Page) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, ThemeRenderTimeout)
+	defer cancel()
+	w := &themeWriter{ctx: ctx, limit: len(page.Content) + MaxThemeOutputSize}
+	err := theme.Execute(w, page)
+	if err != nil {
+		return "", err
+	}
+	return w.buf.String(), nil
+}
@@ -0,0 +1,10 @@
+package markdown_render
+
+import "time"
+
+// Revision is a published version of a post as listed in its history.
+type Revision struct {
+	Version string
+	Date    time.Time
+	Message string
+}
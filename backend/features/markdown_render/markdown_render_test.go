@@ -1,8 +1,13 @@
 package markdown_render
 
 import (
+	"context"
+	"html/template"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,24 +26,308 @@ func TestConvertMarkdown_Empty(t *testing.T) {
 	assert.NotNil(t, html)
 }
 
-func TestInsertTemplate_Basic(t *testing.T) {
-	html := "<h1>Hello</h1>"
-	style := "default"
-	username := "testuser"
-	name := "Test User"
-	date := "01/01/2025"
+func testPage(content string) Page {
+	return Page{
+		Title:     "Hello",
+		Content:   template.HTML(content),
+		Author:    AuthorOf(&db.User{Username: "alice", Name: "Alice"}),
+		Published: time.Date(2025, 2, 2, 0, 0, 0, 0, time.UTC),
+	}
+}
 
-	InsertTemplate(&html, style, username, name, date)
-	assert.Contains(t, html, "Hello")
+func TestRenderPage_Themes(t *testing.T) {
+	assert.Equal(t, []string{"default", "futuristic", "old", "pink"}, Themes())
+
+	for _, style := range append(Themes(), "", "fancy") {
+		html, err := RenderPage(style, testPage("<h1>Hello</h1>"))
+		assert.NoError(t, err, style)
+		assert.Contains(t, html, "<h1>Hello</h1>", style)
+		assert.Contains(t, html, "https://markbyte.xyz/alice", style)
+		assert.Contains(t, html, "02/02/2025", style)
+		assert.Contains(t, html, "<title>Hello | Alice</title>", style)
+	}
+}
+
+func TestRenderPage_EscapesFields(t *testing.T) {
+	page := testPage("<p>body</p>")
+	page.Author = AuthorOf(&db.User{Username: "mallory", Name: "<script>alert(1)</script>"})
+	page.Tags = []string{`a"b`}
+
+	for _, style := range Themes() {
+		html, err := RenderPage(style, page)
+		assert.NoError(t, err, style)
+		assert.NotContains(t, html, "<script>alert(1)</script>", style)
+		assert.NotContains(t, html, `a"b`, style)
+	}
+}
+
+func TestRenderPage_SEO(t *testing.T) {
+	page := testPage("<p>body</p>")
+	page.Tags = []string{"go", "web"}
+	page.SEO = SEO{Description: "A post", CanonicalURL: "https://example.com/post", NoIndex: true}
+
+	html, err := RenderPage("default", page)
+	assert.NoError(t, err)
+	assert.Contains(t, html, `<meta name="description" content="A post">`)
+	assert.Contains(t, html, `<meta name="keywords" content="go, web">`)
+	assert.Contains(t, html, `<meta name="robots" content="noindex, nofollow">`)
+	assert.Contains(t, html, `<link rel="canonical" href="https://example.com/post">`)
+	assert.Contains(t, html, `<meta property="article:published_time" content="2025-02-02T00:00:00Z">`)
+}
+
+func TestRenderPage_TableOfContents(t *testing.T) {
+	content, err := ConvertMarkdown([]byte("# Intro\n## Set *up*\n### Go & more\n#### Too deep\n"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Heading{
+		{Level: 1, ID: "intro", Text: "Intro"},
+		{Level: 2, ID: "set-up", Text: "Set up"},
+		{Level: 3, ID: "go--more", Text: "Go & more"},
+	}, TableOfContents(content))
+
+	html, err := RenderPage("default", testPage(content))
+	assert.NoError(t, err)
+	assert.Contains(t, html, `<a href="#set-up" class="block text-black dark:text-white hover:text-gray-700 dark:hover:text-gray-300 py-1 pl-4">Set up</a>`)
+}
+
+func TestRenderPage_Series(t *testing.T) {
+	page := testPage("<h1>Part Two</h1>")
+	page.Series = []Series{{
+		Name: "Go <Basics>",
+		Parts: []SeriesPart{
+			{Title: "Setup", Link: "/alice/setup"},
+			{Title: "Part Two", Link: "/alice/part-two"},
+			{Title: "Wrap up", Link: "/alice/wrap-up"},
+		},
+		Current: 1,
+	}}
+
+	html, err := RenderPage("default", page)
+	assert.NoError(t, err)
+
+	assert.Contains(t, html, "Part 2 of 3 in <strong>Go &lt;Basics&gt;</strong>")
+	assert.Contains(t, html, `<a rel="prev" href="/alice/setup">&larr; Setup</a>`)
+	assert.Contains(t, html, `<a rel="next" href="/alice/wrap-up">Wrap up &rarr;</a>`)
+	assert.Contains(t, html, `<li aria-current="page"><strong>Part Two</strong></li>`)
 }
 
-func TestInsertTemplate_CustomStyle(t *testing.T) {
-	html := "<h1>Custom</h1>"
-	style := "fancy"
-	username := "alice"
-	name := "Alice"
-	date := "02/02/2025"
+func TestRenderPage_RevisionHistory(t *testing.T) {
+	html, err := RenderPage("default", testPage("<p>body</p>"))
+	assert.NoError(t, err)
+	assert.NotContains(t, html, "Revision history")
 
-	InsertTemplate(&html, style, username, name, date)
-	assert.Contains(t, html, "Custom")
+	page := testPage("<p>body</p>")
+	page.History = []Revision{
+		{Version: "3", Date: time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC), Message: "Fix <typo>"},
+		{Version: "1", Date: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), Message: "First draft"},
+	}
+	html, err = RenderPage("default", page)
+	assert.NoError(t, err)
+
+	assert.Contains(t, html, `<time datetime="2025-02-03T00:00:00Z">02/03/2025</time> &middot; v3: Fix &lt;typo&gt;`)
+	assert.Less(t, strings.Index(html, "v3"), strings.Index(html, "v1"))
+}
+
+// themeStore is a ThemeDB holding the themes of one user.
+type themeStore map[string]*db.Theme
+
+func (s themeStore) SaveTheme(ctx context.Context, theme *db.Theme) error {
+	s[theme.Name] = theme
+	return nil
+}
+func (s themeStore) FetchTheme(ctx context.Context, username string, name string) (*db.Theme, error) {
+	return s[name], nil
+}
+func (s themeStore) FetchUserThemes(ctx context.Context, username string) ([]db.Theme, error) {
+	return nil, nil
+}
+func (s themeStore) DeleteTheme(ctx context.Context, username string, name string) (bool, error) {
+	_, ok := s[name]
+	delete(s, name)
+	return ok, nil
+}
+
+func useThemeStore(t *testing.T) themeStore {
+	t.Helper()
+	store := themeStore{}
+	SetThemeDB(store)
+	t.Cleanup(func() { SetThemeDB(nil) })
+	return store
+}
+
+func TestParseTheme_Rejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		reason string
+	}{
+		{"script", `<script src="x.js"></script>{{template "article" .}}`, "<script"},
+		{"iframe", `<IFRAME src="https://example.com"></IFRAME>{{template "article" .}}`, "<IFRAME"},
+		{"event handler", `<img src="x.png" onerror="alert(1)">{{template "article" .}}`, "onerror"},
+		{"javascript url", `<a href="javascript:alert(1)">x</a>{{template "article" .}}`, "javascript:"},
+		{"call", `{{call .Title}}{{template "article" .}}`, `"call"`},
+		{"call in range", `{{range .Tags}}{{call .}}{{end}}{{template "article" .}}`, `"call"`},
+		{"unknown function", `{{html .Title}}{{template "article" .}}`, `"html"`},
+		{"no article", `<h1>{{.Title}}</h1>`, "does not render the post"},
+		{"fails to run", `{{.Missing}}{{template "article" .}}`, "Missing"},
+		{"unknown asset", `<link href="{{asset "a.css"}}">{{template "article" .}}`, "a.css"},
+		{"bad syntax", `{{if}}{{template "article" .}}`, "theme.html"},
+		{"too large", strings.Repeat("x", MaxThemeTemplateSize+1), "larger than"},
+		{"printf", `{{printf "%0100d" .Title}}{{template "article" .}}`, `"printf"`},
+		{"range over a number", `{{range 3000}}{{range 3000}}a{{end}}{{end}}{{template "article" .}}`, "range over 3000"},
+		{"range over a call", `{{range len .Title}}a{{end}}{{template "article" .}}`, "range over len .Title"},
+		{"number", `{{index .Tags 0}}{{template "article" .}}`, "number 0"},
+		{"variable from a call", `{{$n := len "aaaa"}}{{range $n}}a{{end}}{{template "article" .}}`, "variable $n"},
+		{"svg", `<svg/onload=alert(1)>{{template "article" .}}`, "<svg>"},
+		{"encoded javascript url", `<a href="jav&#x61;script:alert(1)">x</a>{{template "article" .}}`, "javascript:"},
+		{"javascript url with a tab", "<a href=\"java\tscript:alert(1)\">x</a>{{template \"article\" .}}", "href="},
+		{"data url", `<img src="data:text/html,x">{{template "article" .}}`, "data:"},
+		{"scheme from an action", `<a href="{{.Title}}:alert(1)">x</a>{{template "article" .}}`, "href="},
+		{"scheme in a branch", `<a href="{{if .Title}}/{{else}}javascript:alert(1){{end}}">x</a>{{template "article" .}}`, "href="},
+		{"element from an action", `<{{.Title}}>{{template "article" .}}`, "element names"},
+		{"form", `<form action="https://example.com"><input name="q"></form>{{template "article" .}}`, "<form>"},
+		{"meta refresh", `<meta http-equiv="refresh" content="0;url=https://example.com">{{template "article" .}}`, "http-equiv"},
+		{"link import", `<link rel="import" href="x.html">{{template "article" .}}`, "rel="},
+		{"inline style", `<div style="width: expression(alert(1))"></div>{{template "article" .}}`, "expression("},
+		{"style element", `<style>body { -moz-binding: url(x.xml) }</style>{{template "article" .}}`, "-moz-binding"},
+		{"defined template", `{{define "head"}}<script>alert(1)</script>{{end}}{{template "article" .}}`, "<script>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTheme(tt.source, nil)
+			var themeErr *ThemeError
+			if assert.ErrorAs(t, err, &themeErr) {
+				assert.Equal(t, "theme.html", themeErr.Name)
+				assert.Contains(t, err.Error(), tt.reason)
+			}
+		})
+	}
+}
+
+func TestParseTheme_Markup(t *testing.T) {
+	source := `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <link rel="icon" href="/favicon.ico">
+  <style>body { margin: 0 auto; }</style>
+</head>
+<body class="{{if .Tags}}tagged{{end}}" data-theme="paper">
+  <nav aria-label="main"><a href="https://example.com">Home</a> <a href="mailto:me@example.com">Mail</a></nav>
+  <img src="/a.png" srcset="/a.png 1x, https://example.com/a@2x.png 2x" alt="">
+  <a href="#top" style="color: red">Top</a>
+  <!-- comments are fine -->
+  {{template "article" .}}
+</body>
+</html>`
+	_, err := ParseTheme(source, nil)
+	assert.NoError(t, err)
+}
+
+func TestParseTheme_Assets(t *testing.T) {
+	source := `<link rel="stylesheet" href="{{asset "style.css"}}">{{template "head" .}}{{template "article" .}}`
+	assets := []db.ThemeAsset{{Name: "style.css", URL: "https://blobs.example.com/themes/alice/paper/1a2b.css"}}
+	theme, err := ParseTheme(source, assets)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var buf strings.Builder
+	assert.NoError(t, theme.Execute(&buf, Page{Title: "Hi", Content: "<p>body</p>"}))
+	assert.Contains(t, buf.String(), `href="https://blobs.example.com/themes/alice/paper/1a2b.css"`)
+	assert.Contains(t, buf.String(), "<p>body</p>")
+	assert.Contains(t, buf.String(), "<title>Hi")
+}
+
+func TestExecuteTheme_Limits(t *testing.T) {
+	theme, err := ParseTheme(`{{template "article" .}}{{template "article" .}}`, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	page := Page{Content: template.HTML(strings.Repeat("a", MaxThemeOutputSize))}
+	_, err = executeTheme(context.Background(), theme, page)
+	assert.ErrorIs(t, err, errThemeOutputTooLarge)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = executeTheme(ctx, theme, Page{Content: "<p>body</p>"})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// a theme over the limit is replaced by the default one
+	themes := useThemeStore(t)
+	themes["twice"] = &db.Theme{User: "alice", Name: "twice", Template: `{{template "article" .}}{{template "article" .}}`}
+	page.Author = Author{Username: "alice", Name: "Alice"}
+	html, err := RenderUserPage(context.Background(), "custom:twice", page)
+	assert.NoError(t, err)
+	expected, err := RenderPage(DefaultTheme, page)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, html)
+}
+
+func TestCheckStylesheet(t *testing.T) {
+	assert.NoError(t, CheckStylesheet("style.css", []byte(`body { background: url("bg.png"); }`)))
+	for _, css := range []string{
+		`@import url("https://example.com/x.css");`,
+		`body { width: expression(alert(1)); }`,
+		`body { background: url("javascript:alert(1)"); }`,
+		`body { -moz-binding: url("x.xml#x"); }`,
+		`</style><script>alert(1)</script>`,
+	} {
+		err := CheckStylesheet("style.css", []byte(css))
+		var themeErr *ThemeError
+		assert.ErrorAs(t, err, &themeErr, css)
+	}
+}
+
+func TestStyleExists(t *testing.T) {
+	themes := useThemeStore(t)
+	themes["paper"] = &db.Theme{User: "alice", Name: "paper"}
+
+	for style, expected := range map[string]bool{
+		"default":      true,
+		"pink":         true,
+		"custom:paper": true,
+		"custom:ink":   false,
+		"custom:":      false,
+		"paper":        false,
+		"custom:pink":  false,
+	} {
+		exists, err := StyleExists(context.Background(), "alice", style)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, exists, style)
+	}
+}
+
+func TestRenderUserPage(t *testing.T) {
+	themes := useThemeStore(t)
+	page := Page{Title: "Hi", Content: "<h2 id=\"intro\">Intro</h2><p>body</p>", Author: Author{Username: "alice", Name: "Alice"}}
+
+	themes["paper"] = &db.Theme{
+		User:       "alice",
+		Name:       "paper",
+		Template:   `<main class="paper">{{range .TOC}}<a href="#{{.ID}}">{{.Text}}</a>{{end}}{{template "article" .}}</main>`,
+		UploadedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	html, err := RenderUserPage(context.Background(), "custom:paper", page)
+	assert.NoError(t, err)
+	assert.Contains(t, html, `<main class="paper">`)
+	assert.Contains(t, html, `<a href="#intro">Intro</a>`)
+
+	// a new upload replaces the compiled template
+	themes["paper"] = &db.Theme{
+		User:       "alice",
+		Name:       "paper",
+		Template:   `<main class="paper-v2">{{template "article" .}}</main>`,
+		UploadedAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	html, err = RenderUserPage(context.Background(), "custom:paper", page)
+	assert.NoError(t, err)
+	assert.Contains(t, html, `<main class="paper-v2">`)
+
+	// a deleted theme falls back to the default one
+	delete(themes, "paper")
+	html, err = RenderUserPage(context.Background(), "custom:paper", page)
+	assert.NoError(t, err)
+	expected, err := RenderPage(DefaultTheme, page)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, html)
 }
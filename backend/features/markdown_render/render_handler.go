@@ -2,12 +2,13 @@ package markdown_render
 
 import (
 	"encoding/json"
+	"html/template"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/shrijan-swaminathan/markbyte/backend/auth"
 	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/features/frontmatter"
 )
 
 var userDB db.UserDB
@@ -18,6 +19,9 @@ func SetUserDB(repo db.UserDB) {
 
 type RenderRequest struct {
 	MarkdownContent string `json:"markdown_content"`
+	// Style previews the page with another theme than the user's, such as
+	// one they just uploaded.
+	Style string `json:"style,omitempty"`
 }
 
 func HandleRender(w http.ResponseWriter, r *http.Request) {
@@ -32,8 +36,13 @@ func HandleRender(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to decode request", http.StatusBadRequest)
 		return
 	}
-	markdown_content := req.MarkdownContent
-	output_html, err := ConvertMarkdown([]byte(markdown_content))
+	// preview the post the way an upload renders it, without its front matter
+	meta, markdown_content, err := frontmatter.Split([]byte(req.MarkdownContent))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	output_html, err := ConvertMarkdown(markdown_content)
 	if err != nil {
 		http.Error(w, "Failed to convert markdown", http.StatusInternalServerError)
 		return
@@ -47,15 +56,35 @@ func HandleRender(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
-	if user_details.Name == "" {
-		user_details.Name = username
+	page := Page{
+		Title:     meta.Title,
+		Content:   template.HTML(output_html),
+		Author:    AuthorOf(user_details),
+		Published: time.Now(),
+		Tags:      meta.Tags,
+		SEO:       SEO{Description: meta.Description},
 	}
-	if user_details.Style == "" {
-		user_details.Style = "default"
+	if meta.Date != nil {
+		page.Published = *meta.Date
 	}
 	style := user_details.Style
-	time_str := time.Now().Format("01/02/2006")
-	InsertTemplate(&output_html, style, username, user_details.Name, time_str)
+	if req.Style != "" {
+		exists, err := StyleExists(r.Context(), username, req.Style)
+		if err != nil {
+			http.Error(w, "Failed to check style", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "No such style exists", http.StatusBadRequest)
+			return
+		}
+		style = req.Style
+	}
+	output_html, err = RenderUserPage(r.Context(), style, page)
+	if err != nil {
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "text/html")
 	_, err = w.Write([]byte(output_html))
 	if err != nil {
@@ -63,22 +92,3 @@ func HandleRender(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
-
-func InsertTemplate(output_html *string, template_name string, username string, name string, time string) {
-	if template_name == "old" {
-		*output_html = strings.ReplaceAll(old_template, "{{CONTENT}}", *output_html)
-	} else if template_name == "futuristic" {
-		*output_html = strings.ReplaceAll(futuristic_template, "{{CONTENT}}", *output_html)
-		*output_html = strings.ReplaceAll(*output_html, "{{USERNAME}}", username)
-		*output_html = strings.ReplaceAll(*output_html, "{{DATE}}", time)
-	} else if template_name == "pink" {
-		*output_html = strings.ReplaceAll(pink_template, "{{CONTENT}}", *output_html)
-		*output_html = strings.ReplaceAll(*output_html, "{{USERNAME}}", username)
-		*output_html = strings.ReplaceAll(*output_html, "{{NAME}}", name)
-		*output_html = strings.ReplaceAll(*output_html, "{{DATE}}", time)
-	} else {
-		*output_html = strings.ReplaceAll(default_template, "{{CONTENT}}", *output_html)
-		*output_html = strings.ReplaceAll(*output_html, "{{USERNAME}}", username)
-		*output_html = strings.ReplaceAll(*output_html, "{{DATE}}", time)
-	}
-}
@@ -0,0 +1,36 @@
+package markdown_render
+
+// SeriesPart is a post of a series as linked from the series box.
+type SeriesPart struct {
+	Title string
+	Link  string
+}
+
+// Series places the rendered post within one of its author's collections.
+type Series struct {
+	Name  string
+	Parts []SeriesPart
+	// Current is the index of the rendered post in Parts.
+	Current int
+}
+
+// Number is the position of the rendered post counting from 1.
+func (s Series) Number() int {
+	return s.Current + 1
+}
+
+// Prev is the part before the rendered post, nil for the first part.
+func (s Series) Prev() *SeriesPart {
+	if s.Current <= 0 || s.Current > len(s.Parts) {
+		return nil
+	}
+	return &s.Parts[s.Current-1]
+}
+
+// Next is the part after the rendered post, nil for the last part.
+func (s Series) Next() *SeriesPart {
+	if s.Current < 0 || s.Current >= len(s.Parts)-1 {
+		return nil
+	}
+	return &s.Parts[s.Current+1]
+}
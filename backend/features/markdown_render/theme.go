@@ -0,0 +1,186 @@
+package markdown_render
+
+import (
+	"bytes"
+	"embed"
+	"html"
+	"html/template"
+	"io/fs"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+)
+
+// DefaultTheme renders pages of users without a style or with one that does
+// not exist.
+const DefaultTheme = "default"
+
+const profileBase = "https://markbyte.xyz/"
+
+// Page is everything a theme gets to render. Text fields are escaped by the
+// template, only Content is inserted as is.
+type Page struct {
+	Title   string
+	Content template.HTML
+	Author  Author
+	// Published is when the post was written and Updated when the served
+	// version was uploaded. Both are zero on pages that are not posts.
+	Published time.Time
+	Updated   time.Time
+	Tags      []string
+	// TOC lists the headings of Content, it is filled in by RenderPage when
+	// left nil.
+	TOC     []Heading
+	Series  []Series
+	History []Revision
+	SEO     SEO
+}
+
+type Author struct {
+	Username string
+	Name     string
+	// URL is the profile of the author.
+	URL string
+}
+
+// Heading is an entry of the table of contents.
+type Heading struct {
+	Level int
+	ID    string
+	Text  string
+}
+
+type SEO struct {
+	Description  string
+	CanonicalURL string
+	Image        string
+	// NoIndex keeps the page out of search engines.
+	NoIndex bool
+}
+
+// AuthorOf returns the author shown for user, named by their username when
+// they have not set a name.
+func AuthorOf(user *db.User) Author {
+	name := user.Name
+	if name == "" {
+		name = user.Username
+	}
+	return Author{Username: user.Username, Name: name, URL: profileBase + url.PathEscape(user.Username)}
+}
+
+// PostPage returns the page for a version of a post written by user.
+func PostPage(post db.BlogPostData, user *db.User, content string) Page {
+	published := post.DateUploaded
+	if post.Date != nil {
+		published = *post.Date
+	}
+	return Page{
+		Title:     post.Title,
+		Content:   template.HTML(content),
+		Author:    AuthorOf(user),
+		Published: published,
+		Updated:   post.DateUploaded,
+		Tags:      post.Tags,
+		SEO: SEO{
+			Description:  post.Description,
+			CanonicalURL: post.CanonicalURL,
+			Image:        post.CoverImage,
+		},
+	}
+}
+
+//go:embed themes
+var themeFiles embed.FS
+
+var themeFuncs = template.FuncMap{
+	// date formats t the way posts have always shown dates, "" for zero
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("01/02/2006")
+	},
+	"isoDate": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	},
+	"join": strings.Join,
+}
+
+// themePartials are the templates every theme shares.
+var themePartials = template.Must(template.New("").Funcs(themeFuncs).ParseFS(themeFiles, "themes/partials/*.html"))
+
+// themes maps a style to its template, loaded once from themes/*.html.
+var themes = loadThemes(themeFiles)
+
+func loadThemes(files fs.FS) map[string]*template.Template {
+	names, err := fs.Glob(files, "themes/*.html")
+	if err != nil {
+		panic(err)
+	}
+	loaded := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		theme := template.Must(template.Must(themePartials.Clone()).ParseFS(files, name))
+		loaded[strings.TrimSuffix(path.Base(name), ".html")] = theme.Lookup(path.Base(name))
+	}
+	return loaded
+}
+
+// Themes lists the built in styles.
+func Themes() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// HasTheme reports whether style names a theme.
+func HasTheme(style string) bool {
+	_, ok := themes[style]
+	return ok
+}
+
+// RenderPage renders page with the theme of style.
+func RenderPage(style string, page Page) (string, error) {
+	theme, ok := themes[style]
+	if !ok {
+		theme = themes[DefaultTheme]
+	}
+	if page.TOC == nil {
+		page.TOC = TableOfContents(string(page.Content))
+	}
+	var buf bytes.Buffer
+	err := theme.Execute(&buf, page)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+var (
+	headingPattern = regexp.MustCompile(`(?is)<h([1-3])\b[^>]*?\bid="([^"]*)"[^>]*>(.*?)</h[1-3]>`)
+	tagPattern     = regexp.MustCompile(`<[^>]*>`)
+)
+
+// TableOfContents lists the h1 to h3 headings of content that have an id,
+// which the converter gives every heading.
+func TableOfContents(content string) []Heading {
+	headings := []Heading{}
+	for _, match := range headingPattern.FindAllStringSubmatch(content, -1) {
+		text := strings.TrimSpace(html.UnescapeString(tagPattern.ReplaceAllString(match[3], "")))
+		if text == "" {
+			continue
+		}
+		headings = append(headings, Heading{Level: int(match[1][0] - '0'), ID: html.UnescapeString(match[2]), Text: text})
+	}
+	return headings
+}
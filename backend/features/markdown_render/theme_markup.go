@@ -0,0 +1,224 @@
+package markdown_render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template/parse"
+
+	"golang.org/x/net/html"
+)
+
+// actionMark stands in for template actions when the markup of a theme is
+// checked. It cannot appear in a template that parses.
+const actionMark = "{{}}"
+
+// themeElements are the elements an uploaded template may use. Anything that
+// runs scripts, embeds other pages or submits forms is left out.
+var themeElements = map[string]bool{
+	"html": true, "head": true, "body": true, "title": true, "meta": true, "link": true, "style": true,
+	"header": true, "footer": true, "main": true, "nav": true, "article": true, "section": true, "aside": true,
+	"div": true, "span": true, "p": true, "a": true, "br": true, "hr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "li": true, "dl": true, "dt": true, "dd": true,
+	"img": true, "picture": true, "source": true, "figure": true, "figcaption": true,
+	"blockquote": true, "pre": true, "code": true, "em": true, "strong": true, "b": true, "i": true, "u": true,
+	"s": true, "small": true, "sub": true, "sup": true, "mark": true, "abbr": true, "cite": true, "q": true,
+	"time": true, "address": true, "details": true, "summary": true,
+	"table": true, "caption": true, "colgroup": true, "col": true, "thead": true, "tbody": true, "tfoot": true,
+	"tr": true, "th": true, "td": true,
+}
+
+// themeAttributes are the attributes allowed on any element besides aria-*
+// and data-* ones.
+var themeAttributes = map[string]bool{
+	"class": true, "id": true, "title": true, "lang": true, "dir": true, "role": true, "hidden": true, "style": true,
+}
+
+// themeElementAttributes are the attributes allowed on single elements.
+var themeElementAttributes = map[string]map[string]bool{
+	"a":          {"href": true, "rel": true, "target": true},
+	"img":        {"src": true, "srcset": true, "sizes": true, "alt": true, "width": true, "height": true, "loading": true},
+	"source":     {"srcset": true, "sizes": true, "type": true, "media": true},
+	"link":       {"rel": true, "href": true, "type": true, "media": true, "sizes": true},
+	"meta":       {"charset": true, "name": true, "content": true, "property": true},
+	"style":      {"media": true},
+	"time":       {"datetime": true},
+	"blockquote": {"cite": true},
+	"q":          {"cite": true},
+	"ol":         {"start": true, "reversed": true},
+	"col":        {"span": true},
+	"colgroup":   {"span": true},
+	"th":         {"colspan": true, "rowspan": true, "scope": true},
+	"td":         {"colspan": true, "rowspan": true},
+	"details":    {"open": true},
+}
+
+// themeLinkRels are the rel values a <link> may have, others could preload
+// or import anything.
+var themeLinkRels = map[string]bool{"stylesheet": true, "icon": true, "alternate": true, "canonical": true}
+
+// checkThemeMarkup refuses a template whose markup uses anything outside the
+// allowed elements and attributes, links to urls other than http, https and
+// mailto ones or has styles CheckStylesheet would refuse. The markup is read
+// the way a browser reads it, so entities and odd spacing do not get past.
+func checkThemeMarkup(source string) error {
+	trees := map[string]*parse.Tree{}
+	tree := parse.New("theme.html")
+	tree.Mode = parse.SkipFuncCheck
+	_, err := tree.Parse(source, "", "", trees)
+	if err != nil {
+		return err
+	}
+	for _, t := range trees {
+		var markup strings.Builder
+		flattenTemplate(&markup, t.Root)
+		if reason := disallowedMarkup(markup.String()); reason != "" {
+			return fmt.Errorf("%s", reason)
+		}
+	}
+	return nil
+}
+
+// flattenTemplate writes the text of node with every action replaced by
+// actionMark. Both branches of an if, range or with are written.
+func flattenTemplate(b *strings.Builder, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			flattenTemplate(b, child)
+		}
+	case *parse.TextNode:
+		b.Write(n.Text)
+	case *parse.IfNode:
+		flattenBranch(b, &n.BranchNode)
+	case *parse.RangeNode:
+		flattenBranch(b, &n.BranchNode)
+	case *parse.WithNode:
+		flattenBranch(b, &n.BranchNode)
+	case *parse.CommentNode, *parse.BreakNode, *parse.ContinueNode:
+	default:
+		b.WriteString(actionMark)
+	}
+}
+
+func flattenBranch(b *strings.Builder, n *parse.BranchNode) {
+	b.WriteString(actionMark)
+	flattenTemplate(b, n.List)
+	b.WriteString(actionMark)
+	flattenTemplate(b, n.ElseList)
+	b.WriteString(actionMark)
+}
+
+// disallowedMarkup explains why markup may not be in an uploaded template, ""
+// when it may.
+func disallowedMarkup(markup string) string {
+	// the template would pick the element itself
+	if strings.Contains(markup, "<"+actionMark) || strings.Contains(markup, "</"+actionMark) {
+		return "element names cannot come from the template"
+	}
+	z := html.NewTokenizer(strings.NewReader(markup))
+	inStyle := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return ""
+			}
+			return z.Err().Error()
+		case html.TextToken:
+			if inStyle {
+				if match := unsafeStylesheet.Find(z.Text()); match != nil {
+					return fmt.Sprintf("%q is not allowed", strings.TrimSpace(string(match)))
+				}
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			raw := string(z.Raw())
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			// the name as written, html lowercases it
+			written := raw[1 : 1+len(tag)]
+			if !themeElements[tag] {
+				return fmt.Sprintf("element <%s> is not allowed", written)
+			}
+			inStyle = tag == "style"
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if reason := disallowedAttribute(tag, string(key), string(val)); reason != "" {
+					return fmt.Sprintf("%s on <%s> is not allowed", reason, written)
+				}
+			}
+		case html.EndTagToken:
+			inStyle = false
+		}
+	}
+}
+
+// disallowedAttribute names the attribute key=val when tag may not have it,
+// "" when it may.
+func disallowedAttribute(tag string, key string, val string) string {
+	allowed := themeAttributes[key] || themeElementAttributes[tag][key] ||
+		strings.HasPrefix(key, "aria-") || strings.HasPrefix(key, "data-")
+	if !allowed {
+		return "attribute " + key
+	}
+	attr := fmt.Sprintf("%s=%q", key, val)
+	switch key {
+	case "href", "src", "cite":
+		if !safeThemeURL(val) {
+			return attr
+		}
+	case "srcset":
+		for _, candidate := range strings.Split(val, ",") {
+			url, _, _ := strings.Cut(strings.TrimSpace(candidate), " ")
+			if !safeThemeURL(url) {
+				return attr
+			}
+		}
+	case "rel":
+		if tag == "link" && !themeLinkRels[strings.ToLower(strings.TrimSpace(val))] {
+			return attr
+		}
+	case "style":
+		if match := unsafeStylesheet.FindString(val); match != "" {
+			return fmt.Sprintf("%q", strings.TrimSpace(match))
+		}
+	}
+	return ""
+}
+
+// safeThemeURL reports whether url is relative or an http, https or mailto
+// one. Actions at its start are escaped by html/template, but an action
+// in front of the colon could still spell out any scheme, and as an action
+// can be empty, the text after each one has to be safe on its own too.
+func safeThemeURL(url string) bool {
+	for _, part := range strings.Split(url, actionMark) {
+		if !safeURLStart(part) {
+			return false
+		}
+	}
+	return safeURLStart(url)
+}
+
+func safeURLStart(url string) bool {
+	// browsers drop tabs and newlines in urls
+	url = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(url)))
+	i := strings.IndexAny(url, ":/?#")
+	if i < 0 || url[i] != ':' {
+		return true
+	}
+	switch url[:i] {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package preview
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret := []byte("test secret")
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	link := Link{User: "alice", Title: "My Post", Version: "5", Uploaded: 42, Epoch: 1, Expires: now.Add(time.Hour)}
+
+	token, err := Sign(secret, link)
+	assert.NoError(t, err)
+	assert.NotContains(t, token, "/")
+
+	got, err := Verify(secret, token, now)
+	assert.NoError(t, err)
+	assert.Equal(t, link, got)
+
+	_, err = Verify(secret, token, now.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrExpired)
+
+	_, err = Verify([]byte("other secret"), token, now)
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestVerify_Tampered(t *testing.T) {
+	secret := []byte("test secret")
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	token, err := Sign(secret, Link{User: "alice", Title: "My Post", Version: "5", Expires: now.Add(time.Hour)})
+	assert.NoError(t, err)
+
+	other, err := Sign(secret, Link{User: "alice", Title: "My Post", Version: "6", Expires: now.Add(time.Hour)})
+	assert.NoError(t, err)
+	payload, _, _ := strings.Cut(other, ".")
+	_, signature, _ := strings.Cut(token, ".")
+
+	for _, bad := range []string{"", "nodot", payload + "." + signature, token + "x"} {
+		_, err = Verify(secret, bad, now)
+		assert.ErrorIs(t, err, ErrInvalid, bad)
+	}
+}
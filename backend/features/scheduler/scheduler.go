@@ -0,0 +1,101 @@
+// Package scheduler publishes post versions whose publish_at has passed.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+)
+
+const DefaultInterval = time.Minute
+
+// Scheduler polls for due versions. All of its state is the publish_at field
+// on the versions, so nothing is lost on a restart and a version that came due
+// while the server was down is published on the first poll.
+type Scheduler struct {
+	Posts db.BlogPostDataDB
+	// Publish performs the same steps as publishing a version by hand.
+	Publish func(ctx context.Context, username string, title string, version string) error
+	Now     func() time.Time
+}
+
+// RunDue publishes every version that is due and returns how many were.
+// Versions are published in the order they were scheduled for, so of two due
+// versions of one post the later one ends up active. A failed publish is
+// retried on the next poll, unless the version is gone, then its schedule is
+// dropped.
+func (s *Scheduler) RunDue(ctx context.Context) (int, error) {
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+
+	due, err := s.Posts.FetchDuePublishes(ctx, now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch due versions: %w", err)
+	}
+
+	published := 0
+	for _, post := range due {
+		err = s.Publish(ctx, post.User, post.Title, post.Version)
+		if err != nil {
+			fmt.Printf("scheduled publish of %s/%s v%s failed: %v\n", post.User, post.Title, post.Version, err)
+			if s.versionExists(ctx, post) {
+				// left scheduled, the next poll tries again
+				continue
+			}
+			fmt.Printf("dropping schedule of %s/%s v%s, the version no longer exists\n", post.User, post.Title, post.Version)
+			err = s.Posts.SchedulePublish(ctx, post.User, post.Title, post.Version, nil)
+			if err != nil {
+				fmt.Printf("failed to clear schedule of %s/%s v%s: %v\n", post.User, post.Title, post.Version, err)
+			}
+			continue
+		}
+		err = s.Posts.SchedulePublish(ctx, post.User, post.Title, post.Version, nil)
+		if err != nil {
+			fmt.Printf("failed to clear schedule of %s/%s v%s: %v\n", post.User, post.Title, post.Version, err)
+		}
+		published++
+	}
+	return published, nil
+}
+
+// versionExists reports whether post is still stored, so a failed publish of
+// it may work later. It also counts as existing when that cannot be checked.
+func (s *Scheduler) versionExists(ctx context.Context, post db.BlogPostData) bool {
+	versions, err := s.Posts.FetchAllPostVersions(ctx, post.User, post.Title)
+	if err != nil {
+		return true
+	}
+	for _, version := range versions.Versions {
+		if version.Version == post.Version {
+			return true
+		}
+	}
+	return false
+}
+
+// Start polls every interval in the background until ctx is done.
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				published, err := s.RunDue(ctx)
+				if err != nil {
+					fmt.Printf("publish scheduler failed: %v\n", err)
+					continue
+				}
+				if published > 0 {
+					fmt.Printf("publish scheduler: published %d versions\n", published)
+				}
+			}
+		}
+	}()
+}
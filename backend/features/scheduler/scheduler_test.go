@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePosts struct {
+	db.BlogPostDataDB
+	posts []db.BlogPostData
+	// removed are titles whose versions were deleted after they came due
+	removed []string
+}
+
+func (f *fakePosts) FetchAllPostVersions(ctx context.Context, username, title string) (db.BlogPostVersionsData, error) {
+	versions := db.BlogPostVersionsData{User: username, Title: title}
+	for _, post := range f.posts {
+		if post.User == username && post.Title == title && !slices.Contains(f.removed, title) {
+			versions.Versions = append(versions.Versions, post)
+		}
+	}
+	return versions, nil
+}
+
+func (f *fakePosts) FetchDuePublishes(ctx context.Context, now time.Time) ([]db.BlogPostData, error) {
+	due := make([]db.BlogPostData, 0)
+	for _, post := range f.posts {
+		if post.PublishAt != nil && !post.PublishAt.After(now) {
+			due = append(due, post)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakePosts) SchedulePublish(ctx context.Context, username, title, version string, at *time.Time) error {
+	for i := range f.posts {
+		if f.posts[i].User == username && f.posts[i].Title == title && f.posts[i].Version == version {
+			f.posts[i].PublishAt = at
+		}
+	}
+	return nil
+}
+
+func TestRunDue(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	posts := &fakePosts{posts: []db.BlogPostData{
+		{User: "alice", Title: "Post", Version: "2", PublishAt: &past},
+		{User: "alice", Title: "Post", Version: "3", PublishAt: &future},
+		{User: "bob", Title: "Broken", Version: "1", PublishAt: &past},
+		{User: "carol", Title: "Gone", Version: "1", PublishAt: &past},
+	}}
+
+	var published []string
+	s := &Scheduler{
+		Posts: posts,
+		Now:   func() time.Time { return now },
+		Publish: func(ctx context.Context, username, title, version string) error {
+			if username == "bob" {
+				return errors.New("database unavailable")
+			}
+			if username == "carol" {
+				posts.removed = append(posts.removed, title)
+				return errors.New("no such version")
+			}
+			published = append(published, username+"/"+title+"/"+version)
+			return nil
+		},
+	}
+
+	count, err := s.RunDue(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []string{"alice/Post/2"}, published)
+	assert.Nil(t, posts.posts[0].PublishAt)
+	assert.NotNil(t, posts.posts[1].PublishAt, "not due yet")
+	assert.NotNil(t, posts.posts[2].PublishAt, "a failed publish is retried")
+	assert.Nil(t, posts.posts[3].PublishAt, "a version that is gone is not retried")
+}
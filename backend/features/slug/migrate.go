@@ -0,0 +1,146 @@
+package slug
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
+)
+
+// Migrator gives posts stored before slugs existed a slug and moves their html
+// and markdown from the title based keys to the slug based ones.
+type Migrator struct {
+	Posts db.BlogPostDataDB
+	Store storage.BlobStore
+}
+
+type Migrated struct {
+	User  string `json:"user"`
+	Title string `json:"title"`
+	Slug  string `json:"slug"`
+}
+
+type MigrationReport struct {
+	DryRun   bool       `json:"dry_run"`
+	Posts    []Migrated `json:"posts"`
+	Versions int        `json:"versions"`
+	Moved    int        `json:"moved"`
+	Missing  []string   `json:"missing,omitempty"`
+	Errors   []string   `json:"errors,omitempty"`
+}
+
+// legacyKey is where a version was stored when keys were made from the title.
+func legacyKey(username string, title string, version string, ext string) string {
+	return fmt.Sprintf("%s_%s_%s%s", username, strings.ReplaceAll(title, " ", "_"), version, ext)
+}
+
+// Run migrates every post without a slug. Objects are copied before the post
+// record is updated and the old keys are only deleted afterwards, so a run
+// that stops half way can simply be started again.
+func (m *Migrator) Run(ctx context.Context, dryRun bool) (MigrationReport, error) {
+	report := MigrationReport{DryRun: dryRun, Posts: make([]Migrated, 0)}
+
+	versions, err := m.Posts.FetchPostsWithoutSlug(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to fetch posts without slugs: %w", err)
+	}
+
+	type postID struct{ user, title string }
+	order := make([]postID, 0)
+	byPost := make(map[postID][]db.BlogPostData)
+	for _, version := range versions {
+		id := postID{version.User, version.Title}
+		if _, ok := byPost[id]; !ok {
+			order = append(order, id)
+		}
+		byPost[id] = append(byPost[id], version)
+	}
+
+	// slugs handed out in this run, which a dry run never writes back
+	claimed := make(map[string]bool)
+	for _, id := range order {
+		// a post interrupted half way already has a slug on some versions
+		postSlug, err := m.Posts.FetchPostSlug(ctx, id.user, id.title)
+		if err != nil {
+			return report, err
+		}
+		if postSlug == "" {
+			postSlug, err = Unique(Make(id.title), func(candidate string) (bool, error) {
+				if claimed[Path(id.user, candidate)] {
+					return true, nil
+				}
+				owner, err := m.Posts.FetchTitleBySlug(ctx, id.user, candidate)
+				return owner != "", err
+			})
+			if err != nil {
+				return report, err
+			}
+		}
+		claimed[Path(id.user, postSlug)] = true
+		report.Posts = append(report.Posts, Migrated{User: id.user, Title: id.title, Slug: postSlug})
+
+		for _, version := range byPost[id] {
+			report.Versions++
+			if dryRun {
+				continue
+			}
+			err = m.migrateVersion(ctx, version, postSlug, &report)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s/%s v%s: %v", id.user, id.title, version.Version, err))
+			}
+		}
+	}
+	return report, nil
+}
+
+func (m *Migrator) migrateVersion(ctx context.Context, version db.BlogPostData, postSlug string, report *MigrationReport) error {
+	moved := make([]string, 0, 2)
+	for _, ext := range []string{".html", ".md"} {
+		from := legacyKey(version.User, version.Title, version.Version, ext)
+		to := Key(version.User, postSlug, version.Version, ext)
+		if from == to {
+			// lowercase single word titles already live under their slug
+			continue
+		}
+		err := copyObject(ctx, m.Store, from, to)
+		if errors.Is(err, storage.ErrNotFound) {
+			report.Missing = append(report.Missing, from)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		moved = append(moved, from)
+	}
+
+	link := m.Store.URL(Key(version.User, postSlug, version.Version, ".html"))
+	err := m.Posts.SetPostSlug(ctx, version.User, version.Title, version.Version, postSlug, link)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range moved {
+		err = m.Store.Delete(ctx, key)
+		if err != nil {
+			return err
+		}
+		report.Moved++
+	}
+	return nil
+}
+
+func copyObject(ctx context.Context, store storage.BlobStore, from string, to string) error {
+	body, err := store.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	contentType := "text/html"
+	if strings.HasSuffix(from, ".md") {
+		contentType = "text/markdown"
+	}
+	return store.Put(ctx, to, body, contentType)
+}
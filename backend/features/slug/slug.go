@@ -0,0 +1,118 @@
+// Package slug derives the url segment and storage keys of a post from its
+// title. A post keeps the slug it got on its first upload, so titles can use
+// any characters without changing where the post lives.
+package slug
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/gosimple/unidecode"
+)
+
+// MaxLength caps the generated part of a slug. A numeric suffix added by
+// Unique may go past it.
+const MaxLength = 80
+
+// Fallback is used for titles with nothing that transliterates to letters or
+// digits, e.g. a title made of emoji.
+const Fallback = "post"
+
+var validSlug = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Make transliterates title to ascii, lowercases it and joins the words with
+// hyphens, e.g. "Ünïcode & Friends" becomes "unicode-friends". It returns ""
+// when nothing url-safe is left.
+func Make(title string) string {
+	var b strings.Builder
+	pendingDash := false
+	for _, r := range strings.ToLower(unidecode.Unidecode(title)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			if pendingDash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingDash = false
+			b.WriteRune(r)
+		case r == '\'':
+			// "don't" reads better as "dont" than "don-t"
+		default:
+			pendingDash = true
+		}
+	}
+
+	s := b.String()
+	if len(s) > MaxLength {
+		s = s[:MaxLength]
+		// prefer cutting between words
+		if idx := strings.LastIndexByte(s, '-'); idx > MaxLength/2 {
+			s = s[:idx]
+		}
+		s = strings.TrimRight(s, "-")
+	}
+	return s
+}
+
+// Valid reports whether s has the shape Make and Unique produce.
+func Valid(s string) bool {
+	return validSlug.MatchString(s)
+}
+
+// Unique returns base, or base with the lowest numeric suffix from 2 up, that
+// taken reports as free.
+func Unique(base string, taken func(candidate string) (bool, error)) (string, error) {
+	if base == "" {
+		base = Fallback
+	}
+	candidate := base
+	for n := 2; ; n++ {
+		used, err := taken(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !used {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// Key is the storage key of one version of a post, ext being ".html" or ".md".
+func Key(username string, slug string, version string, ext string) string {
+	return fmt.Sprintf("%s_%s_%s%s", username, slug, version, ext)
+}
+
+// ParseKey splits a key made by Key back into its parts. ok is false for
+// keys of other files, such as the about page or attachments.
+func ParseKey(key string) (username string, slug string, version string, ext string, ok bool) {
+	ext = path.Ext(key)
+	if ext != ".html" && ext != ".md" {
+		return "", "", "", "", false
+	}
+	rest := strings.TrimSuffix(key, ext)
+	// usernames may hold underscores, slugs and versions cannot
+	rest, version, found := cutLast(rest, "_")
+	if !found || version == "" || strings.Trim(version, "0123456789") != "" {
+		return "", "", "", "", false
+	}
+	username, slug, found = cutLast(rest, "_")
+	if !found || username == "" || strings.Contains(username, "/") || !Valid(slug) {
+		return "", "", "", "", false
+	}
+	return username, slug, version, ext, true
+}
+
+func cutLast(s string, sep string) (before string, after string, found bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
+
+// Path is the public url of a post, also used as its cache key.
+func Path(username string, slug string) string {
+	return "/" + username + "/" + slug
+}
@@ -0,0 +1,170 @@
+package slug
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/shrijan-swaminathan/markbyte/backend/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMake(t *testing.T) {
+	for _, tc := range []struct {
+		title string
+		want  string
+	}{
+		{"Hello World", "hello-world"},
+		{"snake_case_title", "snake-case-title"},
+		{"  Ünïcode & Friends!  ", "unicode-friends"},
+		{"Don't Panic", "dont-panic"},
+		{"Straße in Köln", "strasse-in-koln"},
+		{"Привет мир", "privet-mir"},
+		{"what/is:this?", "what-is-this"},
+		{"🎉🎉", ""},
+	} {
+		got := Make(tc.title)
+		assert.Equal(t, tc.want, got, tc.title)
+		if got != "" {
+			assert.True(t, Valid(got), got)
+		}
+	}
+}
+
+func TestMake_TruncatesBetweenWords(t *testing.T) {
+	got := Make(strings.Repeat("word ", 40))
+	assert.LessOrEqual(t, len(got), MaxLength)
+	assert.True(t, Valid(got))
+	assert.True(t, strings.HasSuffix(got, "word"))
+}
+
+func TestValid(t *testing.T) {
+	assert.True(t, Valid("a-b-1"))
+	for _, s := range []string{"", "A", "a_b", "-a", "a-", "a--b", "a b"} {
+		assert.False(t, Valid(s), s)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	username, postSlug, version, ext, ok := ParseKey(Key("jane_doe", "my-post-2", "12", ".html"))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"jane_doe", "my-post-2", "12", ".html"}, []string{username, postSlug, version, ext})
+
+	for _, key := range []string{
+		"jane_about_file.md",
+		"jane_my-post_1.png",
+		"assets/abc.html",
+		"_my-post_1.html",
+		"jane_My_Post_1.html",
+		"jane_my-post_v1.md",
+	} {
+		_, _, _, _, ok := ParseKey(key)
+		assert.False(t, ok, key)
+	}
+}
+
+func TestUnique(t *testing.T) {
+	used := map[string]bool{"post": true, "post-2": true}
+	taken := func(candidate string) (bool, error) { return used[candidate], nil }
+
+	got, err := Unique("post", taken)
+	assert.NoError(t, err)
+	assert.Equal(t, "post-3", got)
+
+	got, err = Unique("", taken)
+	assert.NoError(t, err)
+	assert.Equal(t, "post-3", got)
+
+	got, err = Unique("fresh", taken)
+	assert.NoError(t, err)
+	assert.Equal(t, "fresh", got)
+}
+
+type fakePosts struct {
+	db.BlogPostDataDB
+	posts []db.BlogPostData
+}
+
+func (f *fakePosts) FetchPostsWithoutSlug(ctx context.Context) ([]db.BlogPostData, error) {
+	var out []db.BlogPostData
+	for _, post := range f.posts {
+		if post.Slug == "" {
+			out = append(out, post)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakePosts) FetchPostSlug(ctx context.Context, username, title string) (string, error) {
+	for _, post := range f.posts {
+		if post.User == username && post.Title == title && post.Slug != "" {
+			return post.Slug, nil
+		}
+	}
+	return "", nil
+}
+
+func (f *fakePosts) FetchTitleBySlug(ctx context.Context, username, slug string) (string, error) {
+	for _, post := range f.posts {
+		if post.User == username && post.Slug == slug {
+			return post.Title, nil
+		}
+	}
+	return "", nil
+}
+
+func (f *fakePosts) SetPostSlug(ctx context.Context, username, title, version, slug, link string) error {
+	for i := range f.posts {
+		post := &f.posts[i]
+		if post.User == username && post.Title == title && post.Version == version {
+			post.Slug = slug
+			post.Link = &link
+		}
+	}
+	return nil
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewLocalStore(t.TempDir(), "https://blobs.mock")
+	assert.NoError(t, err)
+	for _, key := range []string{"alice_My_Post_1.html", "alice_My_Post_1.md", "alice_My_Post_2.html", "alice_My_Post_2.md", "alice_my-post_1.html", "alice_a_1.html"} {
+		assert.NoError(t, store.Put(ctx, key, strings.NewReader(key), "text/html"))
+	}
+
+	posts := &fakePosts{posts: []db.BlogPostData{
+		{User: "alice", Title: "my post", Slug: "my-post", Version: "1"},
+		{User: "alice", Title: "My Post", Version: "1"},
+		{User: "alice", Title: "My Post", Version: "2"},
+		{User: "alice", Title: "a", Version: "1"},
+	}}
+	migrator := &Migrator{Posts: posts, Store: store}
+
+	report, err := migrator.Run(ctx, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []Migrated{{"alice", "My Post", "my-post-2"}, {"alice", "a", "a"}}, report.Posts)
+	assert.Equal(t, 0, report.Moved)
+	_, err = store.Stat(ctx, "alice_My_Post_1.html")
+	assert.NoError(t, err, "a dry run leaves objects alone")
+
+	report, err = migrator.Run(ctx, false)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Errors)
+	assert.Equal(t, 4, report.Moved)
+	assert.Empty(t, report.Missing)
+
+	content, err := storage.ReadString(ctx, store, "alice_my-post-2_2.md")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice_My_Post_2.md", content)
+	_, err = store.Stat(ctx, "alice_My_Post_2.md")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	// a key that already matches its slug is kept in place
+	_, err = store.Stat(ctx, "alice_a_1.html")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://blobs.mock/alice_my-post-2_1.html", *posts.posts[1].Link)
+
+	report, err = migrator.Run(ctx, false)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Posts)
+}
@@ -0,0 +1,46 @@
+// Package tags normalizes the topic tags of posts.
+package tags
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	MaxTags   = 10
+	MaxLength = 32
+)
+
+// Normalize lowercases tags and joins the words of each with hyphens, so
+// "Machine Learning" and "machine-learning" are the same tag. Empty and
+// repeated tags are dropped, the order is kept.
+func Normalize(raw []string) ([]string, error) {
+	normalized := make([]string, 0, len(raw))
+	seen := make(map[string]bool)
+	for _, tag := range raw {
+		tag = strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len([]rune(tag)) > MaxLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, MaxLength)
+		}
+		for _, r := range tag {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_.+#", r) {
+				return nil, fmt.Errorf("tag %q contains %q", tag, r)
+			}
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > MaxTags {
+		return nil, fmt.Errorf("a post can have at most %d tags", MaxTags)
+	}
+	return normalized, nil
+}
+
+// Parse normalizes a comma separated list of tags.
+func Parse(s string) ([]string, error) {
+	return Normalize(strings.Split(s, ","))
+}
@@ -0,0 +1,36 @@
+package tags
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	normalized, err := Normalize([]string{" Go ", "Machine  Learning", "go", "", "C++", "Café"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"go", "machine-learning", "c++", "café"}, normalized)
+}
+
+func TestNormalize_Invalid(t *testing.T) {
+	for _, raw := range [][]string{
+		{"a/b"},
+		{"<script>"},
+		{strings.Repeat("x", MaxLength+1)},
+		strings.Split("a,b,c,d,e,f,g,h,i,j,k", ","),
+	} {
+		_, err := Normalize(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestParse(t *testing.T) {
+	parsed, err := Parse("go, web ,,Web")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"go", "web"}, parsed)
+
+	parsed, err = Parse("")
+	assert.NoError(t, err)
+	assert.Empty(t, parsed)
+}
@@ -0,0 +1,75 @@
+// Package trash permanently deletes posts that have been in the trash for
+// longer than the retention window.
+package trash
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+)
+
+const (
+	DefaultRetention = 30 * 24 * time.Hour
+	DefaultInterval  = time.Hour
+)
+
+// Purger polls for expired posts. Like the publish scheduler it keeps no
+// state of its own, a post is expired by its deleted_at alone.
+type Purger struct {
+	Posts     db.BlogPostDataDB
+	Retention time.Duration
+	// Purge performs the same steps as permanently deleting a post by hand.
+	Purge func(ctx context.Context, username string, title string) error
+	Now   func() time.Time
+}
+
+// PurgeExpired deletes every post whose retention has passed and returns how
+// many were.
+func (p *Purger) PurgeExpired(ctx context.Context) (int, error) {
+	now := time.Now
+	if p.Now != nil {
+		now = p.Now
+	}
+
+	expired, err := p.Posts.FetchExpiredTrash(ctx, now().Add(-p.Retention))
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch expired posts: %w", err)
+	}
+
+	purged := 0
+	for _, post := range expired {
+		err = p.Purge(ctx, post.User, post.Title)
+		if err != nil {
+			// left in the trash, the next poll tries again
+			fmt.Printf("purge of %s/%s failed: %v\n", post.User, post.Title, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// Start polls every interval in the background until ctx is done.
+func (p *Purger) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purged, err := p.PurgeExpired(ctx)
+				if err != nil {
+					fmt.Printf("trash purge failed: %v\n", err)
+					continue
+				}
+				if purged > 0 {
+					fmt.Printf("trash purge: deleted %d posts\n", purged)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,56 @@
+package trash
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shrijan-swaminathan/markbyte/backend/db"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePosts struct {
+	db.BlogPostDataDB
+	posts []db.BlogPostData
+}
+
+func (f *fakePosts) FetchExpiredTrash(ctx context.Context, before time.Time) ([]db.BlogPostData, error) {
+	expired := make([]db.BlogPostData, 0)
+	for _, post := range f.posts {
+		if post.DeletedAt != nil && !post.DeletedAt.After(before) {
+			expired = append(expired, post)
+		}
+	}
+	return expired, nil
+}
+
+func TestPurgeExpired(t *testing.T) {
+	now := time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+	old, recent := now.Add(-48*time.Hour), now.Add(-time.Hour)
+	posts := &fakePosts{posts: []db.BlogPostData{
+		{User: "alice", Title: "Old", DeletedAt: &old},
+		{User: "alice", Title: "Recent", DeletedAt: &recent},
+		{User: "alice", Title: "Kept"},
+		{User: "bob", Title: "Broken", DeletedAt: &old},
+	}}
+
+	var purged []string
+	p := &Purger{
+		Posts:     posts,
+		Retention: 24 * time.Hour,
+		Now:       func() time.Time { return now },
+		Purge: func(ctx context.Context, username, title string) error {
+			if username == "bob" {
+				return errors.New("storage unavailable")
+			}
+			purged = append(purged, username+"/"+title)
+			return nil
+		},
+	}
+
+	count, err := p.PurgeExpired(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []string{"alice/Old"}, purged)
+}
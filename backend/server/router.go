@@ -50,14 +50,37 @@ func SetupRouter() *chi.Mux {
 		protected.Get("/user/blog_posts", api.HandleFetchAllBlogPosts)
 		protected.Post("/upload/github", api.HandleGithubUpload)
 		protected.Post("/publish", api.HandlePublishPostVersion)
+		protected.Get("/publish/scheduled", api.HandleFetchScheduledPublishes)
+		protected.Post("/publish/cancel", api.HandleCancelScheduledPublish)
 		protected.Post("/render", markdown_render.HandleRender)
 		protected.Post("/markdown", api.HandleFetchMD)
 		protected.Post("/delete", api.HandleDelete)
+		protected.Post("/post/version/delete", api.HandleDeletePostVersion)
+		protected.Post("/post/prune", api.HandlePrunePostVersions)
+		protected.Post("/post/preview", api.HandleCreatePreview)
+		protected.Post("/post/preview/revoke", api.HandleRevokePreviews)
+		protected.Get("/post/experiment", api.HandleExperimentResults)
+		protected.Post("/post/experiment/start", api.HandleStartExperiment)
+		protected.Post("/post/experiment/end", api.HandleEndExperiment)
+		protected.Post("/post/like", api.HandleLikePost)
+		protected.Get("/user/trash", api.HandleFetchTrash)
+		protected.Post("/trash/restore", api.HandleRestorePost)
+		protected.Post("/post/rename", api.HandleRenamePost)
+		protected.Get("/post/diff", api.HandlePostDiff)
+		protected.Post("/post/visibility", api.HandleSetPostVisibility)
+		protected.Post("/collection/create", api.HandleCreateCollection)
+		protected.Post("/collection/update", api.HandleUpdateCollection)
+		protected.Post("/collection/delete", api.HandleDeleteCollection)
+		protected.Get("/user/collections", api.HandleFetchUserCollections)
 		protected.Get("/user/style", api.HandleFetchUserStyle)
 		protected.Post("/user/style", api.HandleUpdateUserStyle)
+		protected.Get("/user/themes", api.HandleFetchUserThemes)
+		protected.Post("/user/theme/upload", api.HandleUploadTheme)
+		protected.Post("/user/theme/delete", api.HandleDeleteTheme)
 		protected.Post("/user/pfp", api.HandleUpdateUserProfilePicture)
 		protected.Post("/user/name", api.HandleUpdateUserName)
 		protected.Get("/user/info", api.HandleUserInfo)
+		protected.Get("/user/usage", api.HandleUserUsage)
 		protected.Post("/post/analytics", api.HandleGetPostAnalytics)
 		protected.Get("/user/analytics", api.HandleAllAnalytics)
 		protected.Get("/user/analytics/timestamps", api.HandleUserActiveTimestamps)
@@ -65,11 +88,19 @@ func SetupRouter() *chi.Mux {
 	})
 
 	r.Get("/static/*", api.HandleStatic)
-	r.Get("/{username}/{post}", api.HandleFetchBlogPost)
+	// post files follow the visibility of their post
+	r.With(auth.OptionalJWTAuthMiddleware).Get("/blobs/*", api.HandleBlob)
+	// private posts are served to their owner, so read the login when present
+	r.With(auth.OptionalJWTAuthMiddleware).Get("/{username}/{post}", api.HandleFetchBlogPost)
 	r.Get("/user/posts", api.HandleFetchUserActivePosts)
+	r.Get("/user/tags", api.HandleFetchUserTags)
+	r.Get("/collections", api.HandleFetchPublicCollections)
+	r.Get("/preview/{token}", api.HandleFetchPreview)
+	r.With(auth.OptionalJWTAuthMiddleware).Post("/post/read", api.HandleRecordRead)
 	r.Post("/user/about", api.HandleAboutPageGet)
 	r.Get("/discover/new", api.HandleDiscoverNewPosts)
 	r.Get("/discover/top", api.HandleDiscoverTopPosts)
+	r.Get("/discover/tag/{tag}", api.HandleDiscoverTagPosts)
 	fmt.Println("Server Started.")
 
 	return r
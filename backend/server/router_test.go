@@ -60,6 +60,14 @@ func (m *MockUserDB) UpdateUserName(ctx context.Context, username string, name s
 	return args.Error(0)
 }
 
+func (m *MockUserDB) FetchAllProfilePictures(ctx context.Context) ([]string, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
 // Helper function to generate a valid JWT token for testing using the actual secret
 func generateTestJWT(username string) string {
 	_, tokenString, _ := auth.TokenAuth.Encode(jwt.MapClaims{
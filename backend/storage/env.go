@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLocalDir     = "data/blobs"
+	defaultLocalBaseURL = "http://localhost:8080/blobs"
+	defaultOpTimeout    = 30 * time.Second
+)
+
+// S3ConfigFromEnv reads the S3_* environment variables.
+func S3ConfigFromEnv() (S3Config, error) {
+	bucket := os.Getenv("S3_BUCKET_NAME")
+	region := os.Getenv("S3_REGION")
+	accessKey := os.Getenv("S3_ACCESS_KEY_ID")
+	secretKey := os.Getenv("S3_SECRET_ACCESS_KEY")
+	endpoint := os.Getenv("S3_ENDPOINT")
+
+	// s3 compatible servers usually ignore the region, but the sdk needs one to sign
+	if region == "" && endpoint != "" {
+		region = "us-east-1"
+	}
+
+	if bucket == "" || region == "" || accessKey == "" || secretKey == "" {
+		return S3Config{}, fmt.Errorf("missing required environment variables for s3")
+	}
+
+	usePathStyle := false
+	if v := os.Getenv("S3_FORCE_PATH_STYLE"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return S3Config{}, fmt.Errorf("invalid S3_FORCE_PATH_STYLE: %w", err)
+		}
+		usePathStyle = parsed
+	}
+
+	opTimeout := defaultOpTimeout
+	if v := os.Getenv("S3_TIMEOUT"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return S3Config{}, fmt.Errorf("invalid S3_TIMEOUT: %w", err)
+		}
+		opTimeout = parsed
+	}
+
+	return S3Config{
+		AccessKey:     accessKey,
+		SecretKey:     secretKey,
+		Bucket:        bucket,
+		Region:        region,
+		Endpoint:      endpoint,
+		UsePathStyle:  usePathStyle,
+		PublicBaseURL: os.Getenv("S3_PUBLIC_BASE_URL"),
+		OpTimeout:     opTimeout,
+	}, nil
+}
+
+// NewFromEnv picks the backend from STORAGE_BACKEND ("s3" or "local"). When
+// it is unset, s3 is used if its credentials are present and the local
+// filesystem otherwise. It is meant to be called once at startup.
+func NewFromEnv(ctx context.Context) (BlobStore, error) {
+	backend := os.Getenv("STORAGE_BACKEND")
+	cred, credErr := S3ConfigFromEnv()
+
+	if backend == "local" || (backend == "" && credErr != nil) {
+		dir := os.Getenv("LOCAL_STORAGE_DIR")
+		if dir == "" {
+			dir = defaultLocalDir
+		}
+		baseURL := os.Getenv("LOCAL_STORAGE_BASE_URL")
+		if baseURL == "" {
+			baseURL = defaultLocalBaseURL
+		}
+		return NewLocalStore(dir, baseURL)
+	}
+
+	if backend != "" && backend != "s3" {
+		return nil, fmt.Errorf("unknown storage backend: %s", backend)
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+	return NewS3Store(ctx, cred)
+}
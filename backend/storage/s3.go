@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type S3Config struct {
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	// Endpoint overrides the AWS endpoint for s3 compatible servers such as
+	// MinIO, e.g. "http://minio:9000".
+	Endpoint string
+	// UsePathStyle addresses objects as endpoint/bucket/key instead of
+	// bucket.endpoint/key. Most self hosted servers need this.
+	UsePathStyle bool
+	// PublicBaseURL is the prefix used for returned object URLs, e.g. a CDN
+	// host in front of the bucket. Defaults to the bucket URL.
+	PublicBaseURL string
+	// OpTimeout bounds every single request to the bucket. Zero means no
+	// timeout beyond the caller's context.
+	OpTimeout time.Duration
+}
+
+type S3Store struct {
+	client        *s3.Client
+	bucket        string
+	region        string
+	endpoint      string
+	usePathStyle  bool
+	publicBaseURL string
+	opTimeout     time.Duration
+}
+
+var _ BlobStore = (*S3Store)(nil)
+
+// NewS3Store builds one client for the lifetime of the process. The client
+// keeps a pool of idle connections, so requests reuse them instead of paying
+// for a new TLS handshake each time.
+func NewS3Store(ctx context.Context, cred S3Config) (*S3Store, error) {
+	httpClient := awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		tr.MaxIdleConns = 100
+		tr.MaxIdleConnsPerHost = 100
+	})
+
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithHTTPClient(httpClient),
+		config.WithRegion(cred.Region),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cred.AccessKey, cred.SecretKey, "")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if cred.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cred.Endpoint)
+		}
+		o.UsePathStyle = cred.UsePathStyle
+	})
+
+	return &S3Store{
+		client:        client,
+		bucket:        cred.Bucket,
+		region:        cred.Region,
+		endpoint:      strings.TrimSuffix(cred.Endpoint, "/"),
+		usePathStyle:  cred.UsePathStyle,
+		publicBaseURL: strings.TrimSuffix(cred.PublicBaseURL, "/"),
+		opTimeout:     cred.OpTimeout,
+	}, nil
+}
+
+func (s *S3Store) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.opTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.opTimeout)
+}
+
+// cancelOnClose releases the operation context once the body has been read.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	// the sdk needs a seekable body to sign the payload
+	if _, ok := body.(io.ReadSeeker); !ok {
+		content, err := io.ReadAll(body)
+		if err != nil {
+			return fmt.Errorf("failed to read upload body: %w", err)
+		}
+		body = bytes.NewReader(content)
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload file to s3: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	ctx, cancel := s.withTimeout(ctx)
+
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		cancel()
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read file from s3: %w", err)
+	}
+	return cancelOnClose{ReadCloser: output.Body, cancel: cancel}, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete file from s3: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		// HEAD responses have no body, so a missing key only shows as NotFound
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return ObjectInfo{}, ErrNotFound
+		}
+		return ObjectInfo{}, fmt.Errorf("failed to stat file in s3: %w", err)
+	}
+	info := ObjectInfo{Key: key, Size: aws.ToInt64(output.ContentLength)}
+	if output.LastModified != nil {
+		info.LastModified = *output.LastModified
+	}
+	return info, nil
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects := make([]ObjectInfo, 0)
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		pageCtx, cancel := s.withTimeout(ctx)
+		page, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files in s3: %w", err)
+		}
+		for _, obj := range page.Contents {
+			info := ObjectInfo{
+				Key:  aws.ToString(obj.Key),
+				Size: aws.ToInt64(obj.Size),
+			}
+			if obj.LastModified != nil {
+				info.LastModified = *obj.LastModified
+			}
+			objects = append(objects, info)
+		}
+	}
+	return objects, nil
+}
+
+func (s *S3Store) URL(key string) string {
+	if s.publicBaseURL != "" {
+		return s.publicBaseURL + "/" + key
+	}
+	if s.endpoint == "" {
+		if s.usePathStyle {
+			return fmt.Sprintf("https://s3.%s.amazonaws.com/%s/%s", s.region, s.bucket, key)
+		}
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, s.region, key)
+	}
+	if s.usePathStyle {
+		return fmt.Sprintf("%s/%s/%s", s.endpoint, s.bucket, key)
+	}
+
+	endpoint, err := url.Parse(s.endpoint)
+	if err != nil || endpoint.Host == "" {
+		return fmt.Sprintf("%s/%s/%s", s.endpoint, s.bucket, key)
+	}
+	endpoint.Host = s.bucket + "." + endpoint.Host
+	return strings.TrimSuffix(endpoint.String(), "/") + "/" + key
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStore_PutGetDelete(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir(), "http://localhost:8080/blobs/")
+	assert.NoError(t, err)
+
+	err = store.Put(ctx, "profile_pictures/alice.png", strings.NewReader("png bytes"), "image/png")
+	assert.NoError(t, err)
+
+	content, err := ReadString(ctx, store, "profile_pictures/alice.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "png bytes", content)
+	assert.Equal(t, "http://localhost:8080/blobs/profile_pictures/alice.png", store.URL("profile_pictures/alice.png"))
+
+	info, err := store.Stat(ctx, "profile_pictures/alice.png")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("png bytes")), info.Size)
+
+	assert.NoError(t, store.Delete(ctx, "profile_pictures/alice.png"))
+	_, err = store.Get(ctx, "profile_pictures/alice.png")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.Stat(ctx, "profile_pictures/alice.png")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// deleting twice is fine
+	assert.NoError(t, store.Delete(ctx, "profile_pictures/alice.png"))
+}
+
+func TestLocalStore_List(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir(), "http://localhost:8080/blobs")
+	assert.NoError(t, err)
+
+	for _, key := range []string{"alice_post_1.html", "alice_post_1.md", "bob_post_1.html"} {
+		assert.NoError(t, store.Put(ctx, key, strings.NewReader(key), "text/plain"))
+	}
+
+	objects, err := store.List(ctx, "alice_")
+	assert.NoError(t, err)
+	keys := make([]string, 0)
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	assert.ElementsMatch(t, []string{"alice_post_1.html", "alice_post_1.md"}, keys)
+}
+
+func TestLocalStore_RejectsTraversal(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir(), "http://localhost:8080/blobs")
+	assert.NoError(t, err)
+
+	for _, key := range []string{"", "../escape.html", "a/../../escape.html", "/abs.html", "dir/"} {
+		err := store.Put(ctx, key, strings.NewReader("x"), "text/plain")
+		assert.Error(t, err, key)
+	}
+}
+
+func TestS3Store_URL(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      S3Config
+		expected string
+	}{
+		{
+			name:     "aws virtual hosted",
+			cfg:      S3Config{Bucket: "blog", Region: "us-east-1"},
+			expected: "https://blog.s3.us-east-1.amazonaws.com/alice_post_1.html",
+		},
+		{
+			name:     "aws path style",
+			cfg:      S3Config{Bucket: "blog", Region: "eu-west-2", UsePathStyle: true},
+			expected: "https://s3.eu-west-2.amazonaws.com/blog/alice_post_1.html",
+		},
+		{
+			name:     "minio path style",
+			cfg:      S3Config{Bucket: "blog", Region: "us-east-1", Endpoint: "http://minio:9000/", UsePathStyle: true},
+			expected: "http://minio:9000/blog/alice_post_1.html",
+		},
+		{
+			name:     "custom endpoint virtual hosted",
+			cfg:      S3Config{Bucket: "blog", Region: "us-east-1", Endpoint: "https://objects.example.com"},
+			expected: "https://blog.objects.example.com/alice_post_1.html",
+		},
+		{
+			name:     "public base url wins",
+			cfg:      S3Config{Bucket: "blog", Region: "us-east-1", Endpoint: "http://minio:9000", UsePathStyle: true, PublicBaseURL: "https://cdn.example.com/"},
+			expected: "https://cdn.example.com/alice_post_1.html",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.AccessKey = "key"
+			tt.cfg.SecretKey = "secret"
+			store, err := NewS3Store(context.Background(), tt.cfg)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, store.URL("alice_post_1.html"))
+		})
+	}
+}
+
+func TestS3Store_OpTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(300 * time.Millisecond):
+		}
+	}))
+	defer slow.Close()
+
+	store, err := NewS3Store(context.Background(), S3Config{
+		AccessKey:    "key",
+		SecretKey:    "secret",
+		Bucket:       "blog",
+		Region:       "us-east-1",
+		Endpoint:     slow.URL,
+		UsePathStyle: true,
+		OpTimeout:    50 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	start := time.Now()
+	err = store.Put(context.Background(), "alice_post_1.html", strings.NewReader("<h1>hi</h1>"), "text/html")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 250*time.Millisecond)
+}
+
+func TestNewFromEnv_FallsBackToLocal(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "")
+	t.Setenv("S3_BUCKET_NAME", "")
+	t.Setenv("LOCAL_STORAGE_DIR", t.TempDir())
+	t.Setenv("LOCAL_STORAGE_BASE_URL", "http://example.com/blobs")
+
+	store, err := NewFromEnv(context.Background())
+	assert.NoError(t, err)
+	assert.IsType(t, &LocalStore{}, store)
+	assert.Equal(t, "http://example.com/blobs/a.png", store.URL("a.png"))
+}
@@ -459,7 +459,7 @@ function BloggerHome() {
 
   const handleInputChange = (e, type) => {
     const value = e.target.value;
-    const match = value.match(/[\\/:*?"<>|_]/);
+    const match = value.match(/[\\/:*?"<>|]/);
 
     let setTitle, setShowWarning, setWarningMsg;
 
@@ -215,7 +215,7 @@ const EditorPreview = () => {
   // It checks for invalid characters and limits the title length to 100 characters
   const handleInputChange = (e) => {
     const value = e.target.value;
-    const match = value.match(/[\\/:*?"<>|_]/);
+    const match = value.match(/[\\/:*?"<>|]/);
 
     if (match) {
       setShowWarning(true);